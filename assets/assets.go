@@ -3,6 +3,7 @@ package assets
 import (
 	"archive/zip"
 	"context"
+	"crypto/sha1"
 	"fmt"
 	"io"
 
@@ -31,6 +32,11 @@ func Init() {
 	if err := loadAssets(Assets); err != nil {
 		panic(err)
 	}
+	if config.PrecompressAssets {
+		if err := Precompress(Assets, "/"); err != nil {
+			panic(err)
+		}
+	}
 }
 
 func loadAssets(fs billy.Filesystem) error {
@@ -115,8 +121,11 @@ func loadAssetFile(zipFile *zip.File, fs billy.Filesystem) error {
 		return err
 	}
 	defer decompressed.Close()
-	if _, err := io.Copy(fsFile, decompressed); err != nil {
+	h := sha1.New()
+	n, err := io.Copy(io.MultiWriter(fsFile, h), decompressed)
+	if err != nil {
 		return err
 	}
+	storeHash(zipFile.Name, n, fmt.Sprintf("%x", h.Sum(nil)))
 	return nil
 }
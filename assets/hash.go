@@ -0,0 +1,51 @@
+package assets
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// hashes holds the sha1 of the contents of the assets, keyed by name.
+var hashes = struct {
+	m     sync.RWMutex
+	files map[string]hashed
+}{files: map[string]hashed{}}
+
+type hashed struct {
+	size int64
+	hash string
+}
+
+// Hash returns the sha1 of the contents of the asset (hex encoded), which identifies it in validators.
+// Hashes are found when the assets are loaded. Other files are hashed the first time they're needed.
+// Like GzipBytes, the size is checked in case the file was replaced.
+func Hash(fi os.FileInfo, name string) (string, error) {
+	hashes.m.RLock()
+	h, ok := hashes.files[name]
+	hashes.m.RUnlock()
+	if ok && h.size == fi.Size() {
+		return h.hash, nil
+	}
+	f, err := Assets.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	s := sha1.New()
+	n, err := io.Copy(s, f)
+	if err != nil {
+		return "", err
+	}
+	hash := fmt.Sprintf("%x", s.Sum(nil))
+	storeHash(name, n, hash)
+	return hash, nil
+}
+
+func storeHash(name string, size int64, hash string) {
+	hashes.m.Lock()
+	hashes.files[name] = hashed{size: size, hash: hash}
+	hashes.m.Unlock()
+}
@@ -0,0 +1,96 @@
+package assets
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/dave/jsgo/config"
+	billy "gopkg.in/src-d/go-billy.v4"
+)
+
+// precompressed holds the gzipped contents of the assets, keyed by name.
+var precompressed = struct {
+	m     sync.RWMutex
+	files map[string]gzipped
+}{files: map[string]gzipped{}}
+
+type gzipped struct {
+	size  int64
+	bytes []byte
+}
+
+// GzipBytes returns the precompressed contents of the asset, if it was precompressed. The assets
+// filesystem doesn't keep modification times, so the size is checked in case the file was replaced.
+func GzipBytes(fi os.FileInfo, name string) ([]byte, bool) {
+	precompressed.m.RLock()
+	defer precompressed.m.RUnlock()
+	g, ok := precompressed.files[name]
+	if !ok || g.size != fi.Size() {
+		return nil, false
+	}
+	return g.bytes, true
+}
+
+// Precompress gzips the files in dir and its sub-directories that are at least
+// config.PrecompressMinSize bytes and aren't already compressed (see config.PrecompressSkipTypes).
+func Precompress(fs billy.Filesystem, dir string) error {
+	infos, err := fs.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range infos {
+		name := path.Join(dir, fi.Name())
+		if fi.IsDir() {
+			if err := Precompress(fs, name); err != nil {
+				return err
+			}
+			continue
+		}
+		if fi.Size() < config.PrecompressMinSize || skipCompress(name) {
+			continue
+		}
+		b, err := gzipFile(fs, name)
+		if err != nil {
+			return err
+		}
+		if len(b) >= int(fi.Size()) {
+			continue // not worth it
+		}
+		precompressed.m.Lock()
+		precompressed.files[name] = gzipped{size: fi.Size(), bytes: b}
+		precompressed.m.Unlock()
+	}
+	return nil
+}
+
+func skipCompress(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	for _, skip := range config.PrecompressSkipTypes {
+		if ext == skip {
+			return true
+		}
+	}
+	return false
+}
+
+func gzipFile(fs billy.Filesystem, name string) ([]byte, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf := &bytes.Buffer{}
+	gzw, _ := gzip.NewWriterLevel(buf, gzip.BestCompression)
+	if _, err := io.Copy(gzw, f); err != nil {
+		return nil, err
+	}
+	if err := gzw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -12,6 +12,10 @@ const (
 	ShareKind      = "ShareDev"
 	HintsKind      = "HintsDev"
 	WasmDeployKind = "WasmDeployDev"
+	AccessKind     = "AccessDev"
+	BuildKind      = "BuildDev"
+	OverflowKind   = "OverflowDev"
+	MigrationKind  = "MigrationDev"
 )
 
 var Bucket = map[string]string{
@@ -12,6 +12,10 @@ const (
 	ShareKind      = "Share"
 	HintsKind      = "Hints"
 	WasmDeployKind = "WasmDeploy"
+	AccessKind     = "Access"
+	BuildKind      = "Build"
+	OverflowKind   = "Overflow"
+	MigrationKind  = "Migration"
 )
 
 var Bucket = map[string]string{
@@ -24,32 +24,189 @@ const (
 	// CompileHost is the domain of the compile server
 	CompileHost = "compile.jsgo.io"
 
-	// MaxConcurrentCompiles is the maximum number of concurrent compile jobs per server
-	MaxConcurrentCompiles = 2
+	// MaxConcurrentCompiles is the maximum number of concurrent compile jobs per server. If zero, it's
+	// calculated from the number of CPUs using CompilesPerCPU and MaxAutoConcurrentCompiles.
+	MaxConcurrentCompiles = 0
+
+	// CompilesPerCPU is the number of concurrent compile jobs per CPU when MaxConcurrentCompiles is zero.
+	CompilesPerCPU = 0.5
+
+	// MaxAutoConcurrentCompiles caps the number of concurrent compile jobs when MaxConcurrentCompiles is
+	// zero.
+	MaxAutoConcurrentCompiles = 16
+
+	// MaxPostSize is the maximum request body size for POST endpoints that take form or JSON parameters
+	MaxPostSize = 64 << 10
+
+	// GoCommand is the go command used for wasm builds
+	GoCommand = "go"
+
+	// PlanEnabled allows plan-only compile requests, which fetch and resolve a package and describe the
+	// build without compiling.
+	PlanEnabled = true
+
+	// MaxConcurrentFetches is the maximum number of fetches (git clones etc.) at once, separate from
+	// the concurrent compiles limit.
+	MaxConcurrentFetches = 8
+
+	// FetchWaitTimeout is the maximum time to wait for a fetch slot
+	FetchWaitTimeout = time.Second * 60
+
+	// MaxUploadSize is the maximum size of an archive uploaded to /_upload/
+	MaxUploadSize = 10 << 20
+
+	// MaxSnippetSize is the maximum size of a Go file posted to /_snippet/
+	MaxSnippetSize = 64 << 10
+
+	// MaxUnpackedSize is the maximum total size of the source files extracted from an upload
+	MaxUnpackedSize = 20 << 20
+
+	// CompileAllTimeout is the overall timeout when compiling all the main packages in a repo
+	CompileAllTimeout = time.Second * 600
+
+	// MaxMains is the maximum number of main packages compiled when compiling all the main packages in a
+	// repo
+	MaxMains = 20
+
+	// MaxExamples is the maximum number of Example functions compiled when compiling the examples of a
+	// package
+	MaxExamples = 20
 
 	// MaxQueue is the maximum queue length waiting for compile. After this an error is returned.
 	MaxQueue = 100
 
+	// OverflowEnabled keeps async compiles (see /_api/compile) that arrive when the compile queue is full
+	// in a persistent overflow queue in the database, instead of rejecting them. The overflow jobs are
+	// started as the queue has room. Websocket clients are still rejected when the queue is full. Only
+	// used with the datastore (not in local mode).
+	OverflowEnabled = false
+
+	// OverflowRetention is how long a job can wait in the overflow queue. Jobs that haven't started by
+	// then are dropped, and the error is written to the job log.
+	OverflowRetention = time.Hour * 6
+
+	// OverflowDrainPeriod is the interval between checks for room in the compile queue for overflow jobs
+	OverflowDrainPeriod = time.Second * 10
+
+	// OverflowCandidates is the number of the oldest overflow jobs read at once, so servers draining the
+	// queue at the same time can each take a different job.
+	OverflowCandidates = 10
+
+	// MaxTenantFraction is the fraction of the concurrent compile slots that a single client can use
+	// while other clients are waiting. Set to 0 to disable.
+	MaxTenantFraction = 0.5
+
+	// SlowCompileThreshold is the duration above which a compile is logged as slow, with the time taken
+	// by each phase. Set to 0 to disable.
+	SlowCompileThreshold = time.Minute
+
+	// StoreSlowCompiles flags slow compiles in the compile log, and stores the time taken by each phase.
+	StoreSlowCompiles = true
+
+	// ServeStale replies to every failed compile with the last successful build of the path, if there is
+	// one, as if the request had Stale set. The failure is still logged.
+	ServeStale = false
+
+	// MaxSymbols is the maximum number of symbols in a compile request (see messages.Compile.Symbols)
+	MaxSymbols = 100
+
+	// MaxReplacements is the maximum number of replacements in a compile request (see
+	// messages.Compile.Replace)
+	MaxReplacements = 10
+
+	// MaxCompilesPerIp is the maximum number of compiles a single client can have running or waiting at
+	// once. Further compiles are rejected until one finishes. Set to 0 to disable.
+	MaxCompilesPerIp = 3
+
+	// ProxyDepth is the number of X-Forwarded-For hops added by the proxies in front of the server, so
+	// the address of the client is this many hops from the end. The Google Cloud load balancer appends
+	// the client's address and then its own, so the client is second from last.
+	ProxyDepth = 2
+
 	AssetsFilename = "assets.zip"
 
 	// WriteTimeout is the timeout when serving static files
 	WriteTimeout = time.Second * 2
 
+	// MaxConcurrentStreams is the maximum number of files streamed to clients at once. Other requests
+	// wait for up to StreamWaitTimeout, and WriteTimeout starts when their stream starts.
+	MaxConcurrentStreams = 64
+	StreamWaitTimeout    = time.Second * 5
+
+	// StreamBytesPerSecond limits the rate of each stream. Zero is unlimited. WriteTimeout must be long
+	// enough for the largest file at this rate.
+	StreamBytesPerSecond = 0
+
+	// StreamGzipMinSize is the size above which files without precompressed contents (e.g. source maps)
+	// are gzipped on the fly while streaming, instead of being served uncompressed.
+	StreamGzipMinSize = 1 << 20
+
+	// PrecompressAssets gzips the static assets when they're loaded, so they're served precompressed
+	// whether or not the assets zip included compressed contents.
+	PrecompressAssets = true
+
+	// PrecompressMinSize is the size below which assets aren't precompressed - gzip barely helps.
+	PrecompressMinSize = 1024
+
 	// CompileTimeout is the timeout when compiling a package.
 	RequestTimeout = time.Second * 300
 
+	// StaticRouteTimeout, ApiRouteTimeout and CompileRouteTimeout are the overall deadlines of HTTP
+	// requests for static files, pages and API calls, and synchronous compiles (uploads and snippets). A
+	// request that hasn't started its response by then gets 504. Websocket requests have no deadline.
+	StaticRouteTimeout  = time.Second * 30
+	ApiRouteTimeout     = time.Second * 60
+	CompileRouteTimeout = RequestTimeout + time.Second*30
+
 	// PageTimeout is the timeout when generating the compile page
 	PageTimeout = time.Second * 5
 
 	// ServerShutdownTimeout is the timeout when doing a graceful server shutdown
 	ServerShutdownTimeout = time.Second * 5
 
-	// WebsocketPingPeriod is the interval between pings. Must be less than WebsocketPongTimeout.
+	// ServerReadHeaderTimeout is the time allowed to read the request headers, and ServerIdleTimeout is
+	// how long an idle keep-alive connection is kept open. There's no overall read timeout on the server,
+	// because websocket connections are long-lived: they have their own deadlines (see
+	// WebsocketPongTimeout and WebsocketWriteTimeout). ServerWriteTimeout is the deadline for writing a
+	// response, which stops a client that reads slowly from holding a stream slot (see
+	// MaxConcurrentStreams). It's longer than any route timeout, and websocket writes replace it with
+	// their own deadlines.
+	ServerReadHeaderTimeout = time.Second * 10
+	ServerIdleTimeout       = time.Second * 120
+	ServerWriteTimeout      = CompileRouteTimeout + time.Second*30
+
+	// ServerMaxHeaderBytes is the maximum size of the request headers.
+	ServerMaxHeaderBytes = 64 << 10
+
+	// StreamDrainTimeout is how long files that are being streamed to clients when the server shuts down
+	// have to finish, once the compiles have been cancelled. Downloads are usually fast, so most finish
+	// rather than leaving the client with a truncated script. Streams still running are then stopped.
+	// Must be less than ServerShutdownTimeout.
+	StreamDrainTimeout = time.Second * 2
+
+	// ShutdownWriteTimeout is the write timeout for the message that tells websocket clients the server is
+	// shutting down. Must be less than ServerShutdownTimeout.
+	ShutdownWriteTimeout = time.Second * 2
+
+	// ShutdownMessage is sent to websocket clients when the server shuts down. Other languages are in
+	// the locale package.
+	ShutdownMessage = "The server is restarting - please try again"
+
+	// WebsocketPingPeriod is the base interval between pings. Pings are sent every half period when the
+	// connection is idle. While messages are being sent, pings are only sent every half
+	// WebsocketPongTimeout, because only pongs extend the read deadline. Must be less than
+	// WebsocketPongTimeout.
 	WebsocketPingPeriod = time.Second * 10
 
 	// WebsocketPongTimeout is the time to wait for a pong from the client before cancelling
 	WebsocketPongTimeout = time.Second * 20
 
+	// MaxSocketMessageSize is the maximum size of a websocket message from a client. Playground messages
+	// carry the source of every file in the project, so it's generous, but it's bounded so a client can't
+	// exhaust memory with an enormous frame. Larger messages close the connection with code 1009
+	// (message too big).
+	MaxSocketMessageSize = 4 << 20
+
 	// WebsocketWriteTimeout is the write timeout for websockets
 	WebsocketWriteTimeout = time.Second * 20
 
@@ -57,14 +214,352 @@ const (
 	// playground compile)
 	WebsocketInstructionTimeout = time.Second * 5
 
+	// CompileRetries is the number of times a compile is retried after a transient compiler crash (see
+	// TransientCompilerErrors). Retries share the request timeout.
+	CompileRetries = 1
+
+	// QueueReorder starts compiles that are predicted to be mostly cached before cold compiles with the
+	// same nice level. This improves throughput, but isn't fair: a cold compile can wait behind a stream
+	// of cached ones.
+	QueueReorder = false
+
+	// MaxVarLength is the maximum length of a value in the Vars of a compile request.
+	MaxVarLength = 1024
+
+	// MaxOutputFiles is the maximum number of files (packages, prelude, loader and index) in each output
+	// of a compile. Compiles with more fail before they're stored.
+	MaxOutputFiles = 2000
+
+	// MaxFilesPerRepo is the maximum number of source files (with one of the ValidExtensions) in a
+	// fetched repo
+	MaxFilesPerRepo = 10000
+
+	// GitMaxBytes is the maximum total size of the Git LFS objects fetched for a compile
+	GitMaxBytes = 10 << 20
+
+	// GitMaxCloneBytes is the maximum total size of the git objects in a clone of a ref, pull request or
+	// gist revision (these bypass the git fetcher)
+	GitMaxCloneBytes = 500 << 20
+
+	// BreakerThreshold is the number of failed fetches from a host within BreakerWindow that stops
+	// fetches from the host for BreakerCooldown
+	BreakerThreshold = 20
+	BreakerWindow    = time.Minute
+	BreakerCooldown  = time.Minute
+
+	// GitListTimeout is the timeout when listing the refs of a repo
+	GitListTimeout = time.Second * 10
+
+	// GitMaxRefs is the maximum number of refs a repo can have when listing refs
+	GitMaxRefs = 5000
+
+	// RefsCacheTime is how long to remember the refs of a repo
+	RefsCacheTime = time.Minute
+
+	// RefsCacheSize is the number of repos to remember the refs of
+	RefsCacheSize = 1000
+
+	// JobLogMaxSize is the maximum size of the log of the messages sent to a websocket client. Later
+	// messages are dropped.
+	JobLogMaxSize = 1 << 20
+
+	// JobLogTTL is how long the log of a websocket request can be retrieved from /_api/job/<id>/log. The
+	// logs should also be deleted from the git bucket by a lifecycle rule on the logs/ prefix.
+	JobLogTTL = time.Hour
+
+	// JobLogWriteTimeout is the timeout of writing a job log. The log is written while the job runs, so
+	// it's longer than RequestTimeout.
+	JobLogWriteTimeout = RequestTimeout + time.Second*30
+
+	// JobLogCloseTimeout is how long closing the websocket waits for the job log to be written
+	JobLogCloseTimeout = time.Second * 10
+
+	// ProgressHistory is the number of messages of a running job kept for subscribers that attach
+	// mid-stream (see /_api/job/<id>/watch). Older messages are dropped from the catch-up snapshot.
+	ProgressHistory = 500
+
+	// ProgressBuffer is the number of messages (beyond the catch-up snapshot) queued for a slow watcher
+	// before it's disconnected.
+	ProgressBuffer = 256
+
 	// HttpTimeout is the time to wait for HTTP operations (e.g. getting meta data - not git)
 	HttpTimeout = time.Second * 5
 
 	ConcurrentStorageUploads = 10
+
+	// AccessFlushPeriod is the interval between writing buffered access counts to the database
+	AccessFlushPeriod = time.Minute
+
+	// DatabaseBatchSize is the maximum number of entities written in one call (the datastore limit)
+	DatabaseBatchSize = 500
+
+	// NormalizeCacheSize is the number of normalized paths to remember
+	NormalizeCacheSize = 10000
+
+	// NormalizeCacheTime is how long to remember a normalized path
+	NormalizeCacheTime = time.Hour
+
+	// FailureCacheTime is how long to remember that a package failed to compile at a commit
+	FailureCacheTime = time.Minute * 10
+
+	// PullFailureCacheTime is FailureCacheTime for pull request refs
+	PullFailureCacheTime = time.Minute
+
+	// RedirectCacheTime is how long to remember whether a repo has been renamed
+	RedirectCacheTime = time.Minute * 10
+
+	// RedirectCacheSize is the number of repos to remember whether they've been renamed
+	RedirectCacheSize = 10000
+
+	// PolicyEnabled checks the repo of each compile against the repo policy (see jsgo.Policy) before it's
+	// fetched. Only repos on PolicyHosts are checked.
+	PolicyEnabled = false
+
+	// PolicyAllowForks allows forks to be compiled by the default repo policy.
+	PolicyAllowForks = true
+
+	// PolicyMinStars is the minimum number of stars of a repo for the default repo policy.
+	PolicyMinStars = 0
+
+	// PolicyMinAge is the minimum age of a repo for the default repo policy.
+	PolicyMinAge = time.Duration(0)
+
+	// PolicyCacheTime is how long to remember the metadata of a repo for the repo policy
+	PolicyCacheTime = time.Minute * 10
+
+	// PolicyCacheSize is the number of repos to remember the metadata of for the repo policy
+	PolicyCacheSize = 10000
+
+	// ArtifactCacheSize is the maximum total size in bytes of the files from the pkg bucket kept in
+	// memory, ArtifactCacheItemSize is the size of the largest file that's kept, and ArtifactCacheItems is
+	// the maximum number of files. Files in the pkg bucket are named by their hash, so they never change.
+	ArtifactCacheSize     = 256 << 20
+	ArtifactCacheItemSize = 8 << 20
+	ArtifactCacheItems    = 10000
+
+	// TtlPinned, TtlDefault and TtlEphemeral are how long the files of a build are kept after it's
+	// compiled: builds of a pinned ref or module version, builds of a package's default branch, and
+	// builds of gists. The cleanup job (see CleanupEnabled) deletes the files of expired builds that no
+	// live build shares. Zero keeps builds of the type forever.
+	TtlPinned    = time.Hour * 24 * 365
+	TtlDefault   = time.Hour * 24 * 90
+	TtlEphemeral = time.Hour * 24 * 7
+
+	// CleanupEnabled runs the cleanup job every CleanupInterval. It's off by default, because deleted
+	// builds can't be served again. The GCS and local fileservers can both delete files.
+	CleanupEnabled  = false
+	CleanupInterval = time.Hour * 24
+
+	// ModuleCacheTime is how long to remember the repo and commit of a module version, and
+	// ModuleCacheSize is the number of module versions to remember. Module versions never change.
+	ModuleCacheTime = time.Hour * 24
+	ModuleCacheSize = 10000
+
+	// InfoTokenEnv is the environment variable holding the bearer token for the /_info/ endpoint. If it's
+	// not set, the endpoint is public.
+	InfoTokenEnv = "JSGO_INFO_TOKEN"
+
+	// TenantKeysEnv is the environment variable holding the API keys of tenants, as comma separated
+	// namespace:key pairs (e.g. "acme:k1,initech:k2"). A compile request with a key as its bearer token
+	// is isolated in the tenant's namespace: its files are stored under TenantPrefix/<namespace>/ in the
+	// buckets, and its database records in a separate datastore namespace. Requests without a key share
+	// the common namespace. Namespaces are lower case letters, digits and hyphens.
+	TenantKeysEnv = "JSGO_TENANT_KEYS"
+	TenantPrefix  = "tenants"
+
+	// CdnProvider is the CDN in front of the buckets, which is told to purge mutable urls when they
+	// change. Empty for no purging.
+	CdnProvider = ""
+
+	// CdnZoneEnv and CdnTokenEnv are the environment variables holding the CDN zone and API token. If
+	// either isn't set, nothing is purged.
+	CdnZoneEnv  = "JSGO_CDN_ZONE"
+	CdnTokenEnv = "JSGO_CDN_TOKEN"
+
+	// MirrorDirEnv is the environment variable holding the directory of mirrored repos, which are used
+	// instead of fetching from the network (in any mode). If it's not set, there's no mirror.
+	MirrorDirEnv = "JSGO_MIRROR_DIR"
+
+	// AdminTokenEnv is the environment variable holding the bearer token for the /_admin/ endpoints. If
+	// it's not set, the admin endpoints are disabled.
+	AdminTokenEnv = "JSGO_ADMIN_TOKEN"
+
+	// EstimateSamples is the number of recent successful compiles that compile time estimates are based
+	// on. Compiles of a similar size are preferred if there are at least EstimateMinSimilar of them.
+	EstimateSamples    = 200
+	EstimateMinSimilar = 5
 )
 
+// StdlibVersion is the Go version of the precompiled standard library in the assets, which every
+// compile links against. It's reported in plans and build metadata.
+const StdlibVersion = "go1.10"
+
 var ValidExtensions = []string{".go", ".jsgo.html", ".inc.js", ".md"}
 
+// GitRemoteHosts are the hosts that the refs of repos are listed from, for /_refs/ and to find the
+// commit of a cached failure. Requests for repos on other hosts fail without connecting.
+var GitRemoteHosts = []string{"github.com", "gitlab.com", "bitbucket.org", "gist.github.com"}
+
+// ModuleProxy is the module proxy that module versions are resolved with, to find the repo and commit
+// to compile for a module request.
+var ModuleProxy = "https://proxy.golang.org"
+
+// PolicyHosts are the hosts that the repo policy is applied to, with the API their repo metadata is
+// read from. Only the GitHub API is supported.
+var PolicyHosts = map[string]string{"github.com": "https://api.github.com"}
+
+// PolicyOwners are the owners (users or organizations) whose repos the default repo policy allows. All
+// owners are allowed if it's empty.
+var PolicyOwners []string
+
+// RedirectHosts are the hosts that are checked for renamed repos before compiling. Redirects are only
+// followed to the same host.
+var RedirectHosts = []string{"github.com"}
+
+// ContentSecurityPolicy is sent with the HTML pages. The default allows the inline scripts and CDN
+// assets the pages use, and websocket connections for compiling. Stricter deployments can tighten it, and
+// an empty policy isn't sent.
+var ContentSecurityPolicy = "default-src 'self'; " +
+	"script-src 'self' 'unsafe-inline' 'unsafe-eval' https:; " +
+	"style-src 'self' 'unsafe-inline' https:; " +
+	"img-src 'self' data: https:; " +
+	"connect-src 'self' ws: wss: https:; " +
+	"object-src 'none'; " +
+	"base-uri 'self'; " +
+	"frame-ancestors 'self'"
+
+// ArtifactAllowOrigin is the Access-Control-Allow-Origin header sent with scripts and source maps, so
+// they can be loaded cross-origin as modules, with fetch() and by devtools. Empty isn't sent.
+var ArtifactAllowOrigin = "*"
+
+// LogCompression logs the compression decision of each static file and source map: the client's
+// Accept-Encoding, the chosen encoding and why (e.g. "skipped: below threshold" or "gzip: precomputed").
+// It's for diagnosing why a client gets uncompressed responses, so it's off by default.
+var LogCompression = false
+
+// ReferrerPolicy is sent with the HTML pages. Empty isn't sent.
+var ReferrerPolicy = "strict-origin-when-cross-origin"
+
+// AltSvcAuthority is the authority (e.g. ":443" or "h3.jsgo.io:443") advertised in the Alt-Svc header of
+// every response, so clients that support it switch to AltSvcProtocols for later requests. The server
+// doesn't terminate HTTP/3 itself - the edge must. Empty doesn't send the header.
+var AltSvcAuthority = ""
+
+// AltSvcProtocols are the ALPN protocol ids advertised at AltSvcAuthority, most preferred first.
+var AltSvcProtocols = []string{"h3", "h2"}
+
+// AltSvcMaxAge is how long clients may remember the advertised endpoints.
+const AltSvcMaxAge = time.Hour * 24
+
+// CompileWorkDir is the directory holding the working directories of compiles that build on disk (e.g.
+// wasm builds). It's created if it doesn't exist, and the working directories left by a crashed server are
+// removed when the server starts. Empty is "jsgo-compile" in the system temp directory.
+var CompileWorkDir = ""
+
+// TransientCompilerErrors are substrings of compiler panics that are known to be nondeterministic, so the
+// compile is retried (see CompileRetries). Other panics and compile errors aren't retried. Only add
+// signatures that are known to be nondeterministic: most panics (e.g. nil pointer dereferences) are
+// deterministic compiler bugs, and fatal runtime errors (e.g. concurrent map writes) can't be recovered.
+var TransientCompilerErrors = []string{}
+
+// UpstreamErrors are substrings of fetch errors caused by the upstream host being unavailable (server
+// errors, rate limiting, timeouts and network failures). Only these count towards opening the host's
+// breaker (see BreakerThreshold), so a missing repo or a bad import path can't trip it.
+var UpstreamErrors = []string{
+	"status code: 5",
+	"status code: 429",
+	"500 Internal Server Error",
+	"502 Bad Gateway",
+	"503 Service Unavailable",
+	"504 Gateway Timeout",
+	"429 Too Many Requests",
+	"rate limit",
+	"timeout",
+	"deadline exceeded",
+	"connection refused",
+	"connection reset",
+}
+
+// RunGenerators runs the go:generate directives of the compiled package before it's compiled, if their
+// command is in AllowedGenerators. Other directives (and all directives when it's off) only send a
+// warning. Generators run in a working directory (see CompileWorkDir) with a copy of the source, a minimal
+// environment and GenerateTimeout, but they're still programs running on the server, so only allow
+// trusted generators, and deploy with network and filesystem isolation if this is enabled.
+var RunGenerators = false
+
+// AllowedGenerators are the commands (e.g. "stringer") that RunGenerators may run. They must be in the
+// server's PATH. "go" is never run, because go run would run code from the repo.
+var AllowedGenerators = []string{}
+
+// GenerateTimeout is the timeout of each generator run by RunGenerators.
+const GenerateTimeout = time.Second * 30
+
+// BlockedImports are packages that can't be compiled, or imported by any package in the dependency
+// graph of a compile. Sub-packages are included.
+var BlockedImports = []string{}
+
+// Reproducible makes builds independent of the machine they run on and the order of their options, so
+// identical source always produces identical output: build tags are sorted, the dev script's source
+// map refers to import paths instead of local files, and build metadata has no compile time. It's off
+// by default, because the dev script's source map then can't open the local files in devtools.
+var Reproducible = false
+
+// DebugTags are the build tags of debug builds. GopherJS has no race detector or optional runtime
+// assertions, so packages opt in to extra checks in files with these tags. Debug builds are slower.
+var DebugTags = []string{"jsgo_debug"}
+
+// AllowedVars are the package level string variables that compile requests can set, like the linker's
+// -X flag. Entries are either import/path.Name, or import/path.* for every variable in the package.
+var AllowedVars = []string{}
+
+// PrecompressSkipTypes are the extensions of assets that are already compressed, so aren't
+// precompressed.
+var PrecompressSkipTypes = []string{".png", ".jpg", ".jpeg", ".gif", ".webp", ".woff", ".woff2", ".gz", ".zip"}
+
+// RuntimeChunkPackages are the packages, in addition to the standard library, that are listed in the
+// shared runtime chunk of the manifest. Sub-packages are included.
+var RuntimeChunkPackages = []string{"github.com/gopherjs/gopherjs"}
+
+// ChunkDir is the directory in the pkg bucket for the files of split compiles, which are named by the
+// hash of their contents.
+var ChunkDir = "_chunks"
+
+// DefaultRefs maps path prefixes to the git ref (branch, tag or commit hash) that is compiled when the
+// request doesn't specify one, for repos where HEAD isn't what users want. The longest matching prefix
+// is used. Prefixes match whole path segments, and the repo root is the first three segments of the
+// prefix (e.g. "github.com/user/repo").
+var DefaultRefs = map[string]string{}
+
+// Sites served by the page handler, used as keys for per-site config.
+const (
+	PlaySite  = "play"
+	JsgoSite  = "jsgo"
+	FrizzSite = "frizz"
+)
+
+// CDN providers for CdnProvider.
+const (
+	CdnCloudflare = "cloudflare"
+)
+
+// Modes for the root path of a site.
+const (
+	RootPage     = "page"     // serve the site's default page
+	RootRedirect = "redirect" // redirect to RootConfig.Redirect
+	RootJson     = "json"     // return a minimal JSON description of the service
+)
+
+// RootConfig configures the root path of a site.
+type RootConfig struct {
+	Mode     string
+	Redirect string // url for RootRedirect
+	Name     string // service name for RootJson
+}
+
+// RootPages configures the root path of each site (keyed by PlaySite, JsgoSite or FrizzSite). Sites not
+// in the map serve their default page.
+var RootPages = map[string]RootConfig{}
+
 var Buckets = []string{Bucket[Src], Bucket[Pkg], Bucket[Index], Bucket[Git]}
 
 var Static = []string{Src, Pkg, Index}
@@ -3,10 +3,12 @@
 package config
 
 import (
+	"strings"
 	"time"
 
 	"github.com/dave/services/deployer"
 	"github.com/dave/services/fetcher/gitfetcher"
+	"github.com/gopherjs/gopherjs/compiler"
 )
 
 var GitFetcherConfig = gitfetcher.Config{
@@ -16,10 +18,63 @@ var GitFetcherConfig = gitfetcher.Config{
 	GitBucket:       Bucket[Git],
 }
 
+// GitHostTimeouts overrides the GitFetcherConfig timeouts for specific hosts (e.g. a slow internal
+// mirror). Zero values use the defaults.
+var GitHostTimeouts = map[string]GitTimeouts{}
+
+type GitTimeouts struct {
+	Save  time.Duration
+	Clone time.Duration
+}
+
+// GitFetcherConfigForHost returns GitFetcherConfig with any timeout overrides for host applied.
+func GitFetcherConfigForHost(host string) gitfetcher.Config {
+	c := GitFetcherConfig
+	t, ok := GitHostTimeouts[host]
+	if !ok {
+		return c
+	}
+	if t.Save > 0 {
+		c.GitSaveTimeout = t.Save
+	}
+	if t.Clone > 0 {
+		c.GitCloneTimeout = t.Clone
+	}
+	return c
+}
+
 var DeployerConfig = deployer.Config{
 	ConcurrentStorageUploads: ConcurrentStorageUploads,
 	IndexBucket:              Bucket[Index],
 	PkgBucket:                Bucket[Pkg],
 	PkgProtocol:              Protocol[Pkg],
-	PkgHost:                  Host[Pkg],
+	PkgHost:                  PkgHostPath(),
+}
+
+// ArtifactPrefix is prepended to the names of files in the pkg bucket, so environments or toolchain
+// versions sharing a bucket don't collide. "{env}" is replaced with dev or prod, and "{toolchain}" with
+// the GopherJS version (e.g. "{env}/{toolchain}").
+var ArtifactPrefix = ""
+
+// ArtifactFallbackPrefix is the prefix tried when a file isn't found with ArtifactPrefix, so files stored
+// before the prefix changed can still be read. It's expanded in the same way.
+var ArtifactFallbackPrefix = ""
+
+// ExpandArtifactPrefix expands the placeholders in a prefix template, and removes leading and trailing
+// slashes.
+func ExpandArtifactPrefix(template string) string {
+	env := "prod"
+	if DEV {
+		env = "dev"
+	}
+	return strings.Trim(strings.NewReplacer("{env}", env, "{toolchain}", compiler.Version).Replace(template), "/")
+}
+
+// PkgHostPath is the host and path that files in the pkg bucket are served from, including the
+// artifact prefix.
+func PkgHostPath() string {
+	if prefix := ExpandArtifactPrefix(ArtifactPrefix); prefix != "" {
+		return Host[Pkg] + "/" + prefix
+	}
+	return Host[Pkg]
 }
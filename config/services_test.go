@@ -0,0 +1,41 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gopherjs/gopherjs/compiler"
+)
+
+func TestGitFetcherConfigForHost(t *testing.T) {
+	defer func(previous map[string]GitTimeouts) { GitHostTimeouts = previous }(GitHostTimeouts)
+	GitHostTimeouts = map[string]GitTimeouts{
+		"git.example.com": {Clone: time.Second * 600},
+	}
+
+	c := GitFetcherConfigForHost("git.example.com")
+	if c.GitCloneTimeout != time.Second*600 {
+		t.Fatalf("expected overridden clone timeout, got %v", c.GitCloneTimeout)
+	}
+	if c.GitSaveTimeout != GitFetcherConfig.GitSaveTimeout {
+		t.Fatalf("expected default save timeout, got %v", c.GitSaveTimeout)
+	}
+
+	c = GitFetcherConfigForHost("github.com")
+	if c.GitCloneTimeout != GitFetcherConfig.GitCloneTimeout || c.GitSaveTimeout != GitFetcherConfig.GitSaveTimeout {
+		t.Fatalf("expected default timeouts, got %v, %v", c.GitCloneTimeout, c.GitSaveTimeout)
+	}
+}
+
+func TestExpandArtifactPrefix(t *testing.T) {
+	env := "prod"
+	if DEV {
+		env = "dev"
+	}
+	if found := ExpandArtifactPrefix("/{env}/gopherjs-{toolchain}/"); found != env+"/gopherjs-"+compiler.Version {
+		t.Fatalf("unexpected prefix %q", found)
+	}
+	if ExpandArtifactPrefix("") != "" {
+		t.Fatal("expected empty prefix")
+	}
+}
@@ -0,0 +1,6 @@
+package config
+
+// Version is the server build, set at build time with:
+//
+//	-ldflags "-X github.com/dave/jsgo/config.Version=<version>"
+var Version = "dev"
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/store"
+	"github.com/dave/services"
+)
+
+// AccessLog counts hits and bytes served per path. Counts are buffered in memory and written to the
+// database periodically, so recording doesn't add latency to serving.
+type AccessLog struct {
+	database services.Database
+	m        sync.Mutex
+	counts   map[string]*store.AccessData
+}
+
+func NewAccessLog(database services.Database) *AccessLog {
+	return &AccessLog{
+		database: database,
+		counts:   map[string]*store.AccessData{},
+	}
+}
+
+// Record adds a hit for path.
+func (a *AccessLog) Record(path string, bytes int64) {
+	a.m.Lock()
+	defer a.m.Unlock()
+	c, ok := a.counts[path]
+	if !ok {
+		c = &store.AccessData{Path: path}
+		a.counts[path] = c
+	}
+	c.Hits++
+	c.Bytes += bytes
+}
+
+// Run flushes the counts every config.AccessFlushPeriod until shutdown is closed, and then flushes
+// a final time.
+func (a *AccessLog) Run(shutdown chan struct{}) {
+	ticker := time.NewTicker(config.AccessFlushPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.Flush()
+		case <-shutdown:
+			a.Flush()
+			return
+		}
+	}
+}
+
+// Flush writes the buffered counts to the database.
+func (a *AccessLog) Flush() {
+	a.m.Lock()
+	counts := a.counts
+	a.counts = map[string]*store.AccessData{}
+	a.m.Unlock()
+
+	if len(counts) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.PageTimeout)
+	defer cancel()
+
+	now := time.Now()
+	data := make([]store.AccessData, 0, len(counts))
+	for _, c := range counts {
+		c.Time = now
+		data = append(data, *c)
+	}
+	// losing a few counts isn't important, so they're not retried
+	if err := store.StoreAccesses(ctx, a.database, data); err != nil {
+		log.Printf("Storing access counts: %v", err)
+	}
+}
+
+// Handler wraps a handler so its responses are counted. HEAD requests and errors aren't counted.
+func (a *AccessLog) Handler(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if a == nil || req.Method == http.MethodHead {
+			handler(w, req)
+			return
+		}
+		cw := &countingWriter{ResponseWriter: w, status: http.StatusOK}
+		handler(cw, req)
+		if cw.status < http.StatusBadRequest {
+			a.Record(req.Host+req.URL.Path, cw.bytes)
+		}
+	}
+}
+
+// countingWriter records the status and counts the bytes of a response.
+type countingWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (c *countingWriter) WriteHeader(status int) {
+	c.status = status
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(b)
+	c.bytes += int64(n)
+	return n, err
+}
+
+func (c *countingWriter) Flush() {
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/memstore"
+	"github.com/dave/jsgo/server/store"
+)
+
+// batchDatabase records the batches written with PutMulti.
+type batchDatabase struct {
+	*memstore.Database
+	batches [][]store.AccessData
+}
+
+func (b *batchDatabase) PutMulti(ctx context.Context, keys []*datastore.Key, src interface{}) ([]*datastore.Key, error) {
+	b.batches = append(b.batches, src.([]store.AccessData))
+	return keys, nil
+}
+
+func TestAccessHandler(t *testing.T) {
+	db := &batchDatabase{Database: memstore.NewDatabase()}
+	a := NewAccessLog(db)
+	handler := a.Handler(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/missing" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("12345"))
+	})
+	for _, r := range []struct{ method, path string }{
+		{"GET", "/a"},
+		{"GET", "/a"},
+		{"HEAD", "/a"},
+		{"GET", "/missing"},
+		{"GET", "/b"},
+	} {
+		req := httptest.NewRequest(r.method, r.path, nil)
+		req.Host = "jsgo.io"
+		handler(httptest.NewRecorder(), req)
+	}
+	a.Flush()
+	if len(db.batches) != 1 || len(db.batches[0]) != 2 {
+		t.Fatalf("expected one batch of 2 paths, found %v", db.batches)
+	}
+	found := map[string]store.AccessData{}
+	for _, d := range db.batches[0] {
+		found[d.Path] = d
+	}
+	if a := found["jsgo.io/a"]; a.Hits != 2 || a.Bytes != 10 || a.Time.IsZero() {
+		t.Fatalf("unexpected count %#v", a)
+	}
+	if b := found["jsgo.io/b"]; b.Hits != 1 || b.Bytes != 5 {
+		t.Fatalf("unexpected count %#v", b)
+	}
+
+	// nothing is written when there are no counts
+	a.Flush()
+	if len(db.batches) != 1 {
+		t.Fatalf("expected no more batches, found %d", len(db.batches))
+	}
+
+	// the access log is optional
+	var none *AccessLog
+	w := httptest.NewRecorder()
+	none.Handler(func(w http.ResponseWriter, req *http.Request) { w.Write([]byte("ok")) })(w, httptest.NewRequest("GET", "/", nil))
+	if w.Body.String() != "ok" {
+		t.Fatalf("unexpected response %q", w.Body.String())
+	}
+}
+
+func TestStoreAccesses(t *testing.T) {
+	db := &batchDatabase{Database: memstore.NewDatabase()}
+	data := make([]store.AccessData, config.DatabaseBatchSize+1)
+	if err := store.StoreAccesses(context.Background(), db, data); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.batches) != 2 || len(db.batches[0]) != config.DatabaseBatchSize || len(db.batches[1]) != 1 {
+		t.Fatalf("expected batches of %d and 1", config.DatabaseBatchSize)
+	}
+}
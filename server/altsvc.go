@@ -0,0 +1,35 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dave/jsgo/config"
+)
+
+// AltSvc wraps a handler so the responses advertise the alternative services in config.AltSvcAuthority
+// (see altSvc). Without an authority it returns the handler unchanged.
+func AltSvc(handler http.Handler) http.Handler {
+	value := altSvc()
+	if value == "" {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Alt-Svc", value)
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// altSvc returns the Alt-Svc header value for config.AltSvcAuthority and config.AltSvcProtocols, e.g.
+// `h3=":443"; ma=86400, h2=":443"; ma=86400`, or "" if either is empty.
+func altSvc() string {
+	if config.AltSvcAuthority == "" {
+		return ""
+	}
+	var services []string
+	for _, protocol := range config.AltSvcProtocols {
+		services = append(services, fmt.Sprintf("%s=%q; ma=%d", protocol, config.AltSvcAuthority, int(config.AltSvcMaxAge.Seconds())))
+	}
+	return strings.Join(services, ", ")
+}
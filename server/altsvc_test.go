@@ -0,0 +1,31 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dave/jsgo/config"
+)
+
+func TestAltSvc(t *testing.T) {
+	defer func(authority string, protocols []string) {
+		config.AltSvcAuthority, config.AltSvcProtocols = authority, protocols
+	}(config.AltSvcAuthority, config.AltSvcProtocols)
+	handler := func(w http.ResponseWriter, req *http.Request) { w.Write([]byte("ok")) }
+
+	config.AltSvcAuthority = ""
+	w := httptest.NewRecorder()
+	AltSvc(http.HandlerFunc(handler)).ServeHTTP(w, httptest.NewRequest("GET", "/_script.js", nil))
+	if _, ok := w.Header()["Alt-Svc"]; ok {
+		t.Errorf("expected no Alt-Svc header, found %q", w.Header().Get("Alt-Svc"))
+	}
+
+	config.AltSvcAuthority, config.AltSvcProtocols = ":443", []string{"h3", "h2"}
+	w = httptest.NewRecorder()
+	AltSvc(http.HandlerFunc(handler)).ServeHTTP(w, httptest.NewRequest("GET", "/_script.js", nil))
+	expected := `h3=":443"; ma=86400, h2=":443"; ma=86400`
+	if found := w.Header().Get("Alt-Svc"); found != expected {
+		t.Errorf("expected %q, found %q", expected, found)
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"io"
+	"sync"
+
+	"github.com/dave/jsgo/server/cleanup"
+	"github.com/dave/services"
+)
+
+// ArtifactCache keeps the files read from one bucket in memory, so hot files aren't read from the
+// fileserver every time they're served. It's only used for the pkg bucket, where files are named by
+// the hash of their contents (or the build id), so a cached file is never stale. Files that aren't
+// found aren't cached, because they may be written later. The least recently read file is evicted
+// first when the total size or number of files is over the limit.
+type ArtifactCache struct {
+	services.Fileserver
+	bucket                      string
+	maxTotal, maxItem, maxItems int
+	m                           sync.Mutex
+	total                       int
+	order                       *list.List // most recently read at the front
+	entries                     map[string]*list.Element
+}
+
+type artifact struct {
+	name string
+	data []byte
+}
+
+// NewArtifactCache wraps fileserver. If maxTotal or maxItems is less than 1, fileserver is returned
+// unchanged.
+func NewArtifactCache(fileserver services.Fileserver, bucket string, maxTotal, maxItem, maxItems int) services.Fileserver {
+	if maxTotal < 1 || maxItems < 1 {
+		return fileserver
+	}
+	return &ArtifactCache{
+		Fileserver: fileserver,
+		bucket:     bucket,
+		maxTotal:   maxTotal,
+		maxItem:    maxItem,
+		maxItems:   maxItems,
+		order:      list.New(),
+		entries:    map[string]*list.Element{},
+	}
+}
+
+func (c *ArtifactCache) Read(ctx context.Context, bucket, name string, writer io.Writer) (bool, error) {
+	if bucket != c.bucket {
+		return c.Fileserver.Read(ctx, bucket, name, writer)
+	}
+	if data, ok := c.get(name); ok {
+		_, err := writer.Write(data)
+		return true, err
+	}
+	buf := &bytes.Buffer{}
+	found, err := c.Fileserver.Read(ctx, bucket, name, buf)
+	if err != nil || !found {
+		return found, err
+	}
+	c.add(name, buf.Bytes())
+	_, err = writer.Write(buf.Bytes())
+	return true, err
+}
+
+// Delete removes a file from the cache and deletes it, if the wrapped fileserver can (see
+// cleanup.Deleter).
+func (c *ArtifactCache) Delete(ctx context.Context, bucket, name string) error {
+	if !cleanup.CanDelete(c.Fileserver) {
+		return errCantDelete
+	}
+	if bucket == c.bucket {
+		c.m.Lock()
+		if e, ok := c.entries[name]; ok {
+			c.order.Remove(e)
+			delete(c.entries, name)
+			c.total -= len(e.Value.(*artifact).data)
+		}
+		c.m.Unlock()
+	}
+	return c.Fileserver.(cleanup.Deleter).Delete(ctx, bucket, name)
+}
+
+// CanDelete returns true if the wrapped fileserver can delete files.
+func (c *ArtifactCache) CanDelete() bool { return cleanup.CanDelete(c.Fileserver) }
+
+func (c *ArtifactCache) get(name string) ([]byte, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	e, ok := c.entries[name]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*artifact).data, true
+}
+
+func (c *ArtifactCache) add(name string, data []byte) {
+	if len(data) > c.maxItem || len(data) > c.maxTotal {
+		return
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	if _, ok := c.entries[name]; ok {
+		// Another read of the same file finished first. The contents are the same.
+		return
+	}
+	c.entries[name] = c.order.PushFront(&artifact{name: name, data: data})
+	c.total += len(data)
+	for c.total > c.maxTotal || c.order.Len() > c.maxItems {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		a := oldest.Value.(*artifact)
+		delete(c.entries, a.name)
+		c.total -= len(a.data)
+	}
+}
+
+// stats returns the number of files and their total size.
+func (c *ArtifactCache) stats() (items, total int) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.order.Len(), c.total
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dave/jsgo/server/memstore"
+)
+
+// countingFileserver counts the reads from a memstore.Fileserver.
+type countingFileserver struct {
+	*memstore.Fileserver
+	m     sync.Mutex
+	reads int
+}
+
+func (f *countingFileserver) Read(ctx context.Context, bucket, name string, writer io.Writer) (bool, error) {
+	f.m.Lock()
+	f.reads++
+	f.m.Unlock()
+	return f.Fileserver.Read(ctx, bucket, name, writer)
+}
+
+func TestArtifactCache(t *testing.T) {
+	ctx := context.Background()
+	mem := &countingFileserver{Fileserver: memstore.NewFileserver(map[string]string{
+		"pkg:a.js":   strings.Repeat("a", 4),
+		"pkg:b.js":   strings.Repeat("b", 4),
+		"pkg:c.js":   strings.Repeat("c", 4),
+		"pkg:big.js": strings.Repeat("d", 11),
+		"index:i":    "i",
+	})}
+	f := NewArtifactCache(mem, "pkg", 10, 8, 100)
+	c := f.(*ArtifactCache)
+
+	read := func(bucket, name string) string {
+		buf := &bytes.Buffer{}
+		if found, err := f.Read(ctx, bucket, name, buf); err != nil || !found {
+			t.Fatalf("expected %s to be found, found %v %v", name, found, err)
+		}
+		return buf.String()
+	}
+	readsOf := func(do func()) int {
+		before := mem.reads
+		do()
+		return mem.reads - before
+	}
+
+	if n := readsOf(func() { read("pkg", "a.js"); read("pkg", "a.js") }); n != 1 {
+		t.Fatalf("expected a.js to be read from the fileserver once, found %d", n)
+	}
+	if n := readsOf(func() { read("index", "i"); read("index", "i") }); n != 2 {
+		t.Fatalf("expected other buckets not to be cached, found %d reads", n)
+	}
+	if n := readsOf(func() { read("pkg", "big.js"); read("pkg", "big.js") }); n != 2 {
+		t.Fatalf("expected files over the item limit not to be cached, found %d reads", n)
+	}
+
+	// The cache holds 10 bytes, so reading c.js after b.js evicts a.js, the least recently read.
+	read("pkg", "b.js")
+	read("pkg", "c.js")
+	if items, total := c.stats(); items != 2 || total != 8 {
+		t.Fatalf("expected 2 files of 8 bytes, found %d files of %d bytes", items, total)
+	}
+	if n := readsOf(func() { read("pkg", "b.js"); read("pkg", "c.js") }); n != 0 {
+		t.Fatalf("expected b.js and c.js to be cached, found %d reads", n)
+	}
+	if n := readsOf(func() { read("pkg", "a.js") }); n != 1 {
+		t.Fatal("expected a.js to be evicted")
+	}
+
+	// Files that aren't found are read again, because they may be written later.
+	if found, _ := f.Read(ctx, "pkg", "missing.js", ioutil.Discard); found {
+		t.Fatal("expected missing.js not to be found")
+	}
+	f.Write(ctx, "pkg", "missing.js", bytes.NewBufferString("m"), false, "", "")
+	if s := read("pkg", "missing.js"); s != "m" {
+		t.Fatalf("expected the written file, found %q", s)
+	}
+
+	if _, ok := NewArtifactCache(mem, "pkg", 0, 0, 0).(*countingFileserver); !ok {
+		t.Fatal("expected no wrapper without a size")
+	}
+}
+
+func TestArtifactCacheItems(t *testing.T) {
+	ctx := context.Background()
+	mem := memstore.NewFileserver(nil)
+	for i := 0; i < 5; i++ {
+		mem.Files[fmt.Sprintf("pkg:%d.js", i)] = "x"
+	}
+	c := NewArtifactCache(mem, "pkg", 100, 100, 3).(*ArtifactCache)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 10; j++ {
+			name := fmt.Sprintf("%d.js", i)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.Read(ctx, "pkg", name, ioutil.Discard)
+			}()
+		}
+	}
+	wg.Wait()
+	if items, total := c.stats(); items != 3 || total != 3 {
+		t.Fatalf("expected 3 files of 3 bytes, found %d files of %d bytes", items, total)
+	}
+}
+
+func BenchmarkArtifactCache(b *testing.B) {
+	ctx := context.Background()
+	mem := memstore.NewFileserver(nil)
+	for i := 0; i < 100; i++ {
+		mem.Files[fmt.Sprintf("pkg:%d.js", i)] = strings.Repeat("x", 100<<10)
+	}
+	for name, size := range map[string]int{"uncached": 0, "cached": 1 << 30} {
+		f := NewArtifactCache(mem, "pkg", size, size, 1000)
+		b.Run(name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				var i int
+				for pb.Next() {
+					f.Read(ctx, "pkg", fmt.Sprintf("%d.js", i%100), ioutil.Discard)
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,110 @@
+// Package backend is the interface between the handlers and the compile backend, so handler logic can
+// be tested without running a real compiler and alternate backends can be plugged in.
+package backend
+
+import (
+	"context"
+
+	"github.com/dave/jsgo/assets/std"
+	"github.com/dave/jsgo/config"
+	"github.com/dave/services"
+	"github.com/dave/services/deployer"
+	"github.com/dave/services/session"
+)
+
+// Options configures a compile.
+type Options struct {
+	Index  deployer.IndexType // where the index page is written
+	Minify map[bool]bool      // which of the minified (true) and un-minified (false) outputs to build
+	Send   func(services.Message)
+
+	// MaxFiles is the maximum number of files in each output. The compile fails before anything is
+	// stored if the package's import graph is too large. Zero is unlimited.
+	MaxFiles int
+
+	// Shake removes the declarations that the program can't reach from the package files (see shake).
+	// If Removed isn't nil, the number of bytes removed from each output is set.
+	Shake   bool
+	Removed map[bool]int64
+
+	// Global is an optional JS identifier. If set, the main package is attached to window[Global] when
+	// it has loaded, and the loader doesn't clobber the package files of other bundles on the page (see
+	// namespace). The package files are the same, so only the loader changes.
+	Global string
+
+	// Symbols are exported objects of the package (functions, types or variables). If set, the output is
+	// shaken (see Shake) and only has the code the symbols need, so the page can call them without
+	// loading the whole package. The package doesn't need to be a main package.
+	Symbols []string
+
+	// Metadata is optional information about the build, recorded in the loader so it can be read at
+	// runtime from window.jsgoBuilds (see loaderJs). Only the loader changes.
+	Metadata *Metadata
+
+	// PkgHost is the host and path the loader and index page load the package files from, if they're
+	// not stored at config.DeployerConfig.PkgHost (e.g. for a tenant, see tenant.PkgHost).
+	PkgHost string
+}
+
+// deployerConfig returns config.DeployerConfig with the options applied.
+func deployerConfig(options Options) deployer.Config {
+	c := config.DeployerConfig
+	if options.PkgHost != "" {
+		c.PkgHost = options.PkgHost
+	}
+	return c
+}
+
+// Metadata is information about a build that's recorded in the loader (see Options.Metadata).
+type Metadata struct {
+	Toolchain string `json:"toolchain"`      // GopherJS version
+	Go        string `json:"go"`             // standard library version
+	Sha       string `json:"sha"`            // commit of the source, if known
+	Time      string `json:"time,omitempty"` // RFC3339 compile time, empty in reproducible builds
+}
+
+// Compiler compiles the package at path, which has been fetched into the session gopath, and stores
+// the output.
+type Compiler interface {
+	Compile(ctx context.Context, s *session.Session, path string, options Options) (map[bool]*deployer.DeployOutput, error)
+}
+
+// GopherJS compiles with GopherJS, using the precompiled standard library in the assets, and stores the
+// output with the deployer.
+type GopherJS struct{}
+
+func (GopherJS) Compile(ctx context.Context, s *session.Session, path string, options Options) (map[bool]*deployer.DeployOutput, error) {
+	send := options.Send
+	if send == nil {
+		send = func(services.Message) {}
+	}
+	if err := checkFiles(s.BuildContext(session.JsType, ""), path, options.MaxFiles); err != nil {
+		return nil, err
+	}
+	if options.Shake || len(options.Symbols) > 0 {
+		output, removed, err := shake(ctx, s, send, path, options)
+		if err != nil {
+			return nil, Explain(err)
+		}
+		if options.Removed != nil {
+			for min, n := range removed {
+				options.Removed[min] = n
+			}
+		}
+		return output, nil
+	}
+	output, err := deployer.New(s, send, std.Index, std.Prelude, deployerConfig(options)).Deploy(ctx, path, options.Index, options.Minify)
+	if err != nil {
+		// errors caused by unsupported Go features are explained
+		return nil, Explain(err)
+	}
+	if options.Global != "" || options.Metadata != nil {
+		if err := namespace(ctx, s, send, path, output, options); err != nil {
+			return nil, err
+		}
+	}
+	return output, nil
+}
+
+// Default is the compiler used when a handler isn't given one. Transient crashes are retried.
+var Default Compiler = Retry{Compiler: GopherJS{}, Retries: config.CompileRetries}
@@ -0,0 +1,41 @@
+package backend
+
+import (
+	"fmt"
+	"go/build"
+)
+
+// checkFiles returns an error if the output of compiling path would have more than max files: one per
+// package in the import graph (including the standard library), plus the prelude, the main package and
+// the index. It's checked before the deployer stores anything. Packages that can't be imported are
+// counted, and the error is reported by the compiler. Zero max is unlimited.
+func checkFiles(bctx *build.Context, path string, max int) error {
+	if max == 0 {
+		return nil
+	}
+	if count := countPackages(bctx, path) + 3; count > max {
+		return fmt.Errorf("the compile output would have at least %d files - the maximum is %d", count, max)
+	}
+	return nil
+}
+
+// countPackages returns the number of packages in the import graph of path, excluding path itself.
+func countPackages(bctx *build.Context, path string) int {
+	seen := map[string]bool{path: true}
+	queue := []string{path}
+	for len(queue) > 0 {
+		p, err := bctx.Import(queue[0], "", 0)
+		queue = queue[1:]
+		if err != nil {
+			continue
+		}
+		for _, imp := range p.Imports {
+			if seen[imp] || imp == "C" {
+				continue
+			}
+			seen[imp] = true
+			queue = append(queue, imp)
+		}
+	}
+	return len(seen) - 1
+}
@@ -0,0 +1,64 @@
+package backend
+
+import (
+	"go/build"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+func TestCheckFiles(t *testing.T) {
+	fs := memfs.New()
+	for name, contents := range map[string]string{
+		"gopath/src/example.com/a/a.go": "package main\n\nimport (\n\t\"fmt\"\n\t\"example.com/b\"\n)\n\nfunc main() { fmt.Println(b.B) }\n",
+		"gopath/src/example.com/b/b.go": "package b\n\nimport (\n\t\"fmt\"\n\t\"example.com/c\"\n)\n\nvar B = fmt.Sprint(c.C)\n",
+		"gopath/src/example.com/c/c.go": "package c\n\nvar C = 1\n",
+		"goroot/src/fmt/fmt.go":         "package fmt\n\nimport \"io\"\n\nvar _ io.Writer\n\nfunc Println(...interface{}) {}\n\nfunc Sprint(...interface{}) string { return \"\" }\n",
+		"goroot/src/io/io.go":           "package io\n\ntype Writer interface{}\n",
+	} {
+		f, err := fs.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(contents))
+		f.Close()
+	}
+	bctx := &build.Context{
+		GOARCH:   "js",
+		GOOS:     "darwin",
+		GOROOT:   "goroot",
+		GOPATH:   "gopath",
+		Compiler: "gc",
+		IsDir: func(path string) bool {
+			fi, err := fs.Stat(path)
+			return err == nil && fi.IsDir()
+		},
+		HasSubdir: func(root, dir string) (string, bool) {
+			root = filepath.Clean(root) + string(filepath.Separator)
+			if !strings.HasPrefix(filepath.Clean(dir), root) {
+				return "", false
+			}
+			return filepath.ToSlash(strings.TrimPrefix(filepath.Clean(dir), root)), true
+		},
+		ReadDir:  func(path string) ([]os.FileInfo, error) { return fs.ReadDir(path) },
+		OpenFile: func(path string) (io.ReadCloser, error) { return fs.Open(path) },
+	}
+
+	// b, c, fmt and io, plus the prelude, main package and index
+	if n := countPackages(bctx, "example.com/a"); n != 4 {
+		t.Fatalf("expected 4 packages, found %d", n)
+	}
+	if err := checkFiles(bctx, "example.com/a", 8); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkFiles(bctx, "example.com/a", 6); err == nil || !strings.Contains(err.Error(), "at least 7 files") {
+		t.Fatalf("expected too many files, found %v", err)
+	}
+	if err := checkFiles(bctx, "example.com/a", 0); err != nil {
+		t.Fatal(err)
+	}
+}
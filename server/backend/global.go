@@ -0,0 +1,38 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/services"
+	"github.com/dave/services/constor"
+	"github.com/dave/services/deployer"
+	"github.com/dave/services/session"
+)
+
+// namespace stores a loader for each output of the deployer with options.Global and options.Metadata
+// (see loaderJs), and changes the main hash of the output to the new loader. The package files and the
+// index page are unchanged.
+func namespace(ctx context.Context, s *session.Session, send func(services.Message), path string, output map[bool]*deployer.DeployOutput, options Options) error {
+	storer := constor.New(ctx, s.Fileserver, send, config.ConcurrentStorageUploads)
+	defer storer.Close()
+	for min, o := range output {
+		loader, mainHash, err := loaderJs(path, o.Packages, min, options)
+		if err != nil {
+			return err
+		}
+		storer.Add(constor.Item{
+			Message:   "Loader",
+			Name:      fmt.Sprintf("%s.%x.js", path, mainHash),
+			Contents:  loader,
+			Bucket:    config.DeployerConfig.PkgBucket,
+			Mime:      constor.MimeJs,
+			Count:     true,
+			Immutable: true,
+			Send:      true,
+		})
+		o.MainHash = mainHash
+	}
+	return storer.Wait()
+}
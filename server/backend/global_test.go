@@ -0,0 +1,61 @@
+package backend
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dave/services/builder"
+)
+
+func TestLoaderGlobal(t *testing.T) {
+	packages := []*builder.PackageOutput{{Path: "github.com/a/b", Hash: []byte{1, 2}}}
+	plain, plainHash, err := loaderJs("github.com/a/b", packages, true, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	global, globalHash, err := loaderJs("github.com/a/b", packages, true, Options{Global: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(plainHash, globalHash) {
+		t.Fatal("expected the global name to change the hash of the loader")
+	}
+	if strings.Contains(string(plain), "window[") || !strings.Contains(string(plain), "var $load = {};") {
+		t.Fatalf("unexpected default loader:\n%s", plain)
+	}
+	for _, s := range []string{`window["app"] = $mainPkg;`, "var $load = window.$load || {};", `"hash":"0102"`} {
+		if !strings.Contains(string(global), s) {
+			t.Fatalf("expected %q in the loader:\n%s", s, global)
+		}
+	}
+}
+
+func TestLoaderMetadata(t *testing.T) {
+	packages := []*builder.PackageOutput{{Path: "github.com/a/b", Hash: []byte{1, 2}}}
+	plain, plainHash, err := loaderJs("github.com/a/b", packages, true, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(plain), "jsgoBuilds") || !strings.HasPrefix(string(plain), "\"use strict\";\nvar $mainPkg;") {
+		t.Fatalf("unexpected default loader:\n%s", plain)
+	}
+	metadata := &Metadata{Toolchain: "1.11-2", Go: "go1.11", Sha: "abc", Time: "2018-11-03T18:53:06Z"}
+	loader, _, err := loaderJs("github.com/a/b", packages, true, Options{Metadata: metadata})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := fmt.Sprintf(`(window.jsgoBuilds = window.jsgoBuilds || []).push({"path":"github.com/a/b","build":"%x","toolchain":"1.11-2","go":"go1.11","sha":"abc","time":"2018-11-03T18:53:06Z"});`, plainHash)
+	if !strings.Contains(string(loader), expected) {
+		t.Fatalf("expected %q in the loader:\n%s", expected, loader)
+	}
+	metadata.Time = ""
+	loader, _, err = loaderJs("github.com/a/b", packages, true, Options{Metadata: metadata})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(loader), `"time"`) {
+		t.Fatalf("expected no time in the loader:\n%s", loader)
+	}
+}
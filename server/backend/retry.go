@@ -0,0 +1,67 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"strings"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/services/deployer"
+	"github.com/dave/services/session"
+)
+
+// Retry retries compiles that crash with a transient error. Panics in the wrapped compiler are recovered
+// and returned as a Crash. Errors returned by the compiler are deterministic (e.g. errors in the
+// source), so they're never retried.
+type Retry struct {
+	Compiler  Compiler
+	Retries   int              // Number of retries after the first attempt
+	Transient func(Crash) bool // If nil, crashes matching config.TransientCompilerErrors are transient
+}
+
+func (r Retry) Compile(ctx context.Context, s *session.Session, path string, options Options) (map[bool]*deployer.DeployOutput, error) {
+	transient := r.Transient
+	if transient == nil {
+		transient = Transient
+	}
+	for attempt := 0; ; attempt++ {
+		output, err := compileSafely(ctx, r.Compiler, s, path, options)
+		crash, ok := err.(Crash)
+		if !ok || !transient(crash) || attempt >= r.Retries || ctx.Err() != nil {
+			return output, err
+		}
+		log.Printf("Retrying compile of %s after transient compiler crash (attempt %d): %v", path, attempt+1, crash.Value)
+	}
+}
+
+// Crash is returned when the compiler panics.
+type Crash struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (c Crash) Error() string {
+	return fmt.Sprintf("compiler crashed: %v", c.Value)
+}
+
+// Transient returns true if the crash matches one of config.TransientCompilerErrors.
+func Transient(c Crash) bool {
+	message := fmt.Sprint(c.Value)
+	for _, s := range config.TransientCompilerErrors {
+		if strings.Contains(message, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func compileSafely(ctx context.Context, c Compiler, s *session.Session, path string, options Options) (output map[bool]*deployer.DeployOutput, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			output, err = nil, Crash{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return c.Compile(ctx, s, path, options)
+}
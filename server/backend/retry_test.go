@@ -0,0 +1,76 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/services/deployer"
+	"github.com/dave/services/session"
+)
+
+// flaky panics with the queued values, then succeeds.
+type flaky struct {
+	calls  int
+	panics []interface{}
+	err    error
+}
+
+func (f *flaky) Compile(ctx context.Context, s *session.Session, path string, options Options) (map[bool]*deployer.DeployOutput, error) {
+	f.calls++
+	if len(f.panics) > 0 {
+		p := f.panics[0]
+		f.panics = f.panics[1:]
+		panic(p)
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	return map[bool]*deployer.DeployOutput{true: {}}, nil
+}
+
+func TestRetry(t *testing.T) {
+	defer func(signatures []string) { config.TransientCompilerErrors = signatures }(config.TransientCompilerErrors)
+	config.TransientCompilerErrors = []string{"transient compiler bug"}
+	const transient = "transient compiler bug in a.go"
+	tests := []struct {
+		name    string
+		compile *flaky
+		retries int
+		calls   int
+		crash   bool
+	}{
+		{"success", &flaky{}, 1, 1, false},
+		{"transient once", &flaky{panics: []interface{}{transient}}, 1, 2, false},
+		{"transient twice", &flaky{panics: []interface{}{transient, transient}}, 1, 2, true},
+		{"transient twice, two retries", &flaky{panics: []interface{}{transient, transient}}, 2, 3, false},
+		{"not transient", &flaky{panics: []interface{}{"unsupported feature"}}, 1, 1, true},
+		{"nil pointer", &flaky{panics: []interface{}{"runtime error: invalid memory address or nil pointer dereference"}}, 1, 1, true},
+		{"source error", &flaky{err: errors.New("main.go:1:1: expected 'package'")}, 1, 1, false},
+	}
+	for _, test := range tests {
+		output, err := Retry{Compiler: test.compile, Retries: test.retries}.Compile(context.Background(), nil, "a", Options{})
+		if test.compile.calls != test.calls {
+			t.Errorf("%s: expected %d calls, found %d", test.name, test.calls, test.compile.calls)
+		}
+		_, crashed := err.(Crash)
+		if crashed != test.crash {
+			t.Errorf("%s: expected crash %v, found %v", test.name, test.crash, err)
+		}
+		if err == nil && output == nil {
+			t.Errorf("%s: expected output", test.name)
+		}
+	}
+}
+
+func TestRetryCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	defer func(signatures []string) { config.TransientCompilerErrors = signatures }(config.TransientCompilerErrors)
+	config.TransientCompilerErrors = []string{"transient compiler bug"}
+	f := &flaky{panics: []interface{}{"transient compiler bug"}}
+	if _, err := (Retry{Compiler: f, Retries: 3}).Compile(ctx, nil, "a", Options{}); err == nil || f.calls != 1 {
+		t.Fatalf("expected no retry after the deadline, found %d calls, %v", f.calls, err)
+	}
+}
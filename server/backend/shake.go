@@ -0,0 +1,403 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/dave/jsgo/assets/std"
+	"github.com/dave/jsgo/config"
+	"github.com/dave/services"
+	"github.com/dave/services/builder"
+	"github.com/dave/services/builder/buildermsg"
+	"github.com/dave/services/constor"
+	"github.com/dave/services/constor/constormsg"
+	"github.com/dave/services/deployer"
+	"github.com/dave/services/session"
+	"github.com/gopherjs/gopherjs/compiler"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+// shake compiles and stores path like the deployer, except each package file only has the
+// declarations that the program can reach (see selectDecls). The deployer keeps every declaration, so a
+// package file is shared by all the programs that import the package, and is often already in the
+// browser cache. Shaken files are specific to the program, so they're smaller but never shared. The
+// index page is only written at its hash. The number of bytes removed from each output is returned. If
+// options.Symbols is set, only the declarations the symbols need are kept (see selectSymbols).
+func shake(ctx context.Context, s *session.Session, send func(services.Message), path string, options Options) (map[bool]*deployer.DeployOutput, map[bool]int64, error) {
+	storer := constor.New(ctx, s.Fileserver, send, config.ConcurrentStorageUploads)
+	defer storer.Close()
+
+	send(buildermsg.Building{Starting: true})
+	send(constormsg.Storing{Starting: true})
+
+	outputs := map[bool]*deployer.DeployOutput{}
+	removed := map[bool]int64{}
+	for _, min := range []bool{true, false} {
+		if !options.Minify[min] {
+			continue
+		}
+		output, n, err := shakeOutput(ctx, s, send, storer, path, min, options)
+		if err != nil {
+			return nil, nil, err
+		}
+		outputs[min], removed[min] = output, n
+	}
+
+	send(buildermsg.Building{Done: true})
+	if err := storer.Wait(); err != nil {
+		return nil, nil, err
+	}
+	send(constormsg.Storing{Done: true})
+	return outputs, removed, nil
+}
+
+func shakeOutput(ctx context.Context, s *session.Session, send func(services.Message), storer *constor.Storer, path string, min bool, options Options) (*deployer.DeployOutput, int64, error) {
+	b := builder.New(s, &builder.Options{
+		Temporary:   memfs.New(),
+		Unvendor:    true,
+		Initializer: true,
+		Send:        send,
+		Verbose:     true,
+		Minify:      min,
+	})
+	data, archive, err := b.BuildImportPath(ctx, path)
+	if err != nil {
+		return nil, 0, err
+	}
+	// A bundle of symbols doesn't need a main function - it's a library for the page to call.
+	if archive.Name != "main" && len(options.Symbols) == 0 {
+		return nil, 0, fmt.Errorf("can't compile - %s is not a main package", path)
+	}
+	deps, err := b.GetDependencies(ctx, archive)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	selection, err := selectSymbols(deps, archive, options.Symbols)
+	if err != nil {
+		return nil, 0, err
+	}
+	var removed int64
+	var packages []*builder.PackageOutput
+	for _, pkg := range deps {
+		contents, hash, err := packageCode(pkg, selection, min)
+		if err != nil {
+			return nil, 0, err
+		}
+		full, _, err := builder.GetPackageCode(ctx, pkg, min, true)
+		if err != nil {
+			return nil, 0, err
+		}
+		removed += int64(len(full) - len(contents))
+		_, standard := std.Index[pkg.ImportPath]
+		packages = append(packages, &builder.PackageOutput{
+			Path:     pkg.ImportPath,
+			Hash:     hash,
+			Contents: contents,
+			Standard: standard,
+			Store:    true,
+		})
+		storer.Add(constor.Item{
+			Message:   pkg.ImportPath,
+			Name:      fmt.Sprintf("%s.%x.js", pkg.ImportPath, hash),
+			Contents:  contents,
+			Bucket:    config.DeployerConfig.PkgBucket,
+			Mime:      constor.MimeJs,
+			Count:     true,
+			Immutable: true,
+			Send:      true,
+		})
+	}
+
+	send(buildermsg.Building{Message: "Loader"})
+	loader, mainHash, err := loaderJs(path, packages, min, options)
+	if err != nil {
+		return nil, 0, err
+	}
+	storer.Add(constor.Item{
+		Message:   "Loader",
+		Name:      fmt.Sprintf("%s.%x.js", path, mainHash),
+		Contents:  loader,
+		Bucket:    config.DeployerConfig.PkgBucket,
+		Mime:      constor.MimeJs,
+		Count:     true,
+		Immutable: true,
+		Send:      true,
+	})
+
+	send(buildermsg.Building{Message: "Index"})
+	index, indexHash, err := shakenIndex(s, data.Dir, path, mainHash, options)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, name := range []string{fmt.Sprintf("%x", indexHash), fmt.Sprintf("%x/index.html", indexHash)} {
+		storer.Add(constor.Item{
+			Message:   "Index",
+			Name:      name,
+			Contents:  index,
+			Bucket:    config.DeployerConfig.IndexBucket,
+			Mime:      constor.MimeHtml,
+			Count:     true,
+			Immutable: true,
+			Send:      true,
+		})
+	}
+
+	return &deployer.DeployOutput{
+		CommandOutput: &builder.CommandOutput{Path: path, Packages: packages},
+		MainHash:      mainHash,
+		IndexHash:     indexHash,
+	}, removed, nil
+}
+
+// selectDecls returns the declarations of the program that are reachable, the same way GopherJS does
+// for a single file build: declarations without a filter (package initialization, and variables that
+// may have side effects) are always kept, and the others are kept when a kept declaration depends on
+// them. roots are the full names (import/path.Name) of extra objects to keep, with the declarations they
+// depend on.
+func selectDecls(pkgs []*compiler.Archive, roots ...string) map[*compiler.Decl]struct{} {
+	type pending struct {
+		decl                 *compiler.Decl
+		objectFilter, method string
+	}
+	byFilter := map[string][]*pending{}
+	var queue []*compiler.Decl
+	for _, pkg := range pkgs {
+		for _, d := range pkg.Declarations {
+			if d.DceObjectFilter == "" && d.DceMethodFilter == "" {
+				queue = append(queue, d)
+				continue
+			}
+			p := &pending{decl: d}
+			if d.DceObjectFilter != "" {
+				p.objectFilter = pkg.ImportPath + "." + d.DceObjectFilter
+				byFilter[p.objectFilter] = append(byFilter[p.objectFilter], p)
+			}
+			if d.DceMethodFilter != "" {
+				p.method = pkg.ImportPath + "." + d.DceMethodFilter
+				byFilter[p.method] = append(byFilter[p.method], p)
+			}
+		}
+	}
+
+	// The roots are used as if a kept declaration depended on them.
+	if len(roots) > 0 {
+		queue = append(queue, &compiler.Decl{DceDeps: roots})
+	}
+
+	selection := map[*compiler.Decl]struct{}{}
+	for len(queue) > 0 {
+		d := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		selection[d] = struct{}{}
+		for _, dep := range d.DceDeps {
+			waiting, ok := byFilter[dep]
+			if !ok {
+				continue
+			}
+			delete(byFilter, dep)
+			for _, p := range waiting {
+				if p.objectFilter == dep {
+					p.objectFilter = ""
+				}
+				if p.method == dep {
+					p.method = ""
+				}
+				if p.objectFilter == "" && p.method == "" {
+					queue = append(queue, p.decl)
+				}
+			}
+		}
+	}
+	return selection
+}
+
+// selectSymbols returns the declarations to keep for a bundle of symbols, the exported objects of pkg
+// that the page will call (see Options.Symbols). Only the declarations the symbols need are kept, as
+// well as package initialization, so the bundle is like a shaken build of a program that only uses the
+// symbols. All the reachable declarations are kept if there are no symbols. An error is returned if
+// pkg doesn't have one of the symbols.
+func selectSymbols(pkgs []*compiler.Archive, pkg *compiler.Archive, symbols []string) (map[*compiler.Decl]struct{}, error) {
+	objects := map[string]bool{}
+	for _, d := range pkg.Declarations {
+		if d.DceObjectFilter != "" && d.DceMethodFilter == "" {
+			objects[d.DceObjectFilter] = true
+		}
+	}
+	var roots []string
+	for _, symbol := range symbols {
+		if !ast.IsExported(symbol) || !objects[symbol] {
+			return nil, fmt.Errorf("%s isn't an exported function, type or variable of %s", symbol, pkg.ImportPath)
+		}
+		roots = append(roots, pkg.ImportPath+"."+symbol)
+	}
+	return selectDecls(pkgs, roots...), nil
+}
+
+// packageCode returns the code of a package file with the selected declarations, wrapped in the
+// initializer like builder.GetPackageCode, and its hash.
+func packageCode(archive *compiler.Archive, selection map[*compiler.Decl]struct{}, minify bool) ([]byte, []byte, error) {
+	buf := &bytes.Buffer{}
+	if minify {
+		fmt.Fprintf(buf, `$load["%s"]=function(){`, archive.ImportPath)
+	} else {
+		fmt.Fprintf(buf, "$load[\"%s\"] = function () {\n", archive.ImportPath)
+	}
+	if err := compiler.WritePkgCode(archive, selection, minify, &compiler.SourceMapFilter{Writer: buf}); err != nil {
+		return nil, nil, err
+	}
+	if minify {
+		// WritePkgCode always finishes with a new line
+		buf.Truncate(buf.Len() - 1)
+	}
+	buf.WriteString("};")
+	hash := sha1.Sum(buf.Bytes())
+	return buf.Bytes(), hash[:], nil
+}
+
+// loaderJs returns the loader JS, which loads the prelude and the package files, and its hash. If
+// options.Global is set, the main package is attached to window[Global] when it has loaded. If
+// options.Metadata is set, it's recorded in window.jsgoBuilds with the build id, which is the hash of
+// the same loader without the metadata.
+func loaderJs(path string, packages []*builder.PackageOutput, min bool, options Options) ([]byte, []byte, error) {
+	type pkgJson struct {
+		Path string `json:"path"`
+		Hash string `json:"hash"`
+	}
+	pkgs := []pkgJson{{Path: "prelude", Hash: std.Prelude[min]}}
+	for _, p := range packages {
+		pkgs = append(pkgs, pkgJson{Path: p.Path, Hash: fmt.Sprintf("%x", p.Hash)})
+	}
+	info, err := json.Marshal(pkgs)
+	if err != nil {
+		return nil, nil, err
+	}
+	var metadata []byte
+	if options.Metadata != nil {
+		plain := options
+		plain.Metadata = nil
+		_, buildHash, err := loaderJs(path, packages, min, plain)
+		if err != nil {
+			return nil, nil, err
+		}
+		metadata, err = json.Marshal(struct {
+			Path  string `json:"path"`
+			Build string `json:"build"`
+			*Metadata
+		}{path, fmt.Sprintf("%x", buildHash), options.Metadata})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := loaderTemplate.Execute(buf, struct {
+		Path, Json, PkgProtocol, PkgHost, Global, Metadata string
+	}{path, string(info), config.DeployerConfig.PkgProtocol, deployerConfig(options).PkgHost, options.Global, string(metadata)}); err != nil {
+		return nil, nil, err
+	}
+	hash := sha1.Sum(buf.Bytes())
+	return buf.Bytes(), hash[:], nil
+}
+
+// loaderTemplate is the deployer's loader. With a global, the package files loaded by other bundles on
+// the page are kept, and the main package is attached to the global. Metadata is appended to
+// window.jsgoBuilds before anything loads.
+var loaderTemplate = template.Must(template.New("loader").Parse(`"use strict";
+{{ if .Metadata }}(window.jsgoBuilds = window.jsgoBuilds || []).push({{ .Metadata }});
+{{ end -}}
+var $mainPkg;
+{{ if .Global }}var $load = window.$load || {};{{ else }}var $load = {};{{ end }}
+(function(){
+	var count = 0;
+	var total = 0;
+	var info = {{ .Json }};
+	var finished = function() {
+		for (var i = 0; i < info.length; i++) {
+			$load[info[i].path]();
+		}
+		$mainPkg = $packages["{{ .Path }}"];{{ if .Global }}
+		window["{{ .Global }}"] = $mainPkg;{{ end }}
+		$synthesizeMethods();
+		$packages["runtime"].$init();
+		$go($mainPkg.$init, []);
+		$flushConsole();
+	};
+	var done = function() {
+		count++;
+		if (window.jsgoProgress) { window.jsgoProgress(count, total); }
+		if (count == total) { finished(); }
+	};
+	var get = function(url) {
+		total++;
+		var tag = document.createElement("script");
+		tag.src = url;
+		tag.onload = done;
+		tag.onreadystatechange = done;
+		document.head.appendChild(tag);
+	};
+	for (var i = 0; i < info.length; i++) {
+		get("{{ .PkgProtocol }}://{{ .PkgHost }}/" + info[i].path + "." + info[i].hash + ".js");
+	}
+})();`))
+
+// shakenIndex returns the index page and its hash. Like the deployer, the page is rendered from
+// index.jsgo.html in the package directory if there is one.
+func shakenIndex(s *session.Session, dir, path string, mainHash []byte, options Options) ([]byte, []byte, error) {
+	tpl := shakenIndexTemplate
+	fs := s.Filesystem(dir)
+	f, err := fs.Open(filepath.Join(dir, "index.jsgo.html"))
+	if err == nil {
+		b, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		if tpl, err = template.New("index").Parse(string(b)); err != nil {
+			return nil, nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	buf := &bytes.Buffer{}
+	sha := sha1.New()
+	if err := tpl.Execute(io.MultiWriter(buf, sha), struct {
+		Path, Hash, Script string
+	}{
+		Path:   path,
+		Hash:   fmt.Sprintf("%x", mainHash),
+		Script: fmt.Sprintf("%s://%s/%s.%x.js", config.DeployerConfig.PkgProtocol, deployerConfig(options).PkgHost, path, mainHash),
+	}); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), sha.Sum(nil), nil
+}
+
+var shakenIndexTemplate = template.Must(template.New("index").Parse(`
+<html>
+	<head>
+		<meta charset="utf-8">
+	</head>
+	<body id="wrapper">
+		<span id="jsgo-progress-span"></span>
+		<script>
+			window.jsgoProgress = function(count, total) {
+				if (count === total) {
+					document.getElementById("jsgo-progress-span").style.display = "none";
+				} else {
+					document.getElementById("jsgo-progress-span").innerHTML = count + "/" + total;
+				}
+			}
+		</script>
+		<script src="{{ .Script }}"></script>
+	</body>
+</html>
+`))
@@ -0,0 +1,98 @@
+package backend
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gopherjs/gopherjs/compiler"
+)
+
+func TestSelectDecls(t *testing.T) {
+	initializer := &compiler.Decl{FullName: "init", DceDeps: []string{"a.T", "b.F"}}
+	typ := &compiler.Decl{FullName: "T", DceObjectFilter: "T"}
+	method := &compiler.Decl{FullName: "T.M", DceObjectFilter: "T", DceMethodFilter: "M~"}
+	called := &compiler.Decl{FullName: "F", DceObjectFilter: "F", DceDeps: []string{"b.G"}}
+	indirect := &compiler.Decl{FullName: "G", DceObjectFilter: "G"}
+	unused := &compiler.Decl{FullName: "H", DceObjectFilter: "H"}
+	sideEffect := &compiler.Decl{FullName: "x"}
+	selection := selectDecls([]*compiler.Archive{
+		{ImportPath: "b", Declarations: []*compiler.Decl{called, indirect, unused, sideEffect}},
+		{ImportPath: "a", Declarations: []*compiler.Decl{initializer, typ, method}},
+	})
+	for _, d := range []*compiler.Decl{initializer, typ, called, indirect, sideEffect} {
+		if _, ok := selection[d]; !ok {
+			t.Errorf("expected %s to be kept", d.FullName)
+		}
+	}
+	// the method is only kept if the type and the method name are both used
+	for _, d := range []*compiler.Decl{method, unused} {
+		if _, ok := selection[d]; ok {
+			t.Errorf("expected %s to be removed", d.FullName)
+		}
+	}
+}
+
+func TestSelectSymbols(t *testing.T) {
+	init := &compiler.Decl{FullName: "init", DceDeps: []string{"b.G"}}
+	small := &compiler.Decl{FullName: "F", DceObjectFilter: "F", DeclCode: []byte("F;"), DceDeps: []string{"b.G"}}
+	large := &compiler.Decl{FullName: "H", DceObjectFilter: "H", DeclCode: []byte(strings.Repeat("H;", 100)), DceDeps: []string{"b.I"}}
+	typ := &compiler.Decl{FullName: "T", DceObjectFilter: "T", DeclCode: []byte("T;")}
+	method := &compiler.Decl{FullName: "T.M", DceObjectFilter: "T", DeclCode: []byte("T.M;")}
+	unexported := &compiler.Decl{FullName: "u", DceObjectFilter: "u", DeclCode: []byte("u;")}
+	g := &compiler.Decl{FullName: "G", DceObjectFilter: "G", DeclCode: []byte("G;")}
+	i := &compiler.Decl{FullName: "I", DceObjectFilter: "I", DeclCode: []byte(strings.Repeat("I;", 100))}
+	b := &compiler.Archive{ImportPath: "b", Declarations: []*compiler.Decl{g, i}}
+	a := &compiler.Archive{ImportPath: "a", Name: "a", Declarations: []*compiler.Decl{init, small, large, typ, method, unexported}}
+	pkgs := []*compiler.Archive{b, a}
+
+	size := func(selection map[*compiler.Decl]struct{}) int {
+		var n int
+		for _, pkg := range pkgs {
+			code, _, err := packageCode(pkg, selection, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			n += len(code)
+		}
+		return n
+	}
+	all := map[*compiler.Decl]struct{}{}
+	for _, pkg := range pkgs {
+		for _, d := range pkg.Declarations {
+			all[d] = struct{}{}
+		}
+	}
+
+	selection, err := selectSymbols(pkgs, a, []string{"F"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []*compiler.Decl{init, small, g} {
+		if _, ok := selection[d]; !ok {
+			t.Errorf("expected %s to be kept", d.FullName)
+		}
+	}
+	for _, d := range []*compiler.Decl{large, typ, method, unexported, i} {
+		if _, ok := selection[d]; ok {
+			t.Errorf("expected %s to be removed", d.FullName)
+		}
+	}
+	if size(selection) >= size(all) {
+		t.Fatalf("expected the bundle of F to be smaller than the full build, found %d and %d", size(selection), size(all))
+	}
+
+	// A type is kept with its exported methods.
+	selection, err = selectSymbols(pkgs, a, []string{"T"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := selection[method]; !ok {
+		t.Error("expected the method of T to be kept")
+	}
+
+	for _, symbol := range []string{"Missing", "u"} {
+		if _, err := selectSymbols(pkgs, a, []string{symbol}); err == nil || !strings.Contains(err.Error(), symbol+" isn't an exported function, type or variable of a") {
+			t.Errorf("%s: expected a clear error, found %v", symbol, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package backend
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Unsupported maps the signatures of compiler errors caused by Go features that GopherJS doesn't
+// support to an explanation. Add entries here to recognize more errors.
+var Unsupported = []UnsupportedFeature{
+	{
+		Signature:  regexp.MustCompile(`importing "C" is not supported`),
+		Feature:    "cgo",
+		Workaround: `use a pure Go alternative, or exclude the cgo files with a "// +build !js" constraint`,
+	},
+	{
+		Signature:  regexp.MustCompile(`missing function body`),
+		Feature:    "functions implemented in assembly",
+		Workaround: `provide a pure Go implementation for the js build tag - many packages have one behind the "purego" or "appengine" tags`,
+	},
+	{
+		Signature:  regexp.MustCompile(`native function not implemented`),
+		Feature:    "native functions",
+		Workaround: "provide a pure Go implementation for the js build tag",
+	},
+	{
+		Signature:  regexp.MustCompile(`cannot use js\.Object as map key`),
+		Feature:    "js.Object map keys",
+		Workaround: "key the map by a string or number instead",
+	},
+	{
+		Signature:  regexp.MustCompile(`(cannot find package|could not import) "?syscall/js`),
+		Feature:    "syscall/js",
+		Workaround: "syscall/js is only available when compiling to WebAssembly - use the wasm target, or github.com/gopherjs/gopherjs/js",
+	},
+	{
+		Signature:  regexp.MustCompile(`(cannot find package|could not import) "?(plugin|runtime/cgo)\b`),
+		Feature:    "plugins and runtime/cgo",
+		Workaround: "these packages aren't available in the browser, so exclude the files that import them from the js build",
+	},
+}
+
+// UnsupportedFeature describes a Go feature that GopherJS doesn't support.
+type UnsupportedFeature struct {
+	Signature  *regexp.Regexp // matches the compiler error
+	Feature    string
+	Workaround string // optional
+}
+
+// UnsupportedError is a compile error caused by an unsupported feature. Raw is the compiler output.
+type UnsupportedError struct {
+	UnsupportedFeature
+	Line string // the line of the compiler output that matched, usually with the position
+	Raw  string
+}
+
+func (e UnsupportedError) Error() string {
+	message := fmt.Sprintf("GopherJS doesn't support %s (%s)", e.Feature, e.Line)
+	if e.Workaround != "" {
+		message += " - " + e.Workaround
+	}
+	return message
+}
+
+// Explain returns an UnsupportedError if err matches one of the Unsupported signatures, and err
+// otherwise.
+func Explain(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(UnsupportedError); ok {
+		return err
+	}
+	raw := err.Error()
+	for _, f := range Unsupported {
+		for _, line := range strings.Split(raw, "\n") {
+			if f.Signature.MatchString(line) {
+				return UnsupportedError{UnsupportedFeature: f, Line: strings.TrimSpace(line), Raw: raw}
+			}
+		}
+	}
+	return err
+}
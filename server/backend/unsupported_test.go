@@ -0,0 +1,40 @@
+package backend
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	tests := []struct {
+		raw, feature string
+	}{
+		{"github.com/a/b/sum.go:10:6: missing function body", "functions implemented in assembly"},
+		{`github.com/a/b: importing "C" is not supported by GopherJS`, "cgo"},
+		{"github.com/a/b/b.go:5:9: cannot use js.Object as map key", "js.Object map keys"},
+		{"errors:\n" + `b.go:3:8: could not import syscall/js (cannot find package "syscall/js")`, "syscall/js"},
+		{`cannot find package "plugin" in any of:`, "plugins and runtime/cgo"},
+		{"b.go:1:1: undefined: foo", ""},
+	}
+	for _, test := range tests {
+		err := Explain(errors.New(test.raw))
+		u, ok := err.(UnsupportedError)
+		if test.feature == "" {
+			if ok {
+				t.Errorf("%q: expected error to be unchanged, found %v", test.raw, err)
+			}
+			continue
+		}
+		if !ok || u.Feature != test.feature || u.Raw != test.raw {
+			t.Errorf("%q: expected %s, found %#v", test.raw, test.feature, err)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), "GopherJS doesn't support "+test.feature) {
+			t.Errorf("%q: unexpected message %q", test.raw, err.Error())
+		}
+	}
+	if Explain(nil) != nil {
+		t.Error("expected nil")
+	}
+}
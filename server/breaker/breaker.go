@@ -0,0 +1,159 @@
+// Package breaker is a circuit breaker for upstream hosts. After too many failures within a window the
+// breaker for a host opens, and requests fail fast until a cooldown period has passed. The breaker then
+// half-opens, and lets a single request through to test whether the host has recovered.
+package breaker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// UnavailableError is returned by Allow when requests to the host should fail fast.
+type UnavailableError struct {
+	Host string
+}
+
+func (e UnavailableError) Error() string {
+	return fmt.Sprintf("upstream %s unavailable - please try again later", e.Host)
+}
+
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+type Breaker struct {
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+	now       func() time.Time
+
+	m     sync.Mutex
+	hosts map[string]*host
+}
+
+type host struct {
+	state    State
+	failures []time.Time // within the window, while closed
+	opened   time.Time
+	trial    bool // a half-open trial request is in progress
+}
+
+// New creates a breaker that opens after threshold failures within window, and half-opens after
+// cooldown.
+func New(threshold int, window, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		threshold: threshold,
+		window:    window,
+		cooldown:  cooldown,
+		now:       time.Now,
+		hosts:     map[string]*host{},
+	}
+}
+
+// Allow returns an error if requests to host should fail fast. If it returns nil, the caller must
+// report the outcome with Done.
+func (b *Breaker) Allow(name string) error {
+	b.m.Lock()
+	defer b.m.Unlock()
+	h := b.host(name)
+	if h.state == Open && b.now().Sub(h.opened) >= b.cooldown {
+		h.state = HalfOpen
+	}
+	switch h.state {
+	case Open:
+		return UnavailableError{Host: name}
+	case HalfOpen:
+		if h.trial {
+			return UnavailableError{Host: name}
+		}
+		h.trial = true
+	}
+	return nil
+}
+
+// Done reports the outcome of a request that was allowed.
+func (b *Breaker) Done(name string, success bool) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	h := b.host(name)
+	now := b.now()
+	switch h.state {
+	case HalfOpen:
+		h.trial = false
+		if success {
+			h.state = Closed
+			h.failures = nil
+		} else {
+			h.state = Open
+			h.opened = now
+		}
+	case Closed:
+		if success {
+			return
+		}
+		b.fail(h, now)
+	}
+}
+
+// Failed reports a failure of host outside a request allowed by Allow (e.g. a dependency fetched from
+// another host). It only counts towards opening a closed breaker.
+func (b *Breaker) Failed(name string) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	if h := b.host(name); h.state == Closed {
+		b.fail(h, b.now())
+	}
+}
+
+// fail records a failure of a closed host, and opens it if there are too many within the window.
+func (b *Breaker) fail(h *host, now time.Time) {
+	var recent []time.Time
+	for _, t := range h.failures {
+		if now.Sub(t) < b.window {
+			recent = append(recent, t)
+		}
+	}
+	h.failures = append(recent, now)
+	if len(h.failures) >= b.threshold {
+		h.state = Open
+		h.opened = now
+		h.failures = nil
+	}
+}
+
+// State returns the state of the breaker for host.
+func (b *Breaker) State(name string) State {
+	b.m.Lock()
+	defer b.m.Unlock()
+	h := b.host(name)
+	if h.state == Open && b.now().Sub(h.opened) >= b.cooldown {
+		return HalfOpen
+	}
+	return h.state
+}
+
+func (b *Breaker) host(name string) *host {
+	h, ok := b.hosts[name]
+	if !ok {
+		h = &host{}
+		b.hosts[name] = h
+	}
+	return h
+}
@@ -0,0 +1,82 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := New(3, time.Minute, time.Minute*5)
+	b.now = func() time.Time { return now }
+
+	fail := func() {
+		if err := b.Allow("github.com"); err != nil {
+			t.Fatal(err)
+		}
+		b.Done("github.com", false)
+	}
+	expect := func(expected State) {
+		t.Helper()
+		if found := b.State("github.com"); found != expected {
+			t.Fatalf("expected %s, found %s", expected, found)
+		}
+	}
+
+	// Failures outside the window don't count.
+	fail()
+	fail()
+	now = now.Add(time.Minute * 2)
+	fail()
+	expect(Closed)
+
+	fail()
+	fail()
+	expect(Open)
+	if b.Allow("github.com") == nil {
+		t.Fatal("expected open breaker to fail fast")
+	}
+	if b.Allow("gitlab.com") != nil {
+		t.Fatal("expected other hosts to be unaffected")
+	}
+
+	// After the cooldown one trial request is allowed. It fails, so the breaker opens again.
+	now = now.Add(time.Minute * 5)
+	expect(HalfOpen)
+	fail()
+	expect(Open)
+
+	// The next trial succeeds, so the breaker closes.
+	now = now.Add(time.Minute * 5)
+	if err := b.Allow("github.com"); err != nil {
+		t.Fatal(err)
+	}
+	if b.Allow("github.com") == nil {
+		t.Fatal("expected only one trial request")
+	}
+	b.Done("github.com", true)
+	expect(Closed)
+}
+
+func TestBreakerFailed(t *testing.T) {
+	now := time.Now()
+	b := New(2, time.Minute, time.Minute*5)
+	b.now = func() time.Time { return now }
+
+	b.Failed("gitlab.com")
+	b.Failed("gitlab.com")
+	if found := b.State("gitlab.com"); found != Open {
+		t.Fatalf("expected open, found %s", found)
+	}
+
+	// a failure outside a request doesn't end a trial
+	now = now.Add(time.Minute * 5)
+	if err := b.Allow("gitlab.com"); err != nil {
+		t.Fatal(err)
+	}
+	b.Failed("gitlab.com")
+	b.Done("gitlab.com", true)
+	if found := b.State("gitlab.com"); found != Closed {
+		t.Fatalf("expected closed, found %s", found)
+	}
+}
@@ -0,0 +1,93 @@
+// Package cdn purges mutable urls (e.g. the index page of a package, which changes every time it's
+// compiled) from the CDN in front of the buckets. Content addressed files never change, so they are
+// never purged.
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/dave/jsgo/config"
+)
+
+// Purger removes urls from the CDN cache.
+type Purger interface {
+	Purge(ctx context.Context, urls []string) error
+}
+
+// Default is the purger for config.CdnProvider. It does nothing if there's no provider or the
+// credentials aren't set.
+var Default = New(config.CdnProvider)
+
+// New returns the purger for a provider.
+func New(provider string) Purger {
+	switch provider {
+	case config.CdnCloudflare:
+		zone, token := os.Getenv(config.CdnZoneEnv), os.Getenv(config.CdnTokenEnv)
+		if zone == "" || token == "" {
+			return none{}
+		}
+		return &Cloudflare{
+			Url:   fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/purge_cache", zone),
+			Token: token,
+		}
+	}
+	return none{}
+}
+
+type none struct{}
+
+func (none) Purge(ctx context.Context, urls []string) error {
+	return nil
+}
+
+// Cloudflare purges urls with the Cloudflare API.
+type Cloudflare struct {
+	Url   string // the purge_cache endpoint of the zone
+	Token string // API token with cache purge permission
+}
+
+func (c *Cloudflare) Purge(ctx context.Context, urls []string) error {
+	if len(urls) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(struct {
+		Files []string `json:"files"`
+	}{urls})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", c.Url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Success bool `json:"success"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, &result); err != nil || !result.Success {
+		if len(result.Errors) > 0 {
+			return fmt.Errorf("purging %d urls: %s", len(urls), result.Errors[0].Message)
+		}
+		return fmt.Errorf("purging %d urls: status %d", len(urls), resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package cdn
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCloudflare(t *testing.T) {
+	var files []string
+	var auth string
+	fail := false
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body struct{ Files []string }
+		json.NewDecoder(req.Body).Decode(&body)
+		files, auth = body.Files, req.Header.Get("Authorization")
+		if fail {
+			w.WriteHeader(400)
+			w.Write([]byte(`{"success":false,"errors":[{"message":"bad zone"}]}`))
+			return
+		}
+		w.Write([]byte(`{"success":true}`))
+	}))
+	defer s.Close()
+
+	c := &Cloudflare{Url: s.URL, Token: "t"}
+	if err := c.Purge(context.Background(), []string{"https://jsgo.io/a/b"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != "https://jsgo.io/a/b" || auth != "Bearer t" {
+		t.Fatalf("unexpected request: %v, %q", files, auth)
+	}
+
+	fail = true
+	if err := c.Purge(context.Background(), []string{"https://jsgo.io/a/b"}); err == nil || err.Error() != "purging 1 urls: bad zone" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := New("").(none); !ok {
+		t.Fatal("expected no-op purger without a provider")
+	}
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"text/template"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/store"
+)
+
+// splitFiles combines the package files of a compile into one file for the runtime chunk and one for
+// the package chunk (see chunk), and generates a loader that loads the two chunks instead of the
+// individual files. The chunk files are named by the hash of their contents, so a runtime chunk is
+// shared by every package compiled with the same runtime, and is reused from the browser cache. The
+// files are stored in the pkg bucket and returned in load order, with the loader last.
+func (h *Handler) splitFiles(ctx context.Context, path string, contents store.CompileContents) ([]ManifestFile, error) {
+	files := make([][]byte, len(contents.Packages))
+	var wg sync.WaitGroup
+	var m sync.Mutex
+	var outer error
+	sem := make(chan struct{}, config.ConcurrentStorageUploads)
+	for i, p := range contents.Packages {
+		i, name := i, fmt.Sprintf("%s.%s.js", p.Path, p.Hash)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			b, err := h.readPkg(ctx, name)
+			if err != nil {
+				m.Lock()
+				outer = err
+				m.Unlock()
+				return
+			}
+			files[i] = b
+		}()
+	}
+	wg.Wait()
+	if outer != nil {
+		return nil, outer
+	}
+
+	// Each package file only defines a function in $load, so the order within a chunk doesn't matter,
+	// but the loader runs them in the original order.
+	chunks := map[string]*bytes.Buffer{RuntimeChunk: {}, PackageChunk: {}}
+	var order []string
+	for i, p := range contents.Packages {
+		chunks[chunk(p.Path, p.Standard)].Write(files[i])
+		order = append(order, p.Path)
+	}
+
+	var manifest []ManifestFile
+	var urls []string
+	for _, c := range []string{RuntimeChunk, PackageChunk} {
+		b := chunks[c].Bytes()
+		if len(b) == 0 {
+			continue
+		}
+		name := fmt.Sprintf("%s/%x.js", config.ChunkDir, sha1.Sum(b))
+		if err := h.storePkg(ctx, name, b); err != nil {
+			return nil, err
+		}
+		file := h.manifestEntry(name, b)
+		file.Chunk = c
+		manifest = append(manifest, file)
+		urls = append(urls, file.Url)
+	}
+
+	loader, err := chunkLoader(path, urls, order)
+	if err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%s.%s.split.js", path, contents.Main)
+	if err := h.storePkg(ctx, name, loader); err != nil {
+		return nil, err
+	}
+	file := h.manifestEntry(name, loader)
+	file.Chunk = PackageChunk
+	return append(manifest, file), nil
+}
+
+// storePkg writes an immutable JS file to the pkg bucket, unless it already exists.
+func (h *Handler) storePkg(ctx context.Context, name string, b []byte) error {
+	_, err := h.Fileserver.Write(ctx, config.Bucket[config.Pkg], name, bytes.NewReader(b), false, "text/javascript", "public,max-age=31536000,immutable")
+	return err
+}
+
+// chunkLoader returns a loader JS that loads the chunk urls, and then runs the packages in order and
+// starts the package at path, like the loader generated by the deployer.
+func chunkLoader(path string, urls, order []string) ([]byte, error) {
+	urlsJson, err := json.Marshal(urls)
+	if err != nil {
+		return nil, err
+	}
+	orderJson, err := json.Marshal(order)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	if err := chunkLoaderTemplate.Execute(buf, struct {
+		Path        string
+		Urls, Order string
+	}{path, string(urlsJson), string(orderJson)}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var chunkLoaderTemplate = template.Must(template.New("loader").Parse(`"use strict";
+var $mainPkg;
+var $load = {};
+(function(){
+	var count = 0;
+	var urls = {{ .Urls }};
+	var order = {{ .Order }};
+	var loaded = function() {
+		count++;
+		if (window.jsgoProgress) {
+			window.jsgoProgress(count, urls.length);
+		}
+		if (count < urls.length) {
+			return;
+		}
+		for (var i = 0; i < order.length; i++) {
+			$load[order[i]]();
+		}
+		$mainPkg = $packages["{{ .Path }}"];
+		$synthesizeMethods();
+		$packages["runtime"].$init();
+		$go($mainPkg.$init, []);
+		$flushConsole();
+	};
+	for (var i = 0; i < urls.length; i++) {
+		var script = document.createElement("script");
+		script.src = urls[i];
+		script.onload = loaded;
+		document.head.appendChild(script);
+	}
+})();
+`))
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/cleanup"
+	"github.com/dave/jsgo/server/tenant"
+	"github.com/dave/services"
+)
+
+// runCleanup deletes the files of expired builds every config.CleanupInterval (see cleanupAll), until
+// the server shuts down.
+func (h *Handler) runCleanup(shutdown chan struct{}) {
+	ticker := time.NewTicker(config.CleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), config.CleanupInterval)
+			cleanupAll(ctx, h.Fileserver, h.Database, time.Now())
+			cancel()
+		case <-shutdown:
+			return
+		}
+	}
+}
+
+// cleanupAll deletes the files of expired builds in the common namespace and in the namespace of each
+// tenant (see cleanup.Run and tenant.Each), and logs the outcome of each.
+func cleanupAll(ctx context.Context, fileserver services.Fileserver, database services.Database, now time.Time) {
+	err := tenant.Each(fileserver, database, func(namespace string, fileserver services.Fileserver, database services.Database) error {
+		prefix := "cleanup"
+		if namespace != "" {
+			prefix = fmt.Sprintf("cleanup (%s)", namespace)
+		}
+		summary, err := cleanup.Run(ctx, fileserver, database, now)
+		if err != nil {
+			fmt.Printf("%s: %v\n", prefix, err)
+		}
+		fmt.Printf("%s: %s\n", prefix, summary)
+		for _, e := range summary.Errors {
+			fmt.Printf("%s: %s\n", prefix, e)
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		fmt.Printf("cleanup: %v\n", err)
+	}
+}
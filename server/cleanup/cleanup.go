@@ -0,0 +1,158 @@
+// Package cleanup deletes the files of expired builds from the pkg bucket. Each build records when it
+// expires (see store.BuildData.Expires), which depends on the type of the build (see config.TtlPinned),
+// so pinned releases are kept longer than gists.
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dave/jsgo/assets/std"
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/store"
+	"github.com/dave/services"
+)
+
+// Deleter is implemented by fileservers that can delete files. A fileserver that wraps another has
+// Delete whether or not the wrapped one can delete, so CanDelete says whether it can.
+type Deleter interface {
+	Delete(ctx context.Context, bucket, name string) error
+	CanDelete() bool
+}
+
+// CanDelete returns true if fileserver can delete files.
+func CanDelete(fileserver services.Fileserver) bool {
+	d, ok := fileserver.(Deleter)
+	return ok && d.CanDelete()
+}
+
+// Summary is the outcome of a cleanup.
+type Summary struct {
+	Builds    int // builds that haven't been evicted
+	Expired   int // expired builds whose files were deleted
+	Protected int // expired builds kept because they're the current build of a package path
+	Deleted   int // files deleted
+	Shared    int // files of expired builds kept because a live build has them
+	Errors    []string
+}
+
+func (s Summary) String() string {
+	return fmt.Sprintf("%d builds: %d expired, %d kept because they're current. %d files deleted, %d shared files kept.", s.Builds, s.Expired, s.Protected, s.Deleted, s.Shared)
+}
+
+// Run deletes the files of the builds that expired before now, and marks the builds as evicted. Files
+// are content addressed, so many builds share them: a file is only deleted if no live build has it. The
+// current build of a package path is never evicted, because the page at the path loads it, and the
+// precompiled standard library is never deleted. The index page of an expired build is deleted from the
+// index bucket if it was written at its hash (see store.BuildData.Index). A build is only marked as
+// evicted when all its files have been deleted, so failures are retried by the next run.
+func Run(ctx context.Context, fileserver services.Fileserver, database services.Database, now time.Time) (Summary, error) {
+	if !CanDelete(fileserver) {
+		return Summary{}, fmt.Errorf("the fileserver can't delete files")
+	}
+	deleter := fileserver.(Deleter)
+
+	current := map[string]bool{}
+	paths, packages, err := store.Packages(ctx, database)
+	if err != nil {
+		return Summary{}, err
+	}
+	for i, path := range paths {
+		// builds of a ref or with options are only served at their hash
+		if strings.ContainsAny(path, "@#") {
+			continue
+		}
+		current[packages[i].Min.Main] = true
+		current[packages[i].Max.Main] = true
+	}
+
+	ids, builds, err := store.Builds(ctx, database)
+	if err != nil {
+		return Summary{}, err
+	}
+	var summary Summary
+	live := standardFiles()
+	var expired []int
+	for i, build := range builds {
+		if build.Evicted {
+			continue
+		}
+		summary.Builds++
+		if build.Expires.IsZero() || now.Before(build.Expires) {
+			addFiles(live, build)
+			continue
+		}
+		if current[ids[i]] {
+			summary.Protected++
+			addFiles(live, build)
+			continue
+		}
+		expired = append(expired, i)
+	}
+
+	deleted := map[string]bool{}
+	bucket := config.Bucket[config.Pkg]
+	for _, i := range expired {
+		build := builds[i]
+		failed := false
+		for _, f := range build.Files {
+			if live[f.Name] {
+				summary.Shared++
+				continue
+			}
+			if deleted[f.Name] {
+				continue
+			}
+			if err := deleter.Delete(ctx, bucket, f.Name); err != nil {
+				summary.Errors = append(summary.Errors, fmt.Sprintf("deleting %s: %v", f.Name, err))
+				failed = true
+				continue
+			}
+			deleted[f.Name] = true
+			summary.Deleted++
+		}
+		// The index page is named by its own hash, so only this build has it. Pages written at the
+		// package path are replaced by later builds, so they aren't deleted.
+		if build.Index != "" {
+			for _, name := range []string{build.Index, build.Index + "/index.html"} {
+				if err := deleter.Delete(ctx, config.Bucket[config.Index], name); err != nil {
+					summary.Errors = append(summary.Errors, fmt.Sprintf("deleting index %s: %v", name, err))
+					failed = true
+				}
+			}
+		}
+		if failed {
+			continue
+		}
+		build.Evicted = true
+		if err := store.StoreBuild(ctx, database, ids[i], build); err != nil {
+			summary.Errors = append(summary.Errors, fmt.Sprintf("evicting %s: %v", ids[i], err))
+			continue
+		}
+		summary.Expired++
+	}
+	return summary, ctx.Err()
+}
+
+func addFiles(files map[string]bool, build store.BuildData) {
+	for _, f := range build.Files {
+		files[f.Name] = true
+	}
+}
+
+// standardFiles returns the names of the precompiled standard library files, which are shared by every
+// build.
+func standardFiles() map[string]bool {
+	files := map[string]bool{}
+	for _, hash := range std.Prelude {
+		files[fmt.Sprintf("prelude.%s.js", hash)] = true
+	}
+	for path, hashes := range std.Index {
+		for _, hash := range hashes {
+			files[fmt.Sprintf("%s.%s.js", path, hash)] = true
+		}
+	}
+	return files
+}
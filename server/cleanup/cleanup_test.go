@@ -0,0 +1,108 @@
+package cleanup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dave/jsgo/assets/std"
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/memstore"
+	"github.com/dave/jsgo/server/store"
+)
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	bucket := config.Bucket[config.Pkg]
+	start := time.Date(2018, 11, 1, 0, 0, 0, 0, time.UTC)
+	day := time.Hour * 24
+	fs := memstore.NewFileserver(nil)
+	db := memstore.NewDatabase()
+	fmtFile := "fmt." + std.Index["fmt"][true] + ".js"
+	build := func(id, path string, ttl time.Duration, files ...string) {
+		data := store.BuildData{Path: path, Time: start, Expires: start.Add(ttl)}
+		for _, name := range append(files, fmtFile, path+"."+id+".js") {
+			fs.Files[bucket+":"+name] = name
+			data.Files = append(data.Files, store.BuildFile{Name: name})
+		}
+		store.StoreBuild(ctx, db, id, data)
+	}
+	build("gist", "gist.github.com/a", config.TtlEphemeral, "shared.1.js")
+	_, gist, _ := store.Build(ctx, db, "gist")
+	gist.Index = "abc"
+	store.StoreBuild(ctx, db, "gist", gist)
+	index := config.Bucket[config.Index]
+	fs.Files[index+":abc"], fs.Files[index+":abc/index.html"] = "", ""
+	build("default", "github.com/b", config.TtlDefault, "b.1.js")
+	build("pinned", "github.com/c", config.TtlPinned, "shared.1.js")
+	build("current", "github.com/d", config.TtlDefault)
+	store.StoreCompile(ctx, db, "github.com/d", store.CompileData{Min: store.CompileContents{Main: "current"}})
+	store.StoreCompile(ctx, db, "github.com/b@v1", store.CompileData{Min: store.CompileContents{Main: "default"}})
+
+	exists := func(names ...string) bool {
+		for _, name := range names {
+			if _, ok := fs.Files[bucket+":"+name]; !ok {
+				return false
+			}
+		}
+		return true
+	}
+
+	// Nothing has expired yet.
+	summary, err := Run(ctx, fs, db, start.Add(day))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Builds != 4 || summary.Expired != 0 || summary.Deleted != 0 {
+		t.Fatalf("unexpected summary %#v", summary)
+	}
+
+	// The gist expires first. The file it shares with the pinned build is kept.
+	summary, err = Run(ctx, fs, db, start.Add(config.TtlEphemeral+day))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Expired != 1 || summary.Deleted != 1 || exists("gist.github.com/a.gist.js") || !exists("shared.1.js", fmtFile) {
+		t.Fatalf("expected the gist to be evicted, found %#v", summary)
+	}
+	_, page := fs.Files[index+":abc"]
+	_, hashed := fs.Files[index+":abc/index.html"]
+	if page || hashed {
+		t.Fatal("expected the index page of the gist to be deleted")
+	}
+
+	// Then the default builds, except the current build of a package path. A failed delete is retried.
+	fs.Fail = "b.1.js"
+	summary, err = Run(ctx, fs, db, start.Add(config.TtlDefault+day))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Builds != 3 || summary.Expired != 0 || summary.Protected != 1 || len(summary.Errors) != 1 {
+		t.Fatalf("unexpected summary %#v", summary)
+	}
+	fs.Fail = ""
+	summary, err = Run(ctx, fs, db, start.Add(config.TtlDefault+day))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Expired != 1 || exists("b.1.js") || !exists("github.com/d.current.js") {
+		t.Fatalf("expected the default build to be evicted, found %#v", summary)
+	}
+
+	// Finally the pinned build. The standard library is never deleted.
+	summary, err = Run(ctx, fs, db, start.Add(config.TtlPinned+day))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Builds != 2 || summary.Expired != 1 || exists("shared.1.js") || !exists(fmtFile, "github.com/d.current.js") {
+		t.Fatalf("expected the pinned build to be evicted, found %#v", summary)
+	}
+}
+
+func TestRunCantDelete(t *testing.T) {
+	fs := memstore.NewFileserver(nil)
+	fs.ReadOnly = true
+	if _, err := Run(context.Background(), fs, memstore.NewDatabase(), time.Now()); err == nil {
+		t.Fatal("expected an error for a fileserver that can't delete")
+	}
+}
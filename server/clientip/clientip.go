@@ -0,0 +1,30 @@
+// Package clientip finds the address of the client that made a request, behind the load balancer.
+package clientip
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/dave/jsgo/config"
+)
+
+// Get returns the address of the client, used to share compile slots fairly between clients and to log
+// compiles. The client controls the start of the X-Forwarded-For header, so only the hop added by the trusted proxies
+// (config.ProxyDepth hops from the end) is used. A header with fewer hops wasn't added by the proxies
+// (e.g. an async compile, which has the client's address only), so its first hop is used. Without the
+// header (e.g. locally) the address of the connection is used.
+func Get(req *http.Request) string {
+	if forwarded := req.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		i := len(hops) - config.ProxyDepth
+		if i < 0 {
+			i = 0
+		}
+		return strings.TrimSpace(hops[i])
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
@@ -0,0 +1,25 @@
+package clientip
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	tests := map[string]string{
+		"":                                  "192.0.2.1",
+		"203.0.113.7":                       "203.0.113.7",
+		"203.0.113.7, 130.211.0.1":          "203.0.113.7",
+		"spoofed, 203.0.113.7,130.211.0.1 ": "203.0.113.7",
+		"1.1.1.1, spoofed, 203.0.113.7, 35.1.1.1": "203.0.113.7",
+	}
+	for forwarded, expected := range tests {
+		req := httptest.NewRequest("GET", "/", nil) // RemoteAddr is 192.0.2.1:1234
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		if found := Get(req); found != expected {
+			t.Errorf("%q: expected %s, found %s", forwarded, expected, found)
+		}
+	}
+}
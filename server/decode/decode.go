@@ -0,0 +1,70 @@
+// Package decode strictly decodes JSON from clients. Errors name the offending field and say what's
+// wrong with it, so clients can fix their requests.
+package decode
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// FieldError is a problem with one field. Field is the dotted path of the field (e.g. "Message.Path"),
+// or empty if the problem isn't with a specific field.
+type FieldError struct {
+	Field  string
+	Reason string
+}
+
+func (e FieldError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("invalid request: %s", e.Reason)
+	}
+	return fmt.Sprintf("invalid request: %s: %s", e.Field, e.Reason)
+}
+
+// Json decodes b into v. Unknown fields are rejected, and each of the required fields (dotted paths)
+// must be present and not null.
+func Json(b []byte, v interface{}, required ...string) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fieldError(err)
+	}
+	for _, field := range required {
+		if !present(b, strings.Split(field, ".")) {
+			return FieldError{Field: field, Reason: "missing required field"}
+		}
+	}
+	return nil
+}
+
+func fieldError(err error) error {
+	switch err := err.(type) {
+	case *json.UnmarshalTypeError:
+		return FieldError{Field: err.Field, Reason: fmt.Sprintf("expected %s, found %s", err.Type, err.Value)}
+	case *json.SyntaxError:
+		return FieldError{Reason: fmt.Sprintf("invalid JSON at offset %d: %v", err.Offset, err)}
+	}
+	// The decoder doesn't have an error type for unknown fields.
+	if msg := err.Error(); strings.HasPrefix(msg, "json: unknown field ") {
+		field := strings.Trim(strings.TrimPrefix(msg, "json: unknown field "), `"`)
+		return FieldError{Field: field, Reason: "unknown field"}
+	}
+	return FieldError{Reason: err.Error()}
+}
+
+func present(b []byte, path []string) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return false
+	}
+	v, ok := fields[path[0]]
+	if !ok || string(v) == "null" {
+		return false
+	}
+	if len(path) == 1 {
+		return true
+	}
+	return present(v, path[1:])
+}
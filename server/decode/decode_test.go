@@ -0,0 +1,35 @@
+package decode
+
+import "testing"
+
+func TestJson(t *testing.T) {
+	type inner struct {
+		Path string
+		All  bool
+	}
+	type outer struct {
+		Type    string
+		Message inner
+	}
+	tests := []struct {
+		name, json, expected string
+	}{
+		{"valid", `{"Type":"Compile","Message":{"Path":"a"}}`, ""},
+		{"unknown field", `{"Type":"Compile","Message":{"Path":"a","Foo":1}}`, "invalid request: Foo: unknown field"},
+		{"type mismatch", `{"Type":"Compile","Message":{"Path":"a","All":"yes"}}`, "invalid request: Message.All: expected bool, found string"},
+		{"missing required", `{"Type":"Compile","Message":{"All":true}}`, "invalid request: Message.Path: missing required field"},
+		{"null required", `{"Type":"Compile","Message":null}`, "invalid request: Message: missing required field"},
+		{"syntax", `{"Type":`, "invalid request: unexpected EOF"},
+	}
+	for _, test := range tests {
+		var v outer
+		err := Json([]byte(test.json), &v, "Type", "Message", "Message.Path")
+		found := ""
+		if err != nil {
+			found = err.Error()
+		}
+		if found != test.expected {
+			t.Errorf("%s: expected %q, found %q", test.name, test.expected, found)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dave/jsgo/config"
+)
+
+// negotiate chooses the content encoding of a response from the Accept-Encoding header of req. The
+// encoding is the one of supported (in order of preference) with the highest q-value, or "" for
+// identity if identity has a higher q-value than all of them, or none of them are accepted. Encodings
+// with q=0 are refused. identity is false if the client has refused identity (e.g. "identity;q=0" or
+// "*;q=0"), in which case the response must use the encoding, and can't be sent at all if it's "".
+func negotiate(req *http.Request, supported ...string) (encoding string, identity bool) {
+	header := req.Header.Get("Accept-Encoding")
+	if strings.TrimSpace(header) == "" {
+		return "", true
+	}
+	qs := acceptEncodings(header)
+
+	// Identity is acceptable unless it's refused, but any encoding the client lists is preferred.
+	identityQ, listed := acceptQuality(qs, "identity")
+	if !listed {
+		identityQ = 0.001
+	}
+	best := 0.0
+	for _, name := range supported {
+		if q, _ := acceptQuality(qs, name); q > best {
+			encoding, best = name, q
+		}
+	}
+	if identityQ > best {
+		encoding = ""
+	}
+	return encoding, identityQ > 0
+}
+
+// acceptEncodings returns the q-value of each encoding in an Accept-Encoding header. Encodings with an
+// invalid q-value are ignored.
+func acceptEncodings(header string) map[string]float64 {
+	qs := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name == "" {
+			continue
+		}
+		q, ok := 1.0, true
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(strings.ToLower(param), "q=") {
+				continue
+			}
+			v, err := strconv.ParseFloat(strings.TrimSpace(param[2:]), 64)
+			if err != nil || v < 0 || v > 1 {
+				ok = false
+				break
+			}
+			q = v
+		}
+		if ok {
+			qs[name] = q
+		}
+	}
+	return qs
+}
+
+// acceptQuality returns the q-value of an encoding, falling back to the wildcard, and whether either is
+// listed.
+func acceptQuality(qs map[string]float64, name string) (float64, bool) {
+	if q, ok := qs[name]; ok {
+		return q, true
+	}
+	q, ok := qs["*"]
+	return q, ok
+}
+
+// compressionLog is where compression decisions are logged when config.LogCompression is set.
+var compressionLog io.Writer = os.Stdout
+
+// logCompression logs the Accept-Encoding of req, the chosen encoding ("" for identity) and the reason,
+// if config.LogCompression is set.
+func logCompression(req *http.Request, encoding, reason string) {
+	if !config.LogCompression {
+		return
+	}
+	fmt.Fprintf(compressionLog, "compression %s: accept-encoding %q, encoding %q, %s\n", req.URL.Path, req.Header.Get("Accept-Encoding"), encoding, reason)
+}
+
+// logSkipped logs why negotiate chose identity instead of encoding, if config.LogCompression is set.
+func logSkipped(req *http.Request, encoding string) {
+	if !config.LogCompression {
+		return
+	}
+	header := req.Header.Get("Accept-Encoding")
+	if strings.TrimSpace(header) == "" {
+		logCompression(req, "", "skipped: no accept-encoding")
+		return
+	}
+	q, listed := acceptQuality(acceptEncodings(header), encoding)
+	switch {
+	case !listed:
+		logCompression(req, "", "skipped: not accepted")
+	case q == 0:
+		logCompression(req, "", "skipped: q=0")
+	default:
+		logCompression(req, "", "skipped: identity preferred")
+	}
+}
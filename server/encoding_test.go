@@ -0,0 +1,133 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dave/jsgo/assets"
+	"github.com/dave/jsgo/config"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		header   string
+		encoding string
+		identity bool
+	}{
+		{"", "", true},
+		{"gzip", "gzip", true},
+		{"gzip, deflate, br", "gzip", true},
+		{"GZIP", "gzip", true},
+		{"gzip;q=0", "", true},
+		{"gzip; q=0.0", "", true},
+		{"identity;q=0", "", false},
+		{"gzip, identity;q=0", "gzip", false},
+		{"*;q=0", "", false},
+		{"*;q=0, gzip", "gzip", false},
+		{"*", "gzip", true},
+		{"br;q=1.0, gzip;q=0.8, *;q=0.1", "gzip", true},
+		{"gzip;q=0.5, identity", "", true},
+		{"gzip;q=0.5, identity;q=0.4", "gzip", true},
+		{"gzip;q=2", "", true},
+		{"deflate", "", true},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", test.header)
+		encoding, identity := negotiate(req, "gzip")
+		if encoding != test.encoding || identity != test.identity {
+			t.Errorf("%q: expected %q %v, found %q %v", test.header, test.encoding, test.identity, encoding, identity)
+		}
+	}
+}
+
+func TestServeStaticEncoding(t *testing.T) {
+	f, err := assets.Assets.Create("/encoding-test.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("body { color: red; }\n"))
+	f.Close()
+
+	serve := func(header string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/encoding-test.css", nil)
+		req.Header.Set("Accept-Encoding", header)
+		if err := ServeStatic(req.URL.Path, w, req, "text/css"); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	// The file is too small to be worth compressing, so it's only gzipped if identity is refused.
+	if w := serve("gzip;q=0"); w.Header().Get("Content-Encoding") != "" || w.Body.String() != "body { color: red; }\n" {
+		t.Fatalf("expected identity when gzip is refused, found %v", w.Header())
+	}
+	w := serve("gzip, identity;q=0")
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected gzip when identity is refused, found %v", w.Header())
+	}
+	r, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(r); string(b) != "body { color: red; }\n" {
+		t.Fatalf("unexpected contents %q", b)
+	}
+	if w := serve("gzip;q=0, identity;q=0"); w.Code != 406 {
+		t.Fatalf("expected 406 when every encoding is refused, found %d", w.Code)
+	}
+}
+
+func TestLogCompression(t *testing.T) {
+	f, err := assets.Assets.Create("/log-compression-test.map")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("{}\n"))
+	f.Close()
+
+	defer func(log bool, w io.Writer) { config.LogCompression, compressionLog = log, w }(config.LogCompression, compressionLog)
+	buf := &bytes.Buffer{}
+	compressionLog = buf
+	serve := func(header string) {
+		req := httptest.NewRequest("GET", "/log-compression-test.map", nil)
+		req.Header.Set("Accept-Encoding", header)
+		if err := ServeStatic(req.URL.Path, httptest.NewRecorder(), req, "application/json"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// nothing is logged by default
+	config.LogCompression = false
+	serve("gzip")
+	if buf.Len() != 0 {
+		t.Fatalf("expected no log, found %q", buf.String())
+	}
+
+	config.LogCompression = true
+	for header, reason := range map[string]string{
+		"gzip;q=0, br": `encoding "", skipped: q=0`,
+		"":             `encoding "", skipped: no accept-encoding`,
+		"br":           `encoding "", skipped: not accepted`,
+	} {
+		buf.Reset()
+		serve(header)
+		expected := fmt.Sprintf("compression /log-compression-test.map: accept-encoding %q, %s\n", header, reason)
+		if buf.String() != expected {
+			t.Errorf("%q: expected %q, found %q", header, expected, buf.String())
+		}
+	}
+
+	// the file is too small to be precompressed, and below the streaming threshold
+	buf.Reset()
+	serve("gzip")
+	if expected := `compression /log-compression-test.map: accept-encoding "gzip", encoding "", skipped: below threshold` + "\n"; buf.String() != expected {
+		t.Errorf("expected %q, found %q", expected, buf.String())
+	}
+}
@@ -0,0 +1,47 @@
+// Package gitauth reports clones that the git host refused because the repo needs credentials, which
+// otherwise fail with an opaque transport error. Over HTTPS some hosts (e.g. GitHub) refuse clones of
+// private repos and repos that don't exist in the same way, so the message covers both.
+package gitauth
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/dave/jsgo/server/locale"
+	"github.com/dave/services"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+// New returns a fetcher that fetches repo urls with next, and reports clones refused with HTTP 401 or
+// 403 with Error.
+func New(next services.Fetcher) services.Fetcher {
+	return &Fetcher{Next: next}
+}
+
+type Fetcher struct {
+	Next services.Fetcher
+}
+
+func (f *Fetcher) Fetch(ctx context.Context, repo string) (billy.Filesystem, error) {
+	fs, err := f.Next.Fetch(ctx, repo)
+	if Required(err) {
+		name := repo
+		if u, err := url.Parse(repo); err == nil && u.Host != "" {
+			name = u.Host + strings.TrimSuffix(u.Path, ".git")
+		}
+		return nil, Error(name)
+	}
+	return fs, err
+}
+
+// Required returns true if err is the error of a clone that the host refused with HTTP 401 or 403.
+func Required(err error) bool {
+	return err == transport.ErrAuthenticationRequired || err == transport.ErrAuthorizationFailed
+}
+
+// Error returns the error reported when the host requires authentication to clone repo.
+func Error(repo string) error {
+	return locale.Error{Code: locale.AuthRequired, Args: []interface{}{repo}}
+}
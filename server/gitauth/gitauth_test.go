@@ -0,0 +1,38 @@
+package gitauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dave/jsgo/server/locale"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+type next struct{ err error }
+
+func (n next) Fetch(ctx context.Context, url string) (billy.Filesystem, error) {
+	return nil, n.err
+}
+
+func TestFetcher(t *testing.T) {
+	for _, err := range []error{transport.ErrAuthenticationRequired, transport.ErrAuthorizationFailed} {
+		_, found := New(next{err: err}).Fetch(context.Background(), "https://github.com/foo/bar.git")
+		e, ok := found.(locale.Error)
+		if !ok || e.Code != locale.AuthRequired {
+			t.Fatalf("%v: expected the auth_required error, found %#v", err, found)
+		}
+		expected := "The repository github.com/foo/bar requires authentication - it may be private, or it may not exist"
+		if e.Error() != expected {
+			t.Fatalf("%v: expected %q, found %q", err, expected, e.Error())
+		}
+	}
+
+	other := errors.New("too many git objects")
+	for _, err := range []error{other, transport.ErrRepositoryNotFound, nil} {
+		if _, found := New(next{err: err}).Fetch(context.Background(), "https://github.com/foo/bar.git"); found != err {
+			t.Fatalf("expected %v to be returned unchanged, found %v", err, found)
+		}
+	}
+}
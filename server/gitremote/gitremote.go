@@ -0,0 +1,106 @@
+// Package gitremote lists the refs of remote git repos, like git ls-remote.
+package gitremote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/dave/jsgo/config"
+	"golang.org/x/net/context/ctxhttp"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+)
+
+// List returns the refs of the repo (host/user/repo) with the git smart HTTP protocol. Only repos on
+// config.GitRemoteHosts can be listed, so clients can't make the server connect to other hosts. The
+// request is bounded by ctx and config.GitListTimeout.
+func List(ctx context.Context, repo string) ([]*plumbing.Reference, error) {
+	if !Allowed(repo) {
+		return nil, fmt.Errorf("listing refs for %s: unsupported host", repo)
+	}
+	ctx, cancel := context.WithTimeout(ctx, config.GitListTimeout)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://%s.git/info/refs?service=git-upload-pack", repo), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/x-git-upload-pack-advertisement")
+	req.Header.Set("User-Agent", "git/1.0")
+	resp, err := ctxhttp.Do(ctx, http.DefaultClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("listing refs for %s: %v", repo, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing refs for %s: %s", repo, resp.Status)
+	}
+	refs, err := decode(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("listing refs for %s: %v", repo, err)
+	}
+	return refs, nil
+}
+
+// Resolve returns the commit that ref points at in the refs of repo. ref may be a full ref name (e.g. a
+// pull request head), a branch or a tag, and HEAD is used if ref is empty.
+func Resolve(repo string, refs []*plumbing.Reference, ref string) (string, error) {
+	names := map[plumbing.ReferenceName]*plumbing.Reference{}
+	for _, r := range refs {
+		names[r.Name()] = r
+	}
+	var target plumbing.ReferenceName
+	switch {
+	case ref == "":
+		target = plumbing.HEAD
+	case names[plumbing.ReferenceName(ref)] != nil:
+		target = plumbing.ReferenceName(ref)
+	case names[plumbing.NewBranchReferenceName(ref)] != nil:
+		target = plumbing.NewBranchReferenceName(ref)
+	default:
+		target = plumbing.NewTagReferenceName(ref)
+	}
+	// HEAD is usually a symbolic ref to the default branch.
+	for i := 0; i < 5; i++ {
+		r, ok := names[target]
+		if !ok {
+			return "", fmt.Errorf("%s not found in %s", strings.TrimPrefix(target.String(), "refs/"), repo)
+		}
+		if r.Type() == plumbing.HashReference {
+			return r.Hash().String(), nil
+		}
+		target = r.Target()
+	}
+	return "", fmt.Errorf("can't resolve %s in %s", ref, repo)
+}
+
+// Allowed returns true if the repo is on one of config.GitRemoteHosts.
+func Allowed(repo string) bool {
+	host := strings.SplitN(repo, "/", 2)[0]
+	for _, h := range config.GitRemoteHosts {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
+
+// decode reads the refs advertised by a git server, including HEAD as a symbolic ref if the server
+// says which branch it points at.
+func decode(r io.Reader) ([]*plumbing.Reference, error) {
+	ar := packp.NewAdvRefs()
+	if err := ar.Decode(r); err != nil {
+		return nil, err
+	}
+	all, err := ar.AllReferences()
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]*plumbing.Reference, 0, len(all))
+	for _, ref := range all {
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
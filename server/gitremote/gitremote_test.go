@@ -0,0 +1,94 @@
+package gitremote
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/pktline"
+)
+
+const hash = "0123456789abcdef0123456789abcdef01234567"
+
+// advertisement returns the response of a git server to a ref listing.
+func advertisement(t *testing.T) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	e := pktline.NewEncoder(buf)
+	err := e.EncodeString(
+		"# service=git-upload-pack\n",
+	)
+	if err == nil {
+		err = e.Flush()
+	}
+	if err == nil {
+		err = e.EncodeString(
+			hash+" HEAD\x00multi_ack symref=HEAD:refs/heads/master\n",
+			hash+" refs/heads/master\n",
+			hash+" refs/tags/v1.0.0\n",
+		)
+	}
+	if err == nil {
+		err = e.Flush()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func TestDecode(t *testing.T) {
+	refs, err := decode(advertisement(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[plumbing.ReferenceName]*plumbing.Reference{}
+	for _, r := range refs {
+		names[r.Name()] = r
+	}
+	if r := names["refs/heads/master"]; r == nil || r.Hash().String() != hash {
+		t.Fatalf("expected master at %s, found %v", hash, r)
+	}
+	if r := names["refs/tags/v1.0.0"]; r == nil {
+		t.Fatal("expected tag v1.0.0")
+	}
+	if r := names[plumbing.HEAD]; r == nil || r.Type() != plumbing.SymbolicReference || r.Target() != "refs/heads/master" {
+		t.Fatalf("expected HEAD to point at master, found %v", r)
+	}
+}
+
+func TestListUnsupportedHost(t *testing.T) {
+	for _, repo := range []string{"localhost:8080/a/b", "169.254.169.254/a/b", "example.com/a/b", "github.com.example.com/a/b"} {
+		if _, err := List(context.Background(), repo); err == nil {
+			t.Errorf("expected %s to be rejected", repo)
+		}
+	}
+	if !Allowed("github.com/a/b") {
+		t.Fatal("expected github.com to be allowed")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	const other = "89abcdef0123456789abcdef0123456789abcdef"
+	refs := []*plumbing.Reference{
+		plumbing.NewSymbolicReference(plumbing.HEAD, "refs/heads/master"),
+		plumbing.NewHashReference("refs/heads/master", plumbing.NewHash(hash)),
+		plumbing.NewHashReference("refs/heads/v1", plumbing.NewHash(other)),
+		plumbing.NewHashReference("refs/tags/v1", plumbing.NewHash(hash)),
+		plumbing.NewHashReference("refs/pull/1/head", plumbing.NewHash(other)),
+	}
+	for ref, expected := range map[string]string{
+		"":                 hash,
+		"master":           hash,
+		"v1":               other, // branches before tags
+		"refs/tags/v1":     hash,
+		"refs/pull/1/head": other,
+	} {
+		if sha, err := Resolve("github.com/a/b", refs, ref); err != nil || sha != expected {
+			t.Errorf("%q: expected %s, found %s (%v)", ref, expected, sha, err)
+		}
+	}
+	if _, err := Resolve("github.com/a/b", refs, "missing"); err == nil {
+		t.Fatal("expected error for a missing ref")
+	}
+}
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/store"
+)
+
+// AdminHandler wraps a handler so it's only available with the admin token. If no token is configured,
+// the admin endpoints are disabled.
+func AdminHandler(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if os.Getenv(config.AdminTokenEnv) == "" {
+			notFound(w, req)
+			return
+		}
+		TokenHandler(config.AdminTokenEnv, handler)(w, req)
+	}
+}
+
+// TokenHandler wraps a handler so it requires the bearer token in the environment variable env. If the
+// variable isn't set, the handler is public.
+func TokenHandler(env string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		token := os.Getenv(env)
+		if token != "" && !validToken(req, token) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler(w, req)
+	}
+}
+
+// validToken compares the bearer token in the request with token in constant time.
+func validToken(req *http.Request, token string) bool {
+	found := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(found), []byte(token)) == 1
+}
+
+// ConcurrencyHandler reports the number of concurrent compile jobs, and changes it when a POST request
+// with an "n" parameter is received.
+func (h *Handler) ConcurrencyHandler(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		n, err := strconv.Atoi(req.FormValue("n"))
+		if err != nil || n < 1 {
+			http.Error(w, "n must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		previous := h.Queue.Concurrent()
+		h.Queue.Resize(n)
+		log.Printf("Concurrent compiles changed from %d to %d", previous, n)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	running, waiting := h.Queue.Stats()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Concurrent int
+		Running    int
+		Waiting    int
+	}{
+		Concurrent: h.Queue.Concurrent(),
+		Running:    running,
+		Waiting:    waiting,
+	})
+}
+
+// CompilesHandler queries the compile log. Parameters (all optional):
+//
+//	since, until: RFC3339 times
+//	path:         package path
+//	ip:           client IP
+//	success:      true or false (failed compiles are logged with the error and no output)
+//	limit:        page size (default 100, max 1000)
+//	cursor:       the Next value from the previous page
+func (h *Handler) CompilesHandler(w http.ResponseWriter, req *http.Request) {
+	if h.Datastore == nil {
+		http.Error(w, "compile log not available in local mode", http.StatusNotImplemented)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), config.PageTimeout)
+	defer cancel()
+
+	q := store.CompileQuery{
+		Path:   req.FormValue("path"),
+		Ip:     req.FormValue("ip"),
+		Limit:  100,
+		Cursor: req.FormValue("cursor"),
+	}
+	var err error
+	if v := req.FormValue("since"); v != "" {
+		if q.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, fmt.Sprintf("invalid since: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := req.FormValue("until"); v != "" {
+		if q.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, fmt.Sprintf("invalid until: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := req.FormValue("success"); v != "" {
+		success, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid success: %v", err), http.StatusBadRequest)
+			return
+		}
+		q.Success = &success
+	}
+	if v := req.FormValue("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 1 || q.Limit > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+	}
+
+	compiles, next, total, err := store.Compiles(ctx, h.Datastore, q)
+	if err == store.InvalidCursor {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Total    int
+		Next     string
+		Compiles []store.CompileData
+	}{
+		Total:    total,
+		Next:     next,
+		Compiles: compiles,
+	})
+}
+
+// AccessHandler reports the hits and bytes served for a path. Parameters:
+//
+//	path:  the served path, including the host (e.g. play.jsgo.io/_script.js)
+//	since: RFC3339 time (optional, default 24 hours ago)
+func (h *Handler) AccessHandler(w http.ResponseWriter, req *http.Request) {
+	if h.Datastore == nil {
+		http.Error(w, "access log not available in local mode", http.StatusNotImplemented)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), config.PageTimeout)
+	defer cancel()
+
+	path := req.FormValue("path")
+	if path == "" {
+		http.Error(w, "path required", http.StatusBadRequest)
+		return
+	}
+	since := time.Now().Add(-24 * time.Hour)
+	if v := req.FormValue("since"); v != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, fmt.Sprintf("invalid since: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	hits, bytes, err := store.Access(ctx, h.Datastore, path, since)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Path  string
+		Since time.Time
+		Hits  int
+		Bytes int64
+	}{
+		Path:  path,
+		Since: since,
+		Hits:  hits,
+		Bytes: bytes,
+	})
+}
+
+// concurrentCompiles returns the number of concurrent compile jobs: MaxConcurrentCompiles if set,
+// otherwise scaled from the number of CPUs.
+func concurrentCompiles(cpus int) int {
+	if config.MaxConcurrentCompiles > 0 {
+		return config.MaxConcurrentCompiles
+	}
+	n := int(math.Ceil(float64(cpus) * config.CompilesPerCPU))
+	if n > config.MaxAutoConcurrentCompiles {
+		n = config.MaxAutoConcurrentCompiles
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+func defaultConcurrentCompiles() int {
+	n := concurrentCompiles(runtime.NumCPU())
+	log.Printf("Concurrent compiles: %d (%d CPUs)", n, runtime.NumCPU())
+	return n
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestTokenHandler(t *testing.T) {
+	const env = "JSGO_TEST_TOKEN"
+	ok := func(w http.ResponseWriter, req *http.Request) {}
+	status := func(h http.HandlerFunc, auth string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/_info/", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		h(w, req)
+		return w.Code
+	}
+
+	os.Unsetenv(env)
+	if found := status(TokenHandler(env, ok), ""); found != 200 {
+		t.Fatalf("expected public access without a token configured, found %d", found)
+	}
+
+	os.Setenv(env, "secret")
+	defer os.Unsetenv(env)
+	for auth, expected := range map[string]int{"": 401, "Bearer wrong": 401, "secret": 200, "Bearer secret": 200} {
+		if found := status(TokenHandler(env, ok), auth); found != expected {
+			t.Errorf("%q: expected %d, found %d", auth, expected, found)
+		}
+	}
+}
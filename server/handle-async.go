@@ -0,0 +1,209 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/clientip"
+	"github.com/dave/jsgo/server/jsgo/messages"
+	"github.com/dave/jsgo/server/locale"
+	"github.com/dave/jsgo/server/progress"
+	"github.com/dave/jsgo/server/queue"
+	"github.com/dave/jsgo/server/requestid"
+	"github.com/dave/jsgo/server/servermsg"
+	"github.com/dave/jsgo/server/store"
+	"github.com/dave/jsgo/server/tenant"
+	"github.com/dave/services"
+	"github.com/dave/services/tracker"
+	"github.com/gorilla/websocket"
+)
+
+// AsyncHandler accepts a compile from a client that doesn't keep a websocket open (e.g. CI). The body is
+// a Compile message as JSON, and the response (status 202) has the job Id. The messages of the compile
+// can be followed at /_api/job/<id>/watch while it runs, and read from /_api/job/<id>/log after it
+// finishes. Async compiles have the Batch nice level. If the compile queue is full, the job is kept in
+// the overflow queue (see OverflowQueue) and Overflow is true in the response, or if there's no overflow
+// queue, 503 is returned.
+func (h *Handler) AsyncHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var info messages.Compile
+	if err := json.NewDecoder(req.Body).Decode(&info); err != nil {
+		http.Error(w, fmt.Sprintf("invalid compile message: %v", err), http.StatusBadRequest)
+		return
+	}
+	if info.Path == "" && info.Module == "" {
+		http.Error(w, "path or module is required", http.StatusBadRequest)
+		return
+	}
+	message, err := json.Marshal(info)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	job := store.OverflowJob{
+		Id:       newJobId(),
+		Time:     now,
+		Deadline: now.Add(config.OverflowRetention),
+		Ip:       clientip.Get(req),
+		Lang:     locale.Lang(req),
+		Tenant:   tenant.FromContext(req.Context()),
+		Message:  message,
+	}
+	var overflow bool
+	if err := h.startAsync(job); err == queue.TooManyItemsQueued && h.Overflow != nil {
+		if err := h.Overflow.Push(req.Context(), job); err != nil {
+			h.storeError(req.Context(), fmt.Errorf("adding job to the overflow queue: %v", err), req)
+			http.Error(w, "error adding job to the overflow queue", http.StatusInternalServerError)
+			return
+		}
+		overflow = true
+	} else if err != nil {
+		slotError(w, req, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(struct {
+		Id       string
+		Overflow bool
+	}{
+		Id:       job.Id,
+		Overflow: overflow,
+	})
+}
+
+// startAsync takes a slot in the compile queue for an async job, and runs the job in the background
+// when the slot starts. It returns queue.TooManyItemsQueued if the queue is full.
+func (h *Handler) startAsync(job store.OverflowJob) error {
+	start, end, err := h.Queue.Slot(job.Ip, queue.Batch, nil)
+	if err != nil {
+		return err
+	}
+	// Watchers can connect while the job is waiting for its slot.
+	h.Progress.Start(job.Id)
+	h.Waitgroup.Add(1)
+	go h.runAsync(job, start, end)
+	return nil
+}
+
+// runAsync waits for the slot of an async job, and compiles it like a websocket compile, with the
+// messages written to the job log and published to watchers. If the server shuts down before the job
+// starts, it's returned to the overflow queue.
+func (h *Handler) runAsync(job store.OverflowJob, start, end chan struct{}) {
+	defer h.Waitgroup.Done()
+	defer close(end)
+	defer h.Progress.Finish(job.Id)
+
+	select {
+	case <-start:
+	case <-h.shutdown:
+		if h.Overflow != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), config.PageTimeout)
+			defer cancel()
+			if err := h.Overflow.Push(ctx, job); err == nil {
+				return
+			}
+		}
+		h.failAsync(job, locale.Error{Code: locale.Shutdown})
+		return
+	}
+
+	s := h.jsgoHandler()
+	req := asyncRequest(job)
+
+	tj := tracker.Default.Start()
+	defer tj.End()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.RequestTimeout())
+	defer cancel()
+	go func() {
+		select {
+		case <-h.shutdown:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	joblog := newJobLog(h.Fileserver, job.Id)
+	defer joblog.close()
+
+	// Messages may be sent from several goroutines, and the log must be written in order.
+	var m sync.Mutex
+	send := func(message services.Message) {
+		b, messageType, err := s.MarshalMessage(message)
+		if err != nil {
+			return
+		}
+		m.Lock()
+		defer m.Unlock()
+		if messageType == websocket.TextMessage {
+			joblog.write(b)
+		}
+		h.Progress.Publish(job.Id, progress.Message{Type: messageType, Payload: b})
+	}
+	send(servermsg.Job{Id: job.Id})
+
+	defer func() {
+		if r := recover(); r != nil {
+			s.StoreError(ctx, fmt.Errorf("panic recovered: %s\n%s", r, string(debug.Stack())), req)
+			send(servermsg.Error{Message: fmt.Sprintf("panic recovered: %s\n%s", r, string(debug.Stack()))})
+		}
+	}()
+
+	var info messages.Compile
+	if err := json.Unmarshal(job.Message, &info); err != nil {
+		send(errorMessage(job.Lang, err))
+		return
+	}
+	receive := make(chan services.Message, 1)
+	receive <- info
+
+	if err := s.Handle(ctx, req, send, receive, tj); err != nil {
+		select {
+		case <-h.shutdown:
+			s.StoreError(ctx, errors.New("server shut down"), req)
+			err = locale.Error{Code: locale.Shutdown}
+		default:
+			s.StoreError(ctx, err, req)
+		}
+		send(errorMessage(job.Lang, err))
+	}
+}
+
+// failAsync writes the job log of an async job that couldn't be started, with the error.
+func (h *Handler) failAsync(job store.OverflowJob, err error) {
+	joblog := newJobLog(h.Fileserver, job.Id)
+	defer joblog.close()
+	for _, message := range []services.Message{servermsg.Job{Id: job.Id}, errorMessage(job.Lang, err)} {
+		if b, _, err := h.jsgoHandler().MarshalMessage(message); err == nil {
+			joblog.write(b)
+		}
+	}
+}
+
+// asyncRequest returns the request given to the compile of an async job. The client's request has
+// finished before the job runs (possibly on another server), so only the headers that the compile uses
+// are set. The tenant is carried in the context, because the job has no API key.
+func asyncRequest(job store.OverflowJob) *http.Request {
+	req, _ := http.NewRequest(http.MethodPost, "/_api/compile", nil)
+	if job.Tenant != "" {
+		req = req.WithContext(tenant.NewContext(req.Context(), job.Tenant))
+	}
+	req.Header.Set("X-Forwarded-For", job.Ip)
+	req.Header.Set("Accept-Language", job.Lang)
+	req.Header.Set(requestid.Header, job.Id)
+	return req
+}
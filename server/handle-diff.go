@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/dave/jsgo/config"
+)
+
+// DiffRequest is the body of a request to /_api/diff.
+type DiffRequest struct {
+	Path     string
+	From, To string // git refs (branch, tag or commit hash)
+	Files    bool   // list the files that differ
+}
+
+// DiffHandler compiles a package at two refs and reports whether the minified outputs differ, with the
+// size delta and optionally the files that changed (see jsgo.Diff), so reviewers can see whether a
+// change affects the shipped output. The body is a DiffRequest as JSON. Both compiles share one compile
+// slot and config.RequestTimeout.
+func (h *Handler) DiffHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var d DiffRequest
+	if err := json.NewDecoder(req.Body).Decode(&d); err != nil {
+		http.Error(w, fmt.Sprintf("invalid diff request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if d.Path == "" || d.From == "" || d.To == "" {
+		http.Error(w, "path, from and to are required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), config.RequestTimeout)
+	defer cancel()
+
+	end, err := h.queueSlot(ctx, req)
+	if err != nil {
+		if ctx.Err() == nil {
+			slotError(w, req, err)
+		}
+		return
+	}
+	defer close(end)
+
+	result, err := h.jsgoHandler().Diff(ctx, req, d.Path, d.From, d.To, d.Files)
+	if err != nil {
+		h.storeError(ctx, err, req)
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
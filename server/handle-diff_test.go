@@ -0,0 +1,28 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDiffHandlerInvalid(t *testing.T) {
+	h := &Handler{}
+	for body, expected := range map[string]int{
+		`{"Path": "github.com/a/b", "From": "v1"}`: http.StatusBadRequest,
+		`{"Path": "github.com/a/b", "To": "v2"}`:   http.StatusBadRequest,
+		`not json`:                                 http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		h.DiffHandler(w, httptest.NewRequest("POST", "/_api/diff", strings.NewReader(body)))
+		if w.Code != expected {
+			t.Errorf("%s: expected %d, found %d", body, expected, w.Code)
+		}
+	}
+	w := httptest.NewRecorder()
+	h.DiffHandler(w, httptest.NewRequest("GET", "/_api/diff", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for GET, found %d", w.Code)
+	}
+}
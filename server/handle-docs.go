@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/jsgo"
+	"github.com/dave/jsgo/server/store"
+)
+
+// DocsHandler redirects to the landing page rendered from the README of the most recent compile of a
+// package. The path is /_docs/<path>. The page runs the package's script, so it's served from the pkg
+// host with the other user content rather than from this host.
+func (h *Handler) DocsHandler(w http.ResponseWriter, req *http.Request) {
+	h = h.tenant(req)
+
+	ctx, cancel := context.WithTimeout(req.Context(), config.PageTimeout)
+	defer cancel()
+
+	path := strings.Trim(strings.TrimPrefix(req.URL.Path, "/_docs/"), "/")
+
+	found, data, err := store.Package(ctx, h.Database, path)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if !found {
+		notFound(w, req)
+		return
+	}
+
+	name := jsgo.DocsName(path, data.Min.Main)
+	exists, err := h.Fileserver.Exists(ctx, config.Bucket[config.Pkg], name)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if !exists {
+		notFound(w, req)
+		return
+	}
+
+	// The page for a path changes when it's re-compiled.
+	w.Header().Set("Cache-Control", "no-cache")
+	http.Redirect(w, req, fmt.Sprintf("%s://%s/%s", config.Protocol[config.Pkg], h.pkgHost(), name), http.StatusFound)
+}
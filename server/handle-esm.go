@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/store"
+)
+
+// EsmHandler serves an ES module wrapper for the most recent compile of a package, so it can be used with
+// import in module based bundlers and <script type="module">. The path is /_esm/<path>, and the
+// un-minified files are used if the max parameter is set. Like the manifest, the module is stored in the
+// pkg bucket next to the loader JS so it's only generated once.
+func (h *Handler) EsmHandler(w http.ResponseWriter, req *http.Request) {
+	h = h.tenant(req)
+
+	ctx, cancel := context.WithTimeout(req.Context(), config.PageTimeout)
+	defer cancel()
+
+	path := strings.Trim(strings.TrimPrefix(req.URL.Path, "/_esm/"), "/")
+	min := req.FormValue("max") == ""
+
+	found, data, err := store.Package(ctx, h.Database, path)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if !found {
+		notFound(w, req)
+		return
+	}
+
+	contents := data.Max
+	if min {
+		contents = data.Min
+	}
+
+	name := fmt.Sprintf("%s.%s.esm.js", path, contents.Main)
+
+	buf := &bytes.Buffer{}
+	exists, err := h.Fileserver.Read(ctx, config.Bucket[config.Pkg], name, buf)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if !exists {
+		loader := fmt.Sprintf("%s://%s/%s.%s.js", config.Protocol[config.Pkg], h.pkgHost(), path, contents.Main)
+		buf.WriteString(esmModule(loader))
+		if _, err := h.Fileserver.Write(ctx, config.Bucket[config.Pkg], name, bytes.NewReader(buf.Bytes()), false, "text/javascript", "public,max-age=31536000,immutable"); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	}
+
+	// The module for a path changes when it's re-compiled, so only the stored copy is immutable.
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", fmt.Sprintf(`"%s-esm"`, contents.Main))
+	w.Header().Set("Content-Type", "text/javascript")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if err := WriteWithTimeout(w, buf.Bytes()); err != nil {
+		h.storeError(ctx, err, req)
+	}
+}
+
+// esmModule returns an ES module that runs the loader JS. GopherJS relies on globals shared between the
+// package files (and exports with js.Global), which doesn't work in module scope, so the loader is added
+// as a classic script rather than being inlined. The default export is a promise that resolves to the
+// global object once the package has loaded and main has started. window.jsgoProgress is still called
+// if it's set.
+func esmModule(loader string) string {
+	return fmt.Sprintf(`const ready = new Promise((resolve, reject) => {
+	const progress = window.jsgoProgress;
+	window.jsgoProgress = (count, total) => {
+		if (progress) {
+			progress(count, total);
+		}
+		if (count === total) {
+			resolve(window);
+		}
+	};
+	const script = document.createElement("script");
+	script.src = %q;
+	script.onerror = () => reject(new Error("error loading " + script.src));
+	document.head.appendChild(script);
+});
+export default ready;
+`, loader)
+}
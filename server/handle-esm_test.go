@@ -0,0 +1,18 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEsmModule(t *testing.T) {
+	m := esmModule("https://pkg.jsgo.io/github.com/a/b.0123.js")
+	for _, expected := range []string{
+		`script.src = "https://pkg.jsgo.io/github.com/a/b.0123.js";`,
+		"export default ready;",
+	} {
+		if !strings.Contains(m, expected) {
+			t.Fatalf("expected %q in:\n%s", expected, m)
+		}
+	}
+}
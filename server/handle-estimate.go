@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/store"
+)
+
+// Estimate is the response of the estimate endpoint.
+type Estimate struct {
+	Path string
+
+	// Cached is true if a successful compile of the package is stored, so its files can be served
+	// without compiling.
+	Cached  bool
+	BuildId string // the build id of the stored compile, if Cached
+
+	// Seconds is a best-effort estimate of the time to fetch and compile the package, based on recent
+	// compiles of a similar size. It's zero if there isn't enough history to estimate.
+	Seconds float64
+	Samples int // Number of compiles the estimate is based on
+
+	Running    int // Compiles running now
+	Waiting    int // Compiles waiting for a slot
+	Concurrent int // Maximum concurrent compiles
+}
+
+// EstimateHandler returns an Estimate for /_estimate/<path>. Nothing is fetched or compiled. The size of
+// a package is only known from its previous compile, so packages that haven't been compiled are
+// estimated from all recent compiles. Estimates aren't available in local mode.
+func (h *Handler) EstimateHandler(w http.ResponseWriter, req *http.Request) {
+	h = h.tenant(req)
+
+	ctx, cancel := context.WithTimeout(req.Context(), config.PageTimeout)
+	defer cancel()
+
+	path := strings.Trim(strings.TrimPrefix(req.URL.Path, "/_estimate/"), "/")
+	if path == "" {
+		notFound(w, req)
+		return
+	}
+
+	found, data, err := store.Package(ctx, h.Database, path)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	e := Estimate{Path: path, Cached: found && data.Success}
+	if e.Cached {
+		e.BuildId = data.Min.Main
+	}
+	e.Running, e.Waiting = h.Queue.Stats()
+	e.Concurrent = h.Queue.Concurrent()
+
+	if h.Datastore != nil {
+		success := true
+		compiles, _, _, err := store.Compiles(ctx, h.Datastore, store.CompileQuery{Success: &success, Limit: config.EstimateSamples})
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		var size int64
+		if found {
+			size = data.Min.RawBytes
+		}
+		duration, samples := estimate(compiles, size)
+		e.Seconds, e.Samples = duration.Seconds(), samples
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(e)
+}
+
+// estimate returns the median duration of the compiles with output between half and double size. If
+// size is zero or there are fewer than config.EstimateMinSimilar of these, all the compiles are used.
+// Compiles without a recorded duration are ignored.
+func estimate(compiles []store.CompileData, size int64) (time.Duration, int) {
+	var all, similar []time.Duration
+	for _, c := range compiles {
+		if c.Duration <= 0 {
+			continue
+		}
+		all = append(all, c.Duration)
+		if size > 0 && c.Min.RawBytes >= size/2 && c.Min.RawBytes <= size*2 {
+			similar = append(similar, c.Duration)
+		}
+	}
+	durations := all
+	if len(similar) >= config.EstimateMinSimilar {
+		durations = similar
+	}
+	if len(durations) == 0 {
+		return 0, 0
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	return durations[len(durations)/2], len(durations)
+}
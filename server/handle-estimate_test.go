@@ -0,0 +1,42 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dave/jsgo/server/store"
+)
+
+func TestEstimate(t *testing.T) {
+	compile := func(seconds int, size int64) store.CompileData {
+		c := store.CompileData{Duration: time.Duration(seconds) * time.Second}
+		c.Min.RawBytes = size
+		return c
+	}
+	var compiles []store.CompileData
+	for i := 1; i <= 5; i++ {
+		compiles = append(compiles, compile(i, 1000))   // small: 1-5s
+		compiles = append(compiles, compile(i*10, 1e6)) // large: 10-50s
+	}
+	compiles = append(compiles, compile(0, 1000)) // no duration recorded
+
+	tests := []struct {
+		size     int64
+		expected time.Duration
+		samples  int
+	}{
+		{0, 10 * time.Second, 10},     // unknown size: median of all
+		{1500, 3 * time.Second, 5},    // similar to the small ones
+		{800000, 30 * time.Second, 5}, // similar to the large ones
+		{50000, 10 * time.Second, 10}, // nothing similar: median of all
+	}
+	for _, test := range tests {
+		found, samples := estimate(compiles, test.size)
+		if found != test.expected || samples != test.samples {
+			t.Errorf("size %d: expected %v from %d, found %v from %d", test.size, test.expected, test.samples, found, samples)
+		}
+	}
+	if found, samples := estimate(nil, 0); found != 0 || samples != 0 {
+		t.Errorf("expected no estimate, found %v from %d", found, samples)
+	}
+}
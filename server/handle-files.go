@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/store"
+)
+
+var buildIdPath = regexp.MustCompile(`^/_files/([0-9a-f]{1,128})$`)
+
+// FilesHandler lists the files of a compile output with their sizes and sha256 hashes. The path is
+// /_files/<build id>, where the build id is the hash of the main package file (see Manifest). The list
+// never changes for a build id, so it can be cached forever. A tenant's builds are in its namespace.
+func (h *Handler) FilesHandler(w http.ResponseWriter, req *http.Request) {
+	matches := buildIdPath.FindStringSubmatch(req.URL.Path)
+	if matches == nil {
+		notFound(w, req)
+		return
+	}
+
+	h = h.tenant(req)
+	ctx, cancel := context.WithTimeout(req.Context(), config.PageTimeout)
+	defer cancel()
+
+	found, data, err := store.Build(ctx, h.Database, matches[1])
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if !found {
+		notFound(w, req)
+		return
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Cache-Control", "public,max-age=31536000,immutable")
+	w.Header().Set("Content-Type", "application/json")
+	if err := WriteWithTimeout(w, b); err != nil {
+		h.storeError(ctx, err, req)
+	}
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/dave/jsgo/server/memstore"
+	"github.com/dave/jsgo/server/store"
+)
+
+func TestFiles(t *testing.T) {
+	db := memstore.NewDatabase()
+	h := &Handler{Database: db}
+	stored := store.BuildData{
+		Path:      "github.com/a/b",
+		Min:       true,
+		Version:   "v1",
+		Toolchain: "t1",
+		Files: []store.BuildFile{
+			{Name: "prelude.p1.js", Size: 7, Hash: "aa"},
+			{Name: "github.com/a/b.m1.js", Size: 4, Hash: "bb"},
+		},
+	}
+	if err := store.StoreBuild(context.Background(), db, "f00d", stored); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	h.FilesHandler(w, httptest.NewRequest("GET", "/_files/f00d", nil))
+	var found store.BuildData
+	if err := json.Unmarshal(w.Body.Bytes(), &found); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != 200 || !reflect.DeepEqual(found, stored) {
+		t.Fatalf("unexpected response %d %#v", w.Code, found)
+	}
+
+	for _, path := range []string{"/_files/beef", "/_files/../x"} {
+		w = httptest.NewRecorder()
+		h.FilesHandler(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != 404 {
+			t.Fatalf("%s: expected 404, got %d", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/store"
+)
+
+type Manifest struct {
+	Path    string
+	Min     bool
+	Split   bool   // the files are combined into one file per chunk (see splitFiles)
+	BuildId string // the hash of the main package file
+	Files   []ManifestFile
+
+	// Versions of the server and the compiler that built the files. Empty for packages compiled before
+	// the versions were recorded.
+	Version   string
+	Toolchain string
+
+	// Total size of the files, raw and gzipped, and the compression ratio (gzipped / raw). Zero for
+	// packages compiled before the sizes were recorded.
+	RawBytes  int64
+	GzipBytes int64
+	Ratio     float64
+
+	// Stale is true if a later compile of the package failed, and the client was served this build
+	// instead (see messages.Compile.Stale). It's not stored with the manifest.
+	Stale bool `json:",omitempty"`
+}
+
+type ManifestFile struct {
+	Url       string
+	Size      int
+	Integrity string // Subresource integrity hash
+	Chunk     string // RuntimeChunk or PackageChunk
+}
+
+const (
+	// RuntimeChunk files are the prelude, standard library and shared packages. These are shared
+	// between all compiled packages, so will often already be in the browser cache.
+	RuntimeChunk = "runtime"
+
+	// PackageChunk files are specific to the compiled package.
+	PackageChunk = "package"
+)
+
+// chunk returns the chunk that the package at path belongs to. The boundary between the runtime and
+// the package chunks is the standard library plus config.RuntimeChunkPackages.
+func chunk(path string, standard bool) string {
+	if standard {
+		return RuntimeChunk
+	}
+	for _, prefix := range config.RuntimeChunkPackages {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return RuntimeChunk
+		}
+	}
+	return PackageChunk
+}
+
+// ManifestHandler lists the files for the most recent compile of a package, with sizes and integrity
+// hashes. The path is /_manifest/<path>, and the un-minified files are listed if the max parameter is
+// set. If the split parameter is set, the files are combined into one file per chunk with a loader for
+// the chunks (see splitFiles). The manifest is stored in the pkg bucket next to the files it lists, so
+// it's only generated once. A tenant's manifest lists the files in its namespace.
+func (h *Handler) ManifestHandler(w http.ResponseWriter, req *http.Request) {
+	h = h.tenant(req)
+
+	ctx, cancel := context.WithTimeout(req.Context(), config.PageTimeout)
+	defer cancel()
+
+	path := strings.Trim(strings.TrimPrefix(req.URL.Path, "/_manifest/"), "/")
+	min := req.FormValue("max") == ""
+	split := req.FormValue("split") != ""
+
+	found, data, err := store.Package(ctx, h.Database, path)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if !found {
+		notFound(w, req)
+		return
+	}
+
+	contents := data.Max
+	if min {
+		contents = data.Min
+	}
+
+	name := fmt.Sprintf("%s.%s.manifest.json", path, contents.Main)
+	if split {
+		name = fmt.Sprintf("%s.%s.split.manifest.json", path, contents.Main)
+	}
+
+	buf := &bytes.Buffer{}
+	exists, err := h.Fileserver.Read(ctx, config.Bucket[config.Pkg], name, buf)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if !exists {
+		manifest, err := h.createManifest(ctx, path, min, split, contents)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		manifest.Version, manifest.Toolchain = data.Version, data.Toolchain
+		if err := json.NewEncoder(buf).Encode(manifest); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		if _, err := h.Fileserver.Write(ctx, config.Bucket[config.Pkg], name, bytes.NewReader(buf.Bytes()), false, "application/json", "public,max-age=31536000,immutable"); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	}
+
+	etag := contents.Main
+	if data.Stale {
+		var manifest Manifest
+		if err := json.Unmarshal(buf.Bytes(), &manifest); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		manifest.Stale = true
+		buf.Reset()
+		if err := json.NewEncoder(buf).Encode(manifest); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		etag += "-stale"
+	}
+
+	// The manifest for a path changes when it's re-compiled, so only the stored copy is immutable.
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", fmt.Sprintf(`"%s"`, etag))
+	w.Header().Set("Content-Type", "application/json")
+	if err := WriteWithTimeout(w, buf.Bytes()); err != nil {
+		h.storeError(ctx, err, req)
+	}
+}
+
+func (h *Handler) createManifest(ctx context.Context, path string, min, split bool, contents store.CompileContents) (Manifest, error) {
+	manifest := Manifest{
+		Path:      path,
+		Min:       min,
+		Split:     split,
+		BuildId:   contents.Main,
+		RawBytes:  contents.RawBytes,
+		GzipBytes: contents.GzipBytes,
+		Ratio:     contents.Ratio,
+	}
+	if split {
+		files, err := h.splitFiles(ctx, path, contents)
+		if err != nil {
+			return Manifest{}, err
+		}
+		manifest.Files = files
+		return manifest, nil
+	}
+
+	var names, chunks []string
+	for _, p := range contents.Packages {
+		names = append(names, fmt.Sprintf("%s.%s.js", p.Path, p.Hash))
+		chunks = append(chunks, chunk(p.Path, p.Standard))
+	}
+	names = append(names, fmt.Sprintf("%s.%s.js", path, contents.Main))
+	chunks = append(chunks, PackageChunk)
+
+	manifest.Files = make([]ManifestFile, len(names))
+
+	var wg sync.WaitGroup
+	var m sync.Mutex
+	var outer error
+	sem := make(chan struct{}, config.ConcurrentStorageUploads)
+	for i, name := range names {
+		i, name := i, name
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			file, err := h.manifestFile(ctx, name)
+			if err != nil {
+				m.Lock()
+				outer = err
+				m.Unlock()
+				return
+			}
+			file.Chunk = chunks[i]
+			manifest.Files[i] = file
+		}()
+	}
+	wg.Wait()
+	if outer != nil {
+		return Manifest{}, outer
+	}
+	return manifest, nil
+}
+
+func (h *Handler) manifestFile(ctx context.Context, name string) (ManifestFile, error) {
+	b, err := h.readPkg(ctx, name)
+	if err != nil {
+		return ManifestFile{}, err
+	}
+	return h.manifestEntry(name, b), nil
+}
+
+// readPkg reads a file from the pkg bucket.
+func (h *Handler) readPkg(ctx context.Context, name string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	found, err := h.Fileserver.Read(ctx, config.Bucket[config.Pkg], name, buf)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%s not found", name)
+	}
+	return buf.Bytes(), nil
+}
+
+// manifestEntry describes the file in the pkg bucket with the name and contents.
+func (h *Handler) manifestEntry(name string, b []byte) ManifestFile {
+	sum := sha512.Sum384(b)
+	return ManifestFile{
+		Url:       fmt.Sprintf("%s://%s/%s", config.Protocol[config.Pkg], h.pkgHost(), name),
+		Size:      len(b),
+		Integrity: "sha384-" + base64.StdEncoding.EncodeToString(sum[:]),
+	}
+}
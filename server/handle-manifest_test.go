@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/memstore"
+	"github.com/dave/jsgo/server/store"
+)
+
+func TestManifestSizes(t *testing.T) {
+	pkg := config.Bucket[config.Pkg]
+	h := &Handler{Fileserver: memstore.NewFileserver(map[string]string{
+		pkg + ":github.com/a/b.m1.js": "main",
+		pkg + ":prelude.p1.js":        "prelude",
+	})}
+	contents := store.CompileContents{
+		Main:      "m1",
+		Packages:  []store.CompilePackage{{Path: "prelude", Hash: "p1", Standard: true}},
+		RawBytes:  11,
+		GzipBytes: 22,
+		Ratio:     2,
+	}
+	manifest, err := h.createManifest(context.Background(), "github.com/a/b", true, false, contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.RawBytes != 11 || manifest.GzipBytes != 22 || manifest.Ratio != 2 {
+		t.Fatalf("expected sizes in manifest, found %d, %d, %v", manifest.RawBytes, manifest.GzipBytes, manifest.Ratio)
+	}
+	if len(manifest.Files) != 2 || manifest.Files[1].Size != 4 {
+		t.Fatalf("unexpected files %#v", manifest.Files)
+	}
+	if manifest.BuildId != "m1" {
+		t.Fatalf("expected build id m1, found %q", manifest.BuildId)
+	}
+}
+
+func TestManifestVersions(t *testing.T) {
+	pkg := config.Bucket[config.Pkg]
+	db := memstore.NewDatabase()
+	h := &Handler{Database: db, Fileserver: memstore.NewFileserver(map[string]string{pkg + ":github.com/a/b.m1.js": "main"})}
+	data := store.CompileData{Min: store.CompileContents{Main: "m1"}, Version: "v1", Toolchain: "t1"}
+	if err := store.StoreCompile(context.Background(), db, "github.com/a/b", data); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ManifestHandler(w, httptest.NewRequest("GET", "/_manifest/github.com/a/b", nil))
+	var manifest Manifest
+	if err := json.Unmarshal(w.Body.Bytes(), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Version != "v1" || manifest.Toolchain != "t1" || manifest.Stale {
+		t.Fatalf("expected versions in manifest, found %q, %q", manifest.Version, manifest.Toolchain)
+	}
+
+	// After a failed compile served the last good build, the manifest says it's stale.
+	if err := store.MarkStale(context.Background(), db, "github.com/a/b"); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	h.ManifestHandler(w, httptest.NewRequest("GET", "/_manifest/github.com/a/b", nil))
+	manifest = Manifest{}
+	if err := json.Unmarshal(w.Body.Bytes(), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if !manifest.Stale || manifest.BuildId != "m1" || w.Header().Get("ETag") != `"m1-stale"` {
+		t.Fatalf("expected a stale manifest, found %#v %s", manifest, w.Header().Get("ETag"))
+	}
+}
+
+func TestManifestSplit(t *testing.T) {
+	pkg := config.Bucket[config.Pkg]
+	fs := memstore.NewFileserver(map[string]string{
+		pkg + ":prelude.p1.js":        "$load.prelude=1;",
+		pkg + ":runtime.r1.js":        "$load.runtime=1;",
+		pkg + ":github.com/a/c.c1.js": "$load.c=1;",
+		pkg + ":github.com/a/b.b1.js": "$load.b=1;",
+		pkg + ":github.com/a/d.d1.js": "$load.d=1;",
+	})
+	h := &Handler{Fileserver: fs}
+	runtime := []store.CompilePackage{
+		{Path: "prelude", Hash: "p1", Standard: true},
+		{Path: "runtime", Hash: "r1", Standard: true},
+	}
+	contents := store.CompileContents{
+		Main:     "m1",
+		Packages: append(append([]store.CompilePackage{}, runtime...), store.CompilePackage{Path: "github.com/a/c", Hash: "c1"}, store.CompilePackage{Path: "github.com/a/b", Hash: "b1"}),
+	}
+	manifest, err := h.createManifest(context.Background(), "github.com/a/b", true, true, contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !manifest.Split || len(manifest.Files) != 3 {
+		t.Fatalf("expected two chunks and a loader, found %#v", manifest.Files)
+	}
+	if manifest.Files[0].Chunk != RuntimeChunk || manifest.Files[0].Size != len("$load.prelude=1;$load.runtime=1;") {
+		t.Fatalf("unexpected runtime chunk %#v", manifest.Files[0])
+	}
+	if manifest.Files[1].Chunk != PackageChunk || manifest.Files[1].Size != len("$load.c=1;$load.b=1;") {
+		t.Fatalf("unexpected package chunk %#v", manifest.Files[1])
+	}
+	loader := fs.Files[pkg+":github.com/a/b.m1.split.js"]
+	for _, s := range []string{manifest.Files[0].Url, manifest.Files[1].Url, `["prelude","runtime","github.com/a/c","github.com/a/b"]`, `$packages["github.com/a/b"]`} {
+		if !strings.Contains(loader, s) {
+			t.Fatalf("expected %q in the loader, found %s", s, loader)
+		}
+	}
+
+	// another package with the same runtime shares the runtime chunk
+	other := store.CompileContents{
+		Main:     "m2",
+		Packages: append(append([]store.CompilePackage{}, runtime...), store.CompilePackage{Path: "github.com/a/d", Hash: "d1"}),
+	}
+	second, err := h.createManifest(context.Background(), "github.com/a/d", true, true, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Files[0].Url != manifest.Files[0].Url || second.Files[1].Url == manifest.Files[1].Url {
+		t.Fatalf("expected only the runtime chunk to be shared, found %#v", second.Files)
+	}
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"encoding/json"
 	"net/http"
 	"strings"
 
@@ -44,8 +45,25 @@ func getPage(req *http.Request) pageType {
 	return UnknownPage
 }
 
+// site is the key for the page in per-site config.
+func (p pageType) site() string {
+	switch p {
+	case PlayPage:
+		return config.PlaySite
+	case JsgoPage:
+		return config.JsgoSite
+	case FrizzPage:
+		return config.FrizzSite
+	}
+	return ""
+}
+
 func (h *Handler) PageHandler(w http.ResponseWriter, req *http.Request) {
-	switch getPage(req) {
+	page := getPage(req)
+	if req.URL.Path == "/" && h.handleRoot(w, req, page) {
+		return
+	}
+	switch page {
 	case PlayPage:
 		play.Page(w, req, h.Database)
 		return
@@ -60,3 +78,28 @@ func (h *Handler) PageHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 }
+
+// handleRoot serves the root path as configured in config.RootPages. It returns false if the site's
+// default page should be served.
+func (h *Handler) handleRoot(w http.ResponseWriter, req *http.Request, page pageType) bool {
+	root, ok := config.RootPages[page.site()]
+	if !ok {
+		return false
+	}
+	switch root.Mode {
+	case config.RootRedirect:
+		http.Redirect(w, req, root.Redirect, http.StatusFound)
+		return true
+	case config.RootJson:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Name    string
+			Version string
+		}{
+			Name:    root.Name,
+			Version: config.Version,
+		})
+		return true
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dave/jsgo/config"
+)
+
+func TestHandleRoot(t *testing.T) {
+	defer func(previous map[string]config.RootConfig) { config.RootPages = previous }(config.RootPages)
+	config.RootPages = map[string]config.RootConfig{
+		config.JsgoSite: {Mode: config.RootRedirect, Redirect: "https://example.com/"},
+		config.PlaySite: {Mode: config.RootJson, Name: "example"},
+	}
+	h := &Handler{}
+
+	w := httptest.NewRecorder()
+	if !h.handleRoot(w, httptest.NewRequest("GET", "/", nil), JsgoPage) || w.Code != http.StatusFound || w.Header().Get("Location") != "https://example.com/" {
+		t.Fatalf("expected redirect, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	w = httptest.NewRecorder()
+	if !h.handleRoot(w, httptest.NewRequest("GET", "/", nil), PlayPage) || !strings.Contains(w.Body.String(), `"Name":"example"`) {
+		t.Fatalf("expected json, got %q", w.Body.String())
+	}
+
+	if h.handleRoot(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), FrizzPage) {
+		t.Fatal("expected default page")
+	}
+}
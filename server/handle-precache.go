@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/store"
+)
+
+var precachePath = regexp.MustCompile(`^/_precache/([0-9a-f]{1,128})$`)
+
+// PrecacheEntry is an entry in a service worker precache manifest. The field names are the ones Workbox
+// expects, so the manifest can be passed to precacheAndRoute as is.
+type PrecacheEntry struct {
+	Url      string `json:"url"`
+	Revision string `json:"revision"`
+}
+
+// PrecacheHandler returns a service worker precache manifest for a compile output: the URL of each file
+// in the pkg bucket, with the sha256 hash of the contents as the revision. The path is
+// /_precache/<build id> (see FilesHandler), so the manifest can be cached forever.
+func (h *Handler) PrecacheHandler(w http.ResponseWriter, req *http.Request) {
+	matches := precachePath.FindStringSubmatch(req.URL.Path)
+	if matches == nil {
+		notFound(w, req)
+		return
+	}
+
+	h = h.tenant(req)
+	ctx, cancel := context.WithTimeout(req.Context(), config.PageTimeout)
+	defer cancel()
+
+	found, data, err := store.Build(ctx, h.Database, matches[1])
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if !found {
+		notFound(w, req)
+		return
+	}
+
+	b, err := json.Marshal(precacheManifest(data, h.pkgHost()))
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Cache-Control", "public,max-age=31536000,immutable")
+	w.Header().Set("Content-Type", "application/json")
+	if err := WriteWithTimeout(w, b); err != nil {
+		h.storeError(ctx, err, req)
+	}
+}
+
+// precacheManifest returns the precache entries for the files of a compile output served from host, in
+// the order they were stored.
+func precacheManifest(data store.BuildData, host string) []PrecacheEntry {
+	entries := make([]PrecacheEntry, 0, len(data.Files))
+	for _, f := range data.Files {
+		entries = append(entries, PrecacheEntry{
+			Url:      fmt.Sprintf("%s://%s/%s", config.Protocol[config.Pkg], host, f.Name),
+			Revision: f.Hash,
+		})
+	}
+	return entries
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/memstore"
+	"github.com/dave/jsgo/server/store"
+)
+
+func TestPrecache(t *testing.T) {
+	db := memstore.NewDatabase()
+	h := &Handler{Database: db}
+	stored := store.BuildData{
+		Path: "github.com/a/b",
+		Min:  true,
+		Files: []store.BuildFile{
+			{Name: "prelude.p1.js", Size: 7, Hash: "aa"},
+			{Name: "github.com/a/b.m1.js", Size: 4, Hash: "bb"},
+		},
+	}
+	if err := store.StoreBuild(context.Background(), db, "f00d", stored); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	h.PrecacheHandler(w, httptest.NewRequest("GET", "/_precache/f00d", nil))
+	var found []map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &found); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != 200 || len(found) != len(stored.Files) {
+		t.Fatalf("unexpected response %d %v", w.Code, found)
+	}
+	for i, f := range stored.Files {
+		url := fmt.Sprintf("%s://%s/%s", config.Protocol[config.Pkg], config.PkgHostPath(), f.Name)
+		if found[i]["url"] != url || found[i]["revision"] != f.Hash {
+			t.Fatalf("entry %d: expected %s %s, found %v", i, url, f.Hash, found[i])
+		}
+	}
+	if w.Header().Get("Cache-Control") != "public,max-age=31536000,immutable" {
+		t.Fatalf("expected the manifest to be cacheable, found %q", w.Header().Get("Cache-Control"))
+	}
+
+	for _, path := range []string{"/_precache/beef", "/_precache/../x"} {
+		w = httptest.NewRecorder()
+		h.PrecacheHandler(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != 404 {
+			t.Fatalf("%s: expected 404, got %d", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/gitremote"
+	"github.com/dave/jsgo/server/lru"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// Refs lists the branches and tags of a repo.
+type Refs struct {
+	Path     string
+	Branches []string
+	Tags     []string
+}
+
+// RefsHandler lists the branches and tags of the repo containing the package at /_refs/<path>, so a
+// version can be picked before compiling. The results are cached for config.RefsCacheTime.
+func (h *Handler) RefsHandler(w http.ResponseWriter, req *http.Request) {
+
+	ctx, cancel := context.WithTimeout(req.Context(), config.GitListTimeout)
+	defer cancel()
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(req.URL.Path, "/_refs/"), "/"), "/")
+	if len(parts) < 3 || !strings.Contains(parts[0], ".") {
+		http.Error(w, "path must include the host, user and repo (e.g. github.com/user/repo)", http.StatusBadRequest)
+		return
+	}
+	repo := strings.Join(parts[:3], "/")
+	if !gitremote.Allowed(repo) {
+		http.Error(w, fmt.Sprintf("refs can only be listed for repos on %s", strings.Join(config.GitRemoteHosts, ", ")), http.StatusBadRequest)
+		return
+	}
+
+	refs, err := lookupRefs(ctx, repo)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(refs)
+}
+
+// refsCache holds the Refs of recently listed repos.
+var refsCache = lru.New(config.RefsCacheSize, config.RefsCacheTime)
+
+func lookupRefs(ctx context.Context, repo string) (Refs, error) {
+	if refs, ok := refsCache.Get(repo); ok {
+		return refs.(Refs), nil
+	}
+	list, err := gitremote.List(ctx, repo)
+	if err != nil {
+		return Refs{}, err
+	}
+	refs, err := sortRefs(repo, list)
+	if err != nil {
+		return Refs{}, err
+	}
+	refsCache.Add(repo, refs)
+	return refs, nil
+}
+
+// sortRefs splits the refs into sorted branches and tags. Repos with more than config.GitMaxRefs refs are
+// rejected.
+func sortRefs(repo string, list []*plumbing.Reference) (Refs, error) {
+	if len(list) > config.GitMaxRefs {
+		return Refs{}, fmt.Errorf("%s has %d refs - the maximum is %d", repo, len(list), config.GitMaxRefs)
+	}
+	refs := Refs{Path: repo, Branches: []string{}, Tags: []string{}}
+	for _, r := range list {
+		switch {
+		case r.Name().IsBranch():
+			refs.Branches = append(refs.Branches, r.Name().Short())
+		case r.Name().IsTag():
+			refs.Tags = append(refs.Tags, r.Name().Short())
+		}
+	}
+	sort.Strings(refs.Branches)
+	sort.Strings(refs.Tags)
+	return refs, nil
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dave/jsgo/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+func TestSortRefs(t *testing.T) {
+	hash := plumbing.NewHash("0123456789abcdef0123456789abcdef01234567")
+	list := []*plumbing.Reference{
+		plumbing.NewHashReference("refs/heads/master", hash),
+		plumbing.NewHashReference("refs/tags/v1.1.0", hash),
+		plumbing.NewHashReference("refs/heads/develop", hash),
+		plumbing.NewHashReference("refs/tags/v1.0.0", hash),
+		plumbing.NewSymbolicReference("HEAD", "refs/heads/master"),
+		plumbing.NewHashReference("refs/pull/1/head", hash),
+	}
+	refs, err := sortRefs("github.com/a/b", list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs.Branches) != 2 || refs.Branches[0] != "develop" || refs.Branches[1] != "master" {
+		t.Fatalf("unexpected branches: %v", refs.Branches)
+	}
+	if len(refs.Tags) != 2 || refs.Tags[0] != "v1.0.0" || refs.Tags[1] != "v1.1.0" {
+		t.Fatalf("unexpected tags: %v", refs.Tags)
+	}
+
+	for len(list) <= config.GitMaxRefs {
+		list = append(list, list[0])
+	}
+	if _, err := sortRefs("github.com/a/b", list); err == nil {
+		t.Fatal("expected error for too many refs")
+	}
+}
+
+func TestRefsHandlerHosts(t *testing.T) {
+	h := &Handler{}
+	for path, expected := range map[string]int{
+		"/_refs/a/b":                        http.StatusBadRequest,
+		"/_refs/localhost:6060/a/b":         http.StatusBadRequest,
+		"/_refs/169.254.169.254/a/b":        http.StatusBadRequest,
+		"/_refs/github.com.example.com/a/b": http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		h.RefsHandler(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != expected {
+			t.Errorf("%s: expected %d, found %d", path, expected, w.Code)
+		}
+	}
+}
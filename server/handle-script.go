@@ -1,7 +1,10 @@
 package server
 
 import (
+	"crypto/sha1"
+	"fmt"
 	"net/http"
+	"sync"
 
 	"bytes"
 	"strings"
@@ -16,7 +19,7 @@ import (
 
 func (h *Handler) ScriptHandler(w http.ResponseWriter, req *http.Request) {
 	if !config.DEV {
-		http.Error(w, "script only available in dev mode", 404)
+		notFound(w, req)
 		return
 	}
 	if err := h.handleScript(w, req); err != nil {
@@ -39,10 +42,50 @@ func (h *Handler) handleScript(w http.ResponseWriter, req *http.Request) error {
 	isPkg := strings.HasSuffix(req.URL.Path, ".js")
 	isMap := strings.HasSuffix(req.URL.Path, ".js.map")
 
+	switch {
+	case isPkg:
+		script, sourceMap, err := compileScript(path, config.Reproducible)
+		if err != nil {
+			return err
+		}
+		sourceMaps.Store(path, sourceMap)
+		return writeScript(w, req, script)
+
+	case isMap:
+		return h.serveSourceMap(w, req, path)
+	}
+	return nil
+}
+
+// serveSourceMap serves the source map for the most recent compile of path, or 404 if there isn't one.
+func (h *Handler) serveSourceMap(w http.ResponseWriter, req *http.Request, path string) error {
+	b, ok := sourceMaps.Load(path)
+	if !ok {
+		notFound(w, req)
+		return nil
+	}
+	encoding, _ := negotiate(req, "gzip")
+	switch {
+	case encoding != "gzip":
+		logSkipped(req, "gzip")
+	case len(b) < config.StreamGzipMinSize:
+		logCompression(req, "", "skipped: below threshold")
+	default:
+		logCompression(req, "gzip", "gzip: streamed")
+		return writeScriptGzip(w, req, b)
+	}
+	return writeScript(w, req, b)
+}
+
+// compileScript compiles the package at path to a single JS file with a source map. In reproducible
+// mode the output doesn't depend on the machine doing the build: source map entries refer to import
+// paths instead of local files.
+func compileScript(path string, reproducible bool) (script, sourceMap []byte, err error) {
+
 	options := &gbuild.Options{
 		Quiet:          true,
 		CreateMapFile:  true,
-		MapToLocalDisk: true,
+		MapToLocalDisk: !reproducible,
 		BuildTags:      []string{"jsgo", "dev"},
 	}
 
@@ -54,53 +97,93 @@ func (h *Handler) handleScript(w http.ResponseWriter, req *http.Request) error {
 	s := gbuild.NewSession(options)
 	pkg, err := gbuild.Import(path, 0, s.InstallSuffix(), options.BuildTags)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	switch {
-	case isPkg:
-		buf := new(bytes.Buffer)
-		err := func() error {
-			archive, err := s.BuildPackage(pkg)
-			if err != nil {
-				return err
-			}
-
-			sourceMapFilter := &compiler.SourceMapFilter{Writer: buf}
-			m := &sourcemap.Map{File: "_script.js"}
-			sourceMapFilter.MappingCallback = gbuild.NewMappingCallback(m, options.GOROOT, options.GOPATH, options.MapToLocalDisk)
-
-			deps, err := compiler.ImportDependencies(archive, s.BuildImportPath)
-			if err != nil {
-				return err
-			}
-			if err := compiler.WriteProgramCode(deps, sourceMapFilter); err != nil {
-				return err
-			}
-
-			mapBuf := new(bytes.Buffer)
-			m.WriteTo(mapBuf)
-			buf.WriteString("//# sourceMappingURL=_script.js.map\n")
-			lastMaps[path] = mapBuf.Bytes()
-			return nil
-		}()
-		if err != nil {
-			return err
-		}
-		w.Header().Set("Cache-Control", "no-cache")
-		w.Header().Set("Content-Type", "application/javascript")
-		if _, err := io.Copy(w, buf); err != nil {
-			return err
-		}
+	archive, err := s.BuildPackage(pkg)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	case isMap:
-		w.Header().Set("Cache-Control", "no-cache")
-		w.Header().Set("Content-Type", "application/javascript")
-		if _, err := io.Copy(w, bytes.NewBuffer(lastMaps[path])); err != nil {
-			return err
-		}
+	buf := new(bytes.Buffer)
+	sourceMapFilter := &compiler.SourceMapFilter{Writer: buf}
+	m := &sourcemap.Map{File: "_script.js"}
+	sourceMapFilter.MappingCallback = gbuild.NewMappingCallback(m, options.GOROOT, options.GOPATH, options.MapToLocalDisk)
+
+	deps, err := compiler.ImportDependencies(archive, s.BuildImportPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := compiler.WriteProgramCode(deps, sourceMapFilter); err != nil {
+		return nil, nil, err
+	}
+
+	mapBuf := new(bytes.Buffer)
+	m.WriteTo(mapBuf)
+	buf.WriteString("//# sourceMappingURL=_script.js.map\n")
+	return buf.Bytes(), mapBuf.Bytes(), nil
+}
+
+// writeScript writes the headers for a script or source map, and the body unless this is a HEAD
+// request.
+func writeScript(w http.ResponseWriter, req *http.Request, b []byte) error {
+	setArtifactCors(w.Header())
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Type", "application/javascript")
+	w.Header().Set("Content-Length", fmt.Sprint(len(b)))
+	w.Header().Set("ETag", fmt.Sprintf(`"%x"`, sha1.Sum(b)))
+	if req.Method == http.MethodHead {
+		return nil
+	}
+	if _, err := io.Copy(w, bytes.NewBuffer(b)); err != nil {
+		return err
 	}
 	return nil
 }
 
-var lastMaps = map[string][]byte{}
+// writeScriptGzip is writeScript for large source maps: the body is gzipped while streaming.
+func writeScriptGzip(w http.ResponseWriter, req *http.Request, b []byte) error {
+	setArtifactCors(w.Header())
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Type", "application/javascript")
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-gzip"`, sha1.Sum(b)))
+	if req.Method == http.MethodHead {
+		return nil
+	}
+	return StreamGzipWithTimeout(w, bytes.NewReader(b))
+}
+
+// setArtifactCors allows scripts and source maps to be read cross-origin (see
+// config.ArtifactAllowOrigin), including the headers clients use to check them.
+func setArtifactCors(header http.Header) {
+	if config.ArtifactAllowOrigin == "" {
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", config.ArtifactAllowOrigin)
+	header.Set("Access-Control-Expose-Headers", "ETag")
+	if config.ArtifactAllowOrigin != "*" {
+		header.Add("Vary", "Origin")
+	}
+}
+
+// sourceMaps holds the source map for the most recent compile of each path.
+var sourceMaps = &memoryMaps{maps: map[string][]byte{}}
+
+type memoryMaps struct {
+	m    sync.Mutex
+	maps map[string][]byte
+}
+
+func (s *memoryMaps) Store(path string, sourceMap []byte) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.maps[path] = sourceMap
+}
+
+func (s *memoryMaps) Load(path string) ([]byte, bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	b, ok := s.maps[path]
+	return b, ok
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"bytes"
+	"go/build"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dave/jsgo/config"
+)
+
+func TestCompileScriptReproducible(t *testing.T) {
+	const path = "github.com/dave/jsgo/server/frizz/gotypes/bug"
+	script1, map1, err := compileScript(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script2, map2, err := compileScript(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(script1, script2) {
+		t.Fatal("script output differs between identical compiles")
+	}
+	if !bytes.Equal(map1, map2) {
+		t.Fatal("source map output differs between identical compiles")
+	}
+	if gopath := build.Default.GOPATH; gopath != "" && bytes.Contains(map1, []byte(gopath)) {
+		t.Fatal("reproducible source map refers to local files")
+	}
+}
+
+func TestScriptCors(t *testing.T) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/_script.js", nil)
+	req.Header.Set("Origin", "https://example.com")
+	if err := writeScript(w, req, []byte("var a;")); err != nil {
+		t.Fatal(err)
+	}
+	if found := w.Header().Get("Access-Control-Allow-Origin"); found != "*" {
+		t.Fatalf("expected *, found %q", found)
+	}
+
+	defer func(origin string) { config.ArtifactAllowOrigin = origin }(config.ArtifactAllowOrigin)
+	config.ArtifactAllowOrigin = "https://example.com"
+	w = httptest.NewRecorder()
+	if err := writeScriptGzip(w, httptest.NewRequest("HEAD", "/_script.js.map", nil), []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://example.com" || w.Header().Get("Vary") != "Origin" {
+		t.Fatalf("unexpected headers %v", w.Header())
+	}
+}
+
+func TestScriptHead(t *testing.T) {
+	defer func(m *memoryMaps) { sourceMaps = m }(sourceMaps)
+	sourceMaps = &memoryMaps{maps: map[string][]byte{}}
+	h := &Handler{}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("HEAD", "/_script.js", nil)
+	if err := writeScript(w, req, []byte("var a = 1;")); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != 200 || w.Body.Len() != 0 {
+		t.Fatalf("expected 200 with empty body, got %d %q", w.Code, w.Body.String())
+	}
+	for header, expected := range map[string]string{
+		"Content-Length": "10",
+		"Content-Type":   "application/javascript",
+		"Cache-Control":  "no-cache",
+	} {
+		if found := w.Header().Get(header); found != expected {
+			t.Fatalf("expected %s %q, got %q", header, expected, found)
+		}
+	}
+	if w.Header().Get("ETag") == "" {
+		t.Fatal("expected ETag")
+	}
+
+	// a stored source map
+	sourceMaps.Store("a", []byte(`{"version":3}`))
+	w = httptest.NewRecorder()
+	if err := h.serveSourceMap(w, httptest.NewRequest("HEAD", "/_script.js.map", nil), "a"); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != 200 || w.Body.Len() != 0 || w.Header().Get("Content-Length") != "13" {
+		t.Fatalf("expected 200 with Content-Length 13 and empty body, got %d %q %q", w.Code, w.Header().Get("Content-Length"), w.Body.String())
+	}
+
+	// a large source map is compressed as it's streamed, so the length isn't known
+	sourceMaps.Store("b", make([]byte, config.StreamGzipMinSize))
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("HEAD", "/_script.js.map", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	if err := h.serveSourceMap(w, req, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != 200 || w.Body.Len() != 0 || w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Content-Length") != "" {
+		t.Fatalf("expected 200 gzip with no Content-Length and empty body, got %d %v", w.Code, w.Header())
+	}
+
+	// a missing artifact
+	w = httptest.NewRecorder()
+	if err := h.serveSourceMap(w, httptest.NewRequest("HEAD", "/_script.js.map", nil), "missing"); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+}
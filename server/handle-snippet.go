@@ -0,0 +1,97 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/dave/jsgo/config"
+)
+
+// snippetPath is the package path that snippets are compiled as. The output is stored by hash, so
+// snippets never replace each other.
+const snippetPath = "snippet"
+
+// SnippetHandler compiles a single Go file posted to /_snippet/, for "run this snippet" widgets. The
+// file may omit the package clause, in which case it's compiled as package main. Like an upload, only
+// the standard library can be imported, the source is only held in memory for the compile, and the
+// response is an UploadResult. Syntax errors are returned with status 400, one per line (or as a
+// CompileError, see compileError).
+func (h *Handler) SnippetHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), config.RequestTimeout)
+	defer cancel()
+
+	// The size is limited to config.MaxSnippetSize by LimitBody.
+	b, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	source, err := snippetSource(b)
+	if err != nil {
+		compileError(w, req, err, http.StatusBadRequest)
+		return
+	}
+
+	end, err := h.queueSlot(ctx, req)
+	if err != nil {
+		if ctx.Err() == nil {
+			slotError(w, req, err)
+		}
+		return
+	}
+	defer close(end)
+
+	result, err := h.tenant(req).compileUpload(ctx, snippetPath, map[string][]byte{"main.go": source})
+	if err != nil {
+		h.storeError(ctx, err, req)
+		compileError(w, req, err, 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// snippetSource returns the source of a snippet as a complete package main file, adding the package
+// clause if it's missing. Syntax errors are returned with all the diagnostics.
+func snippetSource(b []byte) ([]byte, error) {
+	if len(bytes.TrimSpace(b)) == 0 {
+		return nil, errors.New("empty snippet")
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "main.go", b, parser.PackageClauseOnly); err != nil {
+		// Without a package clause the first token is something else. The line directive keeps the
+		// positions in diagnostics the same as the snippet.
+		b = append([]byte("package main\n//line main.go:1:1\n"), b...)
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), "main.go", b, parser.AllErrors)
+	if err != nil {
+		if list, ok := err.(scanner.ErrorList); ok {
+			list.Sort()
+			var lines []string
+			for _, e := range list {
+				lines = append(lines, e.Error())
+			}
+			return nil, errors.New(strings.Join(lines, "\n"))
+		}
+		return nil, err
+	}
+	if f.Name.Name != "main" {
+		return nil, fmt.Errorf("snippet must be package main, found package %s", f.Name.Name)
+	}
+	return b, nil
+}
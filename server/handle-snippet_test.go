@@ -0,0 +1,59 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSnippetSource(t *testing.T) {
+	tests := []struct {
+		source, prefix, err string
+	}{
+		{"package main\n\nfunc main() {}\n", "package main\n\nfunc main", ""},
+		{"import \"fmt\"\n\nfunc main() { fmt.Println(1) }\n", "package main\n//line main.go:1:1\nimport", ""},
+		{"func main() {\n\tx := \n}\n", "", "main.go:3:1: expected operand"},
+		{"func main() {\n\t)\n\t]\n}\n", "", "main.go:2:2: expected statement, found ')'\nmain.go:4:3: "},
+		{"package foo\n", "", "snippet must be package main, found package foo"},
+		{"  \n", "", "empty snippet"},
+	}
+	for _, test := range tests {
+		b, err := snippetSource([]byte(test.source))
+		if test.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Errorf("%q: expected error %q, found %v", test.source, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.source, err)
+			continue
+		}
+		if !strings.HasPrefix(string(b), test.prefix) {
+			t.Errorf("%q: unexpected source %q", test.source, b)
+		}
+	}
+}
+
+func TestSnippetDiagnostics(t *testing.T) {
+	h := &Handler{}
+	req := httptest.NewRequest("POST", "/_snippet/", strings.NewReader("func main() {\n\t)\n\t]\n}\n"))
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	h.SnippetHandler(w, req)
+	if w.Code != http.StatusBadRequest || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("expected a JSON error with status 400, found %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	var e CompileError
+	if err := json.NewDecoder(w.Body).Decode(&e); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Diagnostics.Diagnostics) != 3 || e.Raw == "" || e.Error == "" {
+		t.Fatalf("unexpected error %#v", e)
+	}
+	if d := e.Diagnostics.Diagnostics[1]; d.File != "main.go" || d.Line != 4 || d.Column != 3 {
+		t.Fatalf("unexpected diagnostic %#v", d)
+	}
+}
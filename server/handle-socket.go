@@ -7,9 +7,18 @@ import (
 	"net"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/backend"
+	"github.com/dave/jsgo/server/breaker"
+	"github.com/dave/jsgo/server/clientip"
+	"github.com/dave/jsgo/server/locale"
+	"github.com/dave/jsgo/server/progress"
+	"github.com/dave/jsgo/server/queue"
+	"github.com/dave/jsgo/server/requestid"
 	"github.com/dave/jsgo/server/servermsg"
 	"github.com/dave/services"
 	"github.com/dave/services/tracker"
@@ -27,6 +36,15 @@ type SocketHandlerInterface interface {
 	StoreError(ctx context.Context, err error, req *http.Request)
 }
 
+// LateSlotter is implemented by socket handlers that fetch before compiling. If LateSlot returns true,
+// Handle is called before a slot in the compile queue is taken, and must call queue.Wait with its context
+// before compiling, so a compile slot isn't held while fetching. By then the request is known, so
+// queue.WaitPredicted can give its predicted cache hit ratio, and likely-fast compiles can start first
+// (see config.QueueReorder).
+type LateSlotter interface {
+	LateSlot() bool
+}
+
 func (h *Handler) SocketHandler(s SocketHandlerInterface) func(w http.ResponseWriter, req *http.Request) {
 
 	return func(w http.ResponseWriter, req *http.Request) {
@@ -46,12 +64,27 @@ func (h *Handler) SocketHandler(s SocketHandlerInterface) func(w http.ResponseWr
 			cancel()
 		}()
 
-		conn, err := upgrader.Upgrade(w, req, nil)
+		// The upgrade response doesn't include the headers already set on w, so the request id is added
+		// here.
+		header := http.Header{}
+		header.Set(requestid.Header, req.Header.Get(requestid.Header))
+		conn, err := upgrader.Upgrade(w, req, header)
 		if err != nil {
 			h.storeError(ctx, fmt.Errorf("upgrading request to websocket: %v", err), req)
 			return
 		}
 
+		// The messages sent to the client are also written to the job log, so they can be retrieved after
+		// the client disconnects. The job id is sent to the client first. The log is only created by the
+		// send loop once the job has started (when started is closed), so queued or idle connections don't
+		// write logs.
+		jobId := newJobId()
+		var joblog *jobLog
+		started := make(chan struct{})
+
+		// The messages are also published to any watchers of the job (see WatchHandler).
+		h.Progress.Start(jobId)
+
 		var sendWg sync.WaitGroup
 		sendCh := make(chan services.Message, 256)
 		receive := make(chan services.Message, 256)
@@ -66,12 +99,16 @@ func (h *Handler) SocketHandler(s SocketHandlerInterface) func(w http.ResponseWr
 		}
 
 		defer func() {
-			finished = true // we won't be adding any more messages to the send channel
-			sendWg.Wait()   // wait for in-flight sends to finish
-			close(sendCh)   // close the sendChan, so the send loop will exit
-			conn.Close()    // finally close the websocket
+			finished = true          // we won't be adding any more messages to the send channel
+			sendWg.Wait()            // wait for in-flight sends to finish
+			close(sendCh)            // close the sendChan, so the send loop will exit
+			joblog.close()           // all messages have been written, so finish the log
+			h.Progress.Finish(jobId) // tell watchers the job is done
+			conn.Close()             // finally close the websocket
 		}()
 
+		send(servermsg.Job{Id: jobId})
+
 		// Recover from any panic and log the error.
 		defer func() {
 			if r := recover(); r != nil {
@@ -80,9 +117,13 @@ func (h *Handler) SocketHandler(s SocketHandlerInterface) func(w http.ResponseWr
 			}
 		}()
 
-		// Set up a ticker to ping the client regularly
+		// Set up a ticker to ping the client when the connection is idle. Messages already show the
+		// connection is working, so pings are sent less often while messages are being sent, and more often
+		// when it's quiet so dead clients are found sooner.
 		go func() {
-			ticker := time.NewTicker(s.WebsocketPingPeriod())
+			period, pongTimeout := s.WebsocketPingPeriod(), s.WebsocketPongTimeout()
+			ticker := time.NewTicker(period / 2)
+			last, lastPing := time.Now(), time.Now()
 			defer func() {
 				ticker.Stop()
 				cancel()
@@ -95,27 +136,55 @@ func (h *Handler) SocketHandler(s SocketHandlerInterface) func(w http.ResponseWr
 						conn.WriteMessage(websocket.CloseMessage, []byte{})
 						return
 					}
+					if joblog == nil {
+						select {
+						case <-started:
+							joblog = newJobLog(h.Fileserver, jobId)
+						default:
+						}
+					}
 					func() {
 						defer sendWg.Done()
 						b, messageType, err := s.MarshalMessage(message)
 						if err != nil {
 							return
 						}
-						conn.SetWriteDeadline(time.Now().Add(s.WebsocketTimeout()))
+						if messageType == websocket.TextMessage {
+							joblog.write(b)
+						}
+						h.Progress.Publish(jobId, progress.Message{Type: messageType, Payload: b})
+						timeout := s.WebsocketTimeout()
+						select {
+						case <-h.shutdown:
+							timeout = config.ShutdownWriteTimeout
+						default:
+						}
+						conn.SetWriteDeadline(time.Now().Add(timeout))
 						conn.WriteMessage(messageType, b)
+						last = time.Now()
 					}()
-				case <-ticker.C:
+				case now := <-ticker.C:
+					if !shouldPing(now, last, lastPing, period, pongTimeout) {
+						continue
+					}
 					conn.SetWriteDeadline(time.Now().Add(s.WebsocketTimeout()))
 					conn.WriteMessage(websocket.PingMessage, nil)
+					last, lastPing = now, now
 				}
 			}
 		}()
 
+		// Messages from the server are sent in the client's language where there's a translation.
+		lang := locale.Lang(req)
+
 		// React to pongs from the client
 		go func() {
 			defer func() {
 				cancel()
 			}()
+			// Oversized messages are rejected before they're read, and the connection is closed with a
+			// message too big code.
+			conn.SetReadLimit(config.MaxSocketMessageSize)
 			conn.SetReadDeadline(time.Now().Add(s.WebsocketPongTimeout()))
 			conn.SetPongHandler(func(string) error {
 				conn.SetReadDeadline(time.Now().Add(s.WebsocketPongTimeout()))
@@ -124,6 +193,10 @@ func (h *Handler) SocketHandler(s SocketHandlerInterface) func(w http.ResponseWr
 			for {
 				messageType, messageBytes, err := conn.ReadMessage()
 				if err != nil {
+					if err == websocket.ErrReadLimit {
+						h.storeError(ctx, fmt.Errorf("websocket message from client larger than %d bytes", config.MaxSocketMessageSize), req)
+						break
+					}
 					if websocket.IsCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
 						// Don't bother storing an error if the client disconnects gracefully
 						break
@@ -141,6 +214,8 @@ func (h *Handler) SocketHandler(s SocketHandlerInterface) func(w http.ResponseWr
 				message, err := s.UnarshalMessage(messageBytes)
 				if err != nil {
 					h.storeError(ctx, err, req)
+					// tell the client what was wrong with the message
+					send(errorMessage(lang, err))
 					break
 				}
 				select {
@@ -150,52 +225,113 @@ func (h *Handler) SocketHandler(s SocketHandlerInterface) func(w http.ResponseWr
 			}
 		}()
 
-		// React to the server shutdown signal
-		go func() {
-			select {
-			case <-h.shutdown:
+		// React to the server shutdown signal by telling the client to reconnect. The socket is removed
+		// before the deferred close above runs, so shutdown won't send on a closed socket.
+		sock := &socket{
+			shutdown: func() {
 				s.StoreError(ctx, errors.New("server shut down"), req)
-				send(servermsg.Error{Message: "server shut down"})
+				send(errorMessage(lang, locale.Error{Code: locale.Shutdown}))
 				cancel()
-			case <-ctx.Done():
-			}
-		}()
+			},
+		}
+		h.sockets.add(sock)
+		defer h.sockets.remove(sock)
 
-		// Request a slot in the queue...
-		start, end, err := h.Queue.Slot(func(position int) {
-			tj.Queue(position)
-			send(servermsg.Queueing{Position: position})
-		})
-		if err != nil {
-			s.StoreError(ctx, err, req)
-			send(servermsg.Error{Message: err.Error()})
-			return
+		// Request a slot in the queue and wait for it to start. Slots are shared fairly between clients,
+		// and background work can request a lower priority with the nice parameter. Handlers that fetch
+		// before compiling (see LateSlotter) wait for the slot themselves, after fetching.
+		var end chan struct{}
+		var slotOnce sync.Once
+		var slotErr error
+		wait := func(ctx context.Context, hits float64) error {
+			slotOnce.Do(func() {
+				var start chan struct{}
+				start, end, slotErr = h.Queue.SlotPredicted(clientip.Get(req), niceLevel(req), hits, func(position int) {
+					tj.Queue(position)
+					send(servermsg.Queueing{Position: position})
+				})
+				if slotErr != nil {
+					return
+				}
+				// Wait for the slot to become available.
+				select {
+				case <-start:
+				case <-ctx.Done():
+					slotErr = ctx.Err()
+					return
+				}
+				tj.QueueDone()
+				// Send a message to the client that queue step has finished.
+				send(servermsg.Queueing{Done: true})
+			})
+			return slotErr
 		}
 
 		// Signal to the queue that processing has finished.
 		defer func() {
-			close(end)
+			if end != nil {
+				close(end)
+			}
 		}()
 
-		// Wait for the slot to become available.
-		select {
-		case <-start:
-			// continue
-		case <-ctx.Done():
+		if l, ok := s.(LateSlotter); ok && l.LateSlot() {
+			ctx = queue.WithWait(ctx, wait)
+		} else if err := wait(ctx, 0); err != nil {
+			if err != ctx.Err() {
+				s.StoreError(ctx, err, req)
+				send(errorMessage(lang, err))
+			}
 			return
 		}
 
-		tj.QueueDone()
-
-		// Send a message to the client that queue step has finished.
-		send(servermsg.Queueing{Done: true})
+		// The job has started, so its messages are logged.
+		close(started)
 
 		if err := s.Handle(ctx, req, send, receive, tj); err != nil {
 			s.StoreError(ctx, err, req)
-			send(servermsg.Error{Message: err.Error()})
+			send(errorMessage(lang, err))
 			return
 		}
 
 		return
 	}
 }
+
+// shouldPing returns true if nothing has been written to a websocket for half the ping period, so a ping
+// is needed to check the client is still there. The read deadline is only extended by pongs, so a busy
+// connection is also pinged every half pong timeout.
+func shouldPing(now, last, lastPing time.Time, period, pongTimeout time.Duration) bool {
+	return now.Sub(last) >= period/2 || now.Sub(lastPing) >= pongTimeout/2
+}
+
+// errorMessage returns the message for an error, translated to lang if it's one of the messages in the
+// locale catalog.
+func errorMessage(lang string, err error) servermsg.Error {
+	switch err := err.(type) {
+	case locale.Error:
+		return servermsg.Error{Message: locale.Text(lang, err.Code, err.Args...), Code: err.Code}
+	case breaker.UnavailableError:
+		return servermsg.Error{Message: locale.Text(lang, locale.Unavailable, err.Host), Code: locale.Unavailable}
+	case backend.UnsupportedError:
+		return servermsg.Error{Message: err.Error(), Detail: err.Raw}
+	}
+	switch err {
+	case queue.TooManyItemsQueued:
+		return servermsg.Error{Message: locale.Text(lang, locale.QueueFull), Code: locale.QueueFull}
+	case queue.TooManyTenantItems:
+		return servermsg.Error{Message: locale.Text(lang, locale.TooMany), Code: locale.TooMany}
+	case context.DeadlineExceeded:
+		return servermsg.Error{Message: locale.Text(lang, locale.Timeout), Code: locale.Timeout}
+	}
+	return servermsg.Error{Message: err.Error()}
+}
+
+// niceLevel returns the queue nice level requested with the nice parameter. Requests can lower their
+// priority but can't raise it above interactive.
+func niceLevel(req *http.Request) int {
+	n, err := strconv.Atoi(req.URL.Query().Get("nice"))
+	if err != nil {
+		return queue.Interactive
+	}
+	return queue.Nice(n)
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/memstore"
+	"github.com/dave/jsgo/server/queue"
+	"github.com/dave/jsgo/server/servermsg"
+	"github.com/dave/services"
+	"github.com/dave/services/tracker"
+	"github.com/gorilla/websocket"
+)
+
+func TestShouldPing(t *testing.T) {
+	period, pongTimeout := time.Second*10, time.Second*20
+	start := time.Now()
+	tests := []struct {
+		sinceWrite, sincePing time.Duration
+		ping                  bool
+	}{
+		{0, 0, false},
+		{time.Second * 4, time.Second * 4, false},
+		{time.Second * 5, time.Second * 5, true},
+		{time.Second * 30, time.Second * 30, true},
+		{time.Second, time.Second * 9, false}, // busy
+		{time.Second, time.Second * 10, true}, // busy, but the read deadline needs a pong
+	}
+	for _, test := range tests {
+		now := start.Add(time.Minute)
+		if found := shouldPing(now, now.Add(-test.sinceWrite), now.Add(-test.sincePing), period, pongTimeout); found != test.ping {
+			t.Errorf("%v since last write, %v since last ping: expected %v, found %v", test.sinceWrite, test.sincePing, test.ping, found)
+		}
+	}
+}
+
+// busySocket sends a message every interval, so the connection is never idle.
+type busySocket struct {
+	messages int
+	interval time.Duration
+	err      chan error
+}
+
+func (b *busySocket) Handle(ctx context.Context, req *http.Request, send func(message services.Message), receive chan services.Message, tj *tracker.Job) error {
+	err := func() error {
+		for i := 0; i < b.messages; i++ {
+			select {
+			case <-time.After(b.interval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			send(servermsg.Queueing{Position: i})
+		}
+		return nil
+	}()
+	b.err <- err
+	return err
+}
+
+func (b *busySocket) RequestTimeout() time.Duration       { return time.Minute }
+func (b *busySocket) WebsocketPingPeriod() time.Duration  { return time.Millisecond * 100 }
+func (b *busySocket) WebsocketTimeout() time.Duration     { return time.Second }
+func (b *busySocket) WebsocketPongTimeout() time.Duration { return time.Millisecond * 200 }
+
+func (b *busySocket) MarshalMessage(message services.Message) ([]byte, int, error) {
+	payload, err := json.Marshal(message)
+	return payload, websocket.TextMessage, err
+}
+
+func (b *busySocket) UnarshalMessage([]byte) (services.Message, error) { return nil, nil }
+
+func (b *busySocket) StoreError(ctx context.Context, err error, req *http.Request) {}
+
+func TestSocketBusy(t *testing.T) {
+	h := &Handler{
+		Queue:      queue.New(1, 10, 1),
+		Waitgroup:  &sync.WaitGroup{},
+		Fileserver: memstore.NewFileserver(nil),
+		Database:   memstore.NewDatabase(),
+		sockets:    &sockets{open: map[*socket]bool{}},
+	}
+	// the compile lasts three times the pong timeout, with no idle time between messages
+	s := &busySocket{messages: 20, interval: time.Millisecond * 30, err: make(chan error, 1)}
+	server := httptest.NewServer(http.HandlerFunc(h.SocketHandler(s)))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the job id is sent first
+	var job servermsg.Job
+	if err := conn.ReadJSON(&job); err != nil || len(job.Id) != 32 {
+		t.Fatalf("expected the job id, found %v %v", job, err)
+	}
+
+	go func() {
+		// the client must be reading to reply to pings
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-s.err:
+		if err != nil {
+			t.Fatalf("expected the busy compile to finish, found %v", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out")
+	}
+
+	// the job started, so its log was written
+	h.Waitgroup.Wait()
+	if _, ok := h.Fileserver.(*memstore.Fileserver).Files[config.Bucket[config.Git]+":"+jobLogName(job.Id)]; !ok {
+		t.Fatal("expected the job log to be written")
+	}
+}
+
+// lateSocket waits for its compile slot after fetching (see LateSlotter), and records whether it held a
+// slot before and after.
+type lateSocket struct {
+	busySocket
+	queue    *queue.Queue
+	before   int
+	after    int
+	finished chan struct{}
+}
+
+func (l *lateSocket) LateSlot() bool { return true }
+
+func (l *lateSocket) Handle(ctx context.Context, req *http.Request, send func(message services.Message), receive chan services.Message, tj *tracker.Job) error {
+	defer close(l.finished)
+	l.before, _ = l.queue.Stats()
+	if err := queue.Wait(ctx); err != nil {
+		return err
+	}
+	l.after, _ = l.queue.Stats()
+	return nil
+}
+
+func TestSocketLateSlot(t *testing.T) {
+	h := &Handler{
+		Queue:      queue.New(1, 10, 1),
+		Waitgroup:  &sync.WaitGroup{},
+		Fileserver: memstore.NewFileserver(nil),
+		Database:   memstore.NewDatabase(),
+		sockets:    &sockets{open: map[*socket]bool{}},
+	}
+	s := &lateSocket{queue: h.Queue, finished: make(chan struct{})}
+	server := httptest.NewServer(http.HandlerFunc(h.SocketHandler(s)))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	select {
+	case <-s.finished:
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out")
+	}
+	if s.before != 0 || s.after != 1 {
+		t.Fatalf("expected the slot to be taken when the handler waits, found %d running before and %d after", s.before, s.after)
+	}
+	h.Waitgroup.Wait()
+	if running, _ := h.Queue.Stats(); running != 0 {
+		t.Fatalf("expected the slot to be released, found %d running", running)
+	}
+}
+
+func TestSocketReadLimit(t *testing.T) {
+	h := &Handler{
+		Queue:      queue.New(1, 10, 1),
+		Waitgroup:  &sync.WaitGroup{},
+		Fileserver: memstore.NewFileserver(nil),
+		Database:   memstore.NewDatabase(),
+		sockets:    &sockets{open: map[*socket]bool{}},
+	}
+	s := &busySocket{messages: 1000, interval: time.Millisecond * 10, err: make(chan error, 1)}
+	server := httptest.NewServer(http.HandlerFunc(h.SocketHandler(s)))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteMessage(websocket.TextMessage, make([]byte, config.MaxSocketMessageSize+1)); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+			t.Fatalf("expected the connection to be closed with code %d, found %v", websocket.CloseMessageTooBig, err)
+		}
+		break
+	}
+
+	// the compile is cancelled
+	select {
+	case err := <-s.err:
+		if err != context.Canceled {
+			t.Fatalf("expected the compile to be cancelled, found %v", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out")
+	}
+}
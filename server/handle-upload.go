@@ -0,0 +1,291 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dave/jsgo/assets"
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/backend"
+	"github.com/dave/jsgo/server/clientip"
+	"github.com/dave/jsgo/server/jsgo"
+	"github.com/dave/jsgo/server/jsgo/messages"
+	"github.com/dave/jsgo/server/locale"
+	"github.com/dave/jsgo/server/queue"
+	"github.com/dave/services/deployer"
+	"github.com/dave/services/session"
+)
+
+// UploadResult is the response of the upload endpoint.
+type UploadResult struct {
+	Path    string
+	Main    string // hash of the main package file
+	Index   string // hash of the index page
+	Url     string // url of the index page
+	BuildId string // identifies the output in bug reports: the same as Main
+}
+
+// UploadHandler compiles a package from a zip or tarball (optionally gzipped) upload, for code that
+// isn't in a git repo. The path is /_upload/<path>, and the files in the root of the archive are the
+// package at path (sub-directories are sub-packages). Nothing is fetched, so only the standard library
+// and packages in the upload can be imported. The source is only held in memory for the compile, and the
+// index is stored by hash so it never replaces the page for a real package.
+func (h *Handler) UploadHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), config.RequestTimeout)
+	defer cancel()
+
+	pkg := strings.Trim(strings.TrimPrefix(req.URL.Path, "/_upload/"), "/")
+	if pkg == "" || path.Clean(pkg) != pkg || strings.HasPrefix(pkg, ".") {
+		http.Error(w, "invalid package path", http.StatusBadRequest)
+		return
+	}
+
+	// The size is limited to config.MaxUploadSize by LimitBody.
+	b, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	files, err := unpack(b)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(files) == 0 {
+		http.Error(w, "no source files in upload", http.StatusBadRequest)
+		return
+	}
+
+	end, err := h.queueSlot(ctx, req)
+	if err != nil {
+		if ctx.Err() == nil {
+			slotError(w, req, err)
+		}
+		return
+	}
+	defer close(end)
+
+	result, err := h.tenant(req).compileUpload(ctx, pkg, files)
+	if err != nil {
+		h.storeError(ctx, err, req)
+		compileError(w, req, err, 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// queueSlot waits for a compile slot for req. The caller must close end when the compile has finished.
+// An error is returned if the queue is full or ctx is done first.
+func (h *Handler) queueSlot(ctx context.Context, req *http.Request) (end chan struct{}, err error) {
+	start, end, err := h.Queue.Slot(clientip.Get(req), niceLevel(req), nil)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-start:
+		return end, nil
+	case <-ctx.Done():
+		close(end)
+		return nil, ctx.Err()
+	}
+}
+
+// CompileError is the body of a failed upload or snippet compile for clients that accept JSON, with the
+// compiler's diagnostics (see jsgo.Diagnose) and its raw output.
+type CompileError struct {
+	Error string
+	messages.Diagnostics
+}
+
+// compileError writes a compile error with status: a CompileError if the client accepts JSON, and the
+// error text otherwise.
+func compileError(w http.ResponseWriter, req *http.Request, err error, status int) {
+	if !strings.Contains(req.Header.Get("Accept"), "application/json") {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(CompileError{Error: err.Error(), Diagnostics: jsgo.Diagnose(err)})
+}
+
+// slotError writes the error from Slot: 429 if the client has too many compiles in progress, or 503 if
+// the server is busy.
+func slotError(w http.ResponseWriter, req *http.Request, err error) {
+	status := http.StatusServiceUnavailable
+	if err == queue.TooManyTenantItems {
+		status = http.StatusTooManyRequests
+	}
+	http.Error(w, errorMessage(locale.Lang(req), err).Message, status)
+}
+
+// compileUpload compiles the files of an upload or snippet as pkg. A tenant's output is stored in its
+// namespace, with the standard library files it loads.
+func (h *Handler) compileUpload(ctx context.Context, pkg string, files map[string][]byte) (UploadResult, error) {
+	s := session.New(nil, assets.Assets, assets.Archives, h.Fileserver, config.ValidExtensions)
+
+	for name, contents := range files {
+		if err := writeFile(s, filepath.Join("gopath", "src", pkg, name), contents); err != nil {
+			return UploadResult{}, err
+		}
+	}
+
+	options := backend.Options{Index: deployer.HashIndex, Minify: map[bool]bool{true: true}, MaxFiles: config.MaxOutputFiles}
+	if h.namespace != "" {
+		options.PkgHost = h.pkgHost()
+	}
+	output, err := h.compiler().Compile(ctx, s, pkg, options)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	if err := jsgo.ShareStandard(ctx, h.Fileserver, output); err != nil {
+		return UploadResult{}, err
+	}
+
+	index := fmt.Sprintf("%x", output[true].IndexHash)
+	return UploadResult{
+		Path:    pkg,
+		Main:    fmt.Sprintf("%x", output[true].MainHash),
+		Index:   index,
+		Url:     fmt.Sprintf("%s://%s/%s", config.Protocol[config.Index], config.Host[config.Index], h.indexPath(index)),
+		BuildId: fmt.Sprintf("%x", output[true].MainHash),
+	}, nil
+}
+
+func writeFile(s *session.Session, name string, contents []byte) error {
+	f, err := s.GoPath().Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(contents); err != nil {
+		return err
+	}
+	return nil
+}
+
+// unpack extracts the source files from a zip, tar or tar.gz archive. Only files with one of
+// config.ValidExtensions are extracted, and the total size is limited to config.MaxUnpackedSize. Names
+// that would escape the package directory are rejected.
+func unpack(b []byte) (map[string][]byte, error) {
+	u := &unpacker{files: map[string][]byte{}}
+	switch {
+	case bytes.HasPrefix(b, []byte("PK\x03\x04")):
+		r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range r.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			if err := u.add(f.Name, func() (io.ReadCloser, error) { return f.Open() }); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		var r io.Reader = bytes.NewReader(b)
+		if bytes.HasPrefix(b, []byte{0x1f, 0x8b}) {
+			gzr, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			defer gzr.Close()
+			r = gzr
+		}
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("reading archive: %v", err)
+			}
+			if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+				continue
+			}
+			if err := u.add(hdr.Name, func() (io.ReadCloser, error) { return ioutil.NopCloser(tr), nil }); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return u.files, nil
+}
+
+type unpacker struct {
+	files map[string][]byte
+	size  int64
+}
+
+func (u *unpacker) add(name string, open func() (io.ReadCloser, error)) error {
+	name, err := uploadName(name)
+	if err != nil {
+		return err
+	}
+	if !validExtension(name) {
+		return nil
+	}
+	r, err := open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	// Don't trust the size in the archive headers.
+	remaining := config.MaxUnpackedSize - u.size
+	b, err := ioutil.ReadAll(io.LimitReader(r, remaining+1))
+	if err != nil {
+		return err
+	}
+	u.size += int64(len(b))
+	if u.size > config.MaxUnpackedSize {
+		return fmt.Errorf("unpacked upload exceeds %d bytes", config.MaxUnpackedSize)
+	}
+	u.files[name] = b
+	return nil
+}
+
+// uploadName cleans an archive entry name, and returns an error if it's absolute or escapes the root.
+func uploadName(name string) (string, error) {
+	if strings.Contains(name, "\\") || strings.HasPrefix(name, "/") {
+		return "", fmt.Errorf("invalid file name %q in upload", name)
+	}
+	cleaned := path.Clean(name)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("invalid file name %q in upload", name)
+	}
+	if cleaned == "." {
+		return "", errors.New("empty file name in upload")
+	}
+	return cleaned, nil
+}
+
+func validExtension(name string) bool {
+	for _, ext := range config.ValidExtensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dave/jsgo/server/backend"
+	"github.com/dave/jsgo/server/queue"
+	"github.com/dave/services/deployer"
+	"github.com/dave/services/session"
+	"gopkg.in/src-d/go-billy.v4"
+)
+
+func TestUnpack(t *testing.T) {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for name, contents := range map[string]string{
+		"main.go":     "package main",
+		"sub/a.go":    "package sub",
+		"./b/../c.go": "package main",
+		"image.png":   "not source",
+	} {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(contents))
+	}
+	zw.Close()
+
+	files, err := unpack(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 || string(files["main.go"]) != "package main" || files["sub/a.go"] == nil || files["c.go"] == nil {
+		t.Fatalf("unexpected files: %v", files)
+	}
+}
+
+func TestUnpackTraversal(t *testing.T) {
+	for _, name := range []string{"../evil.go", "a/../../evil.go", "/etc/evil.go", `a\..\..\evil.go`} {
+		buf := &bytes.Buffer{}
+		tw := tar.NewWriter(buf)
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: 4, Typeflag: tar.TypeReg})
+		tw.Write([]byte("evil"))
+		tw.Close()
+		if _, err := unpack(buf.Bytes()); err == nil {
+			t.Errorf("expected error for %q", name)
+		}
+	}
+}
+
+type fakeCompiler struct {
+	path   string
+	source []byte
+}
+
+func (f *fakeCompiler) Compile(ctx context.Context, s *session.Session, path string, options backend.Options) (map[bool]*deployer.DeployOutput, error) {
+	f.path = path
+	f.source, _ = readAll(s.GoPath(), filepath.Join("gopath", "src", path, "main.go"))
+	return map[bool]*deployer.DeployOutput{true: {MainHash: []byte{1}, IndexHash: []byte{2}}}, nil
+}
+
+func readAll(fs billy.Filesystem, name string) ([]byte, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+func TestCompileUpload(t *testing.T) {
+	fake := &fakeCompiler{}
+	h := &Handler{Compiler: fake}
+	result, err := h.compileUpload(context.Background(), "upload/a", map[string][]byte{"main.go": []byte("package main")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.path != "upload/a" || string(fake.source) != "package main" {
+		t.Fatalf("unexpected compile of %q with %q", fake.path, fake.source)
+	}
+	if result.Main != "01" || result.Index != "02" || result.BuildId != "01" {
+		t.Fatalf("unexpected result %#v", result)
+	}
+}
+
+func TestQueueSlotTenantLimit(t *testing.T) {
+	h := &Handler{Queue: queue.New(4, 10, 0)}
+	h.Queue.TenantLimit(1)
+	req := httptest.NewRequest("POST", "/_upload", nil)
+	req.RemoteAddr = "1.2.3.4:1234"
+	end, err := h.queueSlot(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close(end)
+
+	_, err = h.queueSlot(context.Background(), req)
+	if err != queue.TooManyTenantItems {
+		t.Fatalf("expected TooManyTenantItems, found %v", err)
+	}
+	w := httptest.NewRecorder()
+	slotError(w, req, err)
+	if w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), "too many compiles in progress") {
+		t.Fatalf("unexpected response: %d %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+
+	"github.com/dave/jsgo/config"
+	"github.com/gopherjs/gopherjs/compiler"
+)
+
+type VersionInfo struct {
+	Server   string
+	GopherJS string
+	Go       string
+}
+
+// VersionHandler reports the server build and the toolchain versions used to compile.
+func (h *Handler) VersionHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(VersionInfo{
+		Server:   config.Version,
+		GopherJS: compiler.Version,
+		Go:       runtime.Version(),
+	})
+}
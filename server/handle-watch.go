@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/progress"
+	"github.com/gorilla/websocket"
+)
+
+// JobHandler serves /_api/job/<id>/log and /_api/job/<id>/watch.
+func (h *Handler) JobHandler(w http.ResponseWriter, req *http.Request) {
+	if jobWatchPath.MatchString(req.URL.Path) {
+		h.WatchHandler(w, req)
+		return
+	}
+	Timeout(config.ApiRouteTimeout, h.JobLogHandler)(w, req)
+}
+
+var jobWatchPath = regexp.MustCompile(`^/_api/job/([0-9a-f]{32})/watch$`)
+
+// WatchHandler streams the messages of the running websocket job with the id in the path
+// /_api/job/<id>/watch to another websocket (the id is generated by the server and sent to the client in
+// a servermsg.Job message, so only the client can share it), so several clients (e.g. two tabs, or a client that
+// reconnected) can follow one job. The messages so far are sent first. The socket is closed when the
+// job finishes, and a watcher that can't keep up is disconnected. If the job isn't running, 404 is
+// returned and the log is available from /_api/job/<id>/log.
+func (h *Handler) WatchHandler(w http.ResponseWriter, req *http.Request) {
+	matches := jobWatchPath.FindStringSubmatch(req.URL.Path)
+	if matches == nil {
+		notFound(w, req)
+		return
+	}
+
+	messages := make(chan progress.Message, config.ProgressHistory+config.ProgressBuffer)
+	overflow := make(chan struct{})
+	var overflowed bool
+	done, unsubscribe, ok := h.Progress.Subscribe(matches[1], func(message progress.Message) {
+		// called with the job locked, so never block
+		if overflowed {
+			return
+		}
+		select {
+		case messages <- message:
+		default:
+			overflowed = true
+			close(overflow)
+		}
+	})
+	if !ok {
+		notFound(w, req)
+		return
+	}
+	defer unsubscribe()
+
+	h.Waitgroup.Add(1)
+	defer h.Waitgroup.Done()
+
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+
+	conn, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		h.storeError(ctx, fmt.Errorf("upgrading request to websocket: %v", err), req)
+		return
+	}
+	defer conn.Close()
+
+	// Messages from the watcher are ignored, but the connection must be read to notice it closing. This
+	// exits when the connection is closed above.
+	conn.SetReadLimit(config.MaxSocketMessageSize)
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(message progress.Message) bool {
+		conn.SetWriteDeadline(time.Now().Add(config.WebsocketWriteTimeout))
+		return conn.WriteMessage(message.Type, message.Payload) == nil
+	}
+
+	for {
+		select {
+		case message := <-messages:
+			if !write(message) {
+				return
+			}
+		case <-done:
+			// the job has finished - send the remaining messages before closing
+			for {
+				select {
+				case message := <-messages:
+					if !write(message) {
+						return
+					}
+				default:
+					conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+					return
+				}
+			}
+		case <-overflow:
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "too slow"))
+			return
+		case <-ctx.Done():
+			return
+		case <-h.shutdown:
+			return
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dave/jsgo/server/progress"
+	"github.com/gorilla/websocket"
+)
+
+func TestWatch(t *testing.T) {
+	h := &Handler{Progress: progress.New(10), Waitgroup: &sync.WaitGroup{}}
+	server := httptest.NewServer(http.HandlerFunc(h.JobHandler))
+	defer server.Close()
+	id := newJobId()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/_api/job/" + id + "/watch"
+
+	if _, resp, err := websocket.DefaultDialer.Dial(url, nil); err == nil || resp.StatusCode != 404 {
+		t.Fatal("expected 404 for a job that isn't running")
+	}
+
+	h.Progress.Start(id)
+	h.Progress.Publish(id, progress.Message{Type: websocket.TextMessage, Payload: []byte("1")})
+
+	var conns []*websocket.Conn
+	for i := 0; i < 2; i++ {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+	h.Progress.Publish(id, progress.Message{Type: websocket.TextMessage, Payload: []byte("2")})
+	h.Progress.Finish(id)
+
+	for i, conn := range conns {
+		var found []string
+		for {
+			_, b, err := conn.ReadMessage()
+			if err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+					t.Fatalf("watcher %d: unexpected error %v", i, err)
+				}
+				break
+			}
+			found = append(found, string(b))
+		}
+		if strings.Join(found, ",") != "1,2" {
+			t.Fatalf("watcher %d: unexpected messages %v", i, found)
+		}
+	}
+
+	// the watchers have been removed
+	h.Waitgroup.Wait()
+	if n := h.Progress.Subscribers(id); n != 0 {
+		t.Fatalf("expected no subscribers, found %d", n)
+	}
+}
@@ -0,0 +1,21 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/dave/jsgo/config"
+)
+
+// NewServer returns an http.Server for handler listening on addr, with the timeouts in config. The
+// default http.Server has no timeouts, so a client sending headers or reading the response slowly can
+// hold a connection open indefinitely.
+func NewServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: config.ServerReadHeaderTimeout,
+		WriteTimeout:      config.ServerWriteTimeout,
+		IdleTimeout:       config.ServerIdleTimeout,
+		MaxHeaderBytes:    config.ServerMaxHeaderBytes,
+	}
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/dave/jsgo/config"
+)
+
+func TestNewServer(t *testing.T) {
+	handler := http.NotFoundHandler()
+	s := NewServer(":8080", handler)
+	if s.Addr != ":8080" || s.ReadHeaderTimeout != config.ServerReadHeaderTimeout || s.IdleTimeout != config.ServerIdleTimeout {
+		t.Fatalf("unexpected server %#v", s)
+	}
+	// An overall read timeout would cut off websocket connections.
+	if s.ReadTimeout != 0 {
+		t.Fatalf("expected no read timeout, found %v", s.ReadTimeout)
+	}
+	if s.WriteTimeout < config.CompileRouteTimeout {
+		t.Fatalf("expected the write timeout to be longer than the route timeouts, found %v", s.WriteTimeout)
+	}
+}
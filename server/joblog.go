@@ -0,0 +1,146 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/services"
+)
+
+// jobLog streams the messages sent to a websocket client to the fileserver, so the log of a compile can
+// be retrieved after the client disconnects. The log is keyed by the job id, which is generated by the
+// server and sent to the client in a servermsg.Job message, so a log can't be read or overwritten by
+// anyone who only knows the request id. Messages are written through a pipe as they're sent, so the log
+// isn't held in memory.
+type jobLog struct {
+	pw        *io.PipeWriter
+	cancel    context.CancelFunc
+	done      chan error
+	size      int
+	truncated bool
+}
+
+// jobLogHeader is the first line of a log, in the same format as the messages.
+type jobLogHeader struct {
+	Type    string
+	Message struct {
+		Id   string
+		Time time.Time
+	}
+}
+
+func jobLogName(id string) string {
+	return "logs/" + id + ".json"
+}
+
+// newJobId returns a new unguessable job id.
+func newJobId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return fmt.Sprintf("%x", b)
+}
+
+// newJobLog starts writing the log for the job id to the fileserver. The write is cancelled after
+// config.JobLogWriteTimeout.
+func newJobLog(fileserver services.Fileserver, id string) *jobLog {
+	pr, pw := io.Pipe()
+	ctx, cancel := context.WithTimeout(context.Background(), config.JobLogWriteTimeout)
+	l := &jobLog{pw: pw, cancel: cancel, done: make(chan error, 1)}
+	go func() {
+		_, err := fileserver.Write(ctx, config.Bucket[config.Git], jobLogName(id), pr, false, "application/json", "no-store")
+		// if the write failed, further writes to the log fail rather than block
+		pr.CloseWithError(err)
+		l.done <- err
+	}()
+	var header jobLogHeader
+	header.Type = "JobLog"
+	header.Message.Id = id
+	header.Message.Time = time.Now()
+	b, _ := json.Marshal(header)
+	l.write(b)
+	return l
+}
+
+// write adds a message to the log. Messages after config.JobLogMaxSize are dropped, and a single
+// truncation marker is written instead. A nil log (a job that never started) is ignored.
+func (l *jobLog) write(message []byte) {
+	if l == nil || l.truncated {
+		return
+	}
+	if l.size+len(message)+1 > config.JobLogMaxSize {
+		l.truncated = true
+		l.pw.Write([]byte(`{"Type":"Truncated","Message":{}}` + "\n"))
+		return
+	}
+	l.size += len(message) + 1
+	if _, err := l.pw.Write(append(message, '\n')); err != nil {
+		l.truncated = true // the fileserver write has failed, so stop writing
+	}
+}
+
+// close finishes the log and waits for the fileserver write to complete, for at most
+// config.JobLogCloseTimeout.
+func (l *jobLog) close() error {
+	if l == nil {
+		return nil
+	}
+	defer l.cancel()
+	l.pw.Close()
+	select {
+	case err := <-l.done:
+		return err
+	case <-time.After(config.JobLogCloseTimeout):
+		return errors.New("timed out writing job log")
+	}
+}
+
+var jobIdPath = regexp.MustCompile(`^/_api/job/([0-9a-f]{32})/log$`)
+
+// JobLogHandler returns the log of the websocket job with the id in the path /_api/job/<id>/log.
+// The log has one JSON message per line, starting with a JobLog header. Logs older than
+// config.JobLogTTL aren't returned.
+func (h *Handler) JobLogHandler(w http.ResponseWriter, req *http.Request) {
+	matches := jobIdPath.FindStringSubmatch(req.URL.Path)
+	if matches == nil {
+		notFound(w, req)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), config.PageTimeout)
+	defer cancel()
+
+	// The size of the log is capped, so it's fine to read it into memory.
+	buf := &bytes.Buffer{}
+	found, err := h.Fileserver.Read(ctx, config.Bucket[config.Git], jobLogName(matches[1]), buf)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if !found {
+		notFound(w, req)
+		return
+	}
+	first, err := bufio.NewReader(bytes.NewReader(buf.Bytes())).ReadString('\n')
+	var header jobLogHeader
+	if err != nil || json.Unmarshal([]byte(strings.TrimSpace(first)), &header) != nil || time.Since(header.Message.Time) > config.JobLogTTL {
+		notFound(w, req)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Type", "application/json")
+	if err := WriteWithTimeout(w, buf.Bytes()); err != nil {
+		h.storeError(ctx, err, req)
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/memstore"
+)
+
+func TestJobLog(t *testing.T) {
+	mem := memstore.NewFileserver(nil)
+	h := &Handler{Fileserver: mem}
+
+	id := newJobId()
+	l := newJobLog(mem, id)
+	l.write([]byte(`{"Type":"Queueing","Message":{"Position":1}}`))
+	l.write([]byte(strings.Repeat("x", config.JobLogMaxSize)))
+	l.write([]byte(`{"Type":"Complete","Message":{}}`))
+	if err := l.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	h.JobLogHandler(w, httptest.NewRequest("GET", "/_api/job/"+id+"/log", nil))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if w.Code != 200 || len(lines) != 3 || !strings.HasPrefix(lines[0], `{"Type":"JobLog"`) || lines[2] != `{"Type":"Truncated","Message":{}}` {
+		t.Fatalf("unexpected log %d: %q", w.Code, lines)
+	}
+
+	// expired
+	old := newJobId()
+	mem.Files[config.Bucket[config.Git]+":"+jobLogName(old)] = `{"Type":"JobLog","Message":{"Id":"` + old + `","Time":"` + time.Now().Add(-config.JobLogTTL-time.Minute).Format(time.RFC3339) + `"}}` + "\n"
+	for _, path := range []string{"/_api/job/" + old + "/log", "/_api/job/" + newJobId() + "/log", "/_api/job/" + id, "/_api/job/abc/log"} {
+		w = httptest.NewRecorder()
+		h.JobLogHandler(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != 404 {
+			t.Fatalf("%s: expected 404, found %d", path, w.Code)
+		}
+	}
+}
+
+func TestJobLogNotStarted(t *testing.T) {
+	// the log of a job that never started is nil, and is ignored
+	var l *jobLog
+	l.write([]byte(`{"Type":"Queueing","Message":{"Position":1}}`))
+	if err := l.close(); err != nil {
+		t.Fatal(err)
+	}
+}
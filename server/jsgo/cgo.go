@@ -0,0 +1,53 @@
+package jsgo
+
+import (
+	"fmt"
+	"go/build"
+	"strings"
+)
+
+// checkCgo returns an error naming the first package in the import graph of pkg that uses cgo, which
+// GopherJS can't compile. Without this check the build fails deep in the compiler with an error that
+// doesn't mention cgo. The build context must have cgo enabled, so files that import "C" are listed in
+// CgoFiles after the build constraints are applied. The standard library isn't checked: its cgo files
+// all have pure Go alternatives.
+func checkCgo(bctx *build.Context, pkg string) error {
+	type item struct {
+		path, dir string // import path, and the directory of the importing package
+	}
+	seen := map[string]bool{}
+	queue := []item{{path: pkg}}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		if i.path == "C" || isStandard(i.path) {
+			continue
+		}
+		// imports are resolved from the directory of the importer, so vendored packages are checked
+		// rather than the packages they replace
+		p, err := bctx.Import(i.path, i.dir, 0)
+		if err != nil {
+			// missing packages and other import errors are reported by the compiler
+			continue
+		}
+		if seen[p.ImportPath] {
+			continue
+		}
+		seen[p.ImportPath] = true
+		if len(p.CgoFiles) > 0 {
+			if p.ImportPath == pkg {
+				return fmt.Errorf("%s uses cgo (import \"C\" in %s), which isn't supported by GopherJS", pkg, strings.Join(p.CgoFiles, ", "))
+			}
+			return fmt.Errorf("%s imports %s, which uses cgo (import \"C\" in %s), which isn't supported by GopherJS", pkg, p.ImportPath, strings.Join(p.CgoFiles, ", "))
+		}
+		for _, imp := range p.Imports {
+			queue = append(queue, item{path: imp, dir: p.Dir})
+		}
+	}
+	return nil
+}
+
+// isStandard returns true for standard library import paths, which have no dot in the first element.
+func isStandard(path string) bool {
+	return !strings.Contains(strings.Split(path, "/")[0], ".")
+}
@@ -0,0 +1,74 @@
+package jsgo
+
+import (
+	"go/build"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+func TestCheckCgo(t *testing.T) {
+	fs := memfs.New()
+	for name, contents := range map[string]string{
+		"a/main.go":       "package main\n\nimport (\n\t\"fmt\"\n\t\"example.com/b\"\n)\n\nfunc main() { fmt.Println(b.B) }\n",
+		"b/b.go":          "package b\n\nimport \"example.com/c\"\n\nvar B = c.C\n",
+		"c/c.go":          "package c\n\n// #include <stdio.h>\nimport \"C\"\n\nvar C = 1\n",
+		"d/d.go":          "package d\n\nimport \"example.com/e\"\n\nvar D = e.E\n",
+		"e/e_cgo.go":      "// +build cgo,!js\n\npackage e\n\nimport \"C\"\n\nvar E = 1\n",
+		"e/e_fallback.go": "// +build !cgo js\n\npackage e\n\nvar E = 2\n",
+	} {
+		f, err := fs.Create(filepath.Join("gopath", "src", "example.com", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(contents))
+		f.Close()
+	}
+	bctx := memContext(fs)
+
+	tests := map[string]string{
+		"example.com/a": `example.com/a imports example.com/c, which uses cgo (import "C" in c.go)`,
+		"example.com/c": `example.com/c uses cgo (import "C" in c.go)`,
+		"example.com/d": "", // the cgo file is excluded for js
+		"example.com/x": "", // missing packages are reported by the compiler
+	}
+	for pkg, expected := range tests {
+		err := checkCgo(bctx, pkg)
+		switch {
+		case expected == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", pkg, err)
+		case expected != "" && (err == nil || !strings.HasPrefix(err.Error(), expected)):
+			t.Errorf("%s: expected %q, found %v", pkg, expected, err)
+		}
+	}
+}
+
+// memContext returns a build context for a gopath in fs, with cgo enabled.
+func memContext(fs billy.Filesystem) *build.Context {
+	return &build.Context{
+		GOARCH:     "js",
+		GOOS:       "darwin",
+		GOROOT:     "goroot",
+		GOPATH:     "gopath",
+		Compiler:   "gc",
+		CgoEnabled: true,
+		IsDir: func(path string) bool {
+			fi, err := fs.Stat(path)
+			return err == nil && fi.IsDir()
+		},
+		HasSubdir: func(root, dir string) (string, bool) {
+			root = filepath.Clean(root) + string(filepath.Separator)
+			if !strings.HasPrefix(filepath.Clean(dir), root) {
+				return "", false
+			}
+			return filepath.ToSlash(strings.TrimPrefix(filepath.Clean(dir), root)), true
+		},
+		ReadDir:  func(path string) ([]os.FileInfo, error) { return fs.ReadDir(path) },
+		OpenFile: func(path string) (io.ReadCloser, error) { return fs.Open(path) },
+	}
+}
@@ -0,0 +1,135 @@
+package jsgo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/gitauth"
+	"github.com/dave/jsgo/server/locale"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/storage"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// cloneLimits applies the limits of the git fetcher to the clones that bypass it (refs, pull requests
+// and gist revisions): the clone timeout for the host, the maximum number of objects, and
+// config.GitMaxCloneBytes. The clone must use the storage of the returned limit, and the limit as its
+// Progress. The err method returns the error to report if the clone was stopped by a limit.
+func cloneLimits(ctx context.Context, repoUrl string) (context.Context, context.CancelFunc, *cloneLimit) {
+	var host, repo string
+	if u, err := url.Parse(repoUrl); err == nil {
+		host, repo = u.Host, u.Host+strings.TrimSuffix(u.Path, ".git")
+	}
+	c := config.GitFetcherConfigForHost(host)
+	ctx, cancel := context.WithTimeout(ctx, c.GitCloneTimeout)
+	return ctx, cancel, &cloneLimit{repo: repo, maxObjects: c.GitMaxObjects, maxBytes: config.GitMaxCloneBytes, cancel: cancel}
+}
+
+// cloneLimit watches the progress messages and the stored objects of a clone, and cancels it when the
+// server reports more than maxObjects objects, or the objects total more than maxBytes.
+type cloneLimit struct {
+	repo       string
+	maxObjects int
+	maxBytes   int64
+	cancel     context.CancelFunc
+
+	m        sync.Mutex
+	buf      []byte
+	bytes    int64
+	exceeded error
+}
+
+var objectCounts = []*regexp.Regexp{
+	regexp.MustCompile(`Counting objects: (\d+), done\.?`),
+	regexp.MustCompile(`Finding sources: +\d+% \(\d+/(\d+)\)`),
+}
+
+func (l *cloneLimit) Write(b []byte) (int, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.buf = append(l.buf, b...)
+	for {
+		i := bytes.IndexAny(l.buf, "\r\n")
+		if i < 0 {
+			return len(b), nil
+		}
+		line := l.buf[:i]
+		l.buf = l.buf[i+1:]
+		for _, r := range objectCounts {
+			m := r.FindSubmatch(line)
+			if m == nil {
+				continue
+			}
+			if objects, err := strconv.Atoi(string(m[1])); err == nil && objects > l.maxObjects {
+				l.exceed(fmt.Errorf("too many git objects (max %d): %d", l.maxObjects, objects))
+			}
+		}
+	}
+}
+
+// add counts size bytes of stored objects, and returns an error once there are more than maxBytes.
+func (l *cloneLimit) add(size int64) error {
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.bytes += size
+	if l.bytes > l.maxBytes {
+		l.exceed(fmt.Errorf("git objects too large (max %d bytes)", l.maxBytes))
+	}
+	return l.exceeded
+}
+
+// exceed records the first limit that was exceeded and cancels the clone. Must be called with the lock.
+func (l *cloneLimit) exceed(err error) {
+	if l.exceeded == nil {
+		l.exceeded = err
+		l.cancel()
+	}
+}
+
+// storage returns an in-memory storage that counts the size of the objects stored.
+func (l *cloneLimit) storage() storage.Storer {
+	return limitedStorage{Storage: memory.NewStorage(), limit: l}
+}
+
+// err returns the error if the clone exceeded a limit, or else the error of the clone. A clone that the
+// host refused without credentials is reported with gitauth.Error.
+func (l *cloneLimit) err(cloneErr error) error {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.exceeded != nil {
+		return l.exceeded
+	}
+	if gitauth.Required(cloneErr) {
+		return gitauth.Error(l.repo)
+	}
+	return cloneErr
+}
+
+// wrap returns the error of a clone (see err) with the description, unless the host requires
+// authentication, which is reported as is so the client gets the error code.
+func (l *cloneLimit) wrap(cloneErr error, format string, args ...interface{}) error {
+	err := l.err(cloneErr)
+	if _, ok := err.(locale.Error); ok {
+		return err
+	}
+	return fmt.Errorf(format+": %v", append(args, err)...)
+}
+
+type limitedStorage struct {
+	*memory.Storage
+	limit *cloneLimit
+}
+
+func (s limitedStorage) SetEncodedObject(obj plumbing.EncodedObject) (plumbing.Hash, error) {
+	if err := s.limit.add(obj.Size()); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return s.Storage.SetEncodedObject(obj)
+}
@@ -0,0 +1,69 @@
+package jsgo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dave/jsgo/server/locale"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+func TestCloneLimitObjects(t *testing.T) {
+	cloneErr := errors.New("clone failed")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &cloneLimit{maxObjects: 100, maxBytes: 1000, cancel: cancel}
+	l.Write([]byte("Enumerating objects: 5, done.\rCounting objects:  40% (2/5)\rCounting obj"))
+	l.Write([]byte("ects: 50, done.\n"))
+	if ctx.Err() != nil || l.err(cloneErr) != cloneErr {
+		t.Fatal("expected a clone under the limit to continue")
+	}
+
+	l.Write([]byte("Finding sources:  10% (20/3000)\r"))
+	if ctx.Err() == nil {
+		t.Fatal("expected the clone to be cancelled")
+	}
+	if err := l.err(cloneErr); err == nil || !strings.Contains(err.Error(), "too many git objects (max 100): 3000") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestCloneLimitBytes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &cloneLimit{maxObjects: 100, maxBytes: 1000, cancel: cancel}
+	s := l.storage()
+
+	store := func(size int) error {
+		obj := s.NewEncodedObject()
+		obj.SetType(plumbing.BlobObject)
+		w, _ := obj.Writer()
+		w.Write(make([]byte, size))
+		w.Close()
+		_, err := s.SetEncodedObject(obj)
+		return err
+	}
+	if err := store(600); err != nil || ctx.Err() != nil {
+		t.Fatalf("expected an object under the limit to be stored, found %v", err)
+	}
+	if err := store(600); err == nil || ctx.Err() == nil {
+		t.Fatal("expected the clone to be cancelled")
+	}
+	if err := l.err(errors.New("clone failed")); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestCloneLimitAuth(t *testing.T) {
+	_, cancel, l := cloneLimits(context.Background(), "https://github.com/a/b.git")
+	defer cancel()
+	err := l.wrap(transport.ErrAuthenticationRequired, "fetching %s at %s", "github.com/a/b", "v1")
+	if e, ok := err.(locale.Error); !ok || e.Code != locale.AuthRequired || !strings.Contains(e.Error(), "github.com/a/b requires authentication") {
+		t.Fatalf("expected the authentication error, found %v", err)
+	}
+	if err := l.wrap(transport.ErrRepositoryNotFound, "fetching %s at %s", "github.com/a/b", "v1"); err.Error() != "fetching github.com/a/b at v1: repository not found" {
+		t.Fatalf("expected other errors to be described, found %v", err)
+	}
+}
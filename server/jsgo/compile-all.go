@@ -0,0 +1,210 @@
+package jsgo
+
+import (
+	"context"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/backend"
+	"github.com/dave/jsgo/server/jsgo/messages"
+	"github.com/dave/jsgo/server/queue"
+	"github.com/dave/jsgo/server/store"
+	"github.com/dave/services"
+	"github.com/dave/services/deployer"
+	"github.com/dave/services/getter/get"
+	"github.com/dave/services/getter/gettermsg"
+	"github.com/dave/services/session"
+	"gopkg.in/src-d/go-billy.v4"
+)
+
+// compileAll compiles every main package in the repo containing info.Path. The repo is cloned once, and
+// the main packages are compiled one after another within the single queue slot held by this request,
+// so it never uses more than its share of the concurrent compiles. A main package that fails doesn't
+// fail the others.
+func (h *Handler) compileAll(ctx context.Context, s *session.Session, written *sizes, info messages.Compile, req *http.Request, send func(services.Message)) error {
+
+	ctx, cancel := context.WithTimeout(ctx, config.CompileAllTimeout)
+	defer cancel()
+
+	start := time.Now()
+
+	root, err := repoRoot(info.Path)
+	if err != nil {
+		return err
+	}
+
+	send(gettermsg.Downloading{Starting: true})
+
+	if !config.LOCAL {
+		if err := checkRedirect(ctx, root); err != nil {
+			return err
+		}
+		if err := checkPolicy(ctx, root); err != nil {
+			return err
+		}
+	}
+
+	if err := fetches.acquire(ctx); err != nil {
+		return err
+	}
+	fetching := true
+	defer func() {
+		if fetching {
+			fetches.release()
+		}
+	}()
+
+	if err := fetchRef(ctx, s.GoPath(), root, resolveRef(root, info.Ref)); err != nil {
+		return err
+	}
+
+	mains, err := findMains(s.GoPath(), filepath.Join("gopath", "src", root), root)
+	if err != nil {
+		return err
+	}
+	if len(mains) == 0 {
+		return fmt.Errorf("no main packages found in %s", root)
+	}
+	if len(mains) > config.MaxMains {
+		return fmt.Errorf("%s has %d main packages - the maximum is %d", root, len(mains), config.MaxMains)
+	}
+
+	results := map[string]messages.CompileResult{}
+	fail := func(path string, err error) {
+		results[relative(root, path)] = messages.CompileResult{Error: err.Error()}
+		if ctx.Err() == nil {
+			h.storeFailure(ctx, path, req, err, time.Since(start))
+		}
+	}
+
+	// The repo is already in the gopath, so the getter only downloads the dependencies.
+	gitreq := h.cache(root).NewRequest(true)
+	if err := gitreq.InitialiseFromHints(ctx, mains...); err != nil {
+		return err
+	}
+	var fetched []string
+	for _, path := range mains {
+		if err := get.New(s, send, gitreq).Get(ctx, path, false, config.LOCAL, false); err != nil {
+			fail(path, err)
+			continue
+		}
+		fetched = append(fetched, path)
+	}
+	if err := gitreq.Close(ctx); err != nil {
+		return err
+	}
+	fetches.release()
+	fetching = false
+
+	failed, err := checkFetched(ctx, s, root, fetched, send)
+	if err != nil {
+		return err
+	}
+	var checked []string
+	for _, path := range fetched {
+		if err := failed[path]; err != nil {
+			fail(path, err)
+			continue
+		}
+		checked = append(checked, path)
+	}
+
+	send(gettermsg.Downloading{Done: true})
+	fetchTime := time.Since(start)
+
+	// The fetch slot has been released, so wait for a compile slot.
+	waitStart := time.Now()
+	if err := queue.Wait(ctx); err != nil {
+		return err
+	}
+	waitTime := time.Since(waitStart)
+
+	for _, path := range checked {
+		compileStart := time.Now()
+		if ctx.Err() != nil {
+			fail(path, ctx.Err())
+			continue
+		}
+		output, err := h.build(ctx, s, path, backend.Options{Index: deployer.PathIndex, Minify: map[bool]bool{true: true, false: true}, Send: send})
+		if err != nil {
+			fail(path, err)
+			continue
+		}
+		// The fetch is shared, so each duration is what a compile of the package alone would take.
+		phases := store.CompilePhases{Fetch: fetchTime, Wait: waitTime, Compile: time.Since(compileStart)}
+		h.storeCompile(ctx, send, written, path, path, req, output, deployer.PathIndex, fetchTime+time.Since(compileStart), phases, config.TtlDefault)
+		go purgeIndex(h.indexPath(path))
+		results[relative(root, path)] = messages.CompileResult{
+			Url:     fmt.Sprintf("%s://%s/%s", config.Protocol[config.Index], config.Host[config.Index], h.indexPath(path)),
+			BuildId: fmt.Sprintf("%x", output[true].MainHash),
+		}
+	}
+
+	send(messages.CompleteAll{
+		Path:    root,
+		Results: results,
+	})
+	return nil
+}
+
+// findMains returns the import paths of the main packages in dir (the directory of the package path)
+// and its sub-directories. Directories ignored by the go tool are skipped.
+func findMains(fs billy.Filesystem, dir, path string) ([]string, error) {
+	fis, err := fs.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var mains []string
+	var isMain bool
+	for _, fi := range fis {
+		name := fi.Name()
+		if fi.IsDir() {
+			if name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				continue
+			}
+			sub, err := findMains(fs, filepath.Join(dir, name), path+"/"+name)
+			if err != nil {
+				return nil, err
+			}
+			mains = append(mains, sub...)
+			continue
+		}
+		if isMain || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if isMain, err = isMainFile(fs, filepath.Join(dir, name)); err != nil {
+			return nil, err
+		}
+	}
+	if isMain {
+		mains = append(mains, path)
+	}
+	sort.Strings(mains)
+	return mains, nil
+}
+
+func isMainFile(fs billy.Filesystem, name string) (bool, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	file, err := parser.ParseFile(token.NewFileSet(), name, f, parser.PackageClauseOnly)
+	if err != nil {
+		// unparsable files are reported when the package is compiled
+		return false, nil
+	}
+	return file.Name.Name == "main", nil
+}
+
+// relative returns path relative to the repo root.
+func relative(root, path string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(path, root), "/")
+}
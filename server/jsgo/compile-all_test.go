@@ -0,0 +1,38 @@
+package jsgo
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+func TestFindMains(t *testing.T) {
+	fs := memfs.New()
+	for name, contents := range map[string]string{
+		"r/lib.go":                  "package lib",
+		"r/examples/a/main.go":      "package main",
+		"r/examples/b/b.go":         "// comment\npackage main\n",
+		"r/examples/b/b_test.go":    "package main_test",
+		"r/examples/c/c.go":         "package c",
+		"r/testdata/d/main.go":      "package main",
+		"r/vendor/x/main.go":        "package main",
+		"r/_ignored/main.go":        "package main",
+		"r/cmd/tool/tool.go":        "package main",
+		"r/cmd/tool/README.md":      "# tool",
+		"r/cmd/tool/sub/sub_pkg.go": "package sub",
+	} {
+		if err := util.WriteFile(fs, name, []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mains, err := findMains(fs, "r", "github.com/a/r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"github.com/a/r/cmd/tool", "github.com/a/r/examples/a", "github.com/a/r/examples/b"}
+	if !reflect.DeepEqual(mains, expected) {
+		t.Fatalf("expected %v, found %v", expected, mains)
+	}
+}
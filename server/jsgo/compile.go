@@ -2,15 +2,25 @@ package jsgo
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/dave/jsgo/assets"
 	"github.com/dave/jsgo/assets/std"
 	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/backend"
+	"github.com/dave/jsgo/server/breaker"
+	"github.com/dave/jsgo/server/cdn"
+	"github.com/dave/jsgo/server/clientip"
 	"github.com/dave/jsgo/server/jsgo/messages"
+	"github.com/dave/jsgo/server/locale"
+	"github.com/dave/jsgo/server/queue"
 	"github.com/dave/jsgo/server/servermsg"
 	"github.com/dave/jsgo/server/store"
 	"github.com/dave/services"
@@ -18,64 +28,570 @@ import (
 	"github.com/dave/services/getter/get"
 	"github.com/dave/services/getter/gettermsg"
 	"github.com/dave/services/session"
+	"github.com/gopherjs/gopherjs/compiler"
 )
 
 func (h *Handler) Compile(ctx context.Context, info messages.Compile, req *http.Request, send func(services.Message), receive chan services.Message) error {
 
-	path := info.Path
+	// A tenant's compile is isolated in its namespace, so files and records are read and written there.
+	h, err := h.tenant(req)
+	if err != nil {
+		return err
+	}
+
+	// The sizes of the files are recorded as the compile stores them.
+	written := newSizes(h.Fileserver)
+	s := session.New(buildTags(info), assets.Assets, assets.Archives, written, config.ValidExtensions)
+
+	// A module version is compiled as a build of the commit it was resolved to, so Path and Ref come
+	// from the module proxy.
+	if info.Module != "" {
+		if info.Path != "" || info.Ref != "" {
+			return errors.New("a module request can't also specify a path or ref")
+		}
+		m, err := resolveModule(ctx, info.Module)
+		if err != nil {
+			return err
+		}
+		info.Path, info.Ref = m.Path, m.Ref
+	}
+
+	// Pull requests can be requested with the <path>#<number> form, which is converted to a ref here so
+	// the ref is part of the failure cache key.
+	path, ref, err := parsePullRequest(info.Path, info.Ref)
+	if err != nil {
+		return err
+	}
+	info.Path, info.Ref = path, ref
+
+	t, err := target(info)
+	if err != nil {
+		return err
+	}
+
+	if info.Expect != "" && (t != TargetJs || info.All) {
+		return errors.New("expected hashes are only supported for single js builds")
+	}
+
+	if err := checkVars(info.Vars, config.AllowedVars); err != nil {
+		return err
+	}
+	if len(info.Vars) > 0 && (t != TargetJs || info.All) {
+		return errors.New("variables are only supported for single js builds")
+	}
+	if info.Debug && (t != TargetJs || info.All) {
+		return errors.New("debug builds are only supported for single js builds")
+	}
+	if info.Shake && (t != TargetJs || info.All) {
+		return errors.New("shaken builds are only supported for single js builds")
+	}
+	if len(info.Symbols) > 0 {
+		if t != TargetJs || info.All {
+			return errors.New("symbol bundles are only supported for single js builds")
+		}
+		if err := checkSymbols(info.Symbols); err != nil {
+			return err
+		}
+	}
+	if info.Metadata && (t != TargetJs || info.All) {
+		return errors.New("build metadata is only supported for single js builds")
+	}
+	if info.Global != "" {
+		if t != TargetJs || info.All {
+			return errors.New("global names are only supported for single js builds")
+		}
+		if err := checkGlobal(info.Global); err != nil {
+			return err
+		}
+	}
+
+	if info.Examples && (t != TargetJs || info.All || info.Plan) {
+		return errors.New("examples are only supported for single js builds")
+	}
+
+	if len(info.Replace) > 0 {
+		if info.All || info.Examples {
+			return errors.New("replacements are only supported for single builds")
+		}
+		if err := checkReplace(info.Replace, info.Path); err != nil {
+			return err
+		}
+	}
+
+	if info.All {
+		return h.compileAll(ctx, s, written, info, req, send)
+	}
+
+	if info.Examples {
+		return h.compileExamples(ctx, s, written, info, req, send)
+	}
+
+	if info.Plan && !config.PlanEnabled {
+		return errors.New("plan-only requests are disabled")
+	}
+
+	// A package that recently failed to compile at the same commit fails again without being fetched,
+	// unless the client forces a retry.
+	if !info.Force {
+		if err := failures.check(ctx, info); err != nil {
+			return h.stale(ctx, info, err, send)
+		}
+	}
+
+	start := time.Now()
+	if err = h.compile(ctx, s, written, info, req, send); err != nil {
+		if ctx.Err() == nil && !info.Plan {
+			h.storeFailure(ctx, refPath(info.Path, info.Ref), req, err, time.Since(start))
+		}
+		_, mismatch := err.(mismatchError)
+		if ctx.Err() == nil && !serverError(err) && !mismatch && !info.Plan {
+			// don't remember timeouts, cancellations or errors caused by the server, because they aren't
+			// caused by the package. Hash mismatches only fail for the client that expected a different
+			// output.
+			failures.add(ctx, info, err)
+		}
+		if ctx.Err() != nil || mismatch {
+			return err
+		}
+		return h.stale(ctx, info, err, send)
+	}
+	return nil
+}
+
+// serverError returns true if err is caused by the state of the server or an upstream host rather than
+// the package: an unavailable host, a full queue (or too many jobs from the client), or one of the
+// errors in the locale catalog (e.g. a busy or shutting down server). A repo that requires
+// authentication is the package's problem.
+func serverError(err error) bool {
+	switch err := err.(type) {
+	case breaker.UnavailableError:
+		return true
+	case locale.Error:
+		return err.Code != locale.AuthRequired
+	}
+	return err == queue.TooManyItemsQueued || err == queue.TooManyTenantItems
+}
 
-	s := session.New(nil, assets.Assets, assets.Archives, h.Fileserver, config.ValidExtensions)
+func (h *Handler) compile(ctx context.Context, s *session.Session, written *sizes, info messages.Compile, req *http.Request, send func(services.Message)) error {
+
+	path := info.Path
+	start := time.Now()
 
 	// Send a message to the client that downloading step has started.
 	send(gettermsg.Downloading{Starting: true})
 
-	gitreq := h.Cache.NewRequest(true)
-	if err := gitreq.InitialiseFromHints(ctx, path); err != nil {
+	// pkg is the package path to compile. This is the same as path unless a gist revision is pinned, in
+	// which case the revision is part of path (so it's part of the cache key) but not pkg.
+	pkg := path
+	var revision string
+	if gist, rev, ok := gistRevision(path); ok {
+		pkg, revision = gist, rev
+	}
+
+	// Fail fast if the host is failing, rather than piling more requests onto it.
+	host := strings.Split(pkg, "/")[0]
+	if err := breakers.Allow(host); err != nil {
+		return err
+	}
+	if err := fetches.acquire(ctx); err != nil {
+		breakers.Done(host, true) // nothing was fetched
+		return err
+	}
+	// The repo being fetched is tracked, so a failure is reported for the host that failed, which may be
+	// the host of a dependency.
+	failedHost := host
+	err := h.download(ctx, s, pkg, revision, info, func(message services.Message) {
+		if m, ok := message.(gettermsg.Downloading); ok && m.Message != "" {
+			failedHost = strings.Split(m.Message, "/")[0]
+		}
+		send(message)
+	})
+	fetches.release()
+	// Only upstream failures count - not a missing repo, a bad path or a cancellation.
+	failed := err != nil && ctx.Err() == nil && upstreamFailure(err)
+	if failed && failedHost != host {
+		breakers.Done(host, true)
+		breakers.Failed(failedHost)
+	} else {
+		breakers.Done(host, !failed)
+	}
+	if err != nil {
 		return err
 	}
 
-	// set insecure = true in local mode or it will fail if git repo has git protocol
-	insecure := config.LOCAL
+	if err := checkPackage(s.GoPath(), pkg); err != nil {
+		return err
+	}
 
-	// Start the download process - just like the "go get" command.
-	if err := get.New(s, send, gitreq).Get(ctx, path, false, insecure, false); err != nil {
+	errs, err := checkFetched(ctx, s, pkg, []string{pkg}, send)
+	if err != nil {
+		return err
+	}
+	if err := errs[pkg]; err != nil {
 		return err
 	}
 
-	if err := gitreq.Close(ctx); err != nil {
+	if info.Module != "" {
+		if err := checkMain(s.BuildContext(session.JsType, ""), info.Module, pkg); err != nil {
+			return err
+		}
+	}
+
+	if err := applyVars(s.GoPath(), info.Vars); err != nil {
 		return err
 	}
 
 	// Send a message to the client that downloading step has finished.
 	send(gettermsg.Downloading{Done: true})
+	phases := store.CompilePhases{Fetch: time.Since(start)}
+
+	if info.Plan {
+		plan, err := h.plan(ctx, s, pkg, info)
+		if err != nil {
+			return err
+		}
+		send(plan)
+		return nil
+	}
+
+	// The fetch slot has been released, so wait for a compile slot.
+	waitStart := time.Now()
+	if err := queue.WaitPredicted(ctx, h.predict(ctx, info)); err != nil {
+		return err
+	}
+	phases.Wait = time.Since(waitStart)
+
+	if t, _ := target(info); t == TargetWasm {
+		return h.compileWasm(ctx, s, pkg, send)
+	}
+
+	index := indexType(info, revision)
+
+	path = buildPath(path, info)
 
 	// Start the compile process - this compiles to JS and sends the files to a GCS bucket.
-	output, err := deployer.New(s, send, std.Index, std.Prelude, config.DeployerConfig).Deploy(ctx, path, deployer.PathIndex, map[bool]bool{true: true, false: true})
+	removed := map[bool]int64{}
+	compileStart := time.Now()
+	var metadata *backend.Metadata
+	if info.Metadata {
+		metadata = buildMetadata(ctx, info, pkg)
+	}
+	output, err := h.build(ctx, s, pkg, backend.Options{Index: index, Minify: map[bool]bool{true: true, false: true}, Send: send, Shake: info.Shake, Removed: removed, Global: info.Global, Symbols: info.Symbols, Metadata: metadata})
 	if err != nil {
+		if ctx.Err() == nil {
+			send(Diagnose(err))
+		}
 		return err
 	}
+	phases.Compile = time.Since(compileStart)
+
+	if info.Expect != "" {
+		if err := checkExpected(info.Expect, output[true].MainHash); err != nil {
+			return err
+		}
+	}
+
+	// The docs page is optional, so the compile succeeds without it.
+	var docs string
+	hash := fmt.Sprintf("%x", output[true].MainHash)
+	if stored, err := storeDocs(ctx, h.Fileserver, s.GoPath(), h.pkgHost(), pkg, hash); err != nil {
+		fmt.Printf("storing docs for %s: %v\n", pkg, err)
+	} else if stored {
+		docs = fmt.Sprintf("%s://%s/%s", config.Protocol[config.Pkg], h.pkgHost(), DocsName(pkg, hash))
+	}
 
 	// Logs the success in the datastore
-	h.storeCompile(ctx, send, path, req, output)
+	h.storeCompile(ctx, send, written, path, pkg, req, output, index, time.Since(start), phases, buildTtl(info, pkg))
+
+	if index == deployer.PathIndex {
+		go purgeIndex(h.indexPath(pkg))
+	}
 
 	// Send a message to the client that the process has successfully finished
 	send(messages.Complete{
-		Path:    path,
-		Short:   strings.TrimPrefix(path, "github.com/"),
-		HashMin: fmt.Sprintf("%x", output[true].MainHash),
+		Path:    pkg,
+		Short:   strings.TrimPrefix(pkg, "github.com/"),
+		HashMin: hash,
 		HashMax: fmt.Sprintf("%x", output[false].MainHash),
+		Docs:    docs,
+		BuildId: hash,
+		Removed: removed[true],
 	})
 	return nil
 }
 
-func (h *Handler) storeCompile(ctx context.Context, send func(services.Message), path string, req *http.Request, output map[bool]*deployer.DeployOutput) {
+// buildPath returns the path a compile of path is logged at. Builds of a ref or pull request, builds
+// with variables, debug, shaken, namespaced, symbol, metadata or replaced builds are logged separately, so they
+// don't replace the package's default build.
+func buildPath(path string, info messages.Compile) string {
+	path = refPath(path, info.Ref)
+	if key := varsKey(info.Vars); key != "" {
+		path += "@vars-" + key
+	}
+	if info.Debug {
+		path += "@debug"
+	}
+	if info.Shake {
+		path += "@shake"
+	}
+	if info.Global != "" {
+		path += "@global-" + info.Global
+	}
+	if key := symbolsKey(info.Symbols); key != "" {
+		path += "@symbols-" + key
+	}
+	if info.Metadata {
+		path += "@metadata"
+	}
+	if key := replaceKey(info.Replace); key != "" {
+		path += "@replace-" + key
+	}
+	return path
+}
+
+// indexType returns where the index page of a compile is written. Only builds of the package's default
+// source are written at the package path. When a gist revision or ref is pinned, the client expects a
+// specific output, sets variables, requests a debug, shaken, symbol or metadata build, a global name or
+// replacements, the index page is only written at its hash, so the page at the package path isn't
+// changed by another version or a customized build.
+func indexType(info messages.Compile, revision string) deployer.IndexType {
+	if revision != "" || info.Ref != "" || info.Expect != "" || len(info.Vars) > 0 || info.Debug || info.Shake || info.Global != "" || len(info.Symbols) > 0 || info.Metadata || len(info.Replace) > 0 {
+		return deployer.HashIndex
+	}
+	return deployer.PathIndex
+}
+
+// build compiles pkg with the backend. The output can have at most config.MaxOutputFiles files, which
+// the backend checks before anything is stored. A tenant's loader loads the files from its namespace.
+func (h *Handler) build(ctx context.Context, s *session.Session, pkg string, options backend.Options) (map[bool]*deployer.DeployOutput, error) {
+	options.MaxFiles = config.MaxOutputFiles
+	if h.namespace != "" {
+		options.PkgHost = h.pkgHost()
+	}
+	return h.compiler().Compile(ctx, s, pkg, options)
+}
+
+// checkExpected returns an error if the hash of the output isn't the expected hash (hex encoded). The
+// comparison is constant time.
+func checkExpected(expected string, hash []byte) error {
+	found := fmt.Sprintf("%x", hash)
+	if subtle.ConstantTimeCompare([]byte(strings.ToLower(expected)), []byte(found)) != 1 {
+		return mismatchError{found: found, expected: expected}
+	}
+	return nil
+}
+
+type mismatchError struct {
+	found, expected string
+}
+
+func (e mismatchError) Error() string {
+	return fmt.Sprintf("output hash %s doesn't match the expected hash %s", e.found, e.expected)
+}
+
+// plan describes the build for a plan-only request, once the package has been downloaded.
+func (h *Handler) plan(ctx context.Context, s *session.Session, pkg string, info messages.Compile) (messages.Plan, error) {
+	ref := resolveRef(pkg, info.Ref)
+	sha, _ := remoteSha(ctx, info.Path, ref)
+	fis, err := s.GoPath().ReadDir(filepath.Join("gopath", "src", pkg))
+	if err != nil {
+		return messages.Plan{}, err
+	}
+	var files []string
+	for _, fi := range fis {
+		if !fi.IsDir() && isValidFile(fi.Name()) {
+			files = append(files, fi.Name())
+		}
+	}
+	return messages.Plan{
+		Note:      "plan only - no script was compiled",
+		Path:      info.Path,
+		Package:   pkg,
+		Ref:       ref,
+		Sha:       sha,
+		Tags:      append([]string{}, buildTags(info)...),
+		Toolchain: compiler.Version,
+		Go:        config.StdlibVersion,
+		Files:     files,
+	}, nil
+}
+
+// download fetches pkg and its dependencies into the session gopath.
+func (h *Handler) download(ctx context.Context, s *session.Session, pkg, revision string, info messages.Compile, send func(services.Message)) error {
+	if revision != "" {
+		if err := fetchGist(ctx, s.GoPath(), pkg, revision); err != nil {
+			return err
+		}
+	} else if ref := resolveRef(pkg, info.Ref); ref != "" {
+		if err := fetchRef(ctx, s.GoPath(), pkg, ref); err != nil {
+			return err
+		}
+	}
+
+	if !config.LOCAL {
+		if err := checkRedirect(ctx, pkg); err != nil {
+			return err
+		}
+		if err := checkPolicy(ctx, pkg); err != nil {
+			return err
+		}
+		// Replacements are fetched like any other repo, so the same checks apply.
+		for _, r := range info.Replace {
+			if err := checkRedirect(ctx, r.New); err != nil {
+				return err
+			}
+			if err := checkPolicy(ctx, r.New); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := fetchReplacements(ctx, s.GoPath(), info.Replace); err != nil {
+		return err
+	}
+
+	gitreq := h.cache(pkg).NewRequest(true)
+	if err := gitreq.InitialiseFromHints(ctx, pkg); err != nil {
+		return err
+	}
+
+	// set insecure = true in local mode or it will fail if git repo has git protocol
+	insecure := config.LOCAL
+
+	// Start the download process - just like the "go get" command.
+	if err := get.New(s, send, gitreq).Get(ctx, pkg, false, insecure, false); err != nil {
+		return err
+	}
+
+	if err := gitreq.Close(ctx); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkFetched runs the checks that follow a fetch into the session gopath. The checks of the gopath
+// (checkFileCount, checkVendor of the repo containing root, resolveLFS and checkImports) fail the
+// request. Each of pkgs is then checked for cgo (see checkCgo), and its go:generate directives are run or
+// warned about (see runGenerators). A package that fails these doesn't stop the others, so their errors
+// are returned by package.
+func checkFetched(ctx context.Context, s *session.Session, root string, pkgs []string, send func(services.Message)) (map[string]error, error) {
+
+	if err := checkFileCount(s.GoPath(), config.MaxFilesPerRepo); err != nil {
+		return nil, err
+	}
+
+	if err := checkVendor(s.GoPath(), root); err != nil {
+		return nil, err
+	}
+
+	if err := resolveLFS(ctx, s.GoPath()); err != nil {
+		return nil, err
+	}
+
+	if err := checkImports(s.GoPath(), config.BlockedImports); err != nil {
+		return nil, err
+	}
+
+	failed := map[string]error{}
+	for _, pkg := range pkgs {
+		if err := checkGenerated(ctx, s, pkg, send); err != nil {
+			failed[pkg] = err
+		}
+	}
+	return failed, nil
+}
+
+// checkGenerated checks pkg for cgo, and runs or warns about its go:generate directives.
+func checkGenerated(ctx context.Context, s *session.Session, pkg string, send func(services.Message)) error {
+	if err := checkCgo(s.BuildContext(session.JsType, ""), pkg); err != nil {
+		return err
+	}
+	directives, err := findGenerate(s.BuildContext(session.JsType, ""), pkg)
+	if err != nil {
+		return err
+	}
+	if len(directives) > 0 && config.RunGenerators {
+		if directives, err = runGenerators(ctx, s.GoPath(), pkg, directives); err != nil {
+			return err
+		}
+	}
+	if len(directives) > 0 {
+		send(generateWarning(pkg, directives))
+	}
+	return nil
+}
+
+// purgeIndex purges the index page of pkg from the CDN, because it has been overwritten. Failures are
+// logged, but the page expires from the CDN cache eventually anyway.
+func purgeIndex(pkg string) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.HttpTimeout)
+	defer cancel()
+	urls := []string{fmt.Sprintf("%s://%s/%s", config.Protocol[config.Index], config.Host[config.Index], pkg)}
+	if strings.HasPrefix(pkg, "github.com/") {
+		urls = append(urls, fmt.Sprintf("%s://%s/%s", config.Protocol[config.Index], config.Host[config.Index], strings.TrimPrefix(pkg, "github.com/")))
+	}
+	if err := cdn.Default.Purge(ctx, urls); err != nil {
+		fmt.Printf("purging %s: %v\n", pkg, err)
+	}
+}
+
+var breakers = breaker.New(config.BreakerThreshold, config.BreakerWindow, config.BreakerCooldown)
+
+// upstreamFailure returns true if err is caused by the upstream host, rather than the package (see
+// config.UpstreamErrors).
+func upstreamFailure(err error) bool {
+	message := err.Error()
+	for _, s := range config.UpstreamErrors {
+		if strings.Contains(message, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// storeCompile logs a compile of pkg, requested as path (these differ when a gist revision is pinned).
+// The sizes of the files are found from written, which recorded the files as they were stored. Slow
+// compiles are logged with the time taken by each phase (see checkSlow). The files of the build expire
+// after ttl (see buildTtl), with its index page if it was written at its hash.
+func (h *Handler) storeCompile(ctx context.Context, send func(services.Message), written *sizes, path, pkg string, req *http.Request, output map[bool]*deployer.DeployOutput, index deployer.IndexType, duration time.Duration, phases store.CompilePhases, ttl time.Duration) {
+	if err := ShareStandard(ctx, h.Fileserver, output); err != nil {
+		send(servermsg.Error{Message: fmt.Sprintf("sharing standard library files: %v", err)})
+	}
 	data := store.CompileData{
 		Path:    path,
 		Time:    time.Now(),
 		Min:     getCompileContents(output[true], true),
 		Max:     getCompileContents(output[false], false),
-		Ip:      req.Header.Get("X-Forwarded-For"),
+		Ip:      clientip.Get(req),
 		Success: true,
+
+		Duration: duration,
+
+		Version:   config.Version,
+		Toolchain: compiler.Version,
+	}
+	if checkSlow(os.Stdout, path, duration, phases) && config.StoreSlowCompiles {
+		data.Slow = true
+		data.Phases = phases
+	}
+	// The sizes are only informational, so the compile is stored without them if they can't be found.
+	// The file list of each output is stored by build id (see /_files/).
+	for min, contents := range map[bool]*store.CompileContents{true: &data.Min, false: &data.Max} {
+		files, err := written.set(ctx, pkg, contents)
+		if err != nil {
+			fmt.Printf("finding sizes for %s: %v\n", path, err)
+			continue
+		}
+		build := store.BuildData{Path: pkg, Min: min, Time: data.Time, Files: files, Version: data.Version, Toolchain: data.Toolchain}
+		if ttl > 0 {
+			build.Expires = data.Time.Add(ttl)
+		}
+		if index == deployer.HashIndex && len(output[min].IndexHash) > 0 {
+			build.Index = fmt.Sprintf("%x", output[min].IndexHash)
+		}
+		if err := store.StoreBuild(ctx, h.Database, contents.Main, build); err != nil {
+			fmt.Printf("storing files for %s: %v\n", path, err)
+		}
 	}
 	if err := store.StoreCompile(ctx, h.Database, path, data); err != nil {
 		// don't save this one to the datastore because it's an error from the datastore.
@@ -84,6 +600,25 @@ func (h *Handler) storeCompile(ctx context.Context, send func(services.Message),
 	}
 }
 
+// storeFailure logs a compile of path that failed with err. Failures are only logged, so the error is
+// printed rather than sent to the client.
+func (h *Handler) storeFailure(ctx context.Context, path string, req *http.Request, err error, duration time.Duration) {
+	data := store.CompileData{
+		Path:  path,
+		Time:  time.Now(),
+		Ip:    clientip.Get(req),
+		Error: err.Error(),
+
+		Duration: duration,
+
+		Version:   config.Version,
+		Toolchain: compiler.Version,
+	}
+	if err := store.StoreFailedCompile(ctx, h.Database, data); err != nil {
+		fmt.Printf("storing failed compile of %s: %v\n", path, err)
+	}
+}
+
 func getCompileContents(c *deployer.DeployOutput, min bool) store.CompileContents {
 	val := store.CompileContents{}
 	val.Main = fmt.Sprintf("%x", c.MainHash)
@@ -0,0 +1,171 @@
+package jsgo
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/backend"
+	"github.com/dave/jsgo/server/breaker"
+	"github.com/dave/jsgo/server/jsgo/messages"
+	"github.com/dave/jsgo/server/locale"
+	"github.com/dave/jsgo/server/queue"
+	"github.com/dave/jsgo/server/store"
+	"github.com/dave/services"
+	"github.com/dave/services/deployer"
+	"github.com/dave/services/session"
+)
+
+func TestCheckExpected(t *testing.T) {
+	hash := []byte{0xab, 0x01}
+	if err := checkExpected("ab01", hash); err != nil {
+		t.Fatalf("expected match, found %v", err)
+	}
+	if err := checkExpected("AB01", hash); err != nil {
+		t.Fatalf("expected case insensitive match, found %v", err)
+	}
+	for _, expected := range []string{"ab02", "ab", ""} {
+		err := checkExpected(expected, hash)
+		if _, ok := err.(mismatchError); !ok {
+			t.Fatalf("%q: expected mismatch, found %v", expected, err)
+		}
+	}
+}
+
+// maxFiles is a compiler that records the MaxFiles option.
+type maxFiles struct{ found *int }
+
+func (m maxFiles) Compile(ctx context.Context, s *session.Session, path string, options backend.Options) (map[bool]*deployer.DeployOutput, error) {
+	*m.found = options.MaxFiles
+	return nil, nil
+}
+
+func TestBuildMaxFiles(t *testing.T) {
+	var found int
+	h := &Handler{Compiler: maxFiles{found: &found}}
+	if _, err := h.build(context.Background(), nil, "a", backend.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if found != config.MaxOutputFiles {
+		t.Fatalf("expected the backend to limit the output to %d files, found %d", config.MaxOutputFiles, found)
+	}
+}
+
+func TestIndexType(t *testing.T) {
+	if indexType(messages.Compile{Path: "a"}, "") != deployer.PathIndex {
+		t.Fatal("expected the default build to be written at the package path")
+	}
+	for name, info := range map[string]messages.Compile{
+		"revision": {Path: "gist.github.com/a"},
+		"ref":      {Path: "a", Ref: "v1.0.0"},
+		"expect":   {Path: "a", Expect: "ab01"},
+		"vars":     {Path: "a", Vars: map[string]string{"a.b": "c"}},
+		"debug":    {Path: "a", Debug: true},
+		"shake":    {Path: "a", Shake: true},
+		"global":   {Path: "a", Global: "app"},
+		"metadata": {Path: "a", Metadata: true},
+	} {
+		revision := ""
+		if name == "revision" {
+			revision = "0123abcd"
+		}
+		if indexType(info, revision) != deployer.HashIndex {
+			t.Fatalf("%s: expected the index to be written only at its hash", name)
+		}
+	}
+}
+
+func TestUpstreamFailure(t *testing.T) {
+	tests := map[string]bool{
+		"repository not found": false,
+		`unrecognized import path "github.com/a" (parse: no go-import meta tags)`:       false,
+		"fetch https://example.com/a?go-get=1: 404 Not Found":                           false,
+		`unexpected requesting "https://github.com/a/b.git/info/refs" status code: 503`: true,
+		"fetch https://example.com/a?go-get=1: 429 Too Many Requests":                   true,
+		"dial tcp 140.82.112.3:443: i/o timeout":                                        true,
+		"read tcp: connection reset by peer":                                            true,
+	}
+	for message, expected := range tests {
+		if found := upstreamFailure(errors.New(message)); found != expected {
+			t.Errorf("%s: expected %v, found %v", message, expected, found)
+		}
+	}
+}
+
+func TestServerError(t *testing.T) {
+	for _, err := range []error{locale.Error{Code: locale.FetchBusy}, breaker.UnavailableError{Host: "github.com"}, queue.TooManyItemsQueued} {
+		if !serverError(err) {
+			t.Errorf("%v: expected a server error, so the package isn't remembered as failing", err)
+		}
+	}
+	for _, err := range []error{errors.New("a.go:1:1: expected 'package'"), locale.Error{Code: locale.AuthRequired, Args: []interface{}{"github.com/a/b"}}} {
+		if serverError(err) {
+			t.Errorf("%v: expected the error to be remembered", err)
+		}
+	}
+}
+
+// putDatabase records the entities stored.
+type putDatabase struct {
+	slowDatabase
+	keys []*datastore.Key
+	puts []interface{}
+}
+
+func (d *putDatabase) Put(ctx context.Context, key *datastore.Key, src interface{}) (*datastore.Key, error) {
+	d.keys = append(d.keys, key)
+	d.puts = append(d.puts, src)
+	return key, nil
+}
+
+func TestStoreFailure(t *testing.T) {
+	db := &putDatabase{}
+	h := &Handler{Database: db}
+	h.storeFailure(context.Background(), "github.com/a/b@v1", httptest.NewRequest("GET", "/", nil), errors.New("a.go:1:1: expected 'package'"), time.Second)
+	if len(db.keys) != 1 || db.keys[0].Kind != config.CompileKind {
+		t.Fatalf("expected only the compile log to be written, found %v", db.keys)
+	}
+	data := db.puts[0].(*store.CompileData)
+	if data.Success || data.Path != "github.com/a/b@v1" || data.Error != "a.go:1:1: expected 'package'" || data.Duration != time.Second {
+		t.Fatalf("unexpected compile data %#v", data)
+	}
+}
+
+func TestCheckFetched(t *testing.T) {
+	defer func(run bool, blocked []string) { config.RunGenerators, config.BlockedImports = run, blocked }(config.RunGenerators, config.BlockedImports)
+	config.RunGenerators, config.BlockedImports = false, []string{"github.com/blocked"}
+
+	s := session.New(nil, nil, nil, nil, nil)
+	writeFiles(t, s.GoPath(), map[string]string{
+		"example.com/r/a/main.go": "package main\n\n//go:generate stringer -type=Color\n\nfunc main() {}\n",
+		"example.com/r/b/main.go": "package main\n\nimport \"C\"\n\nfunc main() {}\n",
+		"example.com/r/c/main.go": "package main\n\nfunc main() {}\n",
+	})
+	var sent []services.Message
+	send := func(m services.Message) { sent = append(sent, m) }
+
+	// A package that fails the checks doesn't fail the others, which are warned about their directives.
+	errs, err := checkFetched(context.Background(), s, "example.com/r", []string{"example.com/r/a", "example.com/r/b", "example.com/r/c"}, send)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 || errs["example.com/r/b"] == nil {
+		t.Fatalf("expected only example.com/r/b to fail, found %v", errs)
+	}
+	if len(sent) != 1 || !strings.HasPrefix(sent[0].(messages.Warning).Message, "example.com/r/a has go:generate directives") {
+		t.Fatalf("expected a warning for example.com/r/a, found %v", sent)
+	}
+
+	// A blocked import anywhere in the gopath fails the request.
+	writeFiles(t, s.GoPath(), map[string]string{
+		"example.com/d/d.go": "package d\n\nimport _ \"github.com/blocked/x\"\n",
+	})
+	if _, err := checkFetched(context.Background(), s, "example.com/r", []string{"example.com/r/c"}, send); err == nil {
+		t.Fatal("expected the blocked import to fail the request")
+	}
+}
@@ -0,0 +1,21 @@
+package jsgo
+
+import (
+	"sort"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/jsgo/messages"
+)
+
+// buildTags returns the extra build tags for the request: config.DebugTags for debug builds, and none
+// for the default optimized build. In reproducible mode the tags are sorted.
+func buildTags(info messages.Compile) []string {
+	if !info.Debug {
+		return nil
+	}
+	tags := append([]string{}, config.DebugTags...)
+	if config.Reproducible {
+		sort.Strings(tags)
+	}
+	return tags
+}
@@ -0,0 +1,32 @@
+package jsgo
+
+import (
+	"testing"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/jsgo/messages"
+)
+
+func TestDebug(t *testing.T) {
+	optimized := messages.Compile{Path: "github.com/a/b"}
+	debug := messages.Compile{Path: "github.com/a/b", Debug: true}
+	if failureKey(optimized) == failureKey(debug) {
+		t.Fatal("expected debug builds to have a different cache key")
+	}
+	if len(buildTags(optimized)) != 0 {
+		t.Fatalf("unexpected tags %v", buildTags(optimized))
+	}
+	if tags := buildTags(debug); len(tags) != len(config.DebugTags) || tags[0] != config.DebugTags[0] {
+		t.Fatalf("unexpected tags %v", tags)
+	}
+
+	// in reproducible mode the order of the configured tags doesn't matter
+	defer func(tags []string, reproducible bool) {
+		config.DebugTags, config.Reproducible = tags, reproducible
+	}(config.DebugTags, config.Reproducible)
+	config.DebugTags = []string{"b", "a"}
+	config.Reproducible = true
+	if tags := buildTags(debug); tags[0] != "a" || config.DebugTags[0] != "b" {
+		t.Fatalf("expected sorted copy of tags, found %v", tags)
+	}
+}
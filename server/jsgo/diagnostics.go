@@ -0,0 +1,61 @@
+package jsgo
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dave/jsgo/server/backend"
+	"github.com/dave/jsgo/server/jsgo/messages"
+	"github.com/gopherjs/gopherjs/compiler"
+)
+
+// diagnosticLine matches a line of compiler output in the common file:line:col: message format. The
+// column is optional, and the file must have an extension, so host:port errors aren't matched.
+var diagnosticLine = regexp.MustCompile(`^([^\s:]+\.\w+):(\d+)(?::(\d+))?:\s*(.*)$`)
+
+// Diagnose parses a compile error into structured diagnostics, for editors that show them at their
+// positions. Every error of a compiler.ErrorList is included (its Error method only returns the first),
+// and explained errors are parsed from the raw compiler output. Indented lines continue the diagnostic
+// above them. If no line can be parsed, the whole error is a single diagnostic with no position.
+func Diagnose(err error) messages.Diagnostics {
+	var raw string
+	switch err := err.(type) {
+	case backend.UnsupportedError:
+		raw = err.Raw
+	case compiler.ErrorList:
+		var lines []string
+		for _, e := range err {
+			lines = append(lines, e.Error())
+		}
+		raw = strings.Join(lines, "\n")
+	default:
+		raw = err.Error()
+	}
+	d := messages.Diagnostics{Raw: raw}
+	for _, line := range strings.Split(raw, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		match := diagnosticLine.FindStringSubmatch(line)
+		if match == nil {
+			if n := len(d.Diagnostics); n > 0 && (strings.HasPrefix(line, "\t") || strings.HasPrefix(line, " ")) {
+				d.Diagnostics[n-1].Message += "\n" + strings.TrimSpace(line)
+			}
+			continue
+		}
+		lineNumber, _ := strconv.Atoi(match[2])
+		column, _ := strconv.Atoi(match[3])
+		d.Diagnostics = append(d.Diagnostics, messages.Diagnostic{
+			File:     strings.TrimPrefix(strings.TrimPrefix(match[1], "/"), "gopath/src/"),
+			Line:     lineNumber,
+			Column:   column,
+			Severity: "error",
+			Message:  match[4],
+		})
+	}
+	if len(d.Diagnostics) == 0 {
+		d.Diagnostics = []messages.Diagnostic{{Severity: "error", Message: err.Error()}}
+	}
+	return d
+}
@@ -0,0 +1,53 @@
+package jsgo
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/dave/jsgo/server/backend"
+	"github.com/dave/jsgo/server/jsgo/messages"
+	"github.com/gopherjs/gopherjs/compiler"
+)
+
+func TestDiagnose(t *testing.T) {
+	tests := map[string]struct {
+		err      error
+		expected []messages.Diagnostic
+	}{
+		"lines": {
+			err: errors.New("/gopath/src/github.com/a/b/main.go:3:2: undeclared name: x\n\tmore about x\ngithub.com/a/b/c.go:10: missing return\n"),
+			expected: []messages.Diagnostic{
+				{File: "github.com/a/b/main.go", Line: 3, Column: 2, Severity: "error", Message: "undeclared name: x\nmore about x"},
+				{File: "github.com/a/b/c.go", Line: 10, Severity: "error", Message: "missing return"},
+			},
+		},
+		"list": {
+			err: compiler.ErrorList{errors.New("main.go:1:1: a"), errors.New("main.go:2:5: b")},
+			expected: []messages.Diagnostic{
+				{File: "main.go", Line: 1, Column: 1, Severity: "error", Message: "a"},
+				{File: "main.go", Line: 2, Column: 5, Severity: "error", Message: "b"},
+			},
+		},
+		"explained": {
+			err: backend.Explain(errors.New("main.go:4:8: importing \"C\" is not supported\nmain.go:9:1: other")),
+			expected: []messages.Diagnostic{
+				{File: "main.go", Line: 4, Column: 8, Severity: "error", Message: `importing "C" is not supported`},
+				{File: "main.go", Line: 9, Column: 1, Severity: "error", Message: "other"},
+			},
+		},
+		"unparseable": {
+			err:      errors.New("dial tcp example.com:443: connection refused"),
+			expected: []messages.Diagnostic{{Severity: "error", Message: "dial tcp example.com:443: connection refused"}},
+		},
+	}
+	for name, test := range tests {
+		d := Diagnose(test.err)
+		if !reflect.DeepEqual(d.Diagnostics, test.expected) {
+			t.Errorf("%s: expected %#v, found %#v", name, test.expected, d.Diagnostics)
+		}
+		if d.Raw == "" {
+			t.Errorf("%s: expected the raw output", name)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package jsgo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/dave/jsgo/server/jsgo/messages"
+	"github.com/dave/jsgo/server/store"
+	"github.com/dave/services"
+	"github.com/gopherjs/gopherjs/compiler"
+)
+
+// Diff compares the minified outputs of a package compiled at two refs.
+type Diff struct {
+	Path      string
+	From, To  DiffOutput
+	Changed   bool       // the outputs differ
+	SizeDelta int64      // To.Size - From.Size
+	Files     []DiffFile // the files that differ, if requested
+}
+
+// DiffOutput is the output of the package at one ref.
+type DiffOutput struct {
+	Ref     string
+	BuildId string
+	Size    int64 // total size of the files in bytes
+}
+
+// DiffFile is a file that differs between the outputs. The hashes are the sha256 of the contents, and
+// are empty if the file is only in the other output.
+type DiffFile struct {
+	Package   string
+	From, To  string
+	SizeDelta int64
+}
+
+// Diff compiles path at the refs from and to, and compares the outputs file by file. Each compile is a
+// normal compile of a ref, so files that are already stored aren't stored again, and a commit that has
+// already been compiled with the same toolchain isn't compiled again. The caller must hold a compile
+// slot. A tenant's outputs are compiled and read in its namespace.
+func (h *Handler) Diff(ctx context.Context, req *http.Request, path, from, to string, files bool) (Diff, error) {
+	h, err := h.tenant(req)
+	if err != nil {
+		return Diff{}, err
+	}
+	fromOutput, fromBuild, err := h.refOutput(ctx, req, path, from)
+	if err != nil {
+		return Diff{}, err
+	}
+	toOutput, toBuild, err := h.refOutput(ctx, req, path, to)
+	if err != nil {
+		return Diff{}, err
+	}
+	changed := diffFiles(fromBuild, toBuild)
+	d := Diff{
+		Path:      path,
+		From:      fromOutput,
+		To:        toOutput,
+		Changed:   len(changed) > 0,
+		SizeDelta: toOutput.Size - fromOutput.Size,
+	}
+	if files {
+		d.Files = changed
+	}
+	return d, nil
+}
+
+// refOutput returns the minified output of path at ref, compiling it unless ref is a commit that has
+// already been compiled with the current toolchain.
+func (h *Handler) refOutput(ctx context.Context, req *http.Request, path, ref string) (DiffOutput, store.BuildData, error) {
+	var id string
+	if commitHash.MatchString(ref) {
+		found, data, err := store.Package(ctx, h.Database, refPath(path, ref))
+		if err != nil {
+			return DiffOutput{}, store.BuildData{}, err
+		}
+		if found && data.Success && data.Toolchain == compiler.Version {
+			id = data.Min.Main
+		}
+	}
+	if id == "" {
+		var complete messages.Complete
+		send := func(message services.Message) {
+			if m, ok := message.(messages.Complete); ok {
+				complete = m
+			}
+		}
+		if err := h.Compile(ctx, messages.Compile{Path: path, Ref: ref}, req, send, nil); err != nil {
+			return DiffOutput{}, store.BuildData{}, fmt.Errorf("compiling %s: %v", refPath(path, ref), err)
+		}
+		id = complete.BuildId
+	}
+	found, build, err := store.Build(ctx, h.Database, id)
+	if err != nil {
+		return DiffOutput{}, store.BuildData{}, err
+	}
+	if !found {
+		return DiffOutput{}, store.BuildData{}, fmt.Errorf("files of %s not found", refPath(path, ref))
+	}
+	output := DiffOutput{Ref: ref, BuildId: id}
+	for _, f := range build.Files {
+		output.Size += f.Size
+	}
+	return output, build, nil
+}
+
+// diffFiles returns the files that differ between two outputs, ordered by package. Files are matched by
+// package, and compared by the hash of their contents.
+func diffFiles(from, to store.BuildData) []DiffFile {
+	byPackage := map[string]*DiffFile{}
+	get := func(pkg string) *DiffFile {
+		if byPackage[pkg] == nil {
+			byPackage[pkg] = &DiffFile{Package: pkg}
+		}
+		return byPackage[pkg]
+	}
+	for _, f := range from.Files {
+		d := get(filePackage(f.Name))
+		d.From = f.Hash
+		d.SizeDelta -= f.Size
+	}
+	for _, f := range to.Files {
+		d := get(filePackage(f.Name))
+		d.To = f.Hash
+		d.SizeDelta += f.Size
+	}
+	var changed []DiffFile
+	for _, d := range byPackage {
+		if d.From != d.To {
+			changed = append(changed, *d)
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].Package < changed[j].Package })
+	return changed
+}
+
+// filePackage returns the package of a file in the pkg bucket, which is named <package>.<hash>.js.
+func filePackage(name string) string {
+	name = strings.TrimSuffix(name, ".js")
+	if i := strings.LastIndex(name, "."); i > -1 {
+		return name[:i]
+	}
+	return name
+}
@@ -0,0 +1,102 @@
+package jsgo
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/dave/jsgo/server/memstore"
+	"github.com/dave/jsgo/server/store"
+	"github.com/dave/jsgo/server/tenant"
+	"github.com/gopherjs/gopherjs/compiler"
+)
+
+func TestDiff(t *testing.T) {
+	const (
+		path = "github.com/a/b"
+		sha1 = "1111111111111111111111111111111111111111"
+		sha2 = "2222222222222222222222222222222222222222"
+		sha3 = "3333333333333333333333333333333333333333"
+	)
+	ctx := context.Background()
+	db := memstore.NewDatabase()
+	builds := map[string][]store.BuildFile{
+		"m1": {
+			{Name: "prelude.p1.js", Size: 100, Hash: "aa"},
+			{Name: "github.com/a/c.c1.js", Size: 10, Hash: "cc"},
+			{Name: "github.com/a/b.m1.js", Size: 5, Hash: "bb"},
+		},
+		"m2": {
+			{Name: "prelude.p1.js", Size: 100, Hash: "aa"},
+			{Name: "github.com/a/d.d1.js", Size: 20, Hash: "dd"},
+			{Name: "github.com/a/b.m2.js", Size: 6, Hash: "b2"},
+		},
+	}
+	for id, files := range builds {
+		if err := store.StoreBuild(ctx, db, id, store.BuildData{Path: path, Min: true, Files: files}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// sha3 is a later commit that doesn't change the output of sha1.
+	for sha, id := range map[string]string{sha1: "m1", sha2: "m2", sha3: "m1"} {
+		data := store.CompileData{Path: refPath(path, sha), Success: true, Toolchain: compiler.Version, Min: store.CompileContents{Main: id}}
+		if err := store.StoreCompile(ctx, db, refPath(path, sha), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := &Handler{Database: db}
+	req := httptest.NewRequest("POST", "/_api/diff", nil)
+
+	d, err := h.Diff(ctx, req, path, sha1, sha3, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Changed || d.SizeDelta != 0 || len(d.Files) != 0 || d.From.BuildId != "m1" || d.To.BuildId != "m1" || d.To.Size != 115 {
+		t.Fatalf("expected identical outputs, found %+v", d)
+	}
+
+	d, err = h.Diff(ctx, req, path, sha1, sha2, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []DiffFile{
+		{Package: "github.com/a/b", From: "bb", To: "b2", SizeDelta: 1},
+		{Package: "github.com/a/c", From: "cc", SizeDelta: -10},
+		{Package: "github.com/a/d", To: "dd", SizeDelta: 20},
+	}
+	if !d.Changed || d.SizeDelta != 11 || !reflect.DeepEqual(d.Files, expected) {
+		t.Fatalf("expected the outputs to differ by %+v, found %+v", expected, d)
+	}
+
+	if d, _ := h.Diff(ctx, req, path, sha1, sha2, false); !d.Changed || d.Files != nil {
+		t.Fatalf("expected no files unless requested, found %+v", d)
+	}
+}
+
+func TestDiffTenant(t *testing.T) {
+	const path = "github.com/a/b"
+	sha := "1111111111111111111111111111111111111111"
+	ctx := context.Background()
+	db := memstore.NewDatabase()
+	acme := tenant.NewDatabase(db, "acme")
+	if err := store.StoreBuild(ctx, acme, "m1", store.BuildData{Path: path, Min: true, Files: []store.BuildFile{{Name: "github.com/a/b.m1.js", Size: 5, Hash: "bb"}}}); err != nil {
+		t.Fatal(err)
+	}
+	data := store.CompileData{Path: refPath(path, sha), Success: true, Toolchain: compiler.Version, Min: store.CompileContents{Main: "m1"}}
+	if err := store.StoreCompile(ctx, acme, refPath(path, sha), data); err != nil {
+		t.Fatal(err)
+	}
+
+	// The tenant's compiles are read from its namespace.
+	h := &Handler{Database: db}
+	req := httptest.NewRequest("POST", "/_api/diff", nil)
+	req = req.WithContext(tenant.NewContext(req.Context(), "acme"))
+	d, err := h.Diff(ctx, req, path, sha, sha, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.From.BuildId != "m1" || d.To.Size != 5 {
+		t.Fatalf("expected the tenant's build, found %+v", d)
+	}
+}
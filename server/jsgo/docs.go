@@ -0,0 +1,86 @@
+package jsgo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/services"
+	"gopkg.in/src-d/go-billy.v4"
+)
+
+// DocsName is the name of the rendered docs page in the pkg bucket, next to the compiled script (hash
+// is the hash of the minified main script). The page is only rendered once per compile.
+func DocsName(path, hash string) string {
+	return fmt.Sprintf("%s.%s.docs.html", path, hash)
+}
+
+// storeDocs renders the package's README (or the first .md file) as a landing page that runs the
+// compiled script (served from pkgHost), and stores it in the pkg bucket. It returns false if the
+// package has no .md files.
+func storeDocs(ctx context.Context, fileserver services.Fileserver, gopath billy.Filesystem, pkgHost, pkg, hash string) (bool, error) {
+	name, err := docsFile(gopath, pkg)
+	if err != nil || name == "" {
+		return false, err
+	}
+	b, err := readFile(gopath, filepath.Join("gopath", "src", pkg, name))
+	if err != nil {
+		return false, err
+	}
+	buf := &bytes.Buffer{}
+	if err := docsTemplate.Execute(buf, struct {
+		Path   string
+		Body   template.HTML
+		Script string
+	}{
+		Path:   pkg,
+		Body:   template.HTML(renderMarkdown(b)), // renderMarkdown escapes everything
+		Script: fmt.Sprintf("%s://%s/%s.%s.js", config.Protocol[config.Pkg], pkgHost, pkg, hash),
+	}); err != nil {
+		return false, err
+	}
+	if _, err := fileserver.Write(ctx, config.Bucket[config.Pkg], DocsName(pkg, hash), buf, false, "text/html", "public,max-age=31536000,immutable"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// docsFile returns the name of the README.md in the package directory (in any case), or the first .md
+// file if there's no README.
+func docsFile(gopath billy.Filesystem, pkg string) (string, error) {
+	fis, err := gopath.ReadDir(filepath.Join("gopath", "src", pkg))
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	for _, fi := range fis {
+		if fi.IsDir() || !strings.HasSuffix(strings.ToLower(fi.Name()), ".md") {
+			continue
+		}
+		if strings.ToLower(fi.Name()) == "readme.md" {
+			return fi.Name(), nil
+		}
+		names = append(names, fi.Name())
+	}
+	if len(names) == 0 {
+		return "", nil
+	}
+	sort.Strings(names)
+	return names[0], nil
+}
+
+var docsTemplate = template.Must(template.New("docs").Parse(`<html>
+	<head>
+		<meta charset="utf-8">
+		<title>{{ .Path }}</title>
+	</head>
+	<body>
+		{{ .Body }}
+		<script src="{{ .Script }}"></script>
+	</body>
+</html>`))
@@ -0,0 +1,52 @@
+package jsgo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/memstore"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	src := "# Title\n\nSome *em* and **strong** text with `<code>`.\n\n- [link](https://jsgo.io)\n- [bad](javascript:void)\n\n<script>alert(1)</script>\n\n```\nif a < b {\n```\n"
+	expected := `<h1>Title</h1>
+<p>Some <em>em</em> and <strong>strong</strong> text with <code>&lt;code&gt;</code>.</p>
+<ul>
+<li><a href="https://jsgo.io" rel="nofollow">link</a></li>
+<li>bad</li>
+</ul>
+<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>
+<pre><code>if a &lt; b {</code></pre>
+`
+	if found := renderMarkdown([]byte(src)); found != expected {
+		t.Fatalf("unexpected html:\n%s", found)
+	}
+}
+
+func TestStoreDocs(t *testing.T) {
+	gopath := memfs.New()
+	util.WriteFile(gopath, "gopath/src/github.com/a/b/main.go", []byte("package main"), 0666)
+	util.WriteFile(gopath, "gopath/src/github.com/a/b/notes.md", []byte("# Notes"), 0666)
+	util.WriteFile(gopath, "gopath/src/github.com/a/b/Readme.md", []byte("# Hello"), 0666)
+	util.WriteFile(gopath, "gopath/src/github.com/a/c/main.go", []byte("package main"), 0666)
+	fs := memstore.NewFileserver(nil)
+
+	stored, err := storeDocs(context.Background(), fs, gopath, config.PkgHostPath(), "github.com/a/b", "abc")
+	if err != nil || !stored {
+		t.Fatalf("expected docs to be stored, found %v, %v", stored, err)
+	}
+	page := fs.Files[config.Bucket[config.Pkg]+":"+DocsName("github.com/a/b", "abc")]
+	script := fmt.Sprintf(`<script src="%s://%s/github.com/a/b.abc.js">`, config.Protocol[config.Pkg], config.PkgHostPath())
+	if !strings.Contains(page, "<h1>Hello</h1>") || !strings.Contains(page, script) {
+		t.Fatalf("unexpected page:\n%s", page)
+	}
+
+	if stored, err := storeDocs(context.Background(), fs, gopath, config.PkgHostPath(), "github.com/a/c", "def"); err != nil || stored {
+		t.Fatalf("expected no docs, found %v, %v", stored, err)
+	}
+}
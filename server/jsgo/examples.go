@@ -0,0 +1,297 @@
+package jsgo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/backend"
+	"github.com/dave/jsgo/server/jsgo/messages"
+	"github.com/dave/jsgo/server/queue"
+	"github.com/dave/jsgo/server/store"
+	"github.com/dave/services"
+	"github.com/dave/services/deployer"
+	"github.com/dave/services/getter/get"
+	"github.com/dave/services/getter/gettermsg"
+	"github.com/dave/services/session"
+	"gopkg.in/src-d/go-billy.v4"
+)
+
+// exampleDir is the directory in a package where the main packages of its examples are generated. The
+// main packages are inside the package, so vendored and internal imports resolve like they do for the
+// package's tests.
+const exampleDir = "_jsgo_examples"
+
+// example is an Example function in the test files of a package.
+type example struct {
+	name     string // function name, e.g. ExampleFoo_bar
+	external bool   // in the external test package (package foo_test)
+}
+
+// examplePath returns the import path of the main package generated for an example.
+func examplePath(pkg string, e example) string {
+	return pkg + "/" + exampleDir + "/" + e.name
+}
+
+// findExamples returns the Example functions in the test files of pkg, ordered by name. Like go test,
+// examples are functions named Example or starting Example with no parameters or results.
+func findExamples(bctx *build.Context, pkg string) ([]example, error) {
+	p, err := bctx.Import(pkg, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	var examples []example
+	for external, files := range map[bool][]string{false: p.TestGoFiles, true: p.XTestGoFiles} {
+		for _, name := range files {
+			file, err := parseFile(bctx, token.NewFileSet(), filepath.Join(p.Dir, name))
+			if err != nil {
+				return nil, err
+			}
+			for _, decl := range file.Decls {
+				f, ok := decl.(*ast.FuncDecl)
+				if !ok || f.Recv != nil || !isExample(f.Name.Name) {
+					continue
+				}
+				if f.Type.Params.NumFields() > 0 || f.Type.Results.NumFields() > 0 {
+					continue
+				}
+				examples = append(examples, example{name: f.Name.Name, external: external})
+			}
+		}
+	}
+	sort.Slice(examples, func(i, j int) bool { return examples[i].name < examples[j].name })
+	return examples, nil
+}
+
+// isExample returns true for the names go test treats as examples: Example, or Example followed by an
+// identifier that doesn't start with a lower case letter, or by an underscore (e.g. Example_suffix).
+func isExample(name string) bool {
+	if !strings.HasPrefix(name, "Example") {
+		return false
+	}
+	rest := name[len("Example"):]
+	return rest == "" || rest[0] == '_' || !(rest[0] >= 'a' && rest[0] <= 'z')
+}
+
+func parseFile(bctx *build.Context, fset *token.FileSet, name string) (*ast.File, error) {
+	f, err := bctx.OpenFile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return parser.ParseFile(fset, name, b, parser.ParseComments)
+}
+
+// writeExample generates a main package in the gopath that runs an example, and returns its import
+// path. The main package has the test files of the example's package (the external test files, or the
+// package and its internal test files), with the package clause changed to main, and a main function
+// that calls the example. Test files are renamed so they aren't excluded from the build.
+func writeExample(gopath billy.Filesystem, bctx *build.Context, pkg string, e example) (string, error) {
+	p, err := bctx.Import(pkg, "", 0)
+	if err != nil {
+		return "", err
+	}
+	files := p.XTestGoFiles
+	if !e.external {
+		files = append(append([]string{}, p.GoFiles...), p.TestGoFiles...)
+	}
+	path := examplePath(pkg, e)
+	dir := filepath.Join("gopath", "src", path)
+	for _, name := range files {
+		fset := token.NewFileSet()
+		src, err := parseFile(bctx, fset, filepath.Join(p.Dir, name))
+		if err != nil {
+			return "", err
+		}
+		src.Name.Name = "main"
+		buf := &bytes.Buffer{}
+		if err := format.Node(buf, fset, src); err != nil {
+			return "", err
+		}
+		if strings.HasSuffix(name, "_test.go") {
+			name = strings.TrimSuffix(name, "_test.go") + "_example.go"
+		}
+		if err := writeFile(gopath, filepath.Join(dir, name), buf.Bytes()); err != nil {
+			return "", err
+		}
+	}
+	main := fmt.Sprintf("package main\n\nfunc main() {\n\t%s()\n}\n", e.name)
+	if err := writeFile(gopath, filepath.Join(dir, "jsgo_example_main.go"), []byte(main)); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func writeFile(fs billy.Filesystem, name string, contents []byte) error {
+	f, err := fs.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(contents); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// compileExamples compiles each Example function of the package at info.Path into a runnable main
+// package, and replies with CompleteExamples. The package is fetched once, and the examples are compiled
+// one after another within the single queue slot held by this request. An example that fails doesn't
+// fail the others.
+func (h *Handler) compileExamples(ctx context.Context, s *session.Session, written *sizes, info messages.Compile, req *http.Request, send func(services.Message)) error {
+
+	ctx, cancel := context.WithTimeout(ctx, config.CompileAllTimeout)
+	defer cancel()
+
+	start := time.Now()
+	pkg := info.Path
+
+	send(gettermsg.Downloading{Starting: true})
+
+	if err := fetches.acquire(ctx); err != nil {
+		return err
+	}
+	fetching := true
+	defer func() {
+		if fetching {
+			fetches.release()
+		}
+	}()
+
+	if err := h.download(ctx, s, pkg, "", info, send); err != nil {
+		return err
+	}
+
+	bctx := s.BuildContext(session.JsType, "")
+	examples, err := findExamples(bctx, pkg)
+	if err != nil {
+		return err
+	}
+	if len(examples) == 0 {
+		return fmt.Errorf("no examples found in %s", pkg)
+	}
+	if len(examples) > config.MaxExamples {
+		return fmt.Errorf("%s has %d examples - the maximum is %d", pkg, len(examples), config.MaxExamples)
+	}
+
+	results := map[string]messages.CompileResult{}
+	var paths []string
+	for _, e := range examples {
+		path, err := writeExample(s.GoPath(), bctx, pkg, e)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+	}
+
+	// The package is already in the gopath, so the getter only downloads the imports of the tests.
+	gitreq := h.cache(pkg).NewRequest(true)
+	if err := gitreq.InitialiseFromHints(ctx, paths...); err != nil {
+		return err
+	}
+	var fetched []example
+	for _, e := range examples {
+		if err := get.New(s, send, gitreq).Get(ctx, examplePath(pkg, e), false, config.LOCAL, false); err != nil {
+			results[e.name] = messages.CompileResult{Error: err.Error()}
+			continue
+		}
+		fetched = append(fetched, e)
+	}
+	if err := gitreq.Close(ctx); err != nil {
+		return err
+	}
+	fetches.release()
+	fetching = false
+
+	// The package itself is checked for its go:generate directives, which can be in its test files.
+	checks := []string{pkg}
+	for _, e := range fetched {
+		checks = append(checks, examplePath(pkg, e))
+	}
+	failed, err := checkFetched(ctx, s, pkg, checks, send)
+	if err != nil {
+		return err
+	}
+	if err := failed[pkg]; err != nil {
+		return err
+	}
+	var checked []example
+	for _, e := range fetched {
+		if err := failed[examplePath(pkg, e)]; err != nil {
+			results[e.name] = messages.CompileResult{Error: err.Error()}
+			continue
+		}
+		checked = append(checked, e)
+	}
+
+	send(gettermsg.Downloading{Done: true})
+	fetchTime := time.Since(start)
+
+	// The fetch slot has been released, so wait for a compile slot.
+	waitStart := time.Now()
+	if err := queue.Wait(ctx); err != nil {
+		return err
+	}
+	phases := store.CompilePhases{Fetch: fetchTime, Wait: time.Since(waitStart)}
+
+	for name, result := range h.buildExamples(ctx, s, written, req, pkg, refPath(pkg, info.Ref), checked, phases, send) {
+		results[name] = result
+	}
+
+	send(messages.CompleteExamples{
+		Path:    pkg,
+		Results: results,
+	})
+	return nil
+}
+
+// buildExamples compiles the generated main packages of the examples of pkg, and returns the result of
+// each by example name. Each example is a separate build, logged at <path>@example-<name> (path is pkg,
+// or the ref path of pkg), and its page is only written at its hash.
+func (h *Handler) buildExamples(ctx context.Context, s *session.Session, written *sizes, req *http.Request, pkg, path string, examples []example, phases store.CompilePhases, send func(services.Message)) map[string]messages.CompileResult {
+	results := map[string]messages.CompileResult{}
+	for _, e := range examples {
+		main := examplePath(pkg, e)
+		logged := path + "@example-" + e.name
+		compileStart := time.Now()
+		fail := func(err error) {
+			results[e.name] = messages.CompileResult{Error: err.Error()}
+			if ctx.Err() == nil {
+				h.storeFailure(ctx, logged, req, err, time.Since(compileStart))
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			fail(err)
+			continue
+		}
+		output, err := h.build(ctx, s, main, backend.Options{Index: deployer.HashIndex, Minify: map[bool]bool{true: true, false: true}, Send: send})
+		if err != nil {
+			fail(err)
+			continue
+		}
+		phases.Compile = time.Since(compileStart)
+		h.storeCompile(ctx, send, written, logged, main, req, output, deployer.HashIndex, phases.Fetch+phases.Compile, phases, config.TtlDefault)
+		hash := fmt.Sprintf("%x", output[true].MainHash)
+		results[e.name] = messages.CompileResult{
+			Url:     fmt.Sprintf("%s://%s/%s.%s.js", config.Protocol[config.Pkg], h.pkgHost(), main, hash),
+			BuildId: hash,
+		}
+	}
+	return results
+}
@@ -0,0 +1,115 @@
+package jsgo
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"go/parser"
+	"go/token"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dave/jsgo/server/backend"
+	"github.com/dave/jsgo/server/memstore"
+	"github.com/dave/jsgo/server/store"
+	"github.com/dave/services"
+	"github.com/dave/services/builder"
+	"github.com/dave/services/deployer"
+	"github.com/dave/services/session"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+// recordingCompiler records the packages compiled, and fails the ones in fail.
+type recordingCompiler struct {
+	compiled []string
+	fail     map[string]error
+}
+
+func (r *recordingCompiler) Compile(ctx context.Context, s *session.Session, path string, options backend.Options) (map[bool]*deployer.DeployOutput, error) {
+	r.compiled = append(r.compiled, path)
+	if err := r.fail[path]; err != nil {
+		return nil, err
+	}
+	hash := sha1.Sum([]byte(path))
+	return map[bool]*deployer.DeployOutput{
+		true:  {CommandOutput: &builder.CommandOutput{}, MainHash: hash[:]},
+		false: {CommandOutput: &builder.CommandOutput{}, MainHash: hash[:]},
+	}, nil
+}
+
+func TestExamples(t *testing.T) {
+	fs := memfs.New()
+	writeFiles(t, fs, map[string]string{
+		"example.com/a/a.go":         "package a\n\nfunc hello() string { return \"hello\" }\n\n// Hello says hello.\nfunc Hello() string { return hello() }\n",
+		"example.com/a/a_test.go":    "package a\n\nimport \"fmt\"\n\nfunc Example_unexported() {\n\tfmt.Println(hello())\n}\n\nfunc Examples() {}\n\nfunc ExampleArgs(i int) {}\n",
+		"example.com/a/x_test.go":    "package a_test\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/a\"\n)\n\nfunc ExampleHello() {\n\tfmt.Println(a.Hello())\n\t// Output: hello\n}\n",
+		"example.com/a/other_js.go":  "package a\n\nvar js = true\n",
+		"example.com/a/other_cgo.go": "// +build !js\n\npackage a\n\nvar js = false\n",
+	})
+	bctx := memContext(fs)
+
+	examples, err := findExamples(bctx, "example.com/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []example{{name: "ExampleHello", external: true}, {name: "Example_unexported"}}
+	if len(examples) != len(expected) || examples[0] != expected[0] || examples[1] != expected[1] {
+		t.Fatalf("expected %v, found %v", expected, examples)
+	}
+
+	for _, e := range examples {
+		path, err := writeExample(fs, bctx, "example.com/a", e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := bctx.Import(path, "", 0)
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+		if p.Name != "main" {
+			t.Errorf("%s: expected a main package, found %s", e.name, p.Name)
+		}
+		sort.Strings(p.GoFiles)
+		files := strings.Join(p.GoFiles, " ")
+		if e.external && files != "jsgo_example_main.go x_example.go" {
+			t.Errorf("%s: expected the external test files, found %s", e.name, files)
+		}
+		if !e.external && files != "a.go a_example.go jsgo_example_main.go other_js.go" {
+			t.Errorf("%s: expected the package and its test files, found %s", e.name, files)
+		}
+		for _, name := range p.GoFiles {
+			b, err := readFile(fs, filepath.Join(p.Dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := parser.ParseFile(token.NewFileSet(), name, b, 0); err != nil {
+				t.Errorf("%s: invalid generated file %s: %v", e.name, name, err)
+			}
+		}
+		main, _ := readFile(fs, filepath.Join(p.Dir, "jsgo_example_main.go"))
+		if !strings.Contains(string(main), "\t"+e.name+"()\n") {
+			t.Errorf("%s: expected main to call the example, found %q", e.name, main)
+		}
+	}
+
+	compiler := &recordingCompiler{fail: map[string]error{examplePath("example.com/a", expected[1]): errors.New("build failed")}}
+	db := memstore.NewDatabase()
+	h := &Handler{Compiler: compiler, Database: db}
+	req := httptest.NewRequest("GET", "/", nil)
+	results := h.buildExamples(context.Background(), nil, newSizes(memstore.NewFileserver(nil)), req, "example.com/a", "example.com/a", examples, store.CompilePhases{}, func(services.Message) {})
+
+	hello := results["ExampleHello"]
+	if hello.Error != "" || !strings.HasSuffix(hello.Url, "/example.com/a/_jsgo_examples/ExampleHello."+hello.BuildId+".js") {
+		t.Errorf("unexpected result %#v", hello)
+	}
+	if results["Example_unexported"].Error != "build failed" {
+		t.Errorf("expected the failure to be reported, found %#v", results["Example_unexported"])
+	}
+	found, data, err := store.Package(context.Background(), db, "example.com/a@example-ExampleHello")
+	if err != nil || !found || data.Min.Main != hello.BuildId {
+		t.Errorf("expected the example to be logged separately, found %v %#v %v", found, data, err)
+	}
+}
@@ -0,0 +1,126 @@
+package jsgo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/gitremote"
+	"github.com/dave/jsgo/server/jsgo/messages"
+)
+
+// failures remembers recent compile failures, so a package that fails isn't fetched again on every
+// request. Failures are scoped to the commit that was compiled, so a new commit upstream is compiled
+// straight away.
+var failures = &failureCache{entries: map[string]failureEntry{}, sha: remoteSha}
+
+type failureCache struct {
+	m       sync.Mutex
+	entries map[string]failureEntry
+	sha     func(ctx context.Context, path, ref string) (string, error)
+}
+
+type failureEntry struct {
+	sha     string
+	err     string
+	expires time.Time
+}
+
+func failureKey(info messages.Compile) string {
+	key := info.Path + "@" + info.Ref + "#" + info.Target + "~" + varsKey(info.Vars)
+	if info.Debug {
+		key += "~debug"
+	}
+	if info.Shake {
+		key += "~shake"
+	}
+	if k := symbolsKey(info.Symbols); k != "" {
+		key += "~symbols-" + k
+	}
+	if k := replaceKey(info.Replace); k != "" {
+		key += "~replace-" + k
+	}
+	return key
+}
+
+// check returns the remembered error if the package failed to compile at the current upstream commit.
+func (c *failureCache) check(ctx context.Context, info messages.Compile) error {
+	key := failureKey(info)
+	c.m.Lock()
+	e, ok := c.entries[key]
+	c.m.Unlock()
+	if !ok {
+		return nil
+	}
+	if time.Now().After(e.expires) {
+		c.remove(key)
+		return nil
+	}
+	sha, err := c.sha(ctx, info.Path, resolveRef(info.Path, info.Ref))
+	if err != nil || sha != e.sha {
+		// the upstream commit has changed (or we can't tell) so compile again.
+		c.remove(key)
+		return nil
+	}
+	return fmt.Errorf("%s (this failure is cached - force a retry to compile again)", e.err)
+}
+
+// add remembers a failure, along with the upstream commit that failed.
+func (c *failureCache) add(ctx context.Context, info messages.Compile, compileErr error) {
+	sha, err := c.sha(ctx, info.Path, resolveRef(info.Path, info.Ref))
+	if err != nil {
+		return
+	}
+	// pull request heads move often, so their failures are remembered for less time.
+	ttl := config.FailureCacheTime
+	if pullRef.MatchString(info.Ref) {
+		ttl = config.PullFailureCacheTime
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.prune()
+	c.entries[failureKey(info)] = failureEntry{
+		sha:     sha,
+		err:     compileErr.Error(),
+		expires: time.Now().Add(ttl),
+	}
+}
+
+// prune removes the expired failures, so failures that are never checked again don't stay in memory.
+// Must be called with the lock.
+func (c *failureCache) prune() {
+	now := time.Now()
+	for key, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+func (c *failureCache) remove(key string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	delete(c.entries, key)
+}
+
+// remoteSha returns the commit that ref (or HEAD if ref is empty) points at in the repo containing
+// path.
+func remoteSha(ctx context.Context, path, ref string) (string, error) {
+	if revision := gistWithRevision.FindStringSubmatch(path); revision != nil {
+		return revision[2], nil
+	}
+	if commitHash.MatchString(ref) {
+		return ref, nil
+	}
+	root, err := repoRoot(path)
+	if err != nil {
+		return "", err
+	}
+	refs, err := gitremote.List(ctx, root)
+	if err != nil {
+		return "", err
+	}
+	return gitremote.Resolve(root, refs, ref)
+}
@@ -0,0 +1,72 @@
+package jsgo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/jsgo/messages"
+)
+
+func TestFailureCache(t *testing.T) {
+	sha := "a"
+	c := &failureCache{
+		entries: map[string]failureEntry{},
+		sha:     func(ctx context.Context, path, ref string) (string, error) { return sha, nil },
+	}
+	ctx := context.Background()
+	info := messages.Compile{Path: "github.com/a/b"}
+
+	if err := c.check(ctx, info); err != nil {
+		t.Fatalf("expected no cached failure, found %v", err)
+	}
+	c.add(ctx, info, errors.New("compile error"))
+	if err := c.check(ctx, info); err == nil {
+		t.Fatal("expected cached failure")
+	}
+	if err := c.check(ctx, messages.Compile{Path: "github.com/a/b", Ref: "v1"}); err != nil {
+		t.Fatalf("expected no cached failure for a different ref, found %v", err)
+	}
+
+	// A new upstream commit invalidates the failure.
+	sha = "b"
+	if err := c.check(ctx, info); err != nil {
+		t.Fatalf("expected failure to be invalidated, found %v", err)
+	}
+	sha = "a"
+	if err := c.check(ctx, info); err != nil {
+		t.Fatalf("expected failure to be removed, found %v", err)
+	}
+}
+
+func TestFailureCachePullRequest(t *testing.T) {
+	c := &failureCache{
+		entries: map[string]failureEntry{},
+		sha:     func(ctx context.Context, path, ref string) (string, error) { return "a", nil },
+	}
+	pull := messages.Compile{Path: "github.com/a/b", Ref: "refs/pull/1/head"}
+	c.add(context.Background(), pull, errors.New("fail"))
+
+	if failureKey(pull) == failureKey(messages.Compile{Path: "github.com/a/b", Ref: "refs/pull/2/head"}) {
+		t.Fatal("expected the pull request number in the key")
+	}
+	if c.check(context.Background(), messages.Compile{Path: "github.com/a/b"}) != nil {
+		t.Fatal("expected the pull request failure not to affect the default branch")
+	}
+	if e := c.entries[failureKey(pull)]; e.expires.After(time.Now().Add(config.PullFailureCacheTime)) {
+		t.Fatalf("expected the pull request ttl, found %v", time.Until(e.expires))
+	}
+}
+
+func TestFailureCachePrune(t *testing.T) {
+	c := &failureCache{
+		entries: map[string]failureEntry{"expired": {expires: time.Now().Add(-time.Second)}},
+		sha:     func(ctx context.Context, path, ref string) (string, error) { return "a", nil },
+	}
+	c.add(context.Background(), messages.Compile{Path: "github.com/a/b"}, errors.New("fail"))
+	if _, ok := c.entries["expired"]; ok || len(c.entries) != 1 {
+		t.Fatalf("expected the expired failure to be pruned, found %v", c.entries)
+	}
+}
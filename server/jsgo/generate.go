@@ -0,0 +1,161 @@
+package jsgo
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"go/build"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/jsgo/messages"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+)
+
+// generateDirective is a //go:generate line in a file of the compiled package.
+type generateDirective struct {
+	pkg     string // package name
+	file    string // file name, relative to the package
+	line    int
+	command string // the text after //go:generate
+}
+
+func (d generateDirective) String() string {
+	return fmt.Sprintf("%s:%d: %s", d.file, d.line, d.command)
+}
+
+// findGenerate returns the go:generate directives in the files of pkg, including test files, like go
+// generate. Files excluded by build constraints are skipped. Missing packages are reported by the compiler.
+func findGenerate(bctx *build.Context, pkg string) ([]generateDirective, error) {
+	p, err := bctx.Import(pkg, "", 0)
+	if err != nil {
+		return nil, nil
+	}
+	var directives []generateDirective
+	for _, files := range [][]string{p.GoFiles, p.TestGoFiles, p.XTestGoFiles} {
+		for _, name := range files {
+			f, err := bctx.OpenFile(filepath.Join(p.Dir, name))
+			if err != nil {
+				return nil, err
+			}
+			scanner := bufio.NewScanner(f)
+			var line int
+			for scanner.Scan() {
+				line++
+				if strings.HasPrefix(scanner.Text(), "//go:generate ") {
+					command := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "//go:generate "))
+					directives = append(directives, generateDirective{pkg: p.Name, file: name, line: line, command: command})
+				}
+			}
+			f.Close()
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return directives, nil
+}
+
+// generateWarning warns that pkg may need code generated by the directives, which weren't run.
+func generateWarning(pkg string, directives []generateDirective) messages.Warning {
+	var lines []string
+	for _, d := range directives {
+		lines = append(lines, "\t"+d.String())
+	}
+	return messages.Warning{
+		Message: fmt.Sprintf("%s has go:generate directives that weren't run, so generated code may be missing - commit the generated files:\n%s", pkg, strings.Join(lines, "\n")),
+	}
+}
+
+// allowedGenerator returns the arguments of a directive if its command is in config.AllowedGenerators.
+// Directives with quotes or variables are never run: they'd need the expansion rules of go generate.
+func allowedGenerator(d generateDirective) ([]string, bool) {
+	if strings.ContainsAny(d.command, "\"`$") {
+		return nil, false
+	}
+	args := strings.Fields(d.command)
+	if len(args) == 0 || args[0] == "go" {
+		return nil, false
+	}
+	for _, allowed := range config.AllowedGenerators {
+		if args[0] == allowed {
+			return args, true
+		}
+	}
+	return nil, false
+}
+
+// runGenerators runs the directives allowed by config.AllowedGenerators in a copy of the gopath in a
+// working directory, and copies the Go files they write in the package back to the gopath. Each
+// generator runs in the package directory like go generate, with a minimal environment and
+// config.GenerateTimeout. It returns the directives that weren't run.
+func runGenerators(ctx context.Context, gopath billy.Filesystem, pkg string, directives []generateDirective) ([]generateDirective, error) {
+	var skipped, allowed []generateDirective
+	for _, d := range directives {
+		if _, ok := allowedGenerator(d); ok {
+			allowed = append(allowed, d)
+		} else {
+			skipped = append(skipped, d)
+		}
+	}
+	if len(allowed) == 0 {
+		return skipped, nil
+	}
+	err := withWorkDir(func(dir string) error {
+		if err := copyTree(gopath, filepath.Join("gopath", "src"), osfs.New(dir), "src"); err != nil {
+			return err
+		}
+		pkgDir := filepath.Join(dir, "src", filepath.FromSlash(pkg))
+		for _, d := range allowed {
+			args, _ := allowedGenerator(d)
+			command, err := exec.LookPath(args[0])
+			if err != nil {
+				return fmt.Errorf("running %s: %v", d, err)
+			}
+			if err := runGenerator(ctx, command, args[1:], pkgDir, dir, d); err != nil {
+				return err
+			}
+		}
+		fis, err := osfs.New(pkgDir).ReadDir("")
+		if err != nil {
+			return err
+		}
+		for _, fi := range fis {
+			if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".go") {
+				continue
+			}
+			if err := copyFile(osfs.New(pkgDir), fi.Name(), gopath, filepath.Join("gopath", "src", pkg, fi.Name())); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return skipped, err
+}
+
+// runGenerator runs one generator in dir, with the variables go generate sets.
+func runGenerator(ctx context.Context, command string, args []string, dir, gopath string, d generateDirective) error {
+	ctx, cancel := context.WithTimeout(ctx, config.GenerateTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Dir = dir
+	cmd.Env = []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + gopath,
+		"GOPATH=" + gopath,
+		"GO111MODULE=off",
+		"GOOS=js",
+		"GOARCH=wasm",
+		"GOFILE=" + d.file,
+		fmt.Sprintf("GOLINE=%d", d.line),
+		"GOPACKAGE=" + d.pkg,
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("running %s: %v\n%s", d, err, output)
+	}
+	return nil
+}
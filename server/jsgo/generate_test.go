@@ -0,0 +1,84 @@
+package jsgo
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dave/jsgo/config"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+func TestFindGenerate(t *testing.T) {
+	fs := memfs.New()
+	writeFiles(t, fs, map[string]string{
+		"example.com/a/a.go":      "package a\n\n//go:generate stringer -type=Color\n\ntype Color int\n",
+		"example.com/a/a_test.go": "package a\n\n//go:generate mockgen -source=a.go\n",
+		"example.com/a/a_cgo.go":  "// +build !js\n\npackage a\n\n//go:generate excluded\n",
+		"example.com/b/b.go":      "package b\n\n// go:generate isn't a directive with a space\n",
+	})
+	bctx := memContext(fs)
+
+	directives, err := findGenerate(bctx, "example.com/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"a.go:3: stringer -type=Color", "a_test.go:3: mockgen -source=a.go"}
+	if len(directives) != len(expected) {
+		t.Fatalf("expected %v, found %v", expected, directives)
+	}
+	for i, d := range directives {
+		if d.String() != expected[i] || d.pkg != "a" {
+			t.Errorf("expected %q in package a, found %q in package %s", expected[i], d, d.pkg)
+		}
+	}
+
+	warning := generateWarning("example.com/a", directives)
+	if !strings.HasPrefix(warning.Message, "example.com/a has go:generate directives") || !strings.Contains(warning.Message, "\ta.go:3: stringer -type=Color") {
+		t.Errorf("unexpected warning %q", warning.Message)
+	}
+
+	if directives, err := findGenerate(bctx, "example.com/b"); err != nil || len(directives) != 0 {
+		t.Errorf("expected no directives, found %v, %v", directives, err)
+	}
+}
+
+func TestRunGenerators(t *testing.T) {
+	if _, err := exec.LookPath("cp"); err != nil {
+		t.Skip("cp not found")
+	}
+	defer func(run bool, allowed []string) { config.RunGenerators, config.AllowedGenerators = run, allowed }(config.RunGenerators, config.AllowedGenerators)
+	config.RunGenerators, config.AllowedGenerators = true, []string{"cp"}
+
+	fs := memfs.New()
+	writeFiles(t, fs, map[string]string{
+		"example.com/a/a.go":      "package a\n\n//go:generate cp gen.go.in gen.go\n//go:generate stringer -type=Color\n",
+		"example.com/a/gen.go.in": "package a\n\nvar Generated = true\n",
+	})
+	directives, err := findGenerate(memContext(fs), "example.com/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	skipped, err := runGenerators(context.Background(), fs, "example.com/a", directives)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skipped) != 1 || skipped[0].command != "stringer -type=Color" {
+		t.Errorf("expected stringer to be skipped, found %v", skipped)
+	}
+	b, err := readFile(fs, filepath.Join("gopath", "src", "example.com", "a", "gen.go"))
+	if err != nil {
+		t.Fatalf("expected the generated file, found %v", err)
+	}
+	if string(b) != "package a\n\nvar Generated = true\n" {
+		t.Errorf("unexpected generated file %q", b)
+	}
+
+	// go run would run code from the repo, so it's never allowed.
+	config.AllowedGenerators = []string{"go"}
+	if _, ok := allowedGenerator(generateDirective{command: "go run gen.go"}); ok {
+		t.Error("expected go to be disallowed")
+	}
+}
@@ -0,0 +1,98 @@
+package jsgo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/dave/jsgo/config"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// gistRevision splits a normalized gist path with a pinned revision (gist.github.com/<id>/<revision>)
+// into the package path and the revision. ok is false if the path doesn't pin a gist revision.
+func gistRevision(path string) (pkg, revision string, ok bool) {
+	matches := gistWithRevision.FindStringSubmatch(path)
+	if matches == nil {
+		return "", "", false
+	}
+	return fmt.Sprintf("gist.github.com/%s", matches[1]), matches[2], true
+}
+
+var gistWithRevision = regexp.MustCompile(`^gist\.github\.com/([a-f0-9]+)/([a-f0-9]{40})$`)
+
+// fetchGist clones the gist into the gopath filesystem, checked out at revision. Once the package is in
+// the gopath, the getter won't download it again so the pinned revision is compiled. The git fetcher
+// only keeps the default branch, so the clone can't come from its cache, but it has the same limits.
+func fetchGist(ctx context.Context, gopath billy.Filesystem, pkg, revision string) error {
+	url := fmt.Sprintf("https://%s.git", pkg)
+	ctx, cancel, limit := cloneLimits(ctx, url)
+	defer cancel()
+	worktree := memfs.New()
+	repo, err := git.CloneContext(ctx, limit.storage(), worktree, &git.CloneOptions{
+		URL:      url,
+		Progress: limit,
+		Tags:     git.NoTags,
+	})
+	if err != nil {
+		return limit.err(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	if err := w.Checkout(&git.CheckoutOptions{Hash: plumbing.NewHash(revision)}); err != nil {
+		return fmt.Errorf("checking out gist revision %s: %v", revision, err)
+	}
+	return copyValidFiles(worktree, "/", gopath, filepath.Join("gopath", "src", pkg))
+}
+
+// copyValidFiles copies files with one of the valid extensions from the src directory to the dst
+// directory. Gists don't have sub-directories so this isn't recursive.
+func copyValidFiles(srcfs billy.Filesystem, src string, dstfs billy.Filesystem, dst string) error {
+	fis, err := srcfs.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		if fi.IsDir() || !isValidFile(fi.Name()) {
+			continue
+		}
+		if err := copyFile(srcfs, filepath.Join(src, fi.Name()), dstfs, filepath.Join(dst, fi.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(srcfs billy.Filesystem, src string, dstfs billy.Filesystem, dst string) error {
+	in, err := srcfs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := dstfs.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return nil
+}
+
+func isValidFile(name string) bool {
+	for _, ext := range config.ValidExtensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
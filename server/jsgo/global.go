@@ -0,0 +1,34 @@
+package jsgo
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// validGlobal matches the global names a compile can request. Names starting with $ are used by the
+// GopherJS runtime, so they're not allowed.
+var validGlobal = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// reservedGlobals are JS reserved words, and globals of the browser that a bundle must not replace.
+var reservedGlobals = map[string]bool{
+	"break": true, "case": true, "catch": true, "class": true, "const": true, "continue": true,
+	"debugger": true, "default": true, "delete": true, "do": true, "else": true, "enum": true,
+	"export": true, "extends": true, "false": true, "finally": true, "for": true, "function": true,
+	"if": true, "implements": true, "import": true, "in": true, "instanceof": true, "interface": true,
+	"let": true, "new": true, "null": true, "package": true, "private": true, "protected": true,
+	"public": true, "return": true, "static": true, "super": true, "switch": true, "this": true,
+	"throw": true, "true": true, "try": true, "typeof": true, "var": true, "void": true, "while": true,
+	"with": true, "yield": true, "await": true, "arguments": true, "eval": true, "undefined": true,
+	"NaN": true, "Infinity": true,
+	"window": true, "self": true, "globalThis": true, "document": true, "location": true, "top": true,
+	"parent": true, "frames": true, "navigator": true, "console": true, "jsgoProgress": true,
+}
+
+// checkGlobal returns an error if name can't be used as the global name of a compile: it must be a
+// JS identifier that isn't a reserved word or a browser global.
+func checkGlobal(name string) error {
+	if !validGlobal.MatchString(name) || reservedGlobals[name] {
+		return fmt.Errorf("invalid global name %q - it must be a JS identifier of letters, digits and underscores that isn't a reserved word", name)
+	}
+	return nil
+}
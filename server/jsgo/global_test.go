@@ -0,0 +1,29 @@
+package jsgo
+
+import (
+	"testing"
+
+	"github.com/dave/jsgo/server/jsgo/messages"
+)
+
+func TestCheckGlobal(t *testing.T) {
+	for _, name := range []string{"app", "MyApp_2", "_jsgo"} {
+		if err := checkGlobal(name); err != nil {
+			t.Errorf("%s: unexpected error %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "2app", "$mainPkg", "a-b", "a.b", `a"]=1;//`, "window", "class"} {
+		if err := checkGlobal(name); err == nil {
+			t.Errorf("%q: expected an error", name)
+		}
+	}
+}
+
+func TestBuildPathGlobal(t *testing.T) {
+	plain := buildPath("github.com/a/b", messages.Compile{Path: "github.com/a/b"})
+	app := buildPath("github.com/a/b", messages.Compile{Path: "github.com/a/b", Global: "app"})
+	other := buildPath("github.com/a/b", messages.Compile{Path: "github.com/a/b", Global: "other"})
+	if plain != "github.com/a/b" || app != "github.com/a/b@global-app" || app == other {
+		t.Fatalf("expected the global name in the cache key, found %q, %q, %q", plain, app, other)
+	}
+}
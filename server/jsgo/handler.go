@@ -5,24 +5,51 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"cloud.google.com/go/datastore"
 
 	"time"
 
 	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/backend"
+	"github.com/dave/jsgo/server/clientip"
 	"github.com/dave/jsgo/server/jsgo/messages"
+	"github.com/dave/jsgo/server/queue"
+	"github.com/dave/jsgo/server/requestid"
 	"github.com/dave/jsgo/server/store"
 	"github.com/dave/services"
 	"github.com/dave/services/getter/cache"
-	"github.com/dave/services/queue"
 	"github.com/dave/services/tracker"
 )
 
 type Handler struct {
 	Cache      *cache.Cache
+	HostCaches map[string]*cache.Cache // Caches for hosts with custom fetcher config
 	Fileserver services.Fileserver
 	Database   services.Database
+	Compiler   backend.Compiler // If nil, backend.Default is used
+
+	namespace string // The tenant namespace of the compile, if any (see forTenant)
+}
+
+func (h *Handler) compiler() backend.Compiler {
+	if h.Compiler == nil {
+		return backend.Default
+	}
+	return h.Compiler
+}
+
+// cache returns the cache for the host of path, falling back to the default cache.
+func (h *Handler) cache(path string) *cache.Cache {
+	host := path
+	if i := strings.Index(path, "/"); i > -1 {
+		host = path[:i]
+	}
+	if c, ok := h.HostCaches[host]; ok {
+		return c
+	}
+	return h.Cache
 }
 
 func (h *Handler) Handle(ctx context.Context, req *http.Request, send func(message services.Message), receive chan services.Message, tj *tracker.Job) error {
@@ -41,6 +68,12 @@ func (h *Handler) Handle(ctx context.Context, req *http.Request, send func(messa
 	}
 }
 
+// LateSlot is true because compiles are fetched before they take a slot in the compile queue (see
+// fetches), so a compile slot isn't held while fetching. compile waits for the slot with queue.Wait.
+func (h *Handler) LateSlot() bool {
+	return true
+}
+
 func (h *Handler) RequestTimeout() time.Duration {
 	return config.RequestTimeout
 }
@@ -67,17 +100,18 @@ func (h *Handler) UnarshalMessage(b []byte) (services.Message, error) {
 
 func (h *Handler) StoreError(ctx context.Context, err error, req *http.Request) {
 
-	fmt.Println(err)
+	fmt.Printf("%s: %v\n", req.Header.Get(requestid.Header), err)
 
-	if err == queue.TooManyItemsQueued {
+	if err == queue.TooManyItemsQueued || err == queue.TooManyTenantItems {
 		// If the server is getting flooded by a DOS, this will prevent database flooding
 		return
 	}
 
 	h.Database.Put(ctx, datastore.IncompleteKey(config.ErrorKind, nil), &store.Error{
-		Time:  time.Now(),
-		Error: err.Error(),
-		Ip:    req.Header.Get("X-Forwarded-For"),
+		Time:      time.Now(),
+		Error:     err.Error(),
+		Ip:        clientip.Get(req),
+		RequestId: req.Header.Get(requestid.Header),
 	})
 
 }
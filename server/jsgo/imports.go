@@ -0,0 +1,75 @@
+package jsgo
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/src-d/go-billy.v4"
+)
+
+// checkImports returns an error naming the first file in the gopath that imports one of the blocked
+// packages (or a sub-package). The gopath holds the package and all its fetched dependencies, so this
+// covers the whole dependency graph.
+func checkImports(gopath billy.Filesystem, blocked []string) error {
+	if len(blocked) == 0 {
+		return nil
+	}
+	return checkImportsDir(gopath, filepath.Join("gopath", "src"), "", blocked)
+}
+
+func checkImportsDir(fs billy.Filesystem, dir, path string, blocked []string) error {
+	fis, err := fs.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, fi := range fis {
+		name := filepath.Join(dir, fi.Name())
+		rel := strings.TrimPrefix(path+"/"+fi.Name(), "/")
+		if fi.IsDir() {
+			if err := checkImportsDir(fs, name, rel, blocked); err != nil {
+				return err
+			}
+			continue
+		}
+		if !strings.HasSuffix(fi.Name(), ".go") {
+			continue
+		}
+		b, err := readFile(fs, name)
+		if err != nil {
+			return err
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), rel, b, parser.ImportsOnly)
+		if err != nil {
+			// syntax errors are reported by the compiler
+			continue
+		}
+		for _, spec := range f.Imports {
+			imp, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				continue
+			}
+			if isBlocked(imp, blocked) {
+				return fmt.Errorf("%s imports %s, which is blocked on this server", filepath.Dir(rel), imp)
+			}
+		}
+	}
+	return nil
+}
+
+// isBlocked returns true if path is one of the blocked packages or a sub-package.
+func isBlocked(path string, blocked []string) bool {
+	for _, b := range blocked {
+		if path == b || strings.HasPrefix(path, b+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,25 @@
+package jsgo
+
+import (
+	"testing"
+
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+func TestCheckImports(t *testing.T) {
+	fs := memfs.New()
+	util.WriteFile(fs, "gopath/src/github.com/a/main/main.go", []byte("package main\n\nimport (\n\t\"fmt\"\n\t\"github.com/b/dep\"\n)\n"), 0666)
+	util.WriteFile(fs, "gopath/src/github.com/b/dep/dep.go", []byte("package dep\n\nimport _ \"github.com/c/bad/sub\"\n"), 0666)
+
+	if err := checkImports(fs, nil); err != nil {
+		t.Fatalf("expected no error, found %v", err)
+	}
+	if err := checkImports(fs, []string{"github.com/c/ba", "os"}); err != nil {
+		t.Fatalf("expected no error, found %v", err)
+	}
+	err := checkImports(fs, []string{"github.com/c/bad"})
+	if err == nil || err.Error() != "github.com/b/dep imports github.com/c/bad/sub, which is blocked on this server" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package jsgo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dave/jsgo/config"
+	"golang.org/x/net/context/ctxhttp"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+const lfsVersion = "version https://git-lfs.github.com/spec/v1"
+
+// lfsPointer is the content of a Git LFS pointer file.
+type lfsPointer struct {
+	Oid  string `json:"oid"` // sha256 of the real content
+	Size int64  `json:"size"`
+}
+
+// parseLFSPointer returns the pointer if b is a Git LFS pointer file.
+func parseLFSPointer(b []byte) (lfsPointer, bool) {
+	// Pointer files are small, so don't bother parsing anything large.
+	if len(b) > 1024 || !bytes.HasPrefix(b, []byte(lfsVersion+"\n")) {
+		return lfsPointer{}, false
+	}
+	var p lfsPointer
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), " ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch parts[0] {
+		case "oid":
+			p.Oid = strings.TrimPrefix(parts[1], "sha256:")
+		case "size":
+			p.Size, _ = strconv.ParseInt(parts[1], 10, 64)
+		}
+	}
+	if len(p.Oid) != 64 || p.Size <= 0 {
+		return lfsPointer{}, false
+	}
+	return p, true
+}
+
+// resolveLFS finds Git LFS pointer files in the gopath and replaces them with the real content. The
+// total size fetched is limited to config.GitMaxBytes, and an error naming the file is returned if a
+// pointer can't be resolved, instead of leaving the compiler with a cryptic error.
+func resolveLFS(ctx context.Context, gopath billy.Filesystem) error {
+	var total int64
+	return resolveLFSDir(ctx, gopath, filepath.Join("gopath", "src"), "", &total)
+}
+
+func resolveLFSDir(ctx context.Context, gopath billy.Filesystem, dir, path string, total *int64) error {
+	fis, err := gopath.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, fi := range fis {
+		name := filepath.Join(dir, fi.Name())
+		rel := strings.TrimPrefix(path+"/"+fi.Name(), "/")
+		if fi.IsDir() {
+			if err := resolveLFSDir(ctx, gopath, name, rel, total); err != nil {
+				return err
+			}
+			continue
+		}
+		if fi.Size() > 1024 {
+			continue
+		}
+		b, err := readFile(gopath, name)
+		if err != nil {
+			return err
+		}
+		p, ok := parseLFSPointer(b)
+		if !ok {
+			continue
+		}
+		root, err := repoRoot(rel)
+		if err != nil {
+			return err
+		}
+		*total += p.Size
+		if *total > config.GitMaxBytes {
+			return fmt.Errorf("%s uses Git LFS and %s is too large to fetch (%d bytes)", root, rel, p.Size)
+		}
+		contents, err := fetchLFS(ctx, root, p)
+		if err != nil {
+			return fmt.Errorf("%s uses Git LFS and %s couldn't be fetched: %v", root, rel, err)
+		}
+		if err := util.WriteFile(gopath, name, contents, fi.Mode()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readFile(fs billy.Filesystem, name string) ([]byte, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// fetchLFS downloads an object with the Git LFS batch API.
+func fetchLFS(ctx context.Context, root string, p lfsPointer) ([]byte, error) {
+	client := &http.Client{Timeout: config.HttpTimeout}
+
+	request, err := json.Marshal(map[string]interface{}{
+		"operation": "download",
+		"transfers": []string{"basic"},
+		"objects":   []lfsPointer{p},
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", fmt.Sprintf("https://%s.git/info/lfs/objects/batch", root), bytes.NewReader(request))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.git-lfs+json")
+	req.Header.Set("Content-Type", "application/vnd.git-lfs+json")
+	resp, err := ctxhttp.Do(ctx, client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("batch request returned %s", resp.Status)
+	}
+	var batch struct {
+		Objects []struct {
+			Actions struct {
+				Download struct {
+					Href   string
+					Header map[string]string
+				}
+			}
+			Error *struct {
+				Message string
+			}
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&batch); err != nil {
+		return nil, err
+	}
+	if len(batch.Objects) != 1 {
+		return nil, fmt.Errorf("unexpected batch response")
+	}
+	object := batch.Objects[0]
+	if object.Error != nil {
+		return nil, fmt.Errorf("%s", object.Error.Message)
+	}
+	if !strings.HasPrefix(object.Actions.Download.Href, "https://") {
+		return nil, fmt.Errorf("unsupported download location")
+	}
+
+	req, err = http.NewRequest("GET", object.Actions.Download.Href, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range object.Actions.Download.Header {
+		req.Header.Set(k, v)
+	}
+	resp, err = ctxhttp.Do(ctx, client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download returned %s", resp.Status)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, p.Size+1))
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(b); int64(len(b)) != p.Size || fmt.Sprintf("%x", sum) != p.Oid {
+		return nil, fmt.Errorf("downloaded content doesn't match the pointer")
+	}
+	return b, nil
+}
@@ -0,0 +1,44 @@
+package jsgo
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dave/jsgo/config"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+const testPointer = `version https://git-lfs.github.com/spec/v1
+oid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393
+size 104857600
+`
+
+func TestParseLFSPointer(t *testing.T) {
+	p, ok := parseLFSPointer([]byte(testPointer))
+	if !ok {
+		t.Fatal("expected pointer")
+	}
+	if p.Oid != "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393" || p.Size != 100<<20 {
+		t.Fatalf("unexpected pointer: %+v", p)
+	}
+	if _, ok := parseLFSPointer([]byte("package main\n")); ok {
+		t.Fatal("expected not a pointer")
+	}
+}
+
+func TestResolveLFSTooLarge(t *testing.T) {
+	fs := memfs.New()
+	util.WriteFile(fs, "gopath/src/github.com/a/b/main.go", []byte("package main"), 0666)
+	util.WriteFile(fs, "gopath/src/github.com/a/b/data/data.inc.js", []byte(testPointer), 0666)
+
+	// The pointer is larger than GitMaxBytes, so it's reported without being fetched.
+	err := resolveLFS(context.Background(), fs)
+	if err == nil || !strings.Contains(err.Error(), "github.com/a/b uses Git LFS and github.com/a/b/data/data.inc.js is too large") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if 100<<20 <= config.GitMaxBytes {
+		t.Fatal("test pointer should be larger than GitMaxBytes")
+	}
+}
@@ -0,0 +1,104 @@
+package jsgo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/src-d/go-billy.v4"
+)
+
+// checkFileCount returns an error if any repo in the gopath has more than max source files (files with
+// one of config.ValidExtensions). Repos are identified by the first three path segments.
+func checkFileCount(gopath billy.Filesystem, max int) error {
+	counts := map[string]int{}
+	if err := countFiles(gopath, filepath.Join("gopath", "src"), "", counts); err != nil {
+		return err
+	}
+	for repo, count := range counts {
+		if count > max {
+			return fmt.Errorf("%s has %d source files - the maximum is %d", repo, count, max)
+		}
+	}
+	return nil
+}
+
+func countFiles(fs billy.Filesystem, dir, path string, counts map[string]int) error {
+	fis, err := fs.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, fi := range fis {
+		rel := strings.TrimPrefix(path+"/"+fi.Name(), "/")
+		if fi.IsDir() {
+			if err := countFiles(fs, filepath.Join(dir, fi.Name()), rel, counts); err != nil {
+				return err
+			}
+			continue
+		}
+		if !isValidFile(fi.Name()) {
+			continue
+		}
+		root, err := repoRoot(rel)
+		if err != nil {
+			root = filepath.Dir(rel)
+		}
+		counts[root]++
+	}
+	return nil
+}
+
+// checkPackage returns a clear error if the repo containing pkg is empty, or the package directory has
+// no Go files, rather than letting the compiler fail with a less helpful message.
+func checkPackage(gopath billy.Filesystem, pkg string) error {
+	root, err := repoRoot(pkg)
+	if err != nil {
+		root = pkg
+	}
+	empty, err := isEmpty(gopath, filepath.Join("gopath", "src", root))
+	if err != nil {
+		return err
+	}
+	if empty {
+		return fmt.Errorf("the repository %s is empty", root)
+	}
+	fis, err := gopath.ReadDir(filepath.Join("gopath", "src", pkg))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, fi := range fis {
+		if !fi.IsDir() && strings.HasSuffix(fi.Name(), ".go") && !strings.HasSuffix(fi.Name(), "_test.go") {
+			return nil
+		}
+	}
+	return fmt.Errorf("no Go package found at %s", pkg)
+}
+
+// isEmpty returns true if dir doesn't exist or has no files in it or its sub-directories, ignoring the
+// .git directory.
+func isEmpty(fs billy.Filesystem, dir string) (bool, error) {
+	fis, err := fs.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			return false, nil
+		}
+		if fi.Name() == ".git" {
+			continue
+		}
+		empty, err := isEmpty(fs, filepath.Join(dir, fi.Name()))
+		if err != nil || !empty {
+			return empty, err
+		}
+	}
+	return true, nil
+}
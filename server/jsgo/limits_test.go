@@ -0,0 +1,53 @@
+package jsgo
+
+import (
+	"fmt"
+	"testing"
+
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+func TestCheckFileCount(t *testing.T) {
+	fs := memfs.New()
+	for i := 0; i < 3; i++ {
+		util.WriteFile(fs, fmt.Sprintf("gopath/src/github.com/a/big/p%d/p.go", i), []byte("package p"), 0666)
+		util.WriteFile(fs, fmt.Sprintf("gopath/src/github.com/a/big/p%d/image.png", i), nil, 0666)
+	}
+	util.WriteFile(fs, "gopath/src/github.com/a/small/main.go", []byte("package main"), 0666)
+
+	if err := checkFileCount(fs, 3); err != nil {
+		t.Fatalf("expected no error, found %v", err)
+	}
+	err := checkFileCount(fs, 2)
+	if err == nil || err.Error() != "github.com/a/big has 3 source files - the maximum is 2" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestCheckPackage(t *testing.T) {
+	fs := memfs.New()
+	fs.MkdirAll("gopath/src/github.com/a/empty/.git/objects", 0777)
+	util.WriteFile(fs, "gopath/src/github.com/a/empty/.git/HEAD", []byte("ref: refs/heads/master"), 0666)
+	util.WriteFile(fs, "gopath/src/github.com/a/docs/README.md", []byte("# docs"), 0666)
+	util.WriteFile(fs, "gopath/src/github.com/a/docs/sub/sub_test.go", []byte("package sub"), 0666)
+	util.WriteFile(fs, "gopath/src/github.com/a/ok/main.go", []byte("package main"), 0666)
+
+	tests := map[string]string{
+		"github.com/a/empty":    "the repository github.com/a/empty is empty",
+		"github.com/a/missing":  "the repository github.com/a/missing is empty",
+		"github.com/a/docs":     "no Go package found at github.com/a/docs",
+		"github.com/a/docs/sub": "no Go package found at github.com/a/docs/sub",
+		"github.com/a/docs/foo": "no Go package found at github.com/a/docs/foo",
+		"github.com/a/ok":       "",
+	}
+	for pkg, expected := range tests {
+		var found string
+		if err := checkPackage(fs, pkg); err != nil {
+			found = err.Error()
+		}
+		if found != expected {
+			t.Errorf("%s: expected %q, found %q", pkg, expected, found)
+		}
+	}
+}
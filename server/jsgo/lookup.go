@@ -0,0 +1,47 @@
+package jsgo
+
+import (
+	"context"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/store"
+	"github.com/dave/jsgo/server/tenant"
+	"github.com/dave/services"
+	"golang.org/x/sync/singleflight"
+)
+
+// lookupPackage is store.Package with concurrent lookups for the same path coalesced, so a traffic spike
+// on a popular package results in one database read. All callers waiting on a read get its result,
+// including any error. The read has its own timeout (config.PageTimeout) rather than the context of the
+// caller that started it, so the other callers don't fail if that one goes away. Each caller stops
+// waiting when its own context is done. Lookups in a tenant's namespace are only coalesced with lookups in
+// the same namespace.
+func lookupPackage(ctx context.Context, database services.Database, path string) (bool, store.CompileData, error) {
+	key := path
+	if d, ok := database.(*tenant.Database); ok {
+		key = d.Namespace() + ":" + path
+	}
+	c := lookups.DoChan(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), config.PageTimeout)
+		defer cancel()
+		found, data, err := store.Package(ctx, database, path)
+		return lookupResult{found: found, data: data}, err
+	})
+	select {
+	case r := <-c:
+		if r.Err != nil {
+			return false, store.CompileData{}, r.Err
+		}
+		result := r.Val.(lookupResult)
+		return result.found, result.data, nil
+	case <-ctx.Done():
+		return false, store.CompileData{}, ctx.Err()
+	}
+}
+
+var lookups singleflight.Group
+
+type lookupResult struct {
+	found bool
+	data  store.CompileData
+}
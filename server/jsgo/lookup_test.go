@@ -0,0 +1,91 @@
+package jsgo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// slowDatabase counts reads, and blocks them until release is closed.
+type slowDatabase struct {
+	reads   int32
+	started chan struct{}
+	release chan struct{}
+	err     error
+}
+
+func (d *slowDatabase) Get(ctx context.Context, key *datastore.Key, dst interface{}) error {
+	if atomic.AddInt32(&d.reads, 1) == 1 {
+		close(d.started)
+	}
+	select {
+	case <-d.release:
+		return d.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *slowDatabase) Put(ctx context.Context, key *datastore.Key, src interface{}) (*datastore.Key, error) {
+	panic("not implemented")
+}
+
+func (d *slowDatabase) GetAll(ctx context.Context, query *datastore.Query, dst interface{}) ([]*datastore.Key, error) {
+	panic("not implemented")
+}
+
+func (d *slowDatabase) GetMulti(ctx context.Context, keys []*datastore.Key, dst interface{}) error {
+	panic("not implemented")
+}
+
+func (d *slowDatabase) PutMulti(ctx context.Context, keys []*datastore.Key, src interface{}) ([]*datastore.Key, error) {
+	panic("not implemented")
+}
+
+func TestLookupPackage(t *testing.T) {
+	db := &slowDatabase{started: make(chan struct{}), release: make(chan struct{}), err: errors.New("database error")}
+
+	// the first caller goes away while the read is in progress
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, _, err := lookupPackage(first, db, "github.com/a/b")
+		firstErr <- err
+	}()
+	<-db.started
+
+	const n = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := lookupPackage(context.Background(), db, "github.com/a/b")
+			errs <- err
+		}()
+	}
+	cancel()
+	if err := <-firstErr; err != context.Canceled {
+		t.Fatalf("expected the first caller to be cancelled, found %v", err)
+	}
+
+	// give the callers time to join the read in progress
+	time.Sleep(time.Millisecond * 50)
+	close(db.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != db.err {
+			t.Fatalf("expected the lookup error, found %v", err)
+		}
+	}
+	if db.reads != 1 {
+		t.Fatalf("expected 1 read, found %d", db.reads)
+	}
+}
@@ -0,0 +1,118 @@
+package jsgo
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// renderMarkdown renders the common subset of markdown used in READMEs: headings, paragraphs, lists,
+// block quotes, fenced code blocks, code spans, emphasis and links. It's safe for untrusted input: all
+// text is escaped, raw HTML is shown as text, and links are only allowed to http, https, mailto and
+// relative urls.
+func renderMarkdown(src []byte) string {
+	out := &bytes.Buffer{}
+	lines := strings.Split(strings.Replace(string(src), "\r\n", "\n", -1), "\n")
+
+	var paragraph []string
+	var list string // "ul" or "ol" while in a list
+	flush := func() {
+		if len(paragraph) > 0 {
+			fmt.Fprintf(out, "<p>%s</p>\n", inline(strings.Join(paragraph, " ")))
+			paragraph = nil
+		}
+		if list != "" {
+			fmt.Fprintf(out, "</%s>\n", list)
+			list = ""
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "```"):
+			flush()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			fmt.Fprintf(out, "<pre><code>%s</code></pre>\n", html.EscapeString(strings.Join(code, "\n")))
+		case mdHeading.MatchString(trimmed):
+			flush()
+			m := mdHeading.FindStringSubmatch(trimmed)
+			fmt.Fprintf(out, "<h%d>%s</h%d>\n", len(m[1]), inline(strings.TrimRight(m[2], "# ")), len(m[1]))
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			fmt.Fprintf(out, "<blockquote><p>%s</p></blockquote>\n", inline(strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))))
+		case mdBullet.MatchString(trimmed), mdNumber.MatchString(trimmed):
+			kind, re := "ul", mdBullet
+			if mdNumber.MatchString(trimmed) {
+				kind, re = "ol", mdNumber
+			}
+			if list != kind {
+				flush()
+				fmt.Fprintf(out, "<%s>\n", kind)
+				list = kind
+			}
+			fmt.Fprintf(out, "<li>%s</li>\n", inline(re.ReplaceAllString(trimmed, "")))
+		default:
+			if list != "" {
+				flush()
+			}
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flush()
+	return out.String()
+}
+
+var (
+	mdHeading = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	mdBullet  = regexp.MustCompile(`^[-*+]\s+`)
+	mdNumber  = regexp.MustCompile(`^\d+[.)]\s+`)
+	mdCode    = regexp.MustCompile("`([^`]+)`")
+	mdLink    = regexp.MustCompile(`!?\[([^\]]*)\]\(([^)\s]+)\)`)
+	mdStrong  = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	mdEm      = regexp.MustCompile(`\*([^*]+)\*|\b_([^_]+)_\b`)
+)
+
+// inline renders the inline elements of a block of text. Code spans are replaced with placeholders
+// first, so their contents aren't formatted.
+func inline(text string) string {
+	var spans []string
+	text = mdCode.ReplaceAllStringFunc(text, func(s string) string {
+		spans = append(spans, "<code>"+html.EscapeString(mdCode.FindStringSubmatch(s)[1])+"</code>")
+		return fmt.Sprintf("\x00%d\x00", len(spans)-1)
+	})
+	text = html.EscapeString(text)
+	text = mdLink.ReplaceAllStringFunc(text, func(s string) string {
+		m := mdLink.FindStringSubmatch(s)
+		url := html.UnescapeString(m[2])
+		if !safeUrl(url) {
+			return m[1]
+		}
+		return fmt.Sprintf(`<a href="%s" rel="nofollow">%s</a>`, html.EscapeString(url), m[1])
+	})
+	text = mdStrong.ReplaceAllString(text, "<strong>$1$2</strong>")
+	text = mdEm.ReplaceAllString(text, "<em>$1$2</em>")
+	for i, span := range spans {
+		text = strings.Replace(text, fmt.Sprintf("\x00%d\x00", i), span, 1)
+	}
+	return text
+}
+
+// safeUrl allows http, https and mailto urls, and relative urls.
+func safeUrl(url string) bool {
+	lower := strings.ToLower(url)
+	for _, scheme := range []string{"http://", "https://", "mailto:"} {
+		if strings.HasPrefix(lower, scheme) {
+			return true
+		}
+	}
+	return !strings.Contains(lower, ":")
+}
@@ -4,12 +4,65 @@ import (
 	"encoding/json"
 	"reflect"
 
+	"github.com/dave/jsgo/server/decode"
 	"github.com/dave/services"
 	"github.com/gorilla/websocket"
 )
 
 type Compile struct {
-	Path string
+	Path   string
+	Ref    string // Optional git ref (branch, tag or commit hash) to compile instead of the default.
+	All    bool   // Compile all the main packages in the repo containing Path, and reply with CompleteAll.
+	Force  bool   // Compile even if the package recently failed to compile at the same commit.
+	Plan   bool   // Only fetch and resolve the package, and reply with Plan instead of compiling.
+	Target string // "js" (the default) or "wasm". Wasm builds reply with CompleteWasm.
+	Expect string // Optional expected HashMin. The compile fails if the output doesn't match.
+	Debug  bool   // Build with the debug tags (see config.DebugTags). Slower, with extra runtime checks.
+	Shake  bool   // Remove the declarations the program can't reach. Smaller, but the files aren't shared.
+	Module string // Optional module version (path@version) to compile the main package of, instead of Path.
+	Global string // Optional JS identifier. The main package is attached to window[Global] when it has loaded.
+	Stale  bool   // If the compile fails, reply with the last successful build of the path (see Complete.Stale).
+
+	// Examples compiles each Example function in the tests of the package as a runnable main package,
+	// and replies with CompleteExamples.
+	Examples bool
+
+	// Metadata records the build id, toolchain and Go versions, source sha and compile time in the
+	// loader, where the page can read them from window.jsgoBuilds.
+	Metadata bool
+
+	// Symbols optionally lists exported functions, types or variables of the package. Only the code
+	// they need is compiled (like Shake), and the package doesn't need to be a main package.
+	Symbols []string
+
+	// Vars optionally sets package level string variables, like the linker's -X flag. Keys are
+	// import/path.Name, and must be allowed by the server.
+	Vars map[string]string
+
+	// Replace optionally substitutes dependencies, like replace directives in go.mod: each Old repo is
+	// fetched from its New repo instead, so a fork can be tested without changing the package.
+	Replace []Replace
+}
+
+// Replace substitutes the repo at the Old path with the repo at New, checked out at Ref (optional).
+// Both paths are repo roots (e.g. github.com/foo/bar).
+type Replace struct {
+	Old, New string
+	Ref      string
+}
+
+// Plan describes what the server would build for a Compile request. It's sent instead of Complete for
+// plan-only requests - no script is compiled.
+type Plan struct {
+	Note      string
+	Path      string   // requested path
+	Package   string   // resolved package path
+	Ref       string   // resolved git ref (empty for the default branch)
+	Sha       string   // commit of the resolved ref, if it could be found
+	Tags      []string // build tags
+	Toolchain string   // GopherJS compiler version
+	Go        string   // Go standard library version
+	Files     []string // source files in the package
 }
 
 type Complete struct {
@@ -17,6 +70,64 @@ type Complete struct {
 	Short   string
 	HashMin string
 	HashMax string
+	Docs    string // url of the page rendered from the package's README, if it has one
+	BuildId string // identifies the output in bug reports: the hash of the minified main package file
+	Removed int64  // for Shake and Symbols builds, the bytes removed from the minified output
+	Stale   bool   // the compile failed, and this is the last successful build of the path
+}
+
+// Diagnostics is sent when the compiler reports errors in the source, before the error message, so
+// editors can show them at their positions. Raw is the compiler output they were parsed from.
+type Diagnostics struct {
+	Raw         string
+	Diagnostics []Diagnostic
+}
+
+// Diagnostic is a problem reported by the compiler. File is relative to the gopath (e.g.
+// github.com/foo/bar/main.go), and File, Line and Column are empty if the output has no position.
+type Diagnostic struct {
+	File     string `json:",omitempty"`
+	Line     int    `json:",omitempty"`
+	Column   int    `json:",omitempty"`
+	Severity string // "error"
+	Message  string
+}
+
+// Warning is sent when the compile can continue, but the output may not be what the user expects (e.g.
+// the package has go:generate directives, and generated code may be missing).
+type Warning struct {
+	Message string
+}
+
+// CompleteWasm is sent when a wasm build has finished. Loader is the JS to add in a <script> tag, which
+// loads and runs the wasm binary.
+type CompleteWasm struct {
+	Path    string
+	Short   string
+	Loader  string
+	Wasm    string
+	BuildId string // the hash of the loader
+}
+
+// CompleteAll is sent when compiling all the main packages in a repo has finished. Results is keyed by
+// the path of each main package relative to the repo root ("" for the root).
+type CompleteAll struct {
+	Path    string
+	Results map[string]CompileResult
+}
+
+// CompleteExamples is sent when compiling the examples of a package has finished. Results is keyed by
+// the name of each Example function, and the Url of each result is its loader JS.
+type CompleteExamples struct {
+	Path    string
+	Results map[string]CompileResult
+}
+
+// CompileResult is the outcome for one main package. Error is empty if the compile succeeded.
+type CompileResult struct {
+	Url     string
+	BuildId string // the hash of the minified main package file
+	Error   string
 }
 
 func Marshal(in services.Message) ([]byte, int, error) {
@@ -39,7 +150,7 @@ func Unmarshal(in []byte) (services.Message, error) {
 		Type    string
 		Message Compile // the jsgo compile page only ever sends Compile messages
 	}
-	if err := json.Unmarshal(in, &m); err != nil {
+	if err := decode.Json(in, &m, "Type", "Message", "Message.Path"); err != nil {
 		return nil, err
 	}
 	return m.Message, nil
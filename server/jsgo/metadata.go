@@ -0,0 +1,27 @@
+package jsgo
+
+import (
+	"context"
+	"time"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/backend"
+	"github.com/dave/jsgo/server/jsgo/messages"
+	"github.com/gopherjs/gopherjs/compiler"
+)
+
+// buildMetadata returns the metadata recorded in the loader of a compile with Metadata set (see
+// backend.Options.Metadata). The sha of the source is left empty if it can't be found. In reproducible
+// mode the compile time is left out, so the output only depends on the source.
+func buildMetadata(ctx context.Context, info messages.Compile, pkg string) *backend.Metadata {
+	sha, _ := remoteSha(ctx, info.Path, resolveRef(pkg, info.Ref))
+	metadata := &backend.Metadata{
+		Toolchain: compiler.Version,
+		Go:        config.StdlibVersion,
+		Sha:       sha,
+	}
+	if !config.Reproducible {
+		metadata.Time = time.Now().UTC().Format(time.RFC3339)
+	}
+	return metadata
+}
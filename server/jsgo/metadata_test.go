@@ -0,0 +1,35 @@
+package jsgo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/jsgo/messages"
+	"github.com/gopherjs/gopherjs/compiler"
+)
+
+func TestBuildMetadata(t *testing.T) {
+	defer func(reproducible bool) { config.Reproducible = reproducible }(config.Reproducible)
+	sha := "0123456789abcdef0123456789abcdef01234567"
+	info := messages.Compile{Path: "github.com/a/b", Ref: sha, Metadata: true}
+
+	config.Reproducible = false
+	m := buildMetadata(context.Background(), info, "github.com/a/b")
+	if m.Toolchain != compiler.Version || m.Go != config.StdlibVersion || m.Sha != sha {
+		t.Fatalf("unexpected metadata %#v", m)
+	}
+	if _, err := time.Parse(time.RFC3339, m.Time); err != nil {
+		t.Fatalf("expected the compile time, found %q", m.Time)
+	}
+
+	config.Reproducible = true
+	if m := buildMetadata(context.Background(), info, "github.com/a/b"); m.Time != "" || m.Sha != sha {
+		t.Fatalf("expected no compile time in reproducible mode, found %#v", m)
+	}
+
+	if buildPath("github.com/a/b", info) == buildPath("github.com/a/b", messages.Compile{Path: "github.com/a/b", Ref: sha}) {
+		t.Fatal("expected metadata builds to have a different cache key")
+	}
+}
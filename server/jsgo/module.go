@@ -0,0 +1,135 @@
+package jsgo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/gitremote"
+	"github.com/dave/jsgo/server/lru"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// module is the source of a module version, found from the module proxy.
+type module struct {
+	Path string // the package path of the module root in the repo (host/user/repo, plus the sub-directory)
+	Ref  string // the commit hash of the version
+}
+
+// validModule matches a module path and version in the path@version form. The version must be a
+// semantic version or a pseudo-version, not a query like "latest" or a branch, so it always resolves
+// to the same commit.
+var validModule = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9_.\-~/]*)@(v[0-9]+\.[0-9]+\.[0-9]+[A-Za-z0-9_.\-+]*)$`)
+
+// modules holds the source of recently resolved module versions. Module versions never change, so the
+// module path and version is the cache key.
+var modules = lru.New(config.ModuleCacheSize, config.ModuleCacheTime)
+
+// moduleProxy is the module proxy that versions are resolved with (see config.ModuleProxy).
+var moduleProxy = config.ModuleProxy
+
+// resolveModule finds the repo and commit of a module version (path@version) from the module proxy, so
+// the main package of the module can be compiled like a build of a commit. The module proxy reports
+// the origin of the version, which must be a git repo on one of config.GitRemoteHosts.
+func resolveModule(ctx context.Context, spec string) (module, error) {
+	m := validModule.FindStringSubmatch(spec)
+	if m == nil || strings.Contains(m[1], "..") || strings.Contains(m[2], "..") {
+		return module{}, fmt.Errorf("invalid module %q - the form is path@version, e.g. github.com/user/repo@v1.2.3", spec)
+	}
+	if cached, ok := modules.Get(spec); ok {
+		return cached.(module), nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.HttpTimeout)
+	defer cancel()
+	u := fmt.Sprintf("%s/%s/@v/%s.info", strings.TrimSuffix(moduleProxy, "/"), escapeModule(m[1]), escapeModule(m[2]))
+	resp, err := ctxhttp.Get(ctx, http.DefaultClient, u)
+	if err != nil {
+		return module{}, fmt.Errorf("resolving module %s: %v", spec, err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return module{}, fmt.Errorf("module %s not found", spec)
+	case resp.StatusCode != http.StatusOK:
+		return module{}, fmt.Errorf("resolving module %s: %s", spec, resp.Status)
+	}
+	var info struct {
+		Origin *moduleOrigin
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return module{}, fmt.Errorf("resolving module %s: %v", spec, err)
+	}
+	resolved, err := moduleSource(spec, info.Origin)
+	if err != nil {
+		return module{}, err
+	}
+	modules.Add(spec, resolved)
+	return resolved, nil
+}
+
+// moduleOrigin is the source of a module version reported by the module proxy.
+type moduleOrigin struct {
+	VCS    string
+	URL    string
+	Subdir string
+	Hash   string
+}
+
+// moduleSource converts the origin of a module version to the package path and commit.
+func moduleSource(spec string, origin *moduleOrigin) (module, error) {
+	if origin == nil || origin.VCS != "git" || !commitHash.MatchString(origin.Hash) {
+		return module{}, fmt.Errorf("can't find the git repository of module %s", spec)
+	}
+	u, err := url.Parse(origin.URL)
+	if err != nil || u.Scheme != "https" {
+		return module{}, fmt.Errorf("unsupported repository %q for module %s", origin.URL, spec)
+	}
+	repo := u.Host + strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), ".git")
+	if root, err := repoRoot(repo); err != nil || root != repo || !gitremote.Allowed(repo) {
+		return module{}, fmt.Errorf("unsupported repository %q for module %s", origin.URL, spec)
+	}
+	path := repo
+	if subdir := strings.Trim(origin.Subdir, "/"); subdir != "" {
+		if strings.Contains(subdir, "..") {
+			return module{}, fmt.Errorf("unsupported directory %q for module %s", origin.Subdir, spec)
+		}
+		path += "/" + subdir
+	}
+	return module{Path: path, Ref: origin.Hash}, nil
+}
+
+// escapeModule escapes a module path or version for the module proxy, which replaces upper case
+// letters with an exclamation mark followed by the lower case letter.
+func escapeModule(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// checkMain returns an error if the package at the root of the module isn't a main package, so a
+// library module fails with a clear message rather than a compiler error.
+func checkMain(bctx *build.Context, spec, pkg string) error {
+	p, err := bctx.Import(pkg, "", 0)
+	if err != nil {
+		// import errors are reported by the compiler
+		return nil
+	}
+	if p.Name != "main" {
+		return fmt.Errorf("module %s isn't a command - the package at its root is package %s, not package main", spec, p.Name)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package jsgo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+func TestResolveModule(t *testing.T) {
+	const hash = "0123456789abcdef0123456789abcdef01234567"
+	var requests int
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		switch req.URL.Path {
+		case "/github.com/!foo/bar/@v/v1.2.3.info":
+			fmt.Fprintf(w, `{"Version":"v1.2.3","Origin":{"VCS":"git","URL":"https://github.com/Foo/bar","Hash":%q}}`, hash)
+		case "/github.com/foo/mono/cmd/@v/v0.1.0.info":
+			fmt.Fprintf(w, `{"Version":"v0.1.0","Origin":{"VCS":"git","URL":"https://github.com/foo/mono.git","Subdir":"cmd","Hash":%q}}`, hash)
+		case "/example.com/other/@v/v1.0.0.info":
+			fmt.Fprintf(w, `{"Version":"v1.0.0","Origin":{"VCS":"git","URL":"https://example.com/other","Hash":%q}}`, hash)
+		case "/example.com/old/@v/v1.0.0.info":
+			fmt.Fprint(w, `{"Version":"v1.0.0"}`)
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+	defer proxy.Close()
+	defer func(p string) { moduleProxy = p }(moduleProxy)
+	moduleProxy = proxy.URL
+
+	tests := map[string]struct {
+		path, err string
+	}{
+		"github.com/Foo/bar@v1.2.3":      {path: "github.com/Foo/bar"},
+		"github.com/foo/mono/cmd@v0.1.0": {path: "github.com/foo/mono/cmd"},
+		"github.com/foo/missing@v1.0.0":  {err: "module github.com/foo/missing@v1.0.0 not found"},
+		"example.com/other@v1.0.0":       {err: `unsupported repository "https://example.com/other"`},
+		"example.com/old@v1.0.0":         {err: "can't find the git repository of module example.com/old@v1.0.0"},
+		"github.com/foo/bar@latest":      {err: "invalid module"},
+		"github.com/foo/bar":             {err: "invalid module"},
+		"github.com/foo/../bar@v1.0.0":   {err: "invalid module"},
+	}
+	for spec, expected := range tests {
+		m, err := resolveModule(context.Background(), spec)
+		switch {
+		case expected.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", spec, err)
+		case expected.err == "" && (m.Path != expected.path || m.Ref != hash):
+			t.Errorf("%s: expected %s at %s, found %+v", spec, expected.path, hash, m)
+		case expected.err != "" && (err == nil || !strings.HasPrefix(err.Error(), expected.err)):
+			t.Errorf("%s: expected %q, found %v", spec, expected.err, err)
+		}
+	}
+
+	// The module path and version is the cache key, so a version is only resolved once.
+	before := requests
+	if _, err := resolveModule(context.Background(), "github.com/Foo/bar@v1.2.3"); err != nil || requests != before {
+		t.Fatalf("expected the resolved module to be cached, found %d requests (%v)", requests-before, err)
+	}
+}
+
+func TestCheckMain(t *testing.T) {
+	fs := memfs.New()
+	for name, contents := range map[string]string{
+		"cmd/main.go": "package main\n\nfunc main() {}\n",
+		"lib/lib.go":  "package lib\n\nvar A = 1\n",
+	} {
+		f, err := fs.Create(filepath.Join("gopath", "src", "example.com", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(contents))
+		f.Close()
+	}
+	bctx := memContext(fs)
+	if err := checkMain(bctx, "example.com/cmd@v1.0.0", "example.com/cmd"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	err := checkMain(bctx, "example.com/lib@v1.0.0", "example.com/lib")
+	if err == nil || err.Error() != "module example.com/lib@v1.0.0 isn't a command - the package at its root is package lib, not package main" {
+		t.Fatalf("expected a clear error for a library module, found %v", err)
+	}
+}
@@ -0,0 +1,19 @@
+package jsgo
+
+import (
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/lru"
+)
+
+// cachedNormalizePath is normalizePath with the results memoized in a bounded LRU cache, so the work is
+// done once per distinct path.
+func cachedNormalizePath(path string) string {
+	if normalized, ok := normalized.Get(path); ok {
+		return normalized.(string)
+	}
+	n := normalizePath(path)
+	normalized.Add(path, n)
+	return n
+}
+
+var normalized = lru.New(config.NormalizeCacheSize, config.NormalizeCacheTime)
@@ -19,7 +19,7 @@ func Page(w http.ResponseWriter, req *http.Request, database services.Database)
 	ctx, cancel := context.WithTimeout(req.Context(), config.PageTimeout)
 	defer cancel()
 
-	path := normalizePath(strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/"), "/"))
+	path := cachedNormalizePath(strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/"), "/"))
 
 	if path == "" {
 		http.Redirect(w, req, "https://github.com/dave/jsgo", http.StatusFound)
@@ -32,7 +32,7 @@ func Page(w http.ResponseWriter, req *http.Request, database services.Database)
 	if config.LOCAL {
 		found = false
 	} else {
-		found, data, err = store.Package(ctx, database, path)
+		found, data, err = lookupPackage(ctx, database, path)
 		if err != nil {
 			http.Error(w, err.Error(), 500)
 			return
@@ -52,7 +52,7 @@ func Page(w http.ResponseWriter, req *http.Request, database services.Database)
 	}
 
 	v := vars{}
-	v.PkgHost = config.Host[config.Pkg]
+	v.PkgHost = config.PkgHostPath()
 	v.IndexHost = config.Host[config.Index]
 	v.PkgProtocol = config.Protocol[config.Pkg]
 	v.IndexProtocol = config.Protocol[config.Index]
@@ -163,6 +163,10 @@ var compilePageTemplate = template.Must(template.New("main").Funcs(template.Func
 							</tbody>
 						</table>
 					</div>
+					<div id="warning-panel" style="display: none;" class="alert alert-info" role="alert">
+						<h4 class="alert-heading">Warning</h4>
+						<pre id="warning-message"></pre>
+					</div>
 					<div id="error-panel" style="display: none;" class="alert alert-warning" role="alert">
 						<h4 class="alert-heading">Error</h4>
 						<pre id="error-message"></pre>
@@ -200,6 +204,8 @@ var compilePageTemplate = template.Must(template.New("main").Funcs(template.Func
 			var errorPanel = document.getElementById("error-panel");
 			var completePanel = document.getElementById("complete-panel");
 			var errorMessage = document.getElementById("error-message");
+			var warningPanel = document.getElementById("warning-panel");
+			var warningMessage = document.getElementById("warning-message");
 			
 			var done = {};
 			var complete = false;
@@ -252,6 +258,10 @@ var compilePageTemplate = template.Must(template.New("main").Funcs(template.Func
 					headerPanel.style.display = "none";
 					refresh();
 					break;
+				case "Warning":
+					warningPanel.style.display = "";
+					warningMessage.textContent += payload.Message.Message + "\n";
+					break;
 				case "Error":
 					if (complete) {
 						break;
@@ -276,10 +286,14 @@ var compilePageTemplate = template.Must(template.New("main").Funcs(template.Func
 
 func normalizePath(path string) string {
 
-	// We should normalize gist urls by removing the username part
+	// We should normalize gist urls by removing the username part. If a revision is specified, it's
+	// preserved.
 	if strings.HasPrefix(path, "gist.github.com/") {
 		matches := gistWithUsername.FindStringSubmatch(path)
 		if len(matches) > 1 {
+			if matches[2] != "" {
+				return fmt.Sprintf("gist.github.com/%s/%s", matches[1], matches[2])
+			}
 			return fmt.Sprintf("gist.github.com/%s", matches[1])
 		}
 	}
@@ -295,5 +309,6 @@ func normalizePath(path string) string {
 	return path
 }
 
-var gistWithUsername = regexp.MustCompile(`^gist\.github\.com/[A-Za-z0-9_.\-]+/([a-f0-9]+)(/[\p{L}0-9_.\-]+)*$`)
+var gistWithUsername = regexp.MustCompile(`^gist\.github\.com/[A-Za-z0-9_.\-]+/([a-f0-9]+)(?:/([a-f0-9]{40}))?(/[\p{L}0-9_.\-]+)*$`)
 var githubUsername = regexp.MustCompile(`^[a-zA-Z0-9\-]{0,38}$`)
+var githubRepoName = regexp.MustCompile(`^[A-Za-z0-9_.\-]+$`)
@@ -0,0 +1,47 @@
+package jsgo
+
+import (
+	"testing"
+)
+
+func TestNormalizePath(t *testing.T) {
+	const revision = "0123456789abcdef0123456789abcdef01234567"
+	tests := map[string]string{
+		"dave/jstest":                                       "github.com/dave/jstest",
+		"github.com/dave/jstest":                            "github.com/dave/jstest",
+		"gist.github.com/dave/abc123":                       "gist.github.com/abc123",
+		"gist.github.com/dave/abc123/main.go":               "gist.github.com/abc123",
+		"gist.github.com/dave/abc123/" + revision:           "gist.github.com/abc123/" + revision,
+		"gist.github.com/dave/abc123/" + revision + "/a.go": "gist.github.com/abc123/" + revision,
+	}
+	for input, expected := range tests {
+		if found := normalizePath(input); found != expected {
+			t.Errorf("normalizePath(%q): expected %q, found %q", input, expected, found)
+		}
+	}
+}
+
+func TestGistRevision(t *testing.T) {
+	const revision = "0123456789abcdef0123456789abcdef01234567"
+	pkg, rev, ok := gistRevision("gist.github.com/abc123/" + revision)
+	if !ok || pkg != "gist.github.com/abc123" || rev != revision {
+		t.Fatalf("unexpected result: %q %q %v", pkg, rev, ok)
+	}
+	if _, _, ok := gistRevision("gist.github.com/abc123"); ok {
+		t.Fatal("expected no revision")
+	}
+}
+
+const benchmarkPath = "gist.github.com/dave/0123456789abcdef/main.go"
+
+func BenchmarkNormalizePath(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		normalizePath(benchmarkPath)
+	}
+}
+
+func BenchmarkCachedNormalizePath(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		cachedNormalizePath(benchmarkPath)
+	}
+}
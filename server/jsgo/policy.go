@@ -0,0 +1,129 @@
+package jsgo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/lru"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// Repo is the metadata of a repo that the repo policy decides on.
+type Repo struct {
+	Path    string // host/owner/name
+	Owner   string
+	Fork    bool
+	Stars   int
+	Created time.Time
+}
+
+// Policy decides whether a repo may be compiled, when config.PolicyEnabled is set. It returns an error,
+// which is sent to the client, to reject the compile. Self-hosters can replace it with their own
+// policy.
+var Policy = RepoPolicy{
+	AllowForks: config.PolicyAllowForks,
+	MinStars:   config.PolicyMinStars,
+	MinAge:     config.PolicyMinAge,
+	Owners:     config.PolicyOwners,
+}.Check
+
+// RepoPolicy is the default repo policy, configured with the config.Policy settings.
+type RepoPolicy struct {
+	AllowForks bool
+	MinStars   int
+	MinAge     time.Duration
+	Owners     []string // all owners are allowed if empty
+}
+
+// Check rejects forks unless AllowForks is set, repos with fewer than MinStars stars or younger than
+// MinAge, and repos of owners that aren't in Owners.
+func (p RepoPolicy) Check(repo Repo) error {
+	if repo.Fork && !p.AllowForks {
+		return policyError(repo, "forks can't be compiled - please compile the upstream repo")
+	}
+	if repo.Stars < p.MinStars {
+		return policyError(repo, fmt.Sprintf("repos need at least %d stars", p.MinStars))
+	}
+	if p.MinAge > 0 && time.Since(repo.Created) < p.MinAge {
+		return policyError(repo, fmt.Sprintf("repos must be at least %v old", p.MinAge))
+	}
+	if len(p.Owners) > 0 {
+		for _, owner := range p.Owners {
+			if strings.EqualFold(owner, repo.Owner) {
+				return nil
+			}
+		}
+		return policyError(repo, fmt.Sprintf("repos owned by %s can't be compiled", repo.Owner))
+	}
+	return nil
+}
+
+func policyError(repo Repo, reason string) error {
+	return fmt.Errorf("%s can't be compiled on this server: %s", repo.Path, reason)
+}
+
+// checkPolicy applies Policy to the repo containing path, if config.PolicyEnabled is set and the repo is
+// on one of config.PolicyHosts. If the metadata of the repo can't be found (e.g. the API is rate
+// limited), the compile isn't rejected - the fetch will report a missing repo.
+func checkPolicy(ctx context.Context, path string) error {
+	if !config.PolicyEnabled {
+		return nil
+	}
+	parts := strings.Split(path, "/")
+	api, ok := config.PolicyHosts[parts[0]]
+	if !ok || len(parts) < 3 {
+		return nil
+	}
+	repo, err := lookupRepo(ctx, api, strings.Join(parts[:3], "/"))
+	if err != nil {
+		return nil
+	}
+	return Policy(repo)
+}
+
+// repos holds the metadata of recently checked repos.
+var repos = lru.New(config.PolicyCacheSize, config.PolicyCacheTime)
+
+// lookupRepo returns the metadata of repo (host/owner/name) from the GitHub API at api, within
+// config.HttpTimeout.
+func lookupRepo(ctx context.Context, api, repo string) (Repo, error) {
+	if r, ok := repos.Get(repo); ok {
+		return r.(Repo), nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, config.HttpTimeout)
+	defer cancel()
+	parts := strings.Split(repo, "/")
+	resp, err := ctxhttp.Get(ctx, http.DefaultClient, fmt.Sprintf("%s/repos/%s/%s", api, parts[1], parts[2]))
+	if err != nil {
+		return Repo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Repo{}, fmt.Errorf("reading metadata of %s: %s", repo, resp.Status)
+	}
+	var info struct {
+		Fork            bool      `json:"fork"`
+		StargazersCount int       `json:"stargazers_count"`
+		CreatedAt       time.Time `json:"created_at"`
+		Owner           struct {
+			Login string `json:"login"`
+		} `json:"owner"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return Repo{}, fmt.Errorf("reading metadata of %s: %v", repo, err)
+	}
+	r := Repo{
+		Path:    repo,
+		Owner:   info.Owner.Login,
+		Fork:    info.Fork,
+		Stars:   info.StargazersCount,
+		Created: info.CreatedAt,
+	}
+	repos.Add(repo, r)
+	return r, nil
+}
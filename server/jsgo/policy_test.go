@@ -0,0 +1,67 @@
+package jsgo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepoPolicy(t *testing.T) {
+	old := time.Now().Add(-time.Hour * 24 * 365)
+	strict := RepoPolicy{MinStars: 10, MinAge: time.Hour * 24 * 30, Owners: []string{"dave", "gopherjs"}}
+	tests := []struct {
+		name   string
+		policy RepoPolicy
+		repo   Repo
+		reject string
+	}{
+		{"default", RepoPolicy{AllowForks: true}, Repo{Owner: "a", Fork: true}, ""},
+		{"accepted", strict, Repo{Owner: "Dave", Stars: 10, Created: old}, ""},
+		{"fork", strict, Repo{Owner: "dave", Stars: 10, Created: old, Fork: true}, "forks can't be compiled"},
+		{"fork allowed", RepoPolicy{AllowForks: true, Owners: strict.Owners}, Repo{Owner: "dave", Fork: true}, ""},
+		{"stars", strict, Repo{Owner: "dave", Stars: 9, Created: old}, "at least 10 stars"},
+		{"age", strict, Repo{Owner: "dave", Stars: 10, Created: time.Now()}, "at least 720h0m0s old"},
+		{"owner", strict, Repo{Owner: "mallory", Stars: 10, Created: old}, "owned by mallory"},
+	}
+	for _, test := range tests {
+		test.repo.Path = "github.com/" + test.repo.Owner + "/b"
+		err := test.policy.Check(test.repo)
+		switch {
+		case test.reject == "" && err != nil:
+			t.Errorf("%s: expected to accept, found %v", test.name, err)
+		case test.reject != "" && (err == nil || !strings.Contains(err.Error(), test.reject) || !strings.Contains(err.Error(), test.repo.Path)):
+			t.Errorf("%s: expected rejection %q, found %v", test.name, test.reject, err)
+		}
+	}
+}
+
+func TestLookupRepo(t *testing.T) {
+	var requests int
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.URL.Path != "/repos/a/b" {
+			http.NotFound(w, req)
+			return
+		}
+		fmt.Fprint(w, `{"fork": true, "stargazers_count": 12, "created_at": "2018-01-02T03:04:05Z", "owner": {"login": "a"}}`)
+	}))
+	defer api.Close()
+
+	repo, err := lookupRepo(context.Background(), api.URL, "example.com/a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !repo.Fork || repo.Stars != 12 || repo.Owner != "a" || repo.Path != "example.com/a/b" || repo.Created.Year() != 2018 {
+		t.Fatalf("unexpected repo %#v", repo)
+	}
+	if _, err := lookupRepo(context.Background(), api.URL, "example.com/a/b"); err != nil || requests != 1 {
+		t.Fatalf("expected the metadata to be cached, found %d requests, %v", requests, err)
+	}
+	if _, err := lookupRepo(context.Background(), api.URL, "example.com/a/missing"); err == nil {
+		t.Fatal("expected an error for a missing repo")
+	}
+}
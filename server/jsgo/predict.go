@@ -0,0 +1,46 @@
+package jsgo
+
+import (
+	"context"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/jsgo/messages"
+	"github.com/dave/jsgo/server/store"
+	"github.com/gopherjs/gopherjs/compiler"
+)
+
+// predict returns the predicted cache hit ratio of the compile requested by info, for the compile queue
+// (see config.QueueReorder). The stored package is the last default build of the path, so other builds
+// (refs, variables, debug, shaken, symbol, replaced and wasm builds) are predicted to be cold.
+func (h *Handler) predict(ctx context.Context, info messages.Compile) float64 {
+	if !config.QueueReorder || info.Ref != "" || len(info.Vars) > 0 || info.Debug || info.Shake || len(info.Symbols) > 0 || len(info.Replace) > 0 {
+		return 0
+	}
+	if t, _ := target(info); t != TargetJs {
+		return 0
+	}
+	found, data, err := lookupPackage(ctx, h.Database, info.Path)
+	if err != nil {
+		return 0
+	}
+	return predictHits(found, data, compiler.Version)
+}
+
+// predictHits predicts the fraction of packages in a compile that will already be in the bucket, from
+// the previous compile of the same path. If the previous compile used the same toolchain, all its
+// packages are cached. Otherwise only the standard library (which is precompiled) is.
+func predictHits(found bool, data store.CompileData, toolchain string) float64 {
+	if !found || !data.Success || len(data.Min.Packages) == 0 {
+		return 0
+	}
+	if data.Toolchain == toolchain {
+		return 1
+	}
+	var standard int
+	for _, p := range data.Min.Packages {
+		if p.Standard {
+			standard++
+		}
+	}
+	return float64(standard) / float64(len(data.Min.Packages))
+}
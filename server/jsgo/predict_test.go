@@ -0,0 +1,36 @@
+package jsgo
+
+import (
+	"testing"
+
+	"github.com/dave/jsgo/server/store"
+)
+
+func TestPredictHits(t *testing.T) {
+	data := store.CompileData{Success: true, Toolchain: "1.0"}
+	data.Min.Packages = []store.CompilePackage{
+		{Path: "prelude", Standard: true},
+		{Path: "fmt", Standard: true},
+		{Path: "github.com/a/b"},
+		{Path: "github.com/a/c"},
+	}
+	failed := data
+	failed.Success = false
+	tests := []struct {
+		name      string
+		found     bool
+		data      store.CompileData
+		toolchain string
+		expected  float64
+	}{
+		{"not found", false, store.CompileData{}, "1.0", 0},
+		{"failed", true, failed, "1.0", 0},
+		{"same toolchain", true, data, "1.0", 1},
+		{"new toolchain", true, data, "1.1", 0.5},
+	}
+	for _, test := range tests {
+		if found := predictHits(test.found, test.data, test.toolchain); found != test.expected {
+			t.Errorf("%s: expected %v, found %v", test.name, test.expected, found)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package jsgo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/lru"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// checkRedirect returns an error telling the user to use the new path if the repo for path has been
+// renamed (e.g. a GitHub repo that redirects to a new owner or name). Only hosts in
+// config.RedirectHosts are checked, and the redirect must stay on the same host.
+func checkRedirect(ctx context.Context, path string) error {
+	moved, err := lookupRedirect(ctx, path)
+	if err != nil {
+		// Don't fail the compile if the redirect check fails - the fetch will report any real problem.
+		return nil
+	}
+	if moved != "" {
+		return fmt.Errorf("%s has moved to %s - please use the new path", path, moved)
+	}
+	return nil
+}
+
+// redirects holds the new repo path of recently checked repos (empty if the repo hasn't moved).
+var redirects = lru.New(config.RedirectCacheSize, config.RedirectCacheTime)
+
+// lookupRedirect returns the new path if the repo containing path has been renamed, or an empty
+// string if not.
+func lookupRedirect(ctx context.Context, path string) (string, error) {
+	parts := strings.Split(path, "/")
+	if len(parts) < 3 || !isRedirectHost(parts[0]) {
+		return "", nil
+	}
+	repo := strings.Join(parts[:3], "/")
+
+	if moved, ok := redirects.Get(repo); ok {
+		return movedPath(moved.(string), parts), nil
+	}
+
+	moved, err := resolveRedirect(ctx, repo)
+	if err != nil {
+		return "", err
+	}
+	redirects.Add(repo, moved)
+
+	return movedPath(moved, parts), nil
+}
+
+// movedPath adds the sub-package of the original path to the moved repo path.
+func movedPath(moved string, parts []string) string {
+	if moved == "" {
+		return ""
+	}
+	return strings.Join(append([]string{moved}, parts[3:]...), "/")
+}
+
+// resolveRedirect returns the new repo path if the repo redirects, or an empty string if not.
+func resolveRedirect(ctx context.Context, repo string) (string, error) {
+	client := &http.Client{
+		Timeout: config.HttpTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := ctxhttp.Head(ctx, client, "https://"+repo)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMovedPermanently {
+		return "", nil
+	}
+	location, err := resp.Location()
+	if err != nil {
+		return "", err
+	}
+	return redirectTarget(repo, location)
+}
+
+// redirectTarget validates the redirect location and converts it to a repo path. To prevent a redirect
+// sending us somewhere unexpected, the location must be on the same host and must be a repo path.
+func redirectTarget(repo string, location *url.URL) (string, error) {
+	host := repo[:strings.Index(repo, "/")]
+	if location.Scheme != "https" || location.Host != host {
+		return "", fmt.Errorf("%s redirects to unsupported location %s", repo, location)
+	}
+	parts := strings.Split(strings.Trim(location.Path, "/"), "/")
+	if len(parts) != 2 || !githubUsername.MatchString(parts[0]) || !githubRepoName.MatchString(parts[1]) {
+		return "", fmt.Errorf("%s redirects to unsupported location %s", repo, location)
+	}
+	moved := host + "/" + strings.Join(parts, "/")
+	if moved == repo {
+		return "", nil
+	}
+	return moved, nil
+}
+
+func isRedirectHost(host string) bool {
+	for _, h := range config.RedirectHosts {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package jsgo
+
+import (
+	"context"
+	"net/url"
+	"testing"
+)
+
+func TestRedirectTarget(t *testing.T) {
+	tests := []struct {
+		location, expected string
+		err                bool
+	}{
+		{location: "https://github.com/bar/baz", expected: "github.com/bar/baz"},
+		{location: "https://github.com/bar/baz/", expected: "github.com/bar/baz"},
+		{location: "https://github.com/foo/bar", expected: ""}, // same repo
+		{location: "http://github.com/bar/baz", err: true},     // not https
+		{location: "https://gitlab.com/bar/baz", err: true},    // another host
+		{location: "https://github.com.evil.com/bar/baz", err: true},
+		{location: "https://github.com/bar", err: true},                 // not a repo
+		{location: "https://github.com/bar/baz/tree/master", err: true}, // not a repo
+		{location: "https://github.com/b%20r/baz", err: true},           // invalid user
+		{location: "https://github.com/bar/ba$z", err: true},            // invalid repo name
+	}
+	for _, test := range tests {
+		location, err := url.Parse(test.location)
+		if err != nil {
+			t.Fatal(err)
+		}
+		moved, err := redirectTarget("github.com/foo/bar", location)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error, found %q", test.location, moved)
+			}
+			continue
+		}
+		if err != nil || moved != test.expected {
+			t.Errorf("%s: expected %q, found %q (%v)", test.location, test.expected, moved, err)
+		}
+	}
+}
+
+func TestLookupRedirect(t *testing.T) {
+	if moved := movedPath("github.com/bar/baz", []string{"github.com", "foo", "bar", "sub", "pkg"}); moved != "github.com/bar/baz/sub/pkg" {
+		t.Fatalf("expected the sub-package to be kept, found %q", moved)
+	}
+	if moved := movedPath("", []string{"github.com", "foo", "bar"}); moved != "" {
+		t.Fatalf("expected no move, found %q", moved)
+	}
+
+	// Cached results are used without a request.
+	redirects.Add("github.com/foo/bar", "github.com/bar/baz")
+	moved, err := lookupRedirect(context.Background(), "github.com/foo/bar/sub")
+	if err != nil || moved != "github.com/bar/baz/sub" {
+		t.Fatalf("expected the cached redirect, found %q (%v)", moved, err)
+	}
+
+	// Other hosts aren't checked.
+	moved, err = lookupRedirect(context.Background(), "example.com/foo/bar")
+	if err != nil || moved != "" {
+		t.Fatalf("expected no redirect check, found %q (%v)", moved, err)
+	}
+}
@@ -0,0 +1,193 @@
+package jsgo
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/locale"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-git.v4"
+	gitconfig "gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// resolveRef returns the git ref to compile for path. An explicit ref from the request wins, otherwise
+// the longest matching prefix in config.DefaultRefs is used. An empty ref means the repo's HEAD.
+func resolveRef(path, explicit string) string {
+	if explicit != "" {
+		return explicit
+	}
+	var ref, longest string
+	for prefix, r := range config.DefaultRefs {
+		if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			continue
+		}
+		if len(prefix) > len(longest) {
+			longest, ref = prefix, r
+		}
+	}
+	return ref
+}
+
+var validRef = regexp.MustCompile(`^[A-Za-z0-9_.\-/]+$`)
+
+var commitHash = regexp.MustCompile(`^[a-f0-9]{40}$`)
+
+// pullRef matches the ref of the head of a GitHub pull request.
+var pullRef = regexp.MustCompile(`^refs/pull/([0-9]+)/head$`)
+
+// pullSuffix matches the short form of a pull request: <path>#<number>.
+var pullSuffix = regexp.MustCompile(`^(.+)#([0-9]+)$`)
+
+// parsePullRequest converts a path in the <path>#<number> form to the path and the ref of the pull
+// request head. Pull request refs are only supported for GitHub.
+func parsePullRequest(path, ref string) (string, string, error) {
+	if m := pullSuffix.FindStringSubmatch(path); m != nil {
+		if ref != "" {
+			return "", "", fmt.Errorf("%s specifies a pull request, so can't also specify the ref %q", path, ref)
+		}
+		path, ref = m[1], fmt.Sprintf("refs/pull/%s/head", m[2])
+	}
+	if pullRef.MatchString(ref) && !strings.HasPrefix(path, "github.com/") {
+		return "", "", fmt.Errorf("pull requests are only supported for github.com repos, not %s", path)
+	}
+	return path, ref, nil
+}
+
+// refPath returns the path a build of path at ref is logged under: <path>#<number> for pull requests,
+// and <path>@<ref> for other refs.
+func refPath(path, ref string) string {
+	if ref == "" {
+		return path
+	}
+	if m := pullRef.FindStringSubmatch(ref); m != nil {
+		return path + "#" + m[1]
+	}
+	return path + "@" + ref
+}
+
+// repoRoot returns the repo root for path, assuming the host uses <host>/<user>/<repo> paths.
+func repoRoot(path string) (string, error) {
+	parts := strings.Split(path, "/")
+	if len(parts) < 3 {
+		return "", fmt.Errorf("can't find repo root for %s", path)
+	}
+	return strings.Join(parts[:3], "/"), nil
+}
+
+// fetchRef clones the repo containing path into the gopath filesystem, checked out at ref (or the
+// default branch if ref is empty). Once the repo is in the gopath, the getter won't download it again
+// so the requested ref is compiled. The clone has the same limits as the git fetcher (see cloneLimits).
+func fetchRef(ctx context.Context, gopath billy.Filesystem, path, ref string) error {
+	root, err := repoRoot(path)
+	if err != nil {
+		return err
+	}
+	return cloneRef(ctx, gopath, root, ref, root)
+}
+
+// cloneRef clones the repo at root, checked out at ref (or the default branch if ref is empty), into the
+// gopath filesystem at the dst path.
+func cloneRef(ctx context.Context, gopath billy.Filesystem, root, ref, dst string) error {
+	if ref != "" && (!validRef.MatchString(ref) || strings.Contains(ref, "..")) {
+		return fmt.Errorf("invalid ref %q", ref)
+	}
+	url := fmt.Sprintf("https://%s.git", root)
+	ctx, cancel, limit := cloneLimits(ctx, url)
+	defer cancel()
+	worktree := memfs.New()
+	if ref == "" {
+		if _, err := git.CloneContext(ctx, limit.storage(), worktree, &git.CloneOptions{URL: url, Depth: 1, Progress: limit, Tags: git.NoTags}); err != nil {
+			return limit.wrap(err, "fetching %s", root)
+		}
+	} else if pullRef.MatchString(ref) {
+		// pull request heads aren't branches, so they're fetched into a local branch with a refspec.
+		repo, err := git.Init(limit.storage(), worktree)
+		if err != nil {
+			return err
+		}
+		if _, err := repo.CreateRemote(&gitconfig.RemoteConfig{Name: "origin", URLs: []string{url}}); err != nil {
+			return err
+		}
+		local := plumbing.NewBranchReferenceName("pull")
+		if err := repo.FetchContext(ctx, &git.FetchOptions{
+			RefSpecs: []gitconfig.RefSpec{gitconfig.RefSpec("+" + ref + ":" + local.String())},
+			Depth:    1,
+			Progress: limit,
+			Tags:     git.NoTags,
+		}); err != nil {
+			return limit.wrap(err, "fetching %s at %s", root, ref)
+		}
+		w, err := repo.Worktree()
+		if err != nil {
+			return err
+		}
+		if err := w.Checkout(&git.CheckoutOptions{Branch: local}); err != nil {
+			return fmt.Errorf("checking out %s at %s: %v", root, ref, err)
+		}
+	} else if commitHash.MatchString(ref) {
+		// the commit may not be at the head of a branch, so the full history is needed.
+		repo, err := git.CloneContext(ctx, limit.storage(), worktree, &git.CloneOptions{URL: url, Progress: limit, Tags: git.NoTags})
+		if err != nil {
+			return limit.wrap(err, "fetching %s", root)
+		}
+		w, err := repo.Worktree()
+		if err != nil {
+			return err
+		}
+		if err := w.Checkout(&git.CheckoutOptions{Hash: plumbing.NewHash(ref)}); err != nil {
+			return fmt.Errorf("checking out %s at %s: %v", root, ref, err)
+		}
+	} else {
+		clone := func(name plumbing.ReferenceName) error {
+			_, err := git.CloneContext(ctx, limit.storage(), worktree, &git.CloneOptions{
+				URL:           url,
+				ReferenceName: name,
+				SingleBranch:  true,
+				Depth:         1,
+				Progress:      limit,
+			})
+			return limit.err(err)
+		}
+		if err := clone(plumbing.NewBranchReferenceName(ref)); err != nil {
+			// not a branch, so try a tag
+			worktree = memfs.New()
+			if err := clone(plumbing.NewTagReferenceName(ref)); err != nil {
+				if _, ok := err.(locale.Error); ok {
+					return err
+				}
+				return fmt.Errorf("fetching %s at %s: %v", root, ref, err)
+			}
+		}
+	}
+	return copyTree(worktree, "/", gopath, filepath.Join("gopath", "src", dst))
+}
+
+// copyTree recursively copies the files from the src directory to the dst directory, skipping the .git
+// directory.
+func copyTree(srcfs billy.Filesystem, src string, dstfs billy.Filesystem, dst string) error {
+	fis, err := srcfs.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		if fi.IsDir() {
+			if fi.Name() == ".git" {
+				continue
+			}
+			if err := copyTree(srcfs, filepath.Join(src, fi.Name()), dstfs, filepath.Join(dst, fi.Name())); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := copyFile(srcfs, filepath.Join(src, fi.Name()), dstfs, filepath.Join(dst, fi.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
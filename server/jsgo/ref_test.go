@@ -0,0 +1,70 @@
+package jsgo
+
+import (
+	"testing"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/jsgo/messages"
+	"github.com/dave/services/deployer"
+)
+
+func TestResolveRef(t *testing.T) {
+	defer func(refs map[string]string) { config.DefaultRefs = refs }(config.DefaultRefs)
+	config.DefaultRefs = map[string]string{
+		"github.com/a/b":     "develop",
+		"github.com/a/b/sub": "v1",
+	}
+	tests := map[string]struct{ path, explicit, expected string }{
+		"none":        {"github.com/c/d", "", ""},
+		"override":    {"github.com/a/b/pkg", "", "develop"},
+		"longest":     {"github.com/a/b/sub/pkg", "", "v1"},
+		"segment":     {"github.com/a/bc", "", ""},
+		"explicit":    {"github.com/a/b", "master", "master"},
+		"explicit-no": {"github.com/c/d", "master", "master"},
+	}
+	for name, test := range tests {
+		if found := resolveRef(test.path, test.explicit); found != test.expected {
+			t.Errorf("%s: expected %q, found %q", name, test.expected, found)
+		}
+	}
+}
+
+func TestParsePullRequest(t *testing.T) {
+	tests := []struct {
+		path, ref, expectedPath, expectedRef, err string
+	}{
+		{"github.com/a/b", "", "github.com/a/b", "", ""},
+		{"github.com/a/b#123", "", "github.com/a/b", "refs/pull/123/head", ""},
+		{"github.com/a/b/cmd/c#7", "", "github.com/a/b/cmd/c", "refs/pull/7/head", ""},
+		{"github.com/a/b", "refs/pull/9/head", "github.com/a/b", "refs/pull/9/head", ""},
+		{"github.com/a/b#123", "master", "", "", `github.com/a/b#123 specifies a pull request, so can't also specify the ref "master"`},
+		{"gitlab.com/a/b#123", "", "", "", "pull requests are only supported for github.com repos, not gitlab.com/a/b"},
+		{"gitlab.com/a/b", "refs/pull/1/head", "", "", "pull requests are only supported for github.com repos, not gitlab.com/a/b"},
+	}
+	for _, test := range tests {
+		path, ref, err := parsePullRequest(test.path, test.ref)
+		var found string
+		if err != nil {
+			found = err.Error()
+		}
+		if found != test.err || path != test.expectedPath || ref != test.expectedRef {
+			t.Errorf("%s %s: expected %q %q %q, found %q %q %q", test.path, test.ref, test.expectedPath, test.expectedRef, test.err, path, ref, found)
+		}
+	}
+}
+
+func TestRefPath(t *testing.T) {
+	tests := map[string]struct{ path, ref, expected string }{
+		"default": {"github.com/a/b", "", "github.com/a/b"},
+		"branch":  {"github.com/a/b", "develop", "github.com/a/b@develop"},
+		"pull":    {"github.com/a/b/c", "refs/pull/123/head", "github.com/a/b/c#123"},
+	}
+	for name, test := range tests {
+		if found := refPath(test.path, test.ref); found != test.expected {
+			t.Errorf("%s: expected %q, found %q", name, test.expected, found)
+		}
+	}
+	if indexType(messages.Compile{Path: "github.com/a/b", Ref: "refs/pull/123/head"}, "") != deployer.HashIndex {
+		t.Fatal("expected pull request builds to be written only at their hash")
+	}
+}
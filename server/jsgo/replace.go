@@ -0,0 +1,85 @@
+package jsgo
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/gitremote"
+	"github.com/dave/jsgo/server/jsgo/messages"
+	"gopkg.in/src-d/go-billy.v4"
+)
+
+// repoPath matches a repo root: <host>/<owner>/<name>.
+var repoPath = regexp.MustCompile(`^[a-z0-9.\-]+/[A-Za-z0-9_.\-~]+/[A-Za-z0-9_.\-~]+$`)
+
+// checkReplace returns an error if the replacements of a compile of pkg are malformed or not allowed.
+// New repos are only fetched from config.GitRemoteHosts and can't be blocked imports. A repo can only be
+// replaced once, and the repo of the package itself can't be replaced (compile a ref of it instead).
+func checkReplace(replace []messages.Replace, pkg string) error {
+	if len(replace) > config.MaxReplacements {
+		return fmt.Errorf("too many replacements - the maximum is %d", config.MaxReplacements)
+	}
+	root, _ := repoRoot(pkg)
+	replaced := map[string]bool{}
+	for _, r := range replace {
+		for _, path := range []string{r.Old, r.New} {
+			if !repoPath.MatchString(path) || strings.Contains(path, "..") {
+				return fmt.Errorf("invalid replacement %s => %s - both must be repo roots (e.g. github.com/foo/bar)", r.Old, r.New)
+			}
+		}
+		if r.Ref != "" && (!validRef.MatchString(r.Ref) || strings.Contains(r.Ref, "..")) {
+			return fmt.Errorf("invalid ref %q for %s", r.Ref, r.New)
+		}
+		if !gitremote.Allowed(r.New) || isBlocked(r.New, config.BlockedImports) {
+			return fmt.Errorf("%s can't be fetched on this server", r.New)
+		}
+		if r.Old == root {
+			return fmt.Errorf("%s is the repo of %s, so can't be replaced - compile a ref instead", r.Old, pkg)
+		}
+		if replaced[r.Old] {
+			return fmt.Errorf("%s is replaced more than once", r.Old)
+		}
+		replaced[r.Old] = true
+	}
+	return nil
+}
+
+// replaceKey identifies a set of replacements in cache keys. It's empty if there are none.
+func replaceKey(replace []messages.Replace) string {
+	if len(replace) == 0 {
+		return ""
+	}
+	h := sha1.New()
+	for _, r := range sortedReplace(replace) {
+		fmt.Fprintf(h, "%s=%s@%s\n", r.Old, r.New, r.Ref)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))[:16]
+}
+
+func sortedReplace(replace []messages.Replace) []messages.Replace {
+	sorted := append([]messages.Replace(nil), replace...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Old < sorted[j].Old })
+	return sorted
+}
+
+// cloneReplacement fetches the New repo of a replacement into the gopath at the Old path.
+var cloneReplacement = func(ctx context.Context, gopath billy.Filesystem, r messages.Replace) error {
+	return cloneRef(ctx, gopath, r.New, r.Ref, r.Old)
+}
+
+// fetchReplacements fetches the replacements before the package's dependencies are resolved. Once a
+// repo is in the gopath the getter won't download it again, so packages that import the Old path are
+// compiled with the code of the New repo.
+func fetchReplacements(ctx context.Context, gopath billy.Filesystem, replace []messages.Replace) error {
+	for _, r := range replace {
+		if err := cloneReplacement(ctx, gopath, r); err != nil {
+			return fmt.Errorf("replacing %s with %s: %v", r.Old, r.New, err)
+		}
+	}
+	return nil
+}
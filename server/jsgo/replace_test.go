@@ -0,0 +1,113 @@
+package jsgo
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/jsgo/messages"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+func TestCheckReplace(t *testing.T) {
+	defer func(blocked []string) { config.BlockedImports = blocked }(config.BlockedImports)
+	config.BlockedImports = []string{"github.com/blocked"}
+
+	tests := map[string]struct {
+		replace []messages.Replace
+		err     string
+	}{
+		"none":      {nil, ""},
+		"ok":        {[]messages.Replace{{Old: "github.com/up/dep", New: "github.com/me/dep", Ref: "fix"}}, ""},
+		"package":   {[]messages.Replace{{Old: "github.com/a/b", New: "github.com/me/b"}}, "github.com/a/b is the repo of github.com/a/b/cmd, so can't be replaced - compile a ref instead"},
+		"sub":       {[]messages.Replace{{Old: "github.com/up/dep/sub", New: "github.com/me/dep"}}, "invalid replacement github.com/up/dep/sub => github.com/me/dep - both must be repo roots (e.g. github.com/foo/bar)"},
+		"dots":      {[]messages.Replace{{Old: "github.com/up/dep", New: "github.com/me/.."}}, "invalid replacement github.com/up/dep => github.com/me/.. - both must be repo roots (e.g. github.com/foo/bar)"},
+		"ref":       {[]messages.Replace{{Old: "github.com/up/dep", New: "github.com/me/dep", Ref: "a b"}}, `invalid ref "a b" for github.com/me/dep`},
+		"host":      {[]messages.Replace{{Old: "github.com/up/dep", New: "evil.com/me/dep"}}, "evil.com/me/dep can't be fetched on this server"},
+		"blocked":   {[]messages.Replace{{Old: "github.com/up/dep", New: "github.com/blocked/dep"}}, "github.com/blocked/dep can't be fetched on this server"},
+		"duplicate": {[]messages.Replace{{Old: "github.com/up/dep", New: "github.com/me/dep"}, {Old: "github.com/up/dep", New: "github.com/you/dep"}}, "github.com/up/dep is replaced more than once"},
+	}
+	for name, test := range tests {
+		var found string
+		if err := checkReplace(test.replace, "github.com/a/b/cmd"); err != nil {
+			found = err.Error()
+		}
+		if found != test.err {
+			t.Errorf("%s: expected %q, found %q", name, test.err, found)
+		}
+	}
+}
+
+func TestReplaceKey(t *testing.T) {
+	a := messages.Replace{Old: "github.com/up/a", New: "github.com/me/a"}
+	b := messages.Replace{Old: "github.com/up/b", New: "github.com/me/b", Ref: "fix"}
+	if replaceKey(nil) != "" {
+		t.Fatal("expected an empty key without replacements")
+	}
+	if replaceKey([]messages.Replace{a, b}) != replaceKey([]messages.Replace{b, a}) {
+		t.Fatal("expected the key to be independent of the order")
+	}
+	b2 := b
+	b2.Ref = "other"
+	if replaceKey([]messages.Replace{a, b}) == replaceKey([]messages.Replace{a, b2}) {
+		t.Fatal("expected the key to depend on the ref")
+	}
+
+	// Replaced builds are cached separately from the default build.
+	info := messages.Compile{Path: "github.com/a/b", Replace: []messages.Replace{a}}
+	if path := buildPath(info.Path, info); path != "github.com/a/b@replace-"+replaceKey(info.Replace) {
+		t.Fatalf("unexpected build path %s", path)
+	}
+	if failureKey(info) == failureKey(messages.Compile{Path: "github.com/a/b"}) {
+		t.Fatal("expected a separate failure key")
+	}
+}
+
+func TestFetchReplacements(t *testing.T) {
+	fs := memfs.New()
+	writeFiles(t, fs, map[string]string{
+		"github.com/a/b/main.go": "package main\n\nimport \"github.com/up/dep\"\n\nfunc main() { println(dep.Name) }\n",
+	})
+
+	// The fork is a repo with different code at the same package.
+	fork := memfs.New()
+	f, _ := fork.Create("dep.go")
+	f.Write([]byte("package dep\n\nconst Name = \"fork\"\n"))
+	f.Close()
+
+	defer func(f func(context.Context, billy.Filesystem, messages.Replace) error) { cloneReplacement = f }(cloneReplacement)
+	var cloned []string
+	cloneReplacement = func(ctx context.Context, gopath billy.Filesystem, r messages.Replace) error {
+		cloned = append(cloned, r.New+"@"+r.Ref)
+		return copyTree(fork, "/", gopath, filepath.Join("gopath", "src", r.Old))
+	}
+
+	replace := []messages.Replace{{Old: "github.com/up/dep", New: "github.com/me/dep", Ref: "fix"}}
+	if err := fetchReplacements(context.Background(), fs, replace); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(cloned, " ") != "github.com/me/dep@fix" {
+		t.Fatalf("unexpected clones %v", cloned)
+	}
+
+	// The import of the package resolves to the code of the fork.
+	bctx := memContext(fs)
+	main, err := bctx.Import("github.com/a/b", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dep, err := bctx.Import(main.Imports[0], "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := readFile(fs, filepath.Join(dep.Dir, dep.GoFiles[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `const Name = "fork"`) {
+		t.Fatalf("expected the code of the fork, found %s", b)
+	}
+}
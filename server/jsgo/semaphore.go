@@ -0,0 +1,38 @@
+package jsgo
+
+import (
+	"context"
+	"time"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/locale"
+)
+
+// fetches limits the number of concurrent fetches, separately from the compile queue, so a burst of
+// uncached requests doesn't start dozens of clones at once.
+var fetches = newSemaphore(config.MaxConcurrentFetches)
+
+type semaphore chan struct{}
+
+func newSemaphore(n int) semaphore {
+	return make(semaphore, n)
+}
+
+// acquire waits for a free slot for at most config.FetchWaitTimeout. The caller must call release if
+// acquire returns nil.
+func (s semaphore) acquire(ctx context.Context) error {
+	timer := time.NewTimer(config.FetchWaitTimeout)
+	defer timer.Stop()
+	select {
+	case s <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return locale.Error{Code: locale.FetchBusy}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s semaphore) release() {
+	<-s
+}
@@ -0,0 +1,40 @@
+package jsgo
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSemaphore(t *testing.T) {
+	const n = 3
+	s := newSemaphore(n)
+	var running, max int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.acquire(context.Background()); err != nil {
+				t.Error(err)
+				return
+			}
+			defer s.release()
+			current := atomic.AddInt32(&running, 1)
+			for {
+				previous := atomic.LoadInt32(&max)
+				if current <= previous || atomic.CompareAndSwapInt32(&max, previous, current) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond * 5)
+			atomic.AddInt32(&running, -1)
+		}()
+	}
+	wg.Wait()
+	if max > n {
+		t.Fatalf("expected at most %d concurrent fetches, found %d", n, max)
+	}
+}
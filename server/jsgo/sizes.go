@@ -0,0 +1,186 @@
+package jsgo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/store"
+	"github.com/dave/services"
+)
+
+// sizes wraps the fileserver of a session, and records the raw and gzipped size and the hash of each
+// file written to the pkg bucket, so the sizes of a compile are found when its files are stored rather
+// than by reading them back.
+type sizes struct {
+	services.Fileserver
+	m     sync.Mutex
+	files map[string]sizedFile
+}
+
+type sizedFile struct {
+	store.BuildFile
+	Gzip int64
+}
+
+func newSizes(fileserver services.Fileserver) *sizes {
+	return &sizes{Fileserver: fileserver, files: map[string]sizedFile{}}
+}
+
+func (s *sizes) Write(ctx context.Context, bucket, name string, reader io.Reader, overwrite bool, contentType, cacheControl string) (bool, error) {
+	if bucket != config.Bucket[config.Pkg] {
+		return s.Fileserver.Write(ctx, bucket, name, reader, overwrite, contentType, cacheControl)
+	}
+	b, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return false, err
+	}
+	file, err := measure(name, func(w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	s.m.Lock()
+	s.files[name] = file
+	s.m.Unlock()
+	return s.Fileserver.Write(ctx, bucket, name, bytes.NewReader(b), overwrite, contentType, cacheControl)
+}
+
+// standardSizes has the sizes of the prelude and standard library files, which are precompiled so
+// they're never written by a compile. They're read from the pkg bucket the first time they're needed.
+// The names include the hash of the contents, so the sizes never change, and there are only as many as
+// the assets have.
+var standardSizes = struct {
+	sync.Mutex
+	files map[string]sizedFile
+}{files: map[string]sizedFile{}}
+
+// set records the total raw and gzipped size of the files in a compile (the prelude, the packages and
+// the main script), so users can see the effect of size optimizations without downloading the files.
+// The size and hash of each file is returned, in the same order as the manifest.
+func (s *sizes) set(ctx context.Context, path string, contents *store.CompileContents) ([]store.BuildFile, error) {
+	type item struct {
+		name     string
+		standard bool
+	}
+	var items []item
+	for _, p := range contents.Packages {
+		items = append(items, item{name: fmt.Sprintf("%s.%s.js", p.Path, p.Hash), standard: p.Standard})
+	}
+	items = append(items, item{name: fmt.Sprintf("%s.%s.js", path, contents.Main)})
+
+	files := make([]store.BuildFile, len(items))
+	var raw, gz int64
+	var wg sync.WaitGroup
+	var m sync.Mutex
+	var outer error
+	sem := make(chan struct{}, config.ConcurrentStorageUploads)
+	for i, it := range items {
+		i, it := i, it
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			file, err := s.find(ctx, it.name, it.standard)
+			if err != nil {
+				m.Lock()
+				outer = err
+				m.Unlock()
+				return
+			}
+			atomic.AddInt64(&raw, file.Size)
+			atomic.AddInt64(&gz, file.Gzip)
+			files[i] = file.BuildFile
+		}()
+	}
+	wg.Wait()
+	if outer != nil {
+		return nil, outer
+	}
+
+	contents.RawBytes = raw
+	contents.GzipBytes = gz
+	if raw > 0 {
+		contents.Ratio = float64(gz) / float64(raw)
+	}
+	return files, nil
+}
+
+// find returns the size of a file: recorded when it was written by this compile, or else (only
+// expected for standard files) read from the pkg bucket.
+func (s *sizes) find(ctx context.Context, name string, standard bool) (sizedFile, error) {
+	s.m.Lock()
+	file, ok := s.files[name]
+	s.m.Unlock()
+	if ok {
+		return file, nil
+	}
+	if standard {
+		standardSizes.Lock()
+		file, ok := standardSizes.files[name]
+		standardSizes.Unlock()
+		if ok {
+			return file, nil
+		}
+	}
+	file, err := readStored(ctx, s.Fileserver, name)
+	if err != nil {
+		return sizedFile{}, err
+	}
+	if standard {
+		standardSizes.Lock()
+		standardSizes.files[name] = file
+		standardSizes.Unlock()
+	}
+	return file, nil
+}
+
+// readStored measures a file in the pkg bucket. The gzipped contents are only counted, never held in
+// memory.
+func readStored(ctx context.Context, fileserver services.Fileserver, name string) (sizedFile, error) {
+	return measure(name, func(w io.Writer) error {
+		found, err := fileserver.Read(ctx, config.Bucket[config.Pkg], name, w)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("%s not found", name)
+		}
+		return nil
+	})
+}
+
+// measure returns the raw and gzipped size and the hash of the contents written by write.
+func measure(name string, write func(w io.Writer) error) (sizedFile, error) {
+	var raw, gz counter
+	gzw := gzip.NewWriter(&gz)
+	hash := sha256.New()
+	if err := write(io.MultiWriter(&raw, gzw, hash)); err != nil {
+		return sizedFile{}, err
+	}
+	if err := gzw.Close(); err != nil {
+		return sizedFile{}, err
+	}
+	return sizedFile{
+		BuildFile: store.BuildFile{Name: name, Size: int64(raw), Hash: fmt.Sprintf("%x", hash.Sum(nil))},
+		Gzip:      int64(gz),
+	}, nil
+}
+
+// counter is an io.Writer that counts the bytes written.
+type counter int64
+
+func (c *counter) Write(b []byte) (int, error) {
+	*c += counter(len(b))
+	return len(b), nil
+}
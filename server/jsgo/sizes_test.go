@@ -0,0 +1,75 @@
+package jsgo
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/memstore"
+	"github.com/dave/jsgo/server/store"
+)
+
+// countingFileserver counts the reads.
+type countingFileserver struct {
+	*memstore.Fileserver
+	reads int
+}
+
+func (c *countingFileserver) Read(ctx context.Context, bucket, name string, writer io.Writer) (bool, error) {
+	c.reads++
+	return c.Fileserver.Read(ctx, bucket, name, writer)
+}
+
+func TestSetSizes(t *testing.T) {
+	pkg := config.Bucket[config.Pkg]
+	fs := &countingFileserver{Fileserver: memstore.NewFileserver(map[string]string{
+		pkg + ":prelude.p1.js": strings.Repeat("prelude ", 1000),
+		pkg + ":fmt.f1.js":     "fmt",
+	})}
+	written := newSizes(fs)
+	// written by the compile
+	if _, err := written.Write(context.Background(), pkg, "github.com/a/b.m1.js", strings.NewReader(strings.Repeat("main ", 1000)), false, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if fs.Files[pkg+":github.com/a/b.m1.js"] != strings.Repeat("main ", 1000) {
+		t.Fatal("expected the file to be written")
+	}
+	contents := store.CompileContents{
+		Main: "m1",
+		Packages: []store.CompilePackage{
+			{Path: "prelude", Hash: "p1", Standard: true},
+			{Path: "fmt", Hash: "f1", Standard: true},
+		},
+	}
+	files, err := written.set(context.Background(), "github.com/a/b", &contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 || files[2].Name != "github.com/a/b.m1.js" || files[2].Size != 5000 || files[1].Hash != "c63e082dd70f83c72efe6d52dbc055cc68fe8fe597ca035ecc6c23a363a231b2" {
+		t.Fatalf("unexpected files %#v", files)
+	}
+	if contents.RawBytes != 5000+8000+3 {
+		t.Fatalf("unexpected raw size %d", contents.RawBytes)
+	}
+	if contents.GzipBytes == 0 || contents.GzipBytes >= contents.RawBytes {
+		t.Fatalf("unexpected gzip size %d", contents.GzipBytes)
+	}
+	if contents.Ratio != float64(contents.GzipBytes)/float64(contents.RawBytes) {
+		t.Fatalf("unexpected ratio %v", contents.Ratio)
+	}
+	// only the standard files were read, and they're only read once
+	if fs.reads != 2 {
+		t.Fatalf("expected 2 reads, found %d", fs.reads)
+	}
+	again := store.CompileContents{Main: "m1", Packages: contents.Packages}
+	if _, err := written.set(context.Background(), "github.com/a/b", &again); err != nil || again.RawBytes != contents.RawBytes || fs.reads != 2 {
+		t.Fatalf("expected the standard sizes to be remembered, found %v, %d, %d reads", err, again.RawBytes, fs.reads)
+	}
+
+	missing := store.CompileContents{Main: "m2", Packages: contents.Packages}
+	if _, err := written.set(context.Background(), "github.com/a/b", &missing); err == nil || missing.RawBytes != 0 {
+		t.Fatalf("expected error and no sizes for missing file, found %v, %d", err, missing.RawBytes)
+	}
+}
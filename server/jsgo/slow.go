@@ -0,0 +1,24 @@
+package jsgo
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/store"
+)
+
+// slowThreshold is config.SlowCompileThreshold. It's a variable so tests can change it.
+var slowThreshold = config.SlowCompileThreshold
+
+// checkSlow writes a line to w if the compile of path took longer than slowThreshold, with the time
+// taken by each phase, and returns true if it did. Only slow compiles are logged, so performance
+// outliers (e.g. a repo that suddenly compiles much slower) stand out from the normal compiles.
+func checkSlow(w io.Writer, path string, duration time.Duration, phases store.CompilePhases) bool {
+	if slowThreshold <= 0 || duration <= slowThreshold {
+		return false
+	}
+	fmt.Fprintf(w, "slow compile of %s took %v (fetch %v, wait %v, compile %v)\n", path, duration, phases.Fetch, phases.Wait, phases.Compile)
+	return true
+}
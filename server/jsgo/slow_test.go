@@ -0,0 +1,36 @@
+package jsgo
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dave/jsgo/server/store"
+)
+
+func TestCheckSlow(t *testing.T) {
+	defer func(threshold time.Duration) { slowThreshold = threshold }(slowThreshold)
+	slowThreshold = time.Second
+	phases := store.CompilePhases{Fetch: 2 * time.Second, Wait: time.Second, Compile: 3 * time.Second}
+
+	buf := &bytes.Buffer{}
+	if !checkSlow(buf, "github.com/a/b", 6*time.Second, phases) {
+		t.Fatal("expected a slow compile")
+	}
+	for _, s := range []string{"github.com/a/b", "took 6s", "fetch 2s", "wait 1s", "compile 3s"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Fatalf("expected %q in the log, found %q", s, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if checkSlow(buf, "github.com/a/b", time.Second/2, phases) || buf.Len() > 0 {
+		t.Fatalf("expected a fast compile not to be logged, found %q", buf.String())
+	}
+
+	slowThreshold = 0
+	if checkSlow(buf, "github.com/a/b", time.Hour, phases) || buf.Len() > 0 {
+		t.Fatal("expected no logging when disabled")
+	}
+}
@@ -0,0 +1,47 @@
+package jsgo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/jsgo/messages"
+	"github.com/dave/jsgo/server/store"
+	"github.com/dave/services"
+)
+
+// stale handles a failed compile. If the request has Stale set (or config.ServeStale is set) and the
+// path has a previous successful build, the last good build is sent as a Complete message with Stale
+// set, and the package entity is flagged so the manifest shows the path is stale. The error is logged,
+// and nil is returned so the embed keeps working. Otherwise err is returned.
+func (h *Handler) stale(ctx context.Context, info messages.Compile, err error, send func(services.Message)) error {
+	if !info.Stale && !config.ServeStale || info.Plan || info.Expect != "" {
+		return err
+	}
+	if t, _ := target(info); t != TargetJs {
+		return err
+	}
+	path := buildPath(info.Path, info)
+	found, data, lookupErr := store.Package(ctx, h.Database, path)
+	if lookupErr != nil || !found || !data.Success {
+		return err
+	}
+	fmt.Printf("serving the last good build of %s after a failed compile: %v\n", path, err)
+	if err := store.MarkStale(ctx, h.Database, path); err != nil {
+		fmt.Printf("marking %s as stale: %v\n", path, err)
+	}
+	pkg := info.Path
+	if gist, _, ok := gistRevision(info.Path); ok {
+		pkg = gist
+	}
+	send(messages.Complete{
+		Path:    pkg,
+		Short:   strings.TrimPrefix(pkg, "github.com/"),
+		HashMin: data.Min.Main,
+		HashMax: data.Max.Main,
+		BuildId: data.Min.Main,
+		Stale:   true,
+	})
+	return nil
+}
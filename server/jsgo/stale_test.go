@@ -0,0 +1,63 @@
+package jsgo
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dave/jsgo/server/jsgo/messages"
+	"github.com/dave/jsgo/server/memstore"
+	"github.com/dave/jsgo/server/store"
+	"github.com/dave/services"
+)
+
+func TestStale(t *testing.T) {
+	const path = "github.com/a/b"
+	defer func(f *failureCache) { failures = f }(failures)
+	failures = &failureCache{
+		entries: map[string]failureEntry{},
+		sha:     func(ctx context.Context, path, ref string) (string, error) { return "a", nil },
+	}
+	ctx := context.Background()
+	db := memstore.NewDatabase()
+	h := &Handler{Database: db}
+	good := store.CompileData{Path: path, Success: true, Min: store.CompileContents{Main: "m1"}, Max: store.CompileContents{Main: "x1"}}
+	if err := store.StoreCompile(ctx, db, path, good); err != nil {
+		t.Fatal(err)
+	}
+
+	// The recompile fails (the failure is remembered, so it fails without being fetched).
+	failures.add(ctx, messages.Compile{Path: path}, errors.New("syntax error"))
+	compile := func(info messages.Compile) (messages.Complete, error) {
+		var complete messages.Complete
+		send := func(message services.Message) {
+			if m, ok := message.(messages.Complete); ok {
+				complete = m
+			}
+		}
+		err := h.Compile(ctx, info, httptest.NewRequest("GET", "/", nil), send, nil)
+		return complete, err
+	}
+
+	if _, err := compile(messages.Compile{Path: path}); err == nil {
+		t.Fatal("expected the failure without Stale")
+	}
+
+	complete, err := compile(messages.Compile{Path: path, Stale: true})
+	if err != nil {
+		t.Fatalf("expected the last good build, found %v", err)
+	}
+	if !complete.Stale || complete.HashMin != "m1" || complete.HashMax != "x1" || complete.BuildId != "m1" || complete.Path != path {
+		t.Fatalf("unexpected complete message %#v", complete)
+	}
+	if _, data, _ := store.Package(ctx, db, path); !data.Stale || data.Min.Main != "m1" {
+		t.Fatalf("expected the package to be marked stale, found %#v", data)
+	}
+
+	// A path that has never compiled has nothing to fall back to.
+	failures.add(ctx, messages.Compile{Path: "github.com/a/c"}, errors.New("syntax error"))
+	if _, err := compile(messages.Compile{Path: "github.com/a/c", Stale: true}); err == nil {
+		t.Fatal("expected the failure without a previous build")
+	}
+}
@@ -0,0 +1,46 @@
+package jsgo
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"go/ast"
+	"regexp"
+	"sort"
+
+	"github.com/dave/jsgo/config"
+)
+
+var symbolName = regexp.MustCompile(`^[\p{L}_][\p{L}\p{N}_]*$`)
+
+// checkSymbols returns an error if there are too many symbols, or any of them isn't an exported Go
+// identifier. Whether the package has the symbols is checked when it's compiled.
+func checkSymbols(symbols []string) error {
+	if len(symbols) > config.MaxSymbols {
+		return fmt.Errorf("too many symbols - the maximum is %d", config.MaxSymbols)
+	}
+	for _, symbol := range symbols {
+		if !symbolName.MatchString(symbol) || !ast.IsExported(symbol) {
+			return fmt.Errorf("invalid symbol %q - symbols must be exported names of the package", symbol)
+		}
+	}
+	return nil
+}
+
+// symbolsKey returns a short hash of the set of symbols, for the cache key of a symbol build. The
+// order of the symbols doesn't change the output, so it doesn't change the key.
+func symbolsKey(symbols []string) string {
+	if len(symbols) == 0 {
+		return ""
+	}
+	sorted := append([]string(nil), symbols...)
+	sort.Strings(sorted)
+	h := sha1.New()
+	var last string
+	for _, symbol := range sorted {
+		if symbol != last {
+			fmt.Fprintf(h, "%s\n", symbol)
+		}
+		last = symbol
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))[:16]
+}
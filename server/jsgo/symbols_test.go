@@ -0,0 +1,40 @@
+package jsgo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dave/jsgo/server/jsgo/messages"
+)
+
+func TestCheckSymbols(t *testing.T) {
+	if err := checkSymbols([]string{"F", "Type", "Ünïcode"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, symbol := range []string{"f", "", "a.B", "F()", "_F"} {
+		if err := checkSymbols([]string{symbol}); err == nil {
+			t.Errorf("%q: expected an error", symbol)
+		}
+	}
+	if err := checkSymbols(make([]string, 101)); err == nil || !strings.Contains(err.Error(), "too many") {
+		t.Fatalf("expected too many symbols, found %v", err)
+	}
+}
+
+func TestSymbolsKey(t *testing.T) {
+	path := func(symbols ...string) string {
+		return buildPath("github.com/a/b", messages.Compile{Path: "github.com/a/b", Symbols: symbols})
+	}
+	if path() != "github.com/a/b" {
+		t.Fatalf("expected no key without symbols, found %q", path())
+	}
+	if !strings.HasPrefix(path("F"), "github.com/a/b@symbols-") || path("F") == path("G") {
+		t.Fatalf("expected the symbols in the key, found %q and %q", path("F"), path("G"))
+	}
+	if path("F", "G") != path("G", "F", "G") {
+		t.Fatal("expected the order and duplicates not to change the key")
+	}
+	if failureKey(messages.Compile{Path: "a", Symbols: []string{"F"}}) == failureKey(messages.Compile{Path: "a"}) {
+		t.Fatal("expected the symbols in the failure key")
+	}
+}
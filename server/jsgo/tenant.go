@@ -0,0 +1,72 @@
+package jsgo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/tenant"
+	"github.com/dave/services"
+	"github.com/dave/services/deployer"
+)
+
+// tenant returns the handler for the tenant that made req (see tenant.Namespace). A handler that's
+// already in the tenant's namespace is returned as is, so it can be resolved again by the compiles that a
+// request starts (see Diff).
+func (h *Handler) tenant(req *http.Request) (*Handler, error) {
+	namespace, err := tenant.Namespace(req)
+	if err != nil {
+		return nil, err
+	}
+	if namespace == h.namespace {
+		return h, nil
+	}
+	return h.forTenant(namespace), nil
+}
+
+// forTenant returns a copy of the handler that stores files and records in the namespace of a tenant
+// (see tenant.Namespace).
+func (h *Handler) forTenant(namespace string) *Handler {
+	c := *h
+	c.namespace = namespace
+	c.Fileserver = tenant.NewFileserver(h.Fileserver, namespace)
+	c.Database = tenant.NewDatabase(h.Database, namespace)
+	return &c
+}
+
+// pkgHost returns the host and path that the files of the handler's namespace are served from.
+func (h *Handler) pkgHost() string {
+	if h.namespace != "" {
+		return tenant.PkgHost(h.namespace)
+	}
+	return config.PkgHostPath()
+}
+
+// indexPath returns the path of the index page of pkg in the index bucket, which is in the tenant's
+// namespace.
+func (h *Handler) indexPath(pkg string) string {
+	if h.namespace != "" {
+		return tenant.Prefix(h.namespace) + "/" + pkg
+	}
+	return pkg
+}
+
+// ShareStandard copies the standard library files of a build into the tenant's namespace, because the
+// loader loads every file from the namespace but the precompiled files are only stored in the common
+// namespace. Nothing is done unless fileserver is a tenant's (see tenant.NewFileserver).
+func ShareStandard(ctx context.Context, fileserver services.Fileserver, output map[bool]*deployer.DeployOutput) error {
+	f, ok := fileserver.(*tenant.Fileserver)
+	if !ok {
+		return nil
+	}
+	var names []string
+	for min, o := range output {
+		for _, p := range getCompileContents(o, min).Packages {
+			if p.Standard {
+				names = append(names, fmt.Sprintf("%s.%s.js", p.Path, p.Hash))
+			}
+		}
+	}
+	return f.Share(ctx, config.Bucket[config.Pkg], "application/javascript", "public,max-age=31536000,immutable", names...)
+}
@@ -0,0 +1,21 @@
+package jsgo
+
+import (
+	"strings"
+	"time"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/jsgo/messages"
+)
+
+// buildTtl returns how long the files of a compile of pkg are kept (see config.TtlPinned): gists are
+// ephemeral, builds of a ref or module version are pinned, and other builds are the default.
+func buildTtl(info messages.Compile, pkg string) time.Duration {
+	switch {
+	case strings.HasPrefix(pkg, "gist.github.com/"):
+		return config.TtlEphemeral
+	case info.Ref != "" || info.Module != "":
+		return config.TtlPinned
+	}
+	return config.TtlDefault
+}
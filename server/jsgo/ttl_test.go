@@ -0,0 +1,27 @@
+package jsgo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/jsgo/messages"
+)
+
+func TestBuildTtl(t *testing.T) {
+	tests := []struct {
+		info     messages.Compile
+		pkg      string
+		expected time.Duration
+	}{
+		{messages.Compile{Path: "github.com/a/b"}, "github.com/a/b", config.TtlDefault},
+		{messages.Compile{Path: "github.com/a/b", Ref: "v1.0.0"}, "github.com/a/b", config.TtlPinned},
+		{messages.Compile{Module: "example.com/a@v1.0.0"}, "github.com/a/b", config.TtlPinned},
+		{messages.Compile{Path: "gist.github.com/abc"}, "gist.github.com/abc", config.TtlEphemeral},
+	}
+	for _, test := range tests {
+		if found := buildTtl(test.info, test.pkg); found != test.expected {
+			t.Errorf("%#v: expected %v, found %v", test.info, test.expected, found)
+		}
+	}
+}
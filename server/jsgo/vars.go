@@ -0,0 +1,166 @@
+package jsgo
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dave/jsgo/config"
+	"gopkg.in/src-d/go-billy.v4"
+)
+
+// varName matches the keys of a Vars assignment: an import path, a dot, and the name of a package level
+// variable, like the argument of the linker's -X flag.
+var varName = regexp.MustCompile(`^([a-zA-Z0-9_.\-~/]+)\.([a-zA-Z_][a-zA-Z0-9_]*)$`)
+
+// checkVars returns an error if any of the assignments is malformed or not in the allowlist. Allowed
+// entries are either a full name (import/path.Name) or an import path followed by ".*" to allow every
+// variable in the package.
+func checkVars(vars map[string]string, allowed []string) error {
+	for _, name := range sortedVars(vars) {
+		matches := varName.FindStringSubmatch(name)
+		if matches == nil {
+			return fmt.Errorf("invalid variable %q - the form is import/path.Name", name)
+		}
+		if len(vars[name]) > config.MaxVarLength || strings.ContainsRune(vars[name], 0) {
+			return fmt.Errorf("invalid value for %s - values must be at most %d bytes", name, config.MaxVarLength)
+		}
+		if !isAllowedVar(name, matches[1], allowed) {
+			return fmt.Errorf("%s can't be set on this server", name)
+		}
+	}
+	return nil
+}
+
+func isAllowedVar(name, path string, allowed []string) bool {
+	for _, a := range allowed {
+		if a == name || a == path+".*" {
+			return true
+		}
+	}
+	return false
+}
+
+// varsKey identifies a set of assignments in cache keys. It's empty if there are none.
+func varsKey(vars map[string]string) string {
+	if len(vars) == 0 {
+		return ""
+	}
+	h := sha1.New()
+	for _, name := range sortedVars(vars) {
+		fmt.Fprintf(h, "%s=%q\n", name, vars[name])
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))[:16]
+}
+
+func sortedVars(vars map[string]string) []string {
+	var names []string
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// varsFile is the name of the file added to each package with assignments. Init functions run in the
+// order the files are presented to the compiler (sorted by name), so the assignments run before the
+// package's other init functions. Unlike the linker's -X flag, package level variable initializers
+// still see the original values.
+const varsFile = "0000_jsgo_vars.go"
+
+// applyVars adds the assignments to the packages in the gopath. Each variable must be a package level
+// string variable.
+func applyVars(gopath billy.Filesystem, vars map[string]string) error {
+	byPackage := map[string][]string{}
+	for _, name := range sortedVars(vars) {
+		matches := varName.FindStringSubmatch(name)
+		if matches == nil {
+			return fmt.Errorf("invalid variable %q", name)
+		}
+		byPackage[matches[1]] = append(byPackage[matches[1]], matches[2])
+	}
+	for path, names := range byPackage {
+		dir := filepath.Join("gopath", "src", path)
+		pkgName, decls, err := stringVars(gopath, dir)
+		if err != nil {
+			return err
+		}
+		if pkgName == "" {
+			return fmt.Errorf("package %s not found", path)
+		}
+		src := fmt.Sprintf("package %s\n\nfunc init() {\n", pkgName)
+		for _, name := range names {
+			if !decls[name] {
+				return fmt.Errorf("%s.%s is not a package level string variable", path, name)
+			}
+			src += fmt.Sprintf("\t%s = %s\n", name, strconv.Quote(vars[path+"."+name]))
+		}
+		src += "}\n"
+		f, err := gopath.Create(filepath.Join(dir, varsFile))
+		if err != nil {
+			return err
+		}
+		_, err = f.Write([]byte(src))
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stringVars returns the package name and the package level string variables (declared with type
+// string, or initialized with a string literal) in the Go files in dir. Test files are ignored.
+func stringVars(fs billy.Filesystem, dir string) (string, map[string]bool, error) {
+	fis, err := fs.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil, nil
+		}
+		return "", nil, err
+	}
+	var pkgName string
+	decls := map[string]bool{}
+	for _, fi := range fis {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".go") || strings.HasSuffix(fi.Name(), "_test.go") {
+			continue
+		}
+		b, err := readFile(fs, filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return "", nil, err
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), fi.Name(), b, 0)
+		if err != nil {
+			// syntax errors are reported by the compiler
+			continue
+		}
+		pkgName = f.Name.Name
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				vs := spec.(*ast.ValueSpec)
+				for i, name := range vs.Names {
+					if ident, ok := vs.Type.(*ast.Ident); ok && ident.Name == "string" {
+						decls[name.Name] = true
+					} else if vs.Type == nil && i < len(vs.Values) {
+						if lit, ok := vs.Values[i].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+							decls[name.Name] = true
+						}
+					}
+				}
+			}
+		}
+	}
+	return pkgName, decls, nil
+}
@@ -0,0 +1,72 @@
+package jsgo
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+func TestCheckVars(t *testing.T) {
+	allowed := []string{"github.com/a/b.Version", "github.com/a/c.*"}
+	tests := []struct {
+		vars map[string]string
+		err  string
+	}{
+		{nil, ""},
+		{map[string]string{"github.com/a/b.Version": "1.0"}, ""},
+		{map[string]string{"github.com/a/c.Anything": "x", "github.com/a/c.Other": "y"}, ""},
+		{map[string]string{"github.com/a/b.Other": "x"}, "github.com/a/b.Other can't be set on this server"},
+		{map[string]string{"github.com/a/c/d.Name": "x"}, "can't be set"},
+		{map[string]string{"Version": "x"}, "invalid variable"},
+		{map[string]string{"github.com/a/b.Version -X main.x": "x"}, "invalid variable"},
+		{map[string]string{"github.com/a/b.Version": strings.Repeat("x", 2000)}, "invalid value"},
+	}
+	for _, test := range tests {
+		err := checkVars(test.vars, allowed)
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%v: expected %q, found %v", test.vars, test.err, err)
+		}
+	}
+}
+
+func TestVarsKey(t *testing.T) {
+	if varsKey(nil) != "" {
+		t.Fatal("expected empty key")
+	}
+	a := varsKey(map[string]string{"a.B": "1", "a.C": "2"})
+	if a != varsKey(map[string]string{"a.C": "2", "a.B": "1"}) || a == varsKey(map[string]string{"a.B": "1", "a.C": "3"}) {
+		t.Fatal("expected key to depend only on the assignments")
+	}
+}
+
+func TestApplyVars(t *testing.T) {
+	fs := memfs.New()
+	dir := filepath.Join("gopath", "src", "github.com", "a", "b")
+	f, _ := fs.Create(filepath.Join(dir, "b.go"))
+	f.Write([]byte("package b\n\nvar Version string\n\nvar Default = \"x\"\n\nvar Count = 1\n"))
+	f.Close()
+
+	if err := applyVars(fs, map[string]string{"github.com/a/b.Version": "1.0 \"beta\"", "github.com/a/b.Default": "y"}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := readFile(fs, filepath.Join(dir, varsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "package b\n\nfunc init() {\n\tDefault = \"y\"\n\tVersion = \"1.0 \\\"beta\\\"\"\n}\n"
+	if string(b) != expected {
+		t.Fatalf("expected %q, found %q", expected, b)
+	}
+
+	for name, expected := range map[string]string{
+		"github.com/a/b.Count":   "not a package level string variable",
+		"github.com/a/b.Missing": "not a package level string variable",
+		"github.com/a/x.Version": "package github.com/a/x not found",
+	} {
+		if err := applyVars(fs, map[string]string{name: "1"}); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected %q, found %v", name, expected, err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package jsgo
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/src-d/go-billy.v4"
+)
+
+// checkVendor returns an error if the repo containing pkg has a vendor/modules.txt that lists a package
+// that isn't in its vendor directory. The vendor directory is part of the clone, and vendored imports are
+// resolved to it like the go command does, so vendored dependencies are never fetched. Without this
+// check a package missing from vendor would be fetched fresh, silently compiling a different version to
+// the one the repo pins. The go command fails the same way ("inconsistent vendoring").
+func checkVendor(gopath billy.Filesystem, pkg string) error {
+	root, err := repoRoot(pkg)
+	if err != nil {
+		return nil
+	}
+	vendor := filepath.Join("gopath", "src", root, "vendor")
+	modules, err := readVendorModules(gopath, filepath.Join(vendor, "modules.txt"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, m := range modules {
+		dir := filepath.Join(vendor, filepath.FromSlash(m.path))
+		fis, err := gopath.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		var found bool
+		for _, fi := range fis {
+			if !fi.IsDir() && strings.HasSuffix(fi.Name(), ".go") {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("inconsistent vendoring in %s: %s (from %s) is listed in vendor/modules.txt but isn't in the vendor directory - run go mod vendor", root, m.path, m.module)
+		}
+	}
+	return nil
+}
+
+// vendoredPackage is a package listed in vendor/modules.txt.
+type vendoredPackage struct {
+	path   string // import path
+	module string // module path and version
+}
+
+// readVendorModules returns the packages listed in a vendor/modules.txt file. Module lines start with
+// "# ", annotations with "## ", and the other lines are the packages of the module above them.
+func readVendorModules(fs billy.Filesystem, name string) ([]vendoredPackage, error) {
+	b, err := readFile(fs, name)
+	if err != nil {
+		return nil, err
+	}
+	var packages []vendoredPackage
+	var module string
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "## "):
+			continue
+		case strings.HasPrefix(line, "# "):
+			module = strings.TrimPrefix(line, "# ")
+		default:
+			packages = append(packages, vendoredPackage{path: line, module: module})
+		}
+	}
+	return packages, scanner.Err()
+}
@@ -0,0 +1,59 @@
+package jsgo
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+func TestVendor(t *testing.T) {
+	fs := memfs.New()
+	writeFiles(t, fs, map[string]string{
+		"github.com/a/b/main.go": "package main\n\nimport \"github.com/c/d\"\n\nfunc main() { println(d.D) }\n",
+		// the vendored version uses cgo, and the version in the gopath doesn't
+		"github.com/a/b/vendor/github.com/c/d/d.go": "package d\n\n// #include <stdio.h>\nimport \"C\"\n\nvar D = 1\n",
+		"github.com/a/b/vendor/modules.txt":         "# github.com/c/d v1.0.0\n## explicit\ngithub.com/c/d\n",
+		"github.com/c/d/d.go":                       "package d\n\nvar D = 2\n",
+		"github.com/e/f/main.go":                    "package main\n\nimport \"github.com/c/d\"\n\nfunc main() { println(d.D) }\n",
+	})
+
+	// the vendored package is used by the repo that vendors it
+	expected := `github.com/a/b imports github.com/a/b/vendor/github.com/c/d, which uses cgo`
+	if err := checkCgo(memContext(fs), "github.com/a/b"); err == nil || !strings.HasPrefix(err.Error(), expected) {
+		t.Fatalf("expected %q, found %v", expected, err)
+	}
+	if err := checkCgo(memContext(fs), "github.com/e/f"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if err := checkVendor(fs, "github.com/a/b"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := checkVendor(fs, "github.com/e/f"); err != nil {
+		t.Fatalf("expected no error without vendor/modules.txt, found %v", err)
+	}
+
+	// a package listed in modules.txt must be vendored, rather than fetched
+	writeFiles(t, fs, map[string]string{
+		"github.com/a/b/vendor/modules.txt": "# github.com/c/d v1.0.0\n## explicit\ngithub.com/c/d\n# github.com/g/h v1.2.0\ngithub.com/g/h/i\n",
+	})
+	expected = "inconsistent vendoring in github.com/a/b: github.com/g/h/i (from github.com/g/h v1.2.0) is listed in vendor/modules.txt"
+	if err := checkVendor(fs, "github.com/a/b/cmd"); err == nil || !strings.HasPrefix(err.Error(), expected) {
+		t.Fatalf("expected %q, found %v", expected, err)
+	}
+}
+
+// writeFiles writes files to the gopath in fs.
+func writeFiles(t *testing.T, fs billy.Filesystem, files map[string]string) {
+	for name, contents := range files {
+		f, err := fs.Create(filepath.Join("gopath", "src", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(contents))
+		f.Close()
+	}
+}
@@ -0,0 +1,104 @@
+package jsgo
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/jsgo/messages"
+	"github.com/dave/services"
+	"github.com/dave/services/session"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+)
+
+// Compile targets. The js target is compiled with GopherJS, and the wasm target with the standard Go
+// toolchain.
+const (
+	TargetJs   = "js"
+	TargetWasm = "wasm"
+)
+
+// target returns the requested target, defaulting to js.
+func target(info messages.Compile) (string, error) {
+	switch info.Target {
+	case "", TargetJs:
+		return TargetJs, nil
+	case TargetWasm:
+		return TargetWasm, nil
+	}
+	return "", fmt.Errorf("unsupported target %q - use %q or %q", info.Target, TargetJs, TargetWasm)
+}
+
+// compileWasm builds pkg (already downloaded into the session gopath) with GOOS=js GOARCH=wasm, and
+// stores the wasm binary and a JS loader in the pkg bucket. Both are named by the hash of their
+// contents, so they never collide with the js target.
+func (h *Handler) compileWasm(ctx context.Context, s *session.Session, pkg string, send func(services.Message)) error {
+
+	var wasm []byte
+	if err := withWorkDir(func(dir string) error {
+		if err := copyTree(s.GoPath(), filepath.Join("gopath", "src"), osfs.New(dir), filepath.Join("src")); err != nil {
+			return err
+		}
+		out := filepath.Join(dir, "out.wasm")
+		cmd := exec.CommandContext(ctx, config.GoCommand, "build", "-o", out, pkg)
+		cmd.Env = append(os.Environ(), "GOOS=js", "GOARCH=wasm", "GO111MODULE=off", "GOPATH="+dir)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("building %s for wasm: %v\n%s", pkg, err, output)
+		}
+		var err error
+		wasm, err = ioutil.ReadFile(out)
+		return err
+	}); err != nil {
+		return err
+	}
+	support, err := ioutil.ReadFile(filepath.Join(runtime.GOROOT(), "misc", "wasm", "wasm_exec.js"))
+	if err != nil {
+		return err
+	}
+
+	wasmHash := fmt.Sprintf("%x", sha1.Sum(wasm))
+	wasmUrl := fmt.Sprintf("%s://%s/%s.wasm", config.Protocol[config.Pkg], h.pkgHost(), wasmHash)
+	loader := wasmLoader(support, wasmUrl)
+	loaderHash := fmt.Sprintf("%x", sha1.Sum(loader))
+
+	bucket := config.Bucket[config.Pkg]
+	if _, err := h.Fileserver.Write(ctx, bucket, wasmHash+".wasm", bytes.NewReader(wasm), false, "application/wasm", "public,max-age=31536000,immutable"); err != nil {
+		return err
+	}
+	if _, err := h.Fileserver.Write(ctx, bucket, loaderHash+".js", bytes.NewReader(loader), false, "application/javascript", "public,max-age=31536000,immutable"); err != nil {
+		return err
+	}
+
+	send(messages.CompleteWasm{
+		Path:    pkg,
+		Short:   strings.TrimPrefix(pkg, "github.com/"),
+		Loader:  fmt.Sprintf("%s://%s/%s.js", config.Protocol[config.Pkg], h.pkgHost(), loaderHash),
+		Wasm:    wasmUrl,
+		BuildId: loaderHash,
+	})
+	return nil
+}
+
+// wasmLoader returns JS that loads and runs the wasm binary at url. support is wasm_exec.js from the Go
+// distribution that built the binary.
+func wasmLoader(support []byte, url string) []byte {
+	buf := &bytes.Buffer{}
+	buf.Write(support)
+	fmt.Fprintf(buf, `
+(function() {
+	var go = new Go();
+	WebAssembly.instantiateStreaming(fetch(%q), go.importObject).then(function(result) {
+		go.run(result.instance);
+	});
+})();
+`, url)
+	return buf.Bytes()
+}
@@ -0,0 +1,26 @@
+package jsgo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dave/jsgo/server/jsgo/messages"
+)
+
+func TestTarget(t *testing.T) {
+	for requested, expected := range map[string]string{"": TargetJs, "js": TargetJs, "wasm": TargetWasm} {
+		if found, err := target(messages.Compile{Target: requested}); err != nil || found != expected {
+			t.Errorf("%q: expected %q, found %q (%v)", requested, expected, found, err)
+		}
+	}
+	if _, err := target(messages.Compile{Target: "arm"}); err == nil {
+		t.Error("expected error for unsupported target")
+	}
+}
+
+func TestWasmLoader(t *testing.T) {
+	loader := string(wasmLoader([]byte("// wasm_exec.js\n"), "https://pkg.jsgo.io/abc.wasm"))
+	if !strings.HasPrefix(loader, "// wasm_exec.js\n") || !strings.Contains(loader, `fetch("https://pkg.jsgo.io/abc.wasm")`) {
+		t.Fatalf("unexpected loader:\n%s", loader)
+	}
+}
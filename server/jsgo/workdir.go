@@ -0,0 +1,67 @@
+package jsgo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dave/jsgo/config"
+)
+
+// workDirPrefix starts the names of working directories, so the sweep doesn't remove anything else in
+// config.CompileWorkDir.
+const workDirPrefix = "compile-"
+
+// workDirBase returns config.CompileWorkDir, defaulting to jsgo-compile in the system temp directory.
+func workDirBase() string {
+	if config.CompileWorkDir != "" {
+		return config.CompileWorkDir
+	}
+	return filepath.Join(os.TempDir(), "jsgo-compile")
+}
+
+// withWorkDir creates a uniquely named working directory in config.CompileWorkDir, creating that if
+// needed, and runs f in it. The directory is removed when f returns, including when it fails, times out
+// or panics.
+func withWorkDir(f func(dir string) error) error {
+	base := workDirBase()
+	if err := os.MkdirAll(base, 0777); err != nil {
+		return err
+	}
+	dir, err := ioutil.TempDir(base, workDirPrefix)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	return f(dir)
+}
+
+// SweepWorkDirs removes the working directories left in config.CompileWorkDir by a server that crashed.
+// Only directories older than config.CompileAllTimeout (the longest a compile can run) are removed, so
+// the working directories of other servers sharing the directory are safe. It returns the number of
+// directories removed.
+func SweepWorkDirs() (int, error) {
+	infos, err := ioutil.ReadDir(workDirBase())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	var removed int
+	for _, info := range infos {
+		if !info.IsDir() || !strings.HasPrefix(info.Name(), workDirPrefix) {
+			continue
+		}
+		if time.Since(info.ModTime()) < config.CompileAllTimeout {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(workDirBase(), info.Name())); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
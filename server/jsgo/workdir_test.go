@@ -0,0 +1,94 @@
+package jsgo
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dave/jsgo/config"
+)
+
+func TestWorkDir(t *testing.T) {
+	base, err := ioutil.TempDir("", "jsgo-workdir-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+	defer func(dir string) { config.CompileWorkDir = dir }(config.CompileWorkDir)
+	config.CompileWorkDir = filepath.Join(base, "work") // created if absent
+
+	run := func(f func(dir string) error) (string, error) {
+		var found string
+		err := withWorkDir(func(dir string) error {
+			found = dir
+			if err := ioutil.WriteFile(filepath.Join(dir, "out.wasm"), []byte("wasm"), 0666); err != nil {
+				t.Fatal(err)
+			}
+			return f(dir)
+		})
+		return found, err
+	}
+	removed := func(dir string) bool {
+		_, err := os.Stat(dir)
+		return dir != "" && os.IsNotExist(err)
+	}
+
+	dir, err := run(func(string) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !removed(dir) {
+		t.Errorf("expected %s to be removed after success", dir)
+	}
+
+	dir, err = run(func(string) error { return errors.New("build failed") })
+	if err == nil || err.Error() != "build failed" {
+		t.Fatalf("expected the build error, found %v", err)
+	}
+	if !removed(dir) {
+		t.Errorf("expected %s to be removed after failure", dir)
+	}
+
+	func() {
+		defer func() { recover() }()
+		run(func(d string) error { dir = d; panic("compiler panic") })
+	}()
+	if !removed(dir) {
+		t.Errorf("expected %s to be removed after a panic", dir)
+	}
+}
+
+func TestSweepWorkDirs(t *testing.T) {
+	base, err := ioutil.TempDir("", "jsgo-workdir-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+	defer func(dir string) { config.CompileWorkDir = dir }(config.CompileWorkDir)
+	config.CompileWorkDir = base
+
+	old := time.Now().Add(-config.CompileAllTimeout - time.Minute)
+	for _, name := range []string{workDirPrefix + "orphan", workDirPrefix + "running", "other"} {
+		if err := os.Mkdir(filepath.Join(base, name), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if name != workDirPrefix+"running" {
+			os.Chtimes(filepath.Join(base, name), old, old)
+		}
+	}
+	removed, err := SweepWorkDirs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Fatalf("expected 1 directory removed, found %d", removed)
+	}
+	for name, expected := range map[string]bool{workDirPrefix + "orphan": false, workDirPrefix + "running": true, "other": true} {
+		if _, err := os.Stat(filepath.Join(base, name)); (err == nil) != expected {
+			t.Errorf("%s: expected exists %v, found %v", name, expected, err == nil)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// LimitBody wraps a handler so request bodies larger than limit bytes are rejected with 413 before the
+// handler sees them. The body is read up front, so the handler can't be left with a partially parsed
+// request.
+func LimitBody(limit int64, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		tooLarge := func() {
+			http.Error(w, fmt.Sprintf("request body too large - the limit is %d bytes", limit), http.StatusRequestEntityTooLarge)
+		}
+		if req.ContentLength > limit {
+			tooLarge()
+			return
+		}
+		b, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, limit))
+		if err != nil {
+			tooLarge()
+			return
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(b))
+		handler(w, req)
+	}
+}
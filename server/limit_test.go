@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLimitBody(t *testing.T) {
+	var called bool
+	handler := LimitBody(10, func(w http.ResponseWriter, req *http.Request) {
+		called = true
+		req.ParseForm()
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/", strings.NewReader("n=12345678901"))
+	handler(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge || called {
+		t.Fatalf("expected 413 before the handler, got %d (called: %v)", w.Code, called)
+	}
+
+	// Unknown length, e.g. a chunked request
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/", strings.NewReader("n=12345678901"))
+	req.ContentLength = -1
+	handler(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge || called {
+		t.Fatalf("expected 413 before the handler, got %d (called: %v)", w.Code, called)
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/", strings.NewReader("n=1"))
+	handler(w, req)
+	if w.Code != http.StatusOK || !called {
+		t.Fatalf("expected the handler to be called, got %d", w.Code)
+	}
+}
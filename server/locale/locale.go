@@ -0,0 +1,136 @@
+// Package locale translates the user-facing messages sent to clients during a compile. Messages are
+// identified by a code, which is stable across languages so clients can do their own translation.
+package locale
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dave/jsgo/config"
+)
+
+// Codes of the translated messages.
+const (
+	Shutdown     = "shutdown"
+	QueueFull    = "queue_full"
+	FetchBusy    = "fetch_busy"
+	Unavailable  = "upstream_unavailable"
+	Timeout      = "timeout"
+	Expired      = "expired"
+	AuthRequired = "auth_required"
+	TooMany      = "too_many_compiles"
+)
+
+// Default is the language used when the client doesn't ask for a supported one.
+const Default = "en"
+
+// catalog maps language and code to a format string. Every code must be in the Default language.
+var catalog = map[string]map[string]string{
+	"en": {
+		Shutdown:     config.ShutdownMessage,
+		QueueFull:    "The server is busy - please try again later",
+		FetchBusy:    "Timed out waiting to fetch - the server is busy, please try again later",
+		Unavailable:  "Upstream %s unavailable - please try again later",
+		Timeout:      "The request timed out",
+		Expired:      "The server was too busy to start the compile in time - please try again later",
+		AuthRequired: "The repository %s requires authentication - it may be private, or it may not exist",
+		TooMany:      "You have too many compiles in progress - please wait for one to finish",
+	},
+	"de": {
+		Shutdown:     "Der Server wird neu gestartet - bitte versuchen Sie es erneut",
+		QueueFull:    "Der Server ist ausgelastet - bitte versuchen Sie es später erneut",
+		FetchBusy:    "Zeitüberschreitung beim Herunterladen - der Server ist ausgelastet, bitte versuchen Sie es später erneut",
+		Unavailable:  "%s ist nicht erreichbar - bitte versuchen Sie es später erneut",
+		Timeout:      "Zeitüberschreitung der Anfrage",
+		Expired:      "Der Server war zu ausgelastet, um die Kompilierung rechtzeitig zu starten - bitte versuchen Sie es später erneut",
+		AuthRequired: "Das Repository %s erfordert eine Authentifizierung - es ist möglicherweise privat oder existiert nicht",
+		TooMany:      "Sie haben zu viele laufende Kompilierungen - bitte warten Sie, bis eine abgeschlossen ist",
+	},
+	"es": {
+		Shutdown:     "El servidor se está reiniciando - por favor, inténtelo de nuevo",
+		QueueFull:    "El servidor está ocupado - por favor, inténtelo más tarde",
+		FetchBusy:    "Tiempo de espera agotado para la descarga - el servidor está ocupado, por favor, inténtelo más tarde",
+		Unavailable:  "%s no está disponible - por favor, inténtelo más tarde",
+		Timeout:      "Se agotó el tiempo de espera de la solicitud",
+		Expired:      "El servidor estuvo demasiado ocupado para iniciar la compilación a tiempo - por favor, inténtelo más tarde",
+		AuthRequired: "El repositorio %s requiere autenticación - puede ser privado o puede que no exista",
+		TooMany:      "Tiene demasiadas compilaciones en curso - por favor, espere a que termine una",
+	},
+	"fr": {
+		Shutdown:     "Le serveur redémarre - veuillez réessayer",
+		QueueFull:    "Le serveur est occupé - veuillez réessayer plus tard",
+		FetchBusy:    "Délai d'attente du téléchargement dépassé - le serveur est occupé, veuillez réessayer plus tard",
+		Unavailable:  "%s est indisponible - veuillez réessayer plus tard",
+		Timeout:      "La requête a expiré",
+		Expired:      "Le serveur était trop occupé pour démarrer la compilation à temps - veuillez réessayer plus tard",
+		AuthRequired: "Le dépôt %s nécessite une authentification - il est peut-être privé, ou n'existe pas",
+		TooMany:      "Vous avez trop de compilations en cours - veuillez attendre qu'une se termine",
+	},
+}
+
+// Error is an error with a translatable message. Error() returns the message in the Default language.
+type Error struct {
+	Code string
+	Args []interface{}
+}
+
+func (e Error) Error() string {
+	return Text(Default, e.Code, e.Args...)
+}
+
+// Text returns the message for code in lang, falling back to the Default language.
+func Text(lang, code string, args ...interface{}) string {
+	format, ok := catalog[lang][code]
+	if !ok {
+		format = catalog[Default][code]
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Lang returns the supported language for the request: the lang parameter if it's supported, otherwise
+// the preferred supported language in the Accept-Language header, otherwise Default.
+func Lang(req *http.Request) string {
+	if lang := base(req.URL.Query().Get("lang")); catalog[lang] != nil {
+		return lang
+	}
+	type choice struct {
+		lang string
+		q    float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(req.Header.Get("Accept-Language"), ",") {
+		fields := strings.Split(part, ";")
+		c := choice{lang: base(fields[0]), q: 1}
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				q, err := strconv.ParseFloat(strings.TrimPrefix(f, "q="), 64)
+				if err != nil {
+					q = 0
+				}
+				c.q = q
+			}
+		}
+		if c.q > 0 && catalog[c.lang] != nil {
+			choices = append(choices, c)
+		}
+	}
+	if len(choices) == 0 {
+		return Default
+	}
+	// stable so languages with equal weights keep the client's order
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].q > choices[j].q })
+	return choices[0].lang
+}
+
+// base returns the primary language subtag, e.g. "de" for "de-CH".
+func base(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i > -1 {
+		tag = tag[:i]
+	}
+	return tag
+}
@@ -0,0 +1,43 @@
+package locale
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLang(t *testing.T) {
+	tests := []struct {
+		url, header, expected string
+	}{
+		{"/", "", "en"},
+		{"/", "de-CH,de;q=0.9,en;q=0.8", "de"},
+		{"/", "ja,fr;q=0.5,en;q=0.7", "en"},
+		{"/", "ja", "en"},
+		{"/", "fr;q=0,es", "es"},
+		{"/?lang=fr", "de", "fr"},
+		{"/?lang=xx", "es", "es"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.url, nil)
+		req.Header.Set("Accept-Language", test.header)
+		if found := Lang(req); found != test.expected {
+			t.Errorf("%s %q: expected %q, found %q", test.url, test.header, test.expected, found)
+		}
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	for lang, messages := range catalog {
+		for code := range messages {
+			if _, ok := catalog[Default][code]; !ok {
+				t.Errorf("%s: %s missing from default language", lang, code)
+			}
+		}
+	}
+	if found := Text("de", Unavailable, "github.com"); found != "github.com ist nicht erreichbar - bitte versuchen Sie es später erneut" {
+		t.Errorf("unexpected message %q", found)
+	}
+	if found := (Error{Code: Unavailable, Args: []interface{}{"github.com"}}).Error(); found != "Upstream github.com unavailable - please try again later" {
+		t.Errorf("unexpected message %q", found)
+	}
+}
@@ -0,0 +1,79 @@
+// Package lru is an in-memory cache that holds a bounded number of entries, each for a limited time. The
+// least recently used entry is evicted first.
+package lru
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache holds at most size entries, each for at most ttl.
+type Cache struct {
+	m       sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List // most recently used at the front
+	entries map[string]*list.Element
+}
+
+type entry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+// New returns a cache of size entries, each kept for ttl. A cache with size less than 1 holds nothing.
+func New(size int, ttl time.Duration) *Cache {
+	return &Cache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+// Get returns the value for key, if it's cached and hasn't expired.
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	en := e.Value.(*entry)
+	if time.Now().After(en.expires) {
+		c.order.Remove(e)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return en.value, true
+}
+
+// Add caches value for key, evicting the least recently used entry if the cache is full.
+func (c *Cache) Add(key string, value interface{}) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.size < 1 {
+		return
+	}
+	if e, ok := c.entries[key]; ok {
+		e.Value = &entry{key: key, value: value, expires: time.Now().Add(c.ttl)}
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&entry{key: key, value: value, expires: time.Now().Add(c.ttl)})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry).key)
+	}
+}
+
+// Len returns the number of entries, including any that have expired but haven't been evicted.
+func (c *Cache) Len() int {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.order.Len()
+}
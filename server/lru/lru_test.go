@@ -0,0 +1,32 @@
+package lru
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	c := New(2, time.Hour)
+	c.Add("a", "1")
+	c.Add("b", "2")
+	c.Get("a")
+	c.Add("c", "3") // evicts b, the least recently used
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("expected b to be evicted")
+	}
+	if v, ok := c.Get("a"); !ok || v != "1" {
+		t.Fatalf("expected a to be cached, found %v %v", v, ok)
+	}
+	if c.Len() != 2 {
+		t.Fatalf("expected 2 entries, found %d", c.Len())
+	}
+
+	c = New(2, -time.Second)
+	c.Add("a", "1")
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("expected a to be expired")
+	}
+	if c.Len() != 0 {
+		t.Fatal("expected the expired entry to be evicted")
+	}
+}
@@ -12,26 +12,34 @@ import (
 	"syscall"
 
 	"github.com/dave/jsgo/server"
+	"github.com/dave/jsgo/server/jsgo"
 )
 
 func main() {
 
 	var mainServer, dev1Server, dev2Server, dev3Server *http.Server
 
+	// Remove the working directories of compiles that were running when the server last crashed
+	if removed, err := jsgo.SweepWorkDirs(); err != nil {
+		log.Printf("Error sweeping working directories: %v\n", err)
+	} else if removed > 0 {
+		log.Printf("Removed %d orphaned working directories\n", removed)
+	}
+
 	shutdown := make(chan struct{})
 	handler := server.New(shutdown)
 
 	if config.DEV {
-		mainServer = &http.Server{Addr: ":8080", Handler: handler}
-		dev1Server = &http.Server{Addr: ":8081", Handler: handler}
-		dev2Server = &http.Server{Addr: ":8082", Handler: handler}
-		dev3Server = &http.Server{Addr: ":8083", Handler: handler}
+		mainServer = server.NewServer(":8080", handler)
+		dev1Server = server.NewServer(":8081", handler)
+		dev2Server = server.NewServer(":8082", handler)
+		dev3Server = server.NewServer(":8083", handler)
 	} else {
 		port := "8080"
 		if fromEnv := os.Getenv("PORT"); fromEnv != "" {
 			port = fromEnv
 		}
-		mainServer = &http.Server{Addr: ":" + port, Handler: handler}
+		mainServer = server.NewServer(":"+port, handler)
 	}
 
 	go func() {
@@ -77,8 +85,8 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), config.ServerShutdownTimeout)
 	defer cancel()
 
-	// Wait for all compile jobs to be cancelled
-	handler.Waitgroup.Wait()
+	// Wait for all compile jobs to be cancelled, and give downloads in progress a chance to finish
+	handler.Shutdown(ctx)
 
 	if err := mainServer.Shutdown(ctx); err != nil {
 		log.Printf("Error: %v\n", err)
@@ -0,0 +1,190 @@
+// Package memstore has an in-memory services.Fileserver and services.Database for tests.
+package memstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"sync"
+
+	"cloud.google.com/go/datastore"
+)
+
+// Fileserver stores files in memory by "<bucket>:<name>". It can delete files (see cleanup.Deleter),
+// and is safe for concurrent use.
+type Fileserver struct {
+	sync.Mutex
+	Files    map[string]string // contents
+	Types    map[string]string // content types
+	Writes   int               // number of files written
+	Fail     string            // writes and deletes of this name fail
+	ReadOnly bool              // like a wrapper of a fileserver that can't delete
+}
+
+// NewFileserver returns a fileserver holding files, by "<bucket>:<name>".
+func NewFileserver(files map[string]string) *Fileserver {
+	if files == nil {
+		files = map[string]string{}
+	}
+	return &Fileserver{Files: files, Types: map[string]string{}}
+}
+
+func (f *Fileserver) Exists(ctx context.Context, bucket, name string) (bool, error) {
+	f.Lock()
+	defer f.Unlock()
+	_, ok := f.Files[bucket+":"+name]
+	return ok, nil
+}
+
+func (f *Fileserver) Read(ctx context.Context, bucket, name string, writer io.Writer) (bool, error) {
+	f.Lock()
+	s, ok := f.Files[bucket+":"+name]
+	f.Unlock()
+	if !ok {
+		return false, nil
+	}
+	_, err := io.WriteString(writer, s)
+	return true, err
+}
+
+// Write writes a file. Like the real fileservers, an existing file is only replaced if overwrite is set.
+func (f *Fileserver) Write(ctx context.Context, bucket, name string, reader io.Reader, overwrite bool, contentType, cacheControl string) (bool, error) {
+	b, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return false, err
+	}
+	f.Lock()
+	defer f.Unlock()
+	if name == f.Fail {
+		return false, errors.New("write failed")
+	}
+	if _, ok := f.Files[bucket+":"+name]; ok && !overwrite {
+		return false, nil
+	}
+	f.Writes++
+	f.Files[bucket+":"+name] = string(b)
+	f.Types[bucket+":"+name] = contentType
+	return true, nil
+}
+
+// Delete deletes a file. Files that don't exist are already deleted.
+func (f *Fileserver) Delete(ctx context.Context, bucket, name string) error {
+	f.Lock()
+	defer f.Unlock()
+	if name == f.Fail {
+		return errors.New("delete failed")
+	}
+	delete(f.Files, bucket+":"+name)
+	delete(f.Types, bucket+":"+name)
+	return nil
+}
+
+func (f *Fileserver) CanDelete() bool {
+	return !f.ReadOnly
+}
+
+// Database stores copies of entities in memory by namespace, kind and name or ID, like the datastore, and
+// is safe for concurrent use. Incomplete keys (the logs) are given IDs. The queries are simplified:
+// GetAll returns the entities with named keys and the type of the elements of dst, in all namespaces,
+// ordered by key.
+type Database struct {
+	sync.Mutex
+	entities map[datastore.Key]interface{}
+	id       int64
+}
+
+// NewDatabase returns an empty database.
+func NewDatabase() *Database {
+	return &Database{entities: map[datastore.Key]interface{}{}}
+}
+
+// key returns the map key of k. Parent keys aren't used by the server.
+func key(k *datastore.Key) datastore.Key {
+	return datastore.Key{Kind: k.Kind, ID: k.ID, Name: k.Name, Namespace: k.Namespace}
+}
+
+func (d *Database) Get(ctx context.Context, k *datastore.Key, dst interface{}) error {
+	d.Lock()
+	defer d.Unlock()
+	src, ok := d.entities[key(k)]
+	if !ok {
+		return datastore.ErrNoSuchEntity
+	}
+	reflect.ValueOf(dst).Elem().Set(reflect.ValueOf(src).Elem())
+	return nil
+}
+
+func (d *Database) Put(ctx context.Context, k *datastore.Key, src interface{}) (*datastore.Key, error) {
+	v := reflect.New(reflect.TypeOf(src).Elem())
+	v.Elem().Set(reflect.ValueOf(src).Elem())
+	d.Lock()
+	defer d.Unlock()
+	if k.Name == "" && k.ID == 0 {
+		d.id++
+		c := *k
+		c.ID = d.id
+		k = &c
+	}
+	d.entities[key(k)] = v.Interface()
+	return k, nil
+}
+
+func (d *Database) GetAll(ctx context.Context, query *datastore.Query, dst interface{}) ([]*datastore.Key, error) {
+	d.Lock()
+	defer d.Unlock()
+	slice := reflect.ValueOf(dst).Elem()
+	var keys []*datastore.Key
+	for k, src := range d.entities {
+		if k.Name != "" && reflect.TypeOf(src).Elem() == slice.Type().Elem() {
+			k := k
+			keys = append(keys, &k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Namespace != keys[j].Namespace {
+			return keys[i].Namespace < keys[j].Namespace
+		}
+		if keys[i].Kind != keys[j].Kind {
+			return keys[i].Kind < keys[j].Kind
+		}
+		return keys[i].Name < keys[j].Name
+	})
+	for _, k := range keys {
+		slice.Set(reflect.Append(slice, reflect.ValueOf(d.entities[*k]).Elem()))
+	}
+	return keys, nil
+}
+
+func (d *Database) GetMulti(ctx context.Context, keys []*datastore.Key, dst interface{}) error {
+	slice := reflect.ValueOf(dst)
+	for i, k := range keys {
+		if err := d.Get(ctx, k, element(slice, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Database) PutMulti(ctx context.Context, keys []*datastore.Key, src interface{}) ([]*datastore.Key, error) {
+	slice := reflect.ValueOf(src)
+	var put []*datastore.Key
+	for i, k := range keys {
+		k, err := d.Put(ctx, k, element(slice, i))
+		if err != nil {
+			return nil, err
+		}
+		put = append(put, k)
+	}
+	return put, nil
+}
+
+// element returns a pointer to the i'th entity in a slice of entities or pointers to entities.
+func element(slice reflect.Value, i int) interface{} {
+	if v := slice.Index(i); v.Kind() == reflect.Ptr {
+		return v.Interface()
+	}
+	return slice.Index(i).Addr().Interface()
+}
@@ -0,0 +1,48 @@
+// Command main migrates the compiled artifacts of the server's storage (see server.NewStorage) to a
+// local fileserver, with the same build tags as the server. Run it again to resume an interrupted
+// migration (see migrate.Migrate):
+//
+//	go run -tags "dev" ./server/migrate/main -dir ~/jsgo-artifacts
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/dave/jsgo/server"
+	"github.com/dave/jsgo/server/migrate"
+)
+
+func main() {
+	dir := flag.String("dir", "", "directory of the destination local fileserver")
+	name := flag.String("name", "", "name of the destination, which migrated builds are recorded against (defaults to local:<dir>)")
+	concurrency := flag.Int("concurrency", 0, "number of builds copied at once (defaults to config.ConcurrentStorageUploads)")
+	flag.Parse()
+
+	if *dir == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *name == "" {
+		*name = "local:" + *dir
+	}
+
+	ctx := context.Background()
+	storage, err := server.NewStorage(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	summary, err := migrate.Migrate(ctx, storage.Fileserver, server.NewLocalFileserver(*dir), storage.Database, migrate.Options{
+		Destination: *name,
+		Concurrency: *concurrency,
+		Progress:    os.Stdout,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(summary.Errors) > 0 {
+		os.Exit(1)
+	}
+}
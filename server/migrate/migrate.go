@@ -0,0 +1,357 @@
+// Package migrate copies the compiled artifacts from one fileserver to another, for moving to a
+// different storage backend (e.g. from GCS to a local fileserver, or to another provider). The files
+// of every build recorded in the database (see store.BuildData) are copied to the same names, and their
+// sha256 hashes are verified. The builds of tenants are migrated from their namespaces (see tenant.Each).
+// If the source can list its buckets (see Lister), the other files in the pkg and index buckets are
+// copied too: index pages, docs, manifests, ES modules, wasm and the files of builds from before builds
+// were recorded. Job logs and the git cache aren't migrated. The database only refers to files by name,
+// so it doesn't need to change when the backend does.
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/store"
+	"github.com/dave/jsgo/server/tenant"
+	"github.com/dave/services"
+	"github.com/dave/services/constor"
+)
+
+// Lister is implemented by fileservers that can list the files in a bucket.
+type Lister interface {
+	List(ctx context.Context, bucket string) ([]File, error)
+}
+
+// File is a file listed by a Lister.
+type File struct {
+	Name         string
+	ContentType  string // empty if the fileserver doesn't record it (see contentType)
+	CacheControl string // empty if the fileserver doesn't record it (see cacheControl)
+}
+
+// Options configures a migration.
+type Options struct {
+	// Destination names the destination fileserver. Migrated builds are recorded against it, so a
+	// migration that's interrupted skips the builds already copied when it's run again.
+	Destination string
+
+	// Bucket is the bucket of the files in the destination. Defaults to the pkg bucket.
+	Bucket string
+
+	// Concurrency is the number of builds copied at once. Defaults to config.ConcurrentStorageUploads.
+	Concurrency int
+
+	// Progress receives a line for each build, and the summary. Optional.
+	Progress io.Writer
+}
+
+// Summary is the outcome of a migration.
+type Summary struct {
+	Builds   int   // builds in the database
+	Skipped  int   // builds already migrated by an earlier run
+	Migrated int   // builds migrated by this run
+	Failed   int   // builds with a file that couldn't be migrated
+	Copied   int   // files copied
+	Existing int   // files already in the destination with the right contents
+	Bytes    int64 // bytes copied
+	Listed   int   // files copied that no build records, found by listing the buckets (see Lister)
+	Errors   []string
+}
+
+func (s Summary) String() string {
+	return fmt.Sprintf("%d builds: %d migrated, %d already migrated, %d failed. %d files (%d bytes) copied, %d already there, %d not in a build.", s.Builds, s.Migrated, s.Skipped, s.Failed, s.Copied, s.Bytes, s.Existing, s.Listed)
+}
+
+// Migrate copies the files of every build from source to destination. It's idempotent: files that
+// are already in the destination with the right hash aren't copied again, and builds migrated by an
+// earlier run are skipped. A build is only recorded as migrated when all its files have been copied,
+// so the failures of one run are retried by the next. An error is only returned if the builds can't be
+// listed or ctx is done - other failures are counted in the summary.
+func Migrate(ctx context.Context, source, destination services.Fileserver, database services.Database, options Options) (Summary, error) {
+	if options.Destination == "" {
+		return Summary{}, fmt.Errorf("the destination must be named")
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = config.ConcurrentStorageUploads
+	}
+	if options.Progress == nil {
+		options.Progress = ioutil.Discard
+	}
+	m := &migration{
+		options: options,
+		from:    config.Bucket[config.Pkg],
+		to:      options.Bucket,
+	}
+	if m.to == "" {
+		m.to = m.from
+	}
+
+	// The builds of each tenant are in its namespace, with their files under its prefix in both
+	// fileservers.
+	err := tenant.Each(source, database, func(namespace string, source services.Fileserver, database services.Database) error {
+		m.source, m.destination, m.database = source, destination, database
+		if namespace != "" {
+			m.destination = tenant.NewFileserver(destination, namespace)
+		}
+		m.done = map[string]bool{}
+		return m.run(ctx)
+	})
+	if err != nil {
+		return m.summary, err
+	}
+
+	if lister, ok := source.(Lister); ok {
+		for _, bucket := range []string{config.Bucket[config.Pkg], config.Bucket[config.Index]} {
+			if err := m.bucket(ctx, lister, source, destination, bucket); err != nil {
+				return m.summary, err
+			}
+		}
+	} else {
+		fmt.Fprintln(options.Progress, "The source can't list its buckets, so only the files of builds were copied.")
+	}
+
+	fmt.Fprintln(options.Progress, m.summary)
+	return m.summary, ctx.Err()
+}
+
+// run migrates the builds in m.database.
+func (m *migration) run(ctx context.Context) error {
+	ids, builds, err := store.Builds(ctx, m.database)
+	if err != nil {
+		return err
+	}
+	m.summary.Builds += len(ids)
+	m.each(ctx, len(ids), func(i int) { m.build(ctx, ids[i], builds[i]) })
+	return ctx.Err()
+}
+
+// bucket copies the files in a bucket of the source that aren't in the destination. Files of builds
+// have already been copied and verified, and other files have no recorded hash, so files that are
+// already in the destination aren't read.
+func (m *migration) bucket(ctx context.Context, lister Lister, source, destination services.Fileserver, bucket string) error {
+	files, err := lister.List(ctx, bucket)
+	if err != nil {
+		return fmt.Errorf("listing %s: %v", bucket, err)
+	}
+	to := bucket
+	if bucket == m.from {
+		to = m.to
+	}
+	m.each(ctx, len(files), func(i int) {
+		if err := m.listed(ctx, source, destination, bucket, to, files[i]); err != nil {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			m.error(fmt.Sprintf("%s/%s: %v", bucket, files[i].Name, err))
+		}
+	})
+	return ctx.Err()
+}
+
+func (m *migration) listed(ctx context.Context, source, destination services.Fileserver, from, to string, f File) error {
+	exists, err := destination.Exists(ctx, to, f.Name)
+	if err != nil || exists {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	found, err := source.Read(ctx, from, f.Name, buf)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return nil // deleted since it was listed
+	}
+	if f.ContentType == "" {
+		f.ContentType = contentType(from, f.Name)
+	}
+	if f.CacheControl == "" {
+		f.CacheControl = cacheControl(from)
+	}
+	size := int64(buf.Len())
+	if _, err := destination.Write(ctx, to, f.Name, buf, false, f.ContentType, f.CacheControl); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.summary.Copied++
+	m.summary.Listed++
+	m.summary.Bytes += size
+	return nil
+}
+
+// each calls f for 0 to n-1 with m.options.Concurrency at once, until ctx is done.
+func (m *migration) each(ctx context.Context, n int, f func(i int)) {
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < m.options.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				f(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		if ctx.Err() != nil {
+			break
+		}
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+}
+
+type migration struct {
+	source, destination services.Fileserver
+	database            services.Database
+	options             Options
+	from, to            string // buckets
+
+	mu      sync.Mutex
+	summary Summary
+	done    map[string]bool // files copied or verified by this run - builds share many files
+}
+
+// build migrates the files of a build, and records it as migrated if they were all copied.
+func (m *migration) build(ctx context.Context, id string, build store.BuildData) {
+	migrated, err := store.Migrated(ctx, m.database, m.options.Destination, id)
+	if err != nil {
+		m.fail(id, err)
+		return
+	}
+	if migrated {
+		m.mu.Lock()
+		m.summary.Skipped++
+		m.mu.Unlock()
+		return
+	}
+	for _, f := range build.Files {
+		if err := m.file(ctx, f); err != nil {
+			m.fail(id, err)
+			return
+		}
+	}
+	if err := store.StoreMigration(ctx, m.database, m.options.Destination, id, store.MigrationData{Time: time.Now(), Files: len(build.Files)}); err != nil {
+		m.fail(id, err)
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.summary.Migrated++
+	fmt.Fprintf(m.options.Progress, "%s (%s): %d files\n", id, build.Path, len(build.Files))
+}
+
+// file copies a file to the destination, unless it's already there with the right contents. The
+// contents are checked against the hash of the file in the build.
+func (m *migration) file(ctx context.Context, f store.BuildFile) error {
+	m.mu.Lock()
+	done := m.done[f.Name]
+	m.mu.Unlock()
+	if done {
+		return nil
+	}
+
+	// A file in the destination with the wrong contents (e.g. from an interrupted write) is replaced.
+	exists, err := m.destination.Exists(ctx, m.to, f.Name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		buf := &bytes.Buffer{}
+		if _, err := m.destination.Read(ctx, m.to, f.Name, buf); err != nil {
+			return err
+		}
+		if hash(buf.Bytes()) == f.Hash {
+			m.finish(f.Name, false, 0)
+			return nil
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	found, err := m.source.Read(ctx, m.from, f.Name, buf)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%s not found in the source", f.Name)
+	}
+	if found := hash(buf.Bytes()); found != f.Hash {
+		return fmt.Errorf("%s has hash %s in the source, expected %s", f.Name, found, f.Hash)
+	}
+	size := int64(buf.Len())
+	if _, err := m.destination.Write(ctx, m.to, f.Name, buf, exists, contentType(m.from, f.Name), cacheControl(m.from)); err != nil {
+		return err
+	}
+	m.finish(f.Name, true, size)
+	return nil
+}
+
+func (m *migration) finish(name string, copied bool, size int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.done[name] {
+		return
+	}
+	m.done[name] = true
+	if copied {
+		m.summary.Copied++
+		m.summary.Bytes += size
+	} else {
+		m.summary.Existing++
+	}
+}
+
+func (m *migration) fail(id string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.summary.Failed++
+	m.error(fmt.Sprintf("%s: %v", id, err))
+}
+
+// error records an error in the summary. m.mu must be held.
+func (m *migration) error(message string) {
+	m.summary.Errors = append(m.summary.Errors, message)
+	fmt.Fprintln(m.options.Progress, message)
+}
+
+// contentType returns the content type that a file was stored with, from its name. The pages in the
+// index bucket have no extension.
+func contentType(bucket, name string) string {
+	if bucket == config.Bucket[config.Index] {
+		return constor.MimeHtml
+	}
+	switch path.Ext(name) {
+	case ".js":
+		return constor.MimeJs
+	case ".json":
+		return constor.MimeJson
+	case ".html":
+		return constor.MimeHtml
+	case ".wasm":
+		return constor.MimeWasm
+	}
+	return constor.MimeBin
+}
+
+// cacheControl returns the cache control of the files in a bucket. The files in the pkg bucket are
+// named by their contents, but the pages at a package path in the index bucket are replaced by later
+// builds.
+func cacheControl(bucket string) string {
+	if bucket == config.Bucket[config.Index] {
+		return "no-cache"
+	}
+	return "public,max-age=31536000,immutable"
+}
+
+func hash(b []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(b))
+}
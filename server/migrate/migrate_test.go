@@ -0,0 +1,149 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/memstore"
+	"github.com/dave/jsgo/server/store"
+)
+
+// memLister is a memstore.Fileserver that can list its buckets.
+type memLister struct {
+	*memstore.Fileserver
+}
+
+func (m memLister) List(ctx context.Context, bucket string) ([]File, error) {
+	m.Lock()
+	defer m.Unlock()
+	var files []File
+	for name := range m.Files {
+		if strings.HasPrefix(name, bucket+":") {
+			files = append(files, File{Name: strings.TrimPrefix(name, bucket+":")})
+		}
+	}
+	return files, nil
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	bucket := config.Bucket[config.Pkg]
+	source := memstore.NewFileserver(nil)
+	db := memstore.NewDatabase()
+	file := func(name, contents string) store.BuildFile {
+		source.Files[bucket+":"+name] = contents
+		return store.BuildFile{Name: name, Size: int64(len(contents)), Hash: fmt.Sprintf("%x", sha256.Sum256([]byte(contents)))}
+	}
+	fmtFile := file("fmt.1.js", "fmt") // shared by both builds
+	store.StoreBuild(ctx, db, "a1", store.BuildData{Path: "github.com/a", Files: []store.BuildFile{fmtFile, file("github.com/a.a1.js", "a")}})
+	store.StoreBuild(ctx, db, "b1", store.BuildData{Path: "github.com/b", Files: []store.BuildFile{fmtFile, file("github.com/b.b1.js", "b")}})
+
+	// the destination already has one file, and a corrupt copy of another (an interrupted write)
+	destination := memstore.NewFileserver(map[string]string{
+		bucket + ":github.com/a.a1.js": "a",
+		bucket + ":github.com/b.b1.js": "corrupt",
+	})
+	destination.Fail = "fmt.1.js"
+
+	// The first run fails to write the shared file, so neither build is migrated.
+	progress := &bytes.Buffer{}
+	summary, err := Migrate(ctx, source, destination, db, Options{Destination: "mem", Concurrency: 2, Progress: progress})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Builds != 2 || summary.Failed != 2 || summary.Migrated != 0 || len(summary.Errors) != 2 {
+		t.Fatalf("unexpected summary %#v", summary)
+	}
+	if !strings.Contains(progress.String(), "write failed") || !strings.Contains(progress.String(), "2 failed") {
+		t.Fatalf("unexpected progress:\n%s", progress)
+	}
+
+	// The second run resumes: the files are copied and verified, and the corrupt file is replaced.
+	destination.Fail = ""
+	summary, err = Migrate(ctx, source, destination, db, Options{Destination: "mem", Concurrency: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Migrated != 2 || summary.Failed != 0 || summary.Copied != 2 || summary.Existing != 1 || summary.Bytes != 4 {
+		t.Fatalf("unexpected summary %#v", summary)
+	}
+	for name, contents := range source.Files {
+		if destination.Files[name] != contents {
+			t.Fatalf("expected %s to be %q in the destination, found %q", name, contents, destination.Files[name])
+		}
+	}
+
+	// Running again does nothing.
+	writes := destination.Writes
+	summary, err = Migrate(ctx, source, destination, db, Options{Destination: "mem"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Skipped != 2 || summary.Migrated != 0 || destination.Writes != writes {
+		t.Fatalf("expected the migrated builds to be skipped, found %#v", summary)
+	}
+
+	// A file that doesn't match its hash in the source isn't copied.
+	source.Files[bucket+":github.com/c.c1.js"] = "changed"
+	store.StoreBuild(ctx, db, "c1", store.BuildData{Path: "github.com/c", Files: []store.BuildFile{{Name: "github.com/c.c1.js", Hash: "0123"}}})
+	summary, err = Migrate(ctx, source, destination, db, Options{Destination: "mem"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Failed != 1 || !strings.Contains(summary.Errors[0], "expected 0123") {
+		t.Fatalf("expected a hash mismatch, found %#v", summary)
+	}
+	if _, ok := destination.Files[bucket+":github.com/c.c1.js"]; ok {
+		t.Fatal("expected the file not to be copied")
+	}
+}
+
+func TestMigrateListed(t *testing.T) {
+	ctx := context.Background()
+	pkg, index := config.Bucket[config.Pkg], config.Bucket[config.Index]
+	source := memstore.NewFileserver(map[string]string{
+		pkg + ":github.com/a.a1.js":            "a",
+		pkg + ":github.com/a.docs.html":        "docs",
+		pkg + ":github.com/a.a1.manifest.json": "{}",
+		pkg + ":github.com/a.w1.wasm":          "wasm",
+		index + ":github.com/a":                "page",
+		index + ":tenants/acme/abc/index.html": "tenant page",
+	})
+	db := memstore.NewDatabase()
+	store.StoreBuild(ctx, db, "a1", store.BuildData{Path: "github.com/a", Files: []store.BuildFile{{Name: "github.com/a.a1.js", Hash: fmt.Sprintf("%x", sha256.Sum256([]byte("a")))}}})
+
+	// Without listing, only the files of builds are copied.
+	destination := memstore.NewFileserver(nil)
+	if _, err := Migrate(ctx, source, destination, db, Options{Destination: "mem"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(destination.Files) != 1 {
+		t.Fatalf("expected only the build's file, found %v", destination.Files)
+	}
+
+	destination = memstore.NewFileserver(nil)
+	summary, err := Migrate(ctx, memLister{source}, destination, db, Options{Destination: "mem2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Copied != 6 || summary.Listed != 5 || len(summary.Errors) != 0 {
+		t.Fatalf("unexpected summary %#v", summary)
+	}
+	expected := map[string]string{
+		pkg + ":github.com/a.a1.js":            "application/javascript",
+		pkg + ":github.com/a.docs.html":        "text/html",
+		pkg + ":github.com/a.a1.manifest.json": "application/json",
+		pkg + ":github.com/a.w1.wasm":          "application/wasm",
+		index + ":github.com/a":                "text/html",
+		index + ":tenants/acme/abc/index.html": "text/html",
+	}
+	if !reflect.DeepEqual(destination.Types, expected) {
+		t.Fatalf("expected content types %v, found %v", expected, destination.Types)
+	}
+}
@@ -0,0 +1,126 @@
+// Package mirror fetches repos from a local directory of mirrored repos before fetching from the
+// network, for air-gapped deployments. The mirror has a directory for each repo at its import path
+// root, e.g. <root>/github.com/foo/bar.
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dave/services"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+// New returns a fetcher that fetches repos from the mirror at root, and repos that aren't in the mirror
+// with next. If root is empty, next is returned. If next is nil, repos that aren't in the mirror fail.
+func New(root string, next services.Fetcher) services.Fetcher {
+	if root == "" {
+		return next
+	}
+	return &Fetcher{Root: root, Next: next}
+}
+
+type Fetcher struct {
+	Root string
+	Next services.Fetcher
+}
+
+func (f *Fetcher) Fetch(ctx context.Context, repo string) (billy.Filesystem, error) {
+	dir, err := f.dir(repo)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		if f.Next == nil {
+			return nil, fmt.Errorf("%s not found in mirror", repo)
+		}
+		return f.Next.Fetch(ctx, repo)
+	}
+	fs := memfs.New()
+	if err := copyDir(ctx, fs, "/", dir); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// dir returns the mirror directory for a repo url. Urls that would resolve outside the mirror root are
+// rejected.
+func (f *Fetcher) dir(repo string) (string, error) {
+	u, err := url.Parse(repo)
+	if err != nil {
+		return "", err
+	}
+	p := strings.TrimSuffix(u.Host+u.Path, ".git")
+	if u.Host == "" || strings.Contains(p, "\\") || path.Clean(p) != p || strings.Contains("/"+p+"/", "/../") {
+		return "", fmt.Errorf("invalid repo url %q", repo)
+	}
+	root, err := filepath.Abs(f.Root)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(root, filepath.FromSlash(p))
+	if rel, err := filepath.Rel(root, dir); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("invalid repo url %q", repo)
+	}
+	return dir, nil
+}
+
+// copyDir copies the files in the os directory src to dst in fs, excluding .git directories. Symlinks
+// aren't followed, so they can't point outside the mirror.
+func copyDir(ctx context.Context, fs billy.Filesystem, dst, src string) error {
+	infos, err := readDir(src)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		name := info.Name()
+		switch {
+		case info.IsDir():
+			if name == ".git" {
+				continue
+			}
+			if err := copyDir(ctx, fs, path.Join(dst, name), filepath.Join(src, name)); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			if err := copyFile(fs, path.Join(dst, name), filepath.Join(src, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func readDir(dir string) ([]os.FileInfo, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdir(-1)
+}
+
+func copyFile(fs billy.Filesystem, dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := fs.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	return err
+}
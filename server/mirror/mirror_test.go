@@ -0,0 +1,76 @@
+package mirror
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/src-d/go-billy.v4"
+)
+
+type next struct{ fetched string }
+
+func (n *next) Fetch(ctx context.Context, url string) (billy.Filesystem, error) {
+	n.fetched = url
+	return nil, nil
+}
+
+func TestMirror(t *testing.T) {
+	root, err := ioutil.TempDir("", "mirror")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	repo := filepath.Join(root, "github.com", "foo", "bar")
+	for name, contents := range map[string]string{
+		"main.go":     "package main",
+		"sub/a.go":    "package sub",
+		".git/config": "[core]",
+	} {
+		name = filepath.Join(repo, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(name), 0700)
+		if err := ioutil.WriteFile(name, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ioutil.WriteFile(filepath.Join(root, "secret"), []byte("secret"), 0600)
+
+	n := &next{}
+	f := New(root, n)
+
+	fs, err := f.Fetch(context.Background(), "https://github.com/foo/bar.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := fs.Open("sub/a.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(file)
+	if string(b) != "package sub" {
+		t.Fatalf("unexpected contents %q", b)
+	}
+	if _, err := fs.Stat(".git"); err == nil {
+		t.Fatal(".git should be excluded")
+	}
+	if n.fetched != "" {
+		t.Fatal("mirrored repo shouldn't be fetched")
+	}
+
+	// Repos that aren't in the mirror are fetched from the network.
+	if _, err := f.Fetch(context.Background(), "https://github.com/foo/baz"); err != nil || n.fetched != "https://github.com/foo/baz" {
+		t.Fatalf("expected fallback fetch, found %q, %v", n.fetched, err)
+	}
+
+	for _, url := range []string{"https://github.com/../../etc", "https://github.com/foo/../../secret", "https://github.com/a\\..\\..", "file:///etc/passwd"} {
+		if _, err := f.Fetch(context.Background(), url); err == nil {
+			t.Errorf("%s: expected error", url)
+		}
+	}
+
+	if New("", n) != n {
+		t.Fatal("expected next when the mirror isn't configured")
+	}
+}
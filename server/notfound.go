@@ -0,0 +1,46 @@
+package server
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// notFound writes a 404 response. Browsers (that accept text/html) get an HTML page, and other clients
+// get a JSON body.
+func notFound(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if strings.Contains(req.Header.Get("Accept"), "text/html") {
+		setSecurityHeaders(w.Header())
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		notFoundTemplate.Execute(w, req.URL.Path)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{
+		Error: "not found",
+	})
+}
+
+var notFoundTemplate = template.Must(template.New("notfound").Parse(`<!doctype html>
+<html lang="en">
+	<head>
+		<meta charset="utf-8">
+		<title>Not found - jsgo</title>
+		<style>
+			body { font-family: sans-serif; text-align: center; margin-top: 10%; color: #333; }
+			a { color: #007bff; }
+		</style>
+	</head>
+	<body>
+		<h1>404</h1>
+		<p><code>{{ . }}</code> was not found.</p>
+		<p><a href="https://github.com/dave/jsgo">jsgo</a></p>
+	</body>
+</html>
+`))
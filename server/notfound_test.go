@@ -0,0 +1,32 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNotFound(t *testing.T) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/missing<script>", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	notFound(w, req)
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Fatalf("unexpected response: %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), "/missing&lt;script&gt;") {
+		t.Fatalf("expected escaped path in body: %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/missing", nil)
+	req.Header.Set("Accept", "application/json")
+	notFound(w, req)
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected response: %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if strings.TrimSpace(w.Body.String()) != `{"error":"not found"}` {
+		t.Fatalf("unexpected body: %s", w.Body.String())
+	}
+}
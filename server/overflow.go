@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/locale"
+	"github.com/dave/jsgo/server/queue"
+	"github.com/dave/jsgo/server/store"
+	"github.com/dave/services"
+)
+
+// OverflowQueue persists the async compiles that don't fit in the compile queue (see AsyncHandler), so
+// they're not held in memory and survive a restart. Pop returns the oldest job, and found is false if
+// there are none.
+type OverflowQueue interface {
+	Push(ctx context.Context, job store.OverflowJob) error
+	Pop(ctx context.Context) (job store.OverflowJob, found bool, err error)
+}
+
+// datastoreOverflow is the OverflowQueue in the database. It's shared by all the servers.
+type datastoreOverflow struct {
+	database services.Database
+	client   *datastore.Client
+}
+
+func (o *datastoreOverflow) Push(ctx context.Context, job store.OverflowJob) error {
+	return store.StoreOverflow(ctx, o.database, job)
+}
+
+func (o *datastoreOverflow) Pop(ctx context.Context) (store.OverflowJob, bool, error) {
+	return store.NextOverflow(ctx, o.client)
+}
+
+// drainOverflow starts jobs from the overflow queue when the compile queue has room, every
+// config.OverflowDrainPeriod until shutdown.
+func (h *Handler) drainOverflow(shutdown chan struct{}) {
+	ticker := time.NewTicker(config.OverflowDrainPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.drain()
+		case <-shutdown:
+			return
+		}
+	}
+}
+
+// drain starts jobs from the overflow queue, oldest first, until the compile queue is full or there are
+// no more. Jobs past their deadline are dropped.
+func (h *Handler) drain() {
+	ctx, cancel := context.WithTimeout(context.Background(), config.PageTimeout)
+	defer cancel()
+	for !h.Queue.Full() {
+		job, found, err := h.Overflow.Pop(ctx)
+		if err != nil {
+			log.Printf("Reading the overflow queue: %v", err)
+			return
+		}
+		if !found {
+			return
+		}
+		if time.Now().After(job.Deadline) {
+			h.failAsync(job, locale.Error{Code: locale.Expired})
+			continue
+		}
+		if err := h.startAsync(job); err != nil {
+			if err != queue.TooManyItemsQueued {
+				h.failAsync(job, err)
+				continue
+			}
+			// The queue filled up since it was checked, so the job goes back. It keeps its place, because
+			// the queue is ordered by the submit time.
+			if err := h.Overflow.Push(ctx, job); err != nil {
+				log.Printf("Returning job %s to the overflow queue: %v", job.Id, err)
+				h.failAsync(job, err)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/locale"
+	"github.com/dave/jsgo/server/memstore"
+	"github.com/dave/jsgo/server/progress"
+	"github.com/dave/jsgo/server/queue"
+	"github.com/dave/jsgo/server/store"
+)
+
+// memOverflow is an OverflowQueue in memory.
+type memOverflow struct {
+	m    sync.Mutex
+	jobs []store.OverflowJob
+}
+
+func (o *memOverflow) Push(ctx context.Context, job store.OverflowJob) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+	o.jobs = append(o.jobs, job)
+	sort.Slice(o.jobs, func(i, j int) bool { return o.jobs[i].Time.Before(o.jobs[j].Time) })
+	return nil
+}
+
+func (o *memOverflow) Pop(ctx context.Context) (store.OverflowJob, bool, error) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	if len(o.jobs) == 0 {
+		return store.OverflowJob{}, false, nil
+	}
+	job := o.jobs[0]
+	o.jobs = o.jobs[1:]
+	return job, true, nil
+}
+
+func (o *memOverflow) len() int {
+	o.m.Lock()
+	defer o.m.Unlock()
+	return len(o.jobs)
+}
+
+// overflowHandler returns a handler with a queue of one running and one waiting job, and a function
+// that fills it.
+func overflowHandler(overflow OverflowQueue) (h *Handler, fill func(t *testing.T) (running, waiting chan struct{})) {
+	h = &Handler{
+		Queue:      queue.New(1, 1, 0),
+		Waitgroup:  &sync.WaitGroup{},
+		Fileserver: memstore.NewFileserver(nil),
+		Database:   memstore.NewDatabase(),
+		Progress:   progress.New(config.ProgressHistory),
+		Overflow:   overflow,
+		shutdown:   make(chan struct{}),
+	}
+	fill = func(t *testing.T) (running, waiting chan struct{}) {
+		var ends []chan struct{}
+		for i := 0; i < 2; i++ {
+			_, end, err := h.Queue.Slot("other", queue.Interactive, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ends = append(ends, end)
+		}
+		return ends[0], ends[1]
+	}
+	return h, fill
+}
+
+func submitAsync(h *Handler, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.AsyncHandler(w, httptest.NewRequest("POST", "/_api/compile", strings.NewReader(body)))
+	return w
+}
+
+func TestAsyncOverflowSpillAndDrain(t *testing.T) {
+	overflow := &memOverflow{}
+	h, fill := overflowHandler(overflow)
+	running, waiting := fill(t)
+	defer close(running)
+
+	w := submitAsync(h, `{"Path": "github.com/foo/bar"}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, found %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Id       string
+		Overflow bool
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if !response.Overflow || overflow.len() != 1 || overflow.jobs[0].Id != response.Id {
+		t.Fatalf("expected the job to spill to the overflow queue, found %+v and %d jobs", response, overflow.len())
+	}
+	var info struct{ Path string }
+	if err := json.Unmarshal(overflow.jobs[0].Message, &info); err != nil || info.Path != "github.com/foo/bar" {
+		t.Fatalf("expected the compile message to be kept, found %q (%v)", overflow.jobs[0].Message, err)
+	}
+
+	// While the queue is full, the job stays in the overflow queue.
+	h.drain()
+	if overflow.len() != 1 {
+		t.Fatal("expected the job to stay in the overflow queue while the queue is full")
+	}
+
+	// When the waiting job gives up, there's room for the overflow job.
+	close(waiting)
+	deadline := time.Now().Add(time.Second * 5)
+	for h.Queue.Full() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the queue")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	h.drain()
+	if _, waiting := h.Queue.Stats(); overflow.len() != 0 || waiting != 1 {
+		t.Fatalf("expected the job to move to the compile queue, found %d in the overflow queue and %d waiting", overflow.len(), waiting)
+	}
+
+	// If the server shuts down before the job starts, it goes back to the overflow queue.
+	close(h.shutdown)
+	h.Waitgroup.Wait()
+	if overflow.len() != 1 || overflow.jobs[0].Id != response.Id {
+		t.Fatalf("expected the job to return to the overflow queue, found %d jobs", overflow.len())
+	}
+}
+
+func TestAsyncOverflowDisabled(t *testing.T) {
+	h, fill := overflowHandler(nil)
+	running, waiting := fill(t)
+	defer close(running)
+	defer close(waiting)
+
+	if w := submitAsync(h, `{"Path": "github.com/foo/bar"}`); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 without an overflow queue, found %d", w.Code)
+	}
+	if w := submitAsync(h, `{}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a path, found %d", w.Code)
+	}
+}
+
+func TestAsyncOverflowExpired(t *testing.T) {
+	overflow := &memOverflow{}
+	h, _ := overflowHandler(overflow)
+	overflow.Push(context.Background(), store.OverflowJob{
+		Id:       "0123456789abcdef0123456789abcdef",
+		Time:     time.Now().Add(-time.Hour),
+		Deadline: time.Now().Add(-time.Minute),
+		Lang:     locale.Default,
+		Message:  []byte(`{"Path": "github.com/foo/bar"}`),
+	})
+
+	h.drain()
+	if _, waiting := h.Queue.Stats(); overflow.len() != 0 || waiting != 0 {
+		t.Fatalf("expected the expired job to be dropped, found %d in the overflow queue and %d waiting", overflow.len(), waiting)
+	}
+	log := h.Fileserver.(*memstore.Fileserver).Files[config.Bucket[config.Git]+":"+jobLogName("0123456789abcdef0123456789abcdef")]
+	if !strings.Contains(log, `"Code":"`+locale.Expired+`"`) {
+		t.Fatalf("expected the expired error in the job log, found %q", log)
+	}
+}
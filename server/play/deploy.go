@@ -11,6 +11,7 @@ import (
 	"github.com/dave/jsgo/assets"
 	"github.com/dave/jsgo/assets/std"
 	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/clientip"
 	"github.com/dave/jsgo/server/play/messages"
 	"github.com/dave/jsgo/server/store"
 	"github.com/dave/services"
@@ -76,8 +77,9 @@ func (h *Handler) Deploy(ctx context.Context, info messages.Deploy, req *http.Re
 	// Send a message to the client that the process has successfully finished
 	// TODO: make minify configurable
 	send(messages.DeployComplete{
-		Main:  fmt.Sprintf("%x", output[true].MainHash),
-		Index: fmt.Sprintf("%x", output[true].IndexHash),
+		Main:    fmt.Sprintf("%x", output[true].MainHash),
+		Index:   fmt.Sprintf("%x", output[true].IndexHash),
+		BuildId: fmt.Sprintf("%x", output[true].MainHash),
 	})
 
 	return nil
@@ -88,7 +90,7 @@ func (h *Handler) storeDeploy(ctx context.Context, send func(services.Message),
 		Time:     time.Now(),
 		Contents: getDeployContents(output, min),
 		Minify:   min, // TODO: make this configurable
-		Ip:       req.Header.Get("X-Forwarded-For"),
+		Ip:       clientip.Get(req),
 	}
 	if err := store.StoreDeploy(ctx, h.Database, data); err != nil {
 		return err
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"reflect"
 
+	"github.com/dave/jsgo/server/decode"
 	"github.com/dave/jsgo/server/servermsg"
 	"github.com/dave/services"
 	"github.com/dave/services/builder/buildermsg"
@@ -17,6 +18,7 @@ import (
 var payloads = []interface{}{
 
 	// Progress messages:
+	servermsg.Job{},
 	servermsg.Queueing{},
 	gettermsg.Downloading{},
 
@@ -41,8 +43,9 @@ var payloads = []interface{}{
 }
 
 type DeployComplete struct {
-	Main  string
-	Index string
+	Main    string
+	Index   string
+	BuildId string // the hash of the main package file
 }
 
 // Update is sent by the client to the server asking it to compile the source and return the archive
@@ -106,7 +109,7 @@ func Unmarshal(in []byte) (services.Message, error) {
 		Type    string
 		Message json.RawMessage
 	}
-	if err := json.Unmarshal(in, &m); err != nil {
+	if err := decode.Json(in, &m, "Type", "Message"); err != nil {
 		return nil, err
 	}
 	typ, ok := payloadTypes[m.Type]
@@ -114,7 +117,7 @@ func Unmarshal(in []byte) (services.Message, error) {
 		return nil, fmt.Errorf("type not found: %s, %#v", m.Type, m)
 	}
 	pointer := reflect.New(typ)
-	if err := json.Unmarshal(m.Message, pointer.Interface()); err != nil {
+	if err := decode.Json(m.Message, pointer.Interface()); err != nil {
 		return nil, err
 	}
 	return pointer.Elem().Interface(), nil
@@ -13,6 +13,7 @@ import (
 
 	"cloud.google.com/go/storage"
 	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/clientip"
 	"github.com/dave/jsgo/server/play/messages"
 	"github.com/dave/jsgo/server/store"
 	"github.com/dave/play/models"
@@ -80,7 +81,7 @@ func (h *Handler) storeShare(ctx context.Context, source map[string]map[string]s
 	}
 	data := store.ShareData{
 		Time:  time.Now(),
-		Ip:    req.Header.Get("X-Forwarded-For"),
+		Ip:    clientip.Get(req),
 		Files: count,
 		Hash:  hash,
 	}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/dave/jsgo/server/cleanup"
+	"github.com/dave/services"
+)
+
+// PrefixFileserver adds a prefix to the names of files in one bucket (see config.ArtifactPrefix). Reads
+// that aren't found with the prefix fall back to the fallback prefix. Exists doesn't fall back, because
+// it's used to decide whether a file needs to be written - a file that only exists with the old prefix
+// should be written with the new one.
+type PrefixFileserver struct {
+	services.Fileserver
+	bucket, prefix, fallback string
+}
+
+// NewPrefixFileserver wraps fileserver. If the prefix and fallback are both empty, fileserver is
+// returned unchanged.
+func NewPrefixFileserver(fileserver services.Fileserver, bucket, prefix, fallback string) services.Fileserver {
+	if prefix == "" && fallback == "" {
+		return fileserver
+	}
+	return &PrefixFileserver{
+		Fileserver: fileserver,
+		bucket:     bucket,
+		prefix:     prefix,
+		fallback:   fallback,
+	}
+}
+
+func (f *PrefixFileserver) Exists(ctx context.Context, bucket, name string) (bool, error) {
+	return f.Fileserver.Exists(ctx, bucket, f.name(bucket, f.prefix, name))
+}
+
+func (f *PrefixFileserver) Read(ctx context.Context, bucket, name string, writer io.Writer) (bool, error) {
+	found, err := f.Fileserver.Read(ctx, bucket, f.name(bucket, f.prefix, name), writer)
+	if err != nil || found || bucket != f.bucket || f.fallback == f.prefix {
+		return found, err
+	}
+	return f.Fileserver.Read(ctx, bucket, f.name(bucket, f.fallback, name), writer)
+}
+
+func (f *PrefixFileserver) Write(ctx context.Context, bucket, name string, reader io.Reader, overwrite bool, contentType, cacheControl string) (bool, error) {
+	return f.Fileserver.Write(ctx, bucket, f.name(bucket, f.prefix, name), reader, overwrite, contentType, cacheControl)
+}
+
+// Delete deletes a file, if the wrapped fileserver can (see cleanup.Deleter).
+func (f *PrefixFileserver) Delete(ctx context.Context, bucket, name string) error {
+	if !cleanup.CanDelete(f.Fileserver) {
+		return errCantDelete
+	}
+	return f.Fileserver.(cleanup.Deleter).Delete(ctx, bucket, f.name(bucket, f.prefix, name))
+}
+
+// CanDelete returns true if the wrapped fileserver can delete files.
+func (f *PrefixFileserver) CanDelete() bool { return cleanup.CanDelete(f.Fileserver) }
+
+// errCantDelete is returned by the fileservers that wrap another when it can't delete files.
+var errCantDelete = errors.New("the fileserver can't delete files")
+
+func (f *PrefixFileserver) name(bucket, prefix, name string) string {
+	if bucket != f.bucket || prefix == "" {
+		return name
+	}
+	return prefix + "/" + name
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/dave/jsgo/server/memstore"
+)
+
+func TestPrefixFileserver(t *testing.T) {
+	ctx := context.Background()
+	mem := memstore.NewFileserver(map[string]string{"pkg:old.js": "old", "pkg:v1/older.js": "older"})
+	f := NewPrefixFileserver(mem, "pkg", "staging/v2", "v1")
+
+	f.Write(ctx, "pkg", "a.js", bytes.NewBufferString("a"), false, "", "")
+	f.Write(ctx, "index", "b", bytes.NewBufferString("b"), false, "", "")
+	if mem.Files["pkg:staging/v2/a.js"] != "a" || mem.Files["index:b"] != "b" {
+		t.Fatalf("expected prefix only in the pkg bucket: %v", mem)
+	}
+	if exists, _ := f.Exists(ctx, "pkg", "a.js"); !exists {
+		t.Fatal("expected a.js to exist")
+	}
+
+	buf := &bytes.Buffer{}
+	if found, _ := f.Read(ctx, "pkg", "older.js", buf); !found || buf.String() != "older" {
+		t.Fatalf("expected read to fall back to the old prefix, found %v %q", found, buf.String())
+	}
+	if exists, _ := f.Exists(ctx, "pkg", "older.js"); exists {
+		t.Fatal("expected exists not to fall back")
+	}
+
+	if _, ok := NewPrefixFileserver(mem, "pkg", "", "").(*memstore.Fileserver); !ok {
+		t.Fatal("expected no wrapper without prefixes")
+	}
+}
@@ -0,0 +1,152 @@
+// Package progress fans out the messages of a running job to any number of subscribers. A subscriber
+// that attaches mid-stream is first sent the messages so far, so every subscriber sees the same stream.
+package progress
+
+import (
+	"sync"
+)
+
+// Message is a marshaled message, ready to be written to a websocket.
+type Message struct {
+	Type    int
+	Payload []byte
+}
+
+// Hub is the registry of running jobs, keyed by job id. A nil Hub has no jobs, and drops published
+// messages.
+type Hub struct {
+	history int
+	m       sync.Mutex
+	jobs    map[string]*job
+}
+
+type job struct {
+	m        sync.Mutex
+	messages []Message // the most recent messages, for catch-up
+	subs     map[*subscriber]bool
+	done     chan struct{}
+}
+
+type subscriber struct {
+	send func(Message)
+}
+
+// New returns a Hub that keeps up to history messages of each job for subscribers that attach late.
+func New(history int) *Hub {
+	return &Hub{history: history, jobs: map[string]*job{}}
+}
+
+// Start registers a job. Messages published to a key that hasn't been started are dropped. Starting a
+// key that's already running finishes the previous job.
+func (h *Hub) Start(key string) {
+	if h == nil {
+		return
+	}
+	h.m.Lock()
+	previous := h.jobs[key]
+	h.jobs[key] = &job{subs: map[*subscriber]bool{}, done: make(chan struct{})}
+	h.m.Unlock()
+	if previous != nil {
+		previous.finish()
+	}
+}
+
+// Finish removes the job and closes the done channel of its subscribers. Late subscribers won't find
+// it.
+func (h *Hub) Finish(key string) {
+	if h == nil {
+		return
+	}
+	h.m.Lock()
+	j := h.jobs[key]
+	delete(h.jobs, key)
+	h.m.Unlock()
+	if j != nil {
+		j.finish()
+	}
+}
+
+// Publish sends a message to all subscribers of the job and adds it to the catch-up history.
+func (h *Hub) Publish(key string, message Message) {
+	if h == nil {
+		return
+	}
+	h.m.Lock()
+	j := h.jobs[key]
+	h.m.Unlock()
+	if j == nil {
+		return
+	}
+	j.m.Lock()
+	defer j.m.Unlock()
+	select {
+	case <-j.done:
+		return
+	default:
+	}
+	j.messages = append(j.messages, message)
+	if len(j.messages) > h.history {
+		j.messages = j.messages[len(j.messages)-h.history:]
+	}
+	for s := range j.subs {
+		s.send(message)
+	}
+}
+
+// Subscribe attaches send to a running job. The messages so far are sent first, then each new message
+// as it's published. send is called with the job locked, so it mustn't block. The done channel is
+// closed when the job finishes. unsubscribe must be called when the subscriber stops accepting
+// messages - after it returns send won't be called again. ok is false if the job isn't running.
+func (h *Hub) Subscribe(key string, send func(Message)) (done <-chan struct{}, unsubscribe func(), ok bool) {
+	if h == nil {
+		return nil, nil, false
+	}
+	h.m.Lock()
+	j := h.jobs[key]
+	h.m.Unlock()
+	if j == nil {
+		return nil, nil, false
+	}
+	s := &subscriber{send: send}
+	j.m.Lock()
+	defer j.m.Unlock()
+	select {
+	case <-j.done:
+		return nil, nil, false // finished since it was found
+	default:
+	}
+	for _, message := range j.messages {
+		send(message)
+	}
+	j.subs[s] = true
+	unsubscribe = func() {
+		j.m.Lock()
+		defer j.m.Unlock()
+		delete(j.subs, s)
+	}
+	return j.done, unsubscribe, true
+}
+
+// Subscribers returns the number of subscribers of the job.
+func (h *Hub) Subscribers(key string) int {
+	if h == nil {
+		return 0
+	}
+	h.m.Lock()
+	j := h.jobs[key]
+	h.m.Unlock()
+	if j == nil {
+		return 0
+	}
+	j.m.Lock()
+	defer j.m.Unlock()
+	return len(j.subs)
+}
+
+func (j *job) finish() {
+	j.m.Lock()
+	defer j.m.Unlock()
+	close(j.done)
+	j.subs = map[*subscriber]bool{}
+	j.messages = nil
+}
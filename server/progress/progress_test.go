@@ -0,0 +1,67 @@
+package progress
+
+import (
+	"testing"
+)
+
+func TestTwoSubscribers(t *testing.T) {
+	h := New(10)
+	h.Start("a")
+
+	h.Publish("a", Message{Payload: []byte("1")})
+
+	var first, second []string
+	done1, unsubscribe1, ok := h.Subscribe("a", func(m Message) { first = append(first, string(m.Payload)) })
+	if !ok {
+		t.Fatal("expected job to be running")
+	}
+	h.Publish("a", Message{Payload: []byte("2")})
+
+	// the second subscriber attaches mid-stream and catches up
+	done2, unsubscribe2, _ := h.Subscribe("a", func(m Message) { second = append(second, string(m.Payload)) })
+	h.Publish("a", Message{Payload: []byte("3")})
+
+	if len(first) != 3 || len(second) != 3 || first[2] != "3" || second[0] != "1" {
+		t.Fatalf("unexpected messages: %v, %v", first, second)
+	}
+
+	// a removed subscriber isn't sent more messages
+	unsubscribe2()
+	h.Publish("a", Message{Payload: []byte("4")})
+	if len(first) != 4 || len(second) != 3 {
+		t.Fatalf("unexpected messages after unsubscribe: %v, %v", first, second)
+	}
+	if found := h.Subscribers("a"); found != 1 {
+		t.Fatalf("expected 1 subscriber, found %d", found)
+	}
+
+	h.Finish("a")
+	for _, done := range []<-chan struct{}{done1, done2} {
+		select {
+		case <-done:
+		default:
+			t.Fatal("expected done to be closed")
+		}
+	}
+	unsubscribe1() // safe after finish
+	h.Publish("a", Message{Payload: []byte("5")})
+	if len(first) != 4 {
+		t.Fatalf("unexpected message after finish: %v", first)
+	}
+	if _, _, ok := h.Subscribe("a", func(Message) {}); ok {
+		t.Fatal("expected finished job to be removed")
+	}
+}
+
+func TestHistory(t *testing.T) {
+	h := New(2)
+	h.Start("a")
+	for _, s := range []string{"1", "2", "3"} {
+		h.Publish("a", Message{Payload: []byte(s)})
+	}
+	var found []string
+	h.Subscribe("a", func(m Message) { found = append(found, string(m.Payload)) })
+	if len(found) != 2 || found[0] != "2" {
+		t.Fatalf("unexpected catch-up: %v", found)
+	}
+}
@@ -0,0 +1,310 @@
+// Package queue limits the number of concurrent compile jobs. Jobs that can't start immediately wait in
+// the queue, and are notified of their position as it changes. Each job has a nice level: jobs with a
+// lower nice level (e.g. interactive compiles) start before jobs with a higher one (e.g. cache warming).
+// Each job also belongs to a tenant (e.g. the client IP), and waiting jobs with the same nice level are
+// started round-robin across tenants so one tenant submitting many jobs can't starve the others.
+// Optionally, jobs that are predicted to be fast (see Reorder) start first within a nice level, and
+// each tenant can be limited to a number of jobs in the queue at once (see TenantLimit).
+package queue
+
+import (
+	"errors"
+	"math"
+	"sync"
+)
+
+// TooManyItemsQueued is returned by Slot when the queue is full.
+var TooManyItemsQueued = errors.New("too many items queued")
+
+// TooManyTenantItems is returned by Slot when the tenant already has the maximum number of jobs running
+// or waiting (see TenantLimit).
+var TooManyTenantItems = errors.New("too many items queued for tenant")
+
+// Nice levels for common kinds of job. Interactive is the highest priority.
+const (
+	Interactive = 0
+	Batch       = 1
+	Background  = 2
+)
+
+// Nice clamps a requested nice level to the valid range, so a request can lower its priority but
+// can't raise it above Interactive.
+func Nice(requested int) int {
+	if requested < Interactive {
+		return Interactive
+	}
+	if requested > Background {
+		return Background
+	}
+	return requested
+}
+
+type Queue struct {
+	mutex      sync.Mutex
+	concurrent int
+	max        int
+	fraction   float64
+	reorder    bool
+	perTenant  int
+	running    int
+	tenants    map[string]int // running jobs per tenant
+	waiting    []*item        // in order of arrival
+}
+
+type item struct {
+	tenant   string
+	nice     int
+	hits     float64 // predicted cache hit ratio
+	start    chan struct{}
+	end      chan struct{}
+	started  bool
+	position int
+	notify   func(position int)
+}
+
+// New creates a queue that runs at most concurrent jobs at once, and allows at most max jobs to wait.
+// While jobs from other tenants are waiting, a single tenant may only run fraction of the concurrent
+// jobs (at least one). A fraction of 0 disables the limit.
+func New(concurrent, max int, fraction float64) *Queue {
+	return &Queue{
+		concurrent: concurrent,
+		max:        max,
+		fraction:   fraction,
+		tenants:    map[string]int{},
+	}
+}
+
+// Slot requests a slot in the queue for tenant, with a nice level (see Nice). The start channel is closed when the job may start. The
+// caller must close the end channel when the job has finished (or if it is abandoned before starting).
+// notify is called with the current position while the job is waiting.
+func (q *Queue) Slot(tenant string, nice int, notify func(position int)) (start, end chan struct{}, err error) {
+	return q.SlotPredicted(tenant, nice, 0, notify)
+}
+
+// SlotPredicted is Slot for a job with a predicted cache hit ratio between 0 (cold) and 1 (everything
+// cached). The prediction is only used if reordering is enabled (see Reorder).
+func (q *Queue) SlotPredicted(tenant string, nice int, hits float64, notify func(position int)) (start, end chan struct{}, err error) {
+	q.mutex.Lock()
+	if len(q.waiting) >= q.max {
+		q.mutex.Unlock()
+		return nil, nil, TooManyItemsQueued
+	}
+	if q.perTenant > 0 && tenant != "" && q.count(tenant) >= q.perTenant {
+		q.mutex.Unlock()
+		return nil, nil, TooManyTenantItems
+	}
+	i := &item{
+		tenant: tenant,
+		nice:   Nice(nice),
+		hits:   hits,
+		start:  make(chan struct{}),
+		end:    make(chan struct{}),
+		notify: notify,
+	}
+	q.waiting = append(q.waiting, i)
+	updates := q.dispatch()
+	q.mutex.Unlock()
+
+	send(updates)
+
+	go func() {
+		<-i.end
+		q.mutex.Lock()
+		if i.started {
+			q.running--
+			q.tenants[i.tenant]--
+			if q.tenants[i.tenant] == 0 {
+				delete(q.tenants, i.tenant)
+			}
+		} else {
+			q.remove(i)
+		}
+		updates := q.dispatch()
+		q.mutex.Unlock()
+		send(updates)
+	}()
+
+	return i.start, i.end, nil
+}
+
+// Resize changes the number of concurrent jobs. Reducing the size doesn't interrupt running jobs - new
+// jobs just won't start until enough have finished.
+func (q *Queue) Resize(concurrent int) {
+	q.mutex.Lock()
+	q.concurrent = concurrent
+	updates := q.dispatch()
+	q.mutex.Unlock()
+	send(updates)
+}
+
+// Reorder enables or disables reordering by predicted cache hit ratio. When enabled, waiting jobs with
+// the same nice level start in order of predicted hit ratio (highest first), before the fair order
+// across tenants is applied. This improves throughput and average latency when many jobs are mostly
+// cached, but a cold job can wait behind a stream of fast ones.
+func (q *Queue) Reorder(enabled bool) {
+	q.mutex.Lock()
+	q.reorder = enabled
+	updates := q.dispatch()
+	q.mutex.Unlock()
+	send(updates)
+}
+
+// TenantLimit sets the maximum number of jobs a tenant may have running or waiting at once. Slot
+// returns TooManyTenantItems for jobs over the limit, so one client can't fill the queue (and then
+// the slots) by submitting many jobs at once. Jobs with no tenant aren't limited. A limit of 0
+// disables it.
+func (q *Queue) TenantLimit(n int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.perTenant = n
+}
+
+// Concurrent returns the number of concurrent jobs.
+func (q *Queue) Concurrent() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.concurrent
+}
+
+// Stats returns the number of running and waiting jobs.
+func (q *Queue) Stats() (running, waiting int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.running, len(q.waiting)
+}
+
+// Full returns true if Slot would return TooManyItemsQueued.
+func (q *Queue) Full() bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.waiting) >= q.max
+}
+
+// dispatch starts as many waiting jobs as there are free slots, and returns the position updates that
+// should be sent to the remaining jobs. Must be called with the mutex held.
+func (q *Queue) dispatch() []update {
+	for q.running < q.concurrent {
+		i := q.next()
+		if i == nil {
+			break
+		}
+		q.remove(i)
+		i.started = true
+		q.running++
+		q.tenants[i.tenant]++
+		close(i.start)
+	}
+	var updates []update
+	for index, i := range q.order() {
+		if i.position != index+1 {
+			i.position = index + 1
+			updates = append(updates, update{i.notify, i.position})
+		}
+	}
+	return updates
+}
+
+// next returns the first job in the fair order whose tenant is below its limit, or nil if there is none.
+// Must be called with the mutex held.
+func (q *Queue) next() *item {
+	for _, i := range q.order() {
+		if q.tenants[i.tenant] < q.limit(i.tenant) {
+			return i
+		}
+	}
+	return nil
+}
+
+// limit returns the maximum number of jobs tenant may run. Must be called with the mutex held.
+func (q *Queue) limit(tenant string) int {
+	if q.fraction <= 0 {
+		return q.concurrent
+	}
+	others := false
+	for _, i := range q.waiting {
+		if i.tenant != tenant {
+			others = true
+			break
+		}
+	}
+	if !others {
+		// nobody else is waiting, so there's no reason to hold back free slots.
+		return q.concurrent
+	}
+	limit := int(math.Floor(float64(q.concurrent) * q.fraction))
+	if limit < 1 {
+		limit = 1
+	}
+	return limit
+}
+
+// count returns the number of jobs tenant has running or waiting. Must be called with the mutex held.
+func (q *Queue) count(tenant string) int {
+	n := q.tenants[tenant]
+	for _, i := range q.waiting {
+		if i.tenant == tenant {
+			n++
+		}
+	}
+	return n
+}
+
+// order returns the waiting jobs in the order they will start: lowest nice level first, then (if
+// reordering) highest predicted hit ratio, then round-robin across tenants with the tenant running the
+// fewest jobs first, and in order of arrival within a tenant. Must be called with the mutex held.
+func (q *Queue) order() []*item {
+	counts := map[string]int{}
+	for tenant, n := range q.tenants {
+		counts[tenant] = n
+	}
+	remaining := append([]*item(nil), q.waiting...)
+	ordered := make([]*item, 0, len(remaining))
+	for len(remaining) > 0 {
+		best := 0
+		for index, i := range remaining {
+			b := remaining[best]
+			switch {
+			case i.nice != b.nice:
+				if i.nice < b.nice {
+					best = index
+				}
+			case q.reorder && i.hits != b.hits:
+				if i.hits > b.hits {
+					best = index
+				}
+			case counts[i.tenant] < counts[b.tenant]:
+				best = index
+			}
+		}
+		i := remaining[best]
+		remaining = append(remaining[:best], remaining[best+1:]...)
+		counts[i.tenant]++
+		ordered = append(ordered, i)
+	}
+	return ordered
+}
+
+// remove removes a job from the waiting list. Must be called with the mutex held.
+func (q *Queue) remove(i *item) {
+	for index, w := range q.waiting {
+		if w == i {
+			q.waiting = append(q.waiting[:index], q.waiting[index+1:]...)
+			return
+		}
+	}
+}
+
+type update struct {
+	notify   func(int)
+	position int
+}
+
+// send notifies jobs of their new positions. This is done outside the mutex so a slow notify func can't
+// hold up the queue.
+func send(updates []update) {
+	for _, u := range updates {
+		if u.notify != nil {
+			u.notify(u.position)
+		}
+	}
+}
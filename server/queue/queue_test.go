@@ -0,0 +1,197 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestResize(t *testing.T) {
+	q := New(1, 10, 0)
+	start1, end1, err := q.Slot("", Interactive, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close(end1)
+	start2, end2, err := q.Slot("", Interactive, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close(end2)
+	waitStart(t, start1)
+	select {
+	case <-start2:
+		t.Fatal("second job shouldn't start before resize")
+	default:
+	}
+	q.Resize(2)
+	waitStart(t, start2)
+}
+
+func TestTenants(t *testing.T) {
+	q := New(4, 10, 0.5)
+	var ends []chan struct{}
+	slot := func(tenant string) chan struct{} {
+		start, end, err := q.Slot(tenant, Interactive, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ends = append(ends, end)
+		return start
+	}
+	defer func() {
+		for _, end := range ends[4:] {
+			close(end)
+		}
+	}()
+
+	// Nobody else is waiting, so tenant a can use all the slots.
+	var a []chan struct{}
+	for i := 0; i < 6; i++ {
+		a = append(a, slot("a"))
+	}
+	for _, start := range a[:4] {
+		waitStart(t, start)
+	}
+	b1 := slot("b")
+	b2 := slot("b")
+	assertWaiting(t, a[4], a[5], b1, b2)
+
+	// b has queued after a, but should get the freed slots until it has its fair share.
+	close(ends[0])
+	waitStart(t, b1)
+	assertWaiting(t, a[4], a[5], b2)
+	close(ends[1])
+	waitStart(t, b2)
+	assertWaiting(t, a[4], a[5])
+	close(ends[2])
+	waitStart(t, a[4])
+	close(ends[3])
+	waitStart(t, a[5])
+}
+
+func TestTenantLimit(t *testing.T) {
+	q := New(4, 10, 0)
+	q.TenantLimit(2)
+	a1, endA1, err := q.Slot("a", Interactive, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, endA2, err := q.Slot("a", Interactive, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close(endA2)
+	waitStart(t, a1)
+
+	// a has two jobs in progress, so a third is rejected even though there are free slots.
+	if _, _, err := q.Slot("a", Interactive, nil); err != TooManyTenantItems {
+		t.Fatalf("expected TooManyTenantItems, found %v", err)
+	}
+
+	// Other tenants, and jobs with no tenant, aren't affected.
+	b, endB, err := q.Slot("b", Interactive, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close(endB)
+	waitStart(t, b)
+	for i := 0; i < 3; i++ {
+		_, end, err := q.Slot("", Interactive, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer close(end)
+	}
+
+	// When one of a's jobs finishes, a can submit another.
+	close(endA1)
+	time.Sleep(10 * time.Millisecond)
+	_, endA3, err := q.Slot("a", Interactive, nil)
+	if err != nil {
+		t.Fatalf("expected a slot after a job finished, found %v", err)
+	}
+	close(endA3)
+}
+
+func TestNice(t *testing.T) {
+	q := New(1, 10, 0)
+	start1, end1, _ := q.Slot("a", Interactive, nil)
+	waitStart(t, start1)
+	low, endLow, _ := q.Slot("b", Background, nil)
+	defer close(endLow)
+	high, endHigh, _ := q.Slot("c", Interactive, nil)
+	defer close(endHigh)
+
+	// The high priority job was submitted after the low priority one, but should start first.
+	close(end1)
+	waitStart(t, high)
+	assertWaiting(t, low)
+
+	if Nice(-5) != Interactive || Nice(10) != Background {
+		t.Fatal("expected nice level to be clamped")
+	}
+}
+
+func TestReorder(t *testing.T) {
+	for _, reorder := range []bool{false, true} {
+		q := New(1, 10, 0)
+		q.Reorder(reorder)
+		start1, end1, _ := q.Slot("a", Interactive, nil)
+		waitStart(t, start1)
+		cold, endCold, _ := q.SlotPredicted("b", Interactive, 0.1, nil)
+		fast, endFast, _ := q.SlotPredicted("c", Interactive, 0.9, nil)
+
+		// The fast job was submitted after the cold one, but overtakes it when reordering is enabled.
+		close(end1)
+		if reorder {
+			waitStart(t, fast)
+			assertWaiting(t, cold)
+		} else {
+			waitStart(t, cold)
+			assertWaiting(t, fast)
+		}
+		close(endCold)
+		close(endFast)
+	}
+}
+
+func assertWaiting(t *testing.T, starts ...chan struct{}) {
+	t.Helper()
+	time.Sleep(10 * time.Millisecond)
+	for i, start := range starts {
+		select {
+		case <-start:
+			t.Fatalf("job %d shouldn't have started", i)
+		default:
+		}
+	}
+}
+
+func waitStart(t *testing.T, start chan struct{}) {
+	t.Helper()
+	select {
+	case <-start:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for job to start")
+	}
+}
+
+func TestWait(t *testing.T) {
+	if err := Wait(context.Background()); err != nil {
+		t.Fatalf("expected a job without a wait function to already hold a slot, found %v", err)
+	}
+	var waited int
+	var predicted float64
+	ctx := WithWait(context.Background(), func(ctx context.Context, hits float64) error {
+		waited++
+		predicted = hits
+		return TooManyItemsQueued
+	})
+	if err := Wait(ctx); err != TooManyItemsQueued || waited != 1 || predicted != 0 {
+		t.Fatalf("expected the wait function to be called, found %d calls, %v", waited, err)
+	}
+	if err := WaitPredicted(ctx, 0.5); err != TooManyItemsQueued || waited != 2 || predicted != 0.5 {
+		t.Fatalf("expected the prediction to be passed to the wait function, found %v", predicted)
+	}
+}
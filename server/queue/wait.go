@@ -0,0 +1,29 @@
+package queue
+
+import "context"
+
+type waitKey struct{}
+
+// WithWait returns a context holding wait, which waits for a slot in a queue. It's used for jobs that do
+// some work (e.g. fetching) before they need a slot, so the slot isn't held during that work. The job
+// calls Wait before the work that needs the slot. wait is given the predicted cache hit ratio of the job
+// (see SlotPredicted), which is only known once the job has started.
+func WithWait(ctx context.Context, wait func(ctx context.Context, hits float64) error) context.Context {
+	return context.WithValue(ctx, waitKey{}, wait)
+}
+
+// Wait waits for the slot of the job with context ctx (see WithWait). If ctx has no wait function the
+// job already holds a slot, so Wait returns nil immediately.
+func Wait(ctx context.Context) error {
+	return WaitPredicted(ctx, 0)
+}
+
+// WaitPredicted is Wait for a job with a predicted cache hit ratio between 0 (cold) and 1 (everything
+// cached).
+func WaitPredicted(ctx context.Context, hits float64) error {
+	wait, ok := ctx.Value(waitKey{}).(func(ctx context.Context, hits float64) error)
+	if !ok {
+		return nil
+	}
+	return wait(ctx, hits)
+}
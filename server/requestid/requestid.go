@@ -0,0 +1,45 @@
+// Package requestid propagates a correlation id for each request. The id is taken from the X-Request-ID
+// header sent by the client or an upstream proxy, or generated if there isn't one.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// Header is the request and response header holding the id.
+const Header = "X-Request-ID"
+
+type key struct{}
+
+// Handler wraps a handler so every request has an id. The id is stored in the request context and the
+// request header (so code with only the request can find it), and is echoed in the response header.
+func Handler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(Header)
+		if !valid.MatchString(id) {
+			id = generate()
+		}
+		req.Header.Set(Header, id)
+		w.Header().Set(Header, id)
+		handler.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), key{}, id)))
+	})
+}
+
+// FromContext returns the id of the request, or an empty string if there isn't one.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(key{}).(string)
+	return id
+}
+
+// ids from clients are used in logs and the datastore, so only allow short, printable ids.
+var valid = regexp.MustCompile(`^[A-Za-z0-9_.:\-]{1,128}$`)
+
+func generate() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return fmt.Sprintf("%x", b)
+}
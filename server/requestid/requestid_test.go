@@ -0,0 +1,32 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	var found string
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		found = FromContext(req.Context())
+	}))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(Header, "abc-123")
+	h.ServeHTTP(w, req)
+	if found != "abc-123" || w.Header().Get(Header) != "abc-123" {
+		t.Fatalf("expected id to round-trip, found %q and %q", found, w.Header().Get(Header))
+	}
+
+	for _, sent := range []string{"", "bad id\n"} {
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(Header, sent)
+		h.ServeHTTP(w, req)
+		if found == "" || found == sent || w.Header().Get(Header) != found {
+			t.Fatalf("expected generated id, found %q and %q", found, w.Header().Get(Header))
+		}
+	}
+}
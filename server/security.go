@@ -0,0 +1,27 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/dave/jsgo/config"
+)
+
+// SecurityHeaders wraps a handler that serves HTML pages so the responses have the security headers
+// (see setSecurityHeaders).
+func SecurityHeaders(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		setSecurityHeaders(w.Header())
+		handler(w, req)
+	}
+}
+
+// setSecurityHeaders sets config.ContentSecurityPolicy, config.ReferrerPolicy and nosniff.
+func setSecurityHeaders(header http.Header) {
+	header.Set("X-Content-Type-Options", "nosniff")
+	if config.ContentSecurityPolicy != "" {
+		header.Set("Content-Security-Policy", config.ContentSecurityPolicy)
+	}
+	if config.ReferrerPolicy != "" {
+		header.Set("Referrer-Policy", config.ReferrerPolicy)
+	}
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dave/jsgo/config"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	handler := SecurityHeaders(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("<html></html>"))
+	})
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/github.com/dave/jstest", nil))
+	for name, expected := range map[string]string{
+		"Content-Security-Policy": config.ContentSecurityPolicy,
+		"Referrer-Policy":         config.ReferrerPolicy,
+		"X-Content-Type-Options":  "nosniff",
+	} {
+		if found := w.Header().Get(name); found == "" || found != expected {
+			t.Errorf("%s: expected %q, found %q", name, expected, found)
+		}
+	}
+
+	// The 404 page is also HTML.
+	req := httptest.NewRequest("GET", "/missing", nil)
+	req.Header.Set("Accept", "text/html")
+	w = httptest.NewRecorder()
+	notFound(w, req)
+	if w.Header().Get("Content-Security-Policy") != config.ContentSecurityPolicy {
+		t.Errorf("expected policy on 404 page, found %q", w.Header().Get("Content-Security-Policy"))
+	}
+}
+
+func TestSecurityHeadersDisabled(t *testing.T) {
+	defer func(csp, referrer string) { config.ContentSecurityPolicy, config.ReferrerPolicy = csp, referrer }(config.ContentSecurityPolicy, config.ReferrerPolicy)
+	config.ContentSecurityPolicy, config.ReferrerPolicy = "", ""
+	w := httptest.NewRecorder()
+	SecurityHeaders(func(http.ResponseWriter, *http.Request) {})(w, httptest.NewRequest("GET", "/", nil))
+	if _, ok := w.Header()["Content-Security-Policy"]; ok {
+		t.Error("expected no policy")
+	}
+	if _, ok := w.Header()["Referrer-Policy"]; ok {
+		t.Error("expected no referrer policy")
+	}
+}
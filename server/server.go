@@ -2,6 +2,7 @@ package server
 
 import (
 	"bytes"
+	"compress/gzip"
 	"fmt"
 	"io"
 	"mime"
@@ -12,126 +13,215 @@ import (
 
 	pathpkg "path"
 
-	"errors"
-
 	"context"
 
 	"sync"
 
 	"cloud.google.com/go/datastore"
-	"cloud.google.com/go/storage"
 	"github.com/dave/jsgo/assets"
 	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/backend"
+	"github.com/dave/jsgo/server/clientip"
 	"github.com/dave/jsgo/server/frizz"
+	"github.com/dave/jsgo/server/gitauth"
 	"github.com/dave/jsgo/server/jsgo"
+	"github.com/dave/jsgo/server/mirror"
 	"github.com/dave/jsgo/server/play"
+	"github.com/dave/jsgo/server/progress"
+	"github.com/dave/jsgo/server/queue"
+	"github.com/dave/jsgo/server/requestid"
 	"github.com/dave/jsgo/server/store"
 	"github.com/dave/jsgo/server/wasm"
 	"github.com/dave/patsy"
 	"github.com/dave/patsy/vos"
 	"github.com/dave/services"
-	"github.com/dave/services/database/gcsdatabase"
-	"github.com/dave/services/database/localdatabase"
 	"github.com/dave/services/fetcher/gitfetcher"
 	"github.com/dave/services/fetcher/localfetcher"
 	"github.com/dave/services/fileserver/cachefileserver"
-	"github.com/dave/services/fileserver/gcsfileserver"
-	"github.com/dave/services/fileserver/localfileserver"
 	"github.com/dave/services/getter/cache"
-	"github.com/dave/services/queue"
 	"github.com/dave/services/tracker"
 	"github.com/gorilla/websocket"
 	"github.com/shurcooL/httpgzip"
 	"gopkg.in/src-d/go-billy.v4"
 )
 
-func init() {
-	assets.Init()
+// Deps are the dependencies of the handler that can be replaced, e.g. in tests.
+type Deps struct {
+	Compiler backend.Compiler
 }
 
 func New(shutdown chan struct{}) *Handler {
+	return NewWithDeps(shutdown, Deps{Compiler: backend.Default})
+}
+
+func NewWithDeps(shutdown chan struct{}, deps Deps) *Handler {
+	assets.Init()
+
 	var c *cache.Cache
-	var fileserver services.Fileserver
-	var database services.Database
+	hostCaches := map[string]*cache.Cache{}
+	st, err := NewStorage(context.Background())
+	if err != nil {
+		panic(err)
+	}
+	fileserver, database, datastoreClient := st.Fileserver, st.Database, st.Datastore
 	if config.LOCAL {
-		fileserver = localfileserver.New(config.LocalFileserverTempDir, config.Static, config.Host, config.Bucket)
-		database = localdatabase.New(config.LocalFileserverTempDir)
 		fetcherResolver, err := localfetcher.New()
 		if err != nil {
 			panic(err)
 		}
 		c = cache.New(
 			database,
-			fetcherResolver,
+			mirror.New(os.Getenv(config.MirrorDirEnv), fetcherResolver),
 			fetcherResolver,
 			config.HintsKind,
 		)
 	} else {
-		storageClient, err := storage.NewClient(context.Background())
-		if err != nil {
-			panic(err)
-		}
-
-		datastoreClient, err := datastore.NewClient(context.Background(), config.ProjectID)
-		if err != nil {
-			panic(err)
-		}
-
-		database = gcsdatabase.New(datastoreClient)
-		fileserver = gcsfileserver.New(storageClient, config.Buckets)
+		gitCache := cachefileserver.New(1024*1024*1042, 100*1024*1024)
 		c = cache.New(
 			database,
-			gitfetcher.New(
-				cachefileserver.New(1024*1024*1042, 100*1024*1024),
+			mirror.New(os.Getenv(config.MirrorDirEnv), gitauth.New(gitfetcher.New(
+				gitCache,
 				fileserver,
 				config.GitFetcherConfig,
-			),
+			))),
 			nil,
 			config.HintsKind,
 		)
+		// Hosts with timeout overrides get their own fetcher, sharing the same git cache.
+		for host := range config.GitHostTimeouts {
+			hostCaches[host] = cache.New(
+				database,
+				mirror.New(os.Getenv(config.MirrorDirEnv), gitauth.New(gitfetcher.New(
+					gitCache,
+					fileserver,
+					config.GitFetcherConfigForHost(host),
+				))),
+				nil,
+				config.HintsKind,
+			)
+		}
 	}
+	fileserver = NewPrefixFileserver(fileserver, config.Bucket[config.Pkg], config.ExpandArtifactPrefix(config.ArtifactPrefix), config.ExpandArtifactPrefix(config.ArtifactFallbackPrefix))
+	fileserver = NewArtifactCache(fileserver, config.Bucket[config.Pkg], config.ArtifactCacheSize, config.ArtifactCacheItemSize, config.ArtifactCacheItems)
+
 	h := &Handler{
 		mux:        http.NewServeMux(),
 		shutdown:   shutdown,
-		Queue:      queue.New(config.MaxConcurrentCompiles, config.MaxQueue),
+		Queue:      queue.New(defaultConcurrentCompiles(), config.MaxQueue, config.MaxTenantFraction),
 		Waitgroup:  &sync.WaitGroup{},
 		Cache:      c,
+		HostCaches: hostCaches,
 		Fileserver: fileserver,
 		Database:   database,
+		Datastore:  datastoreClient,
+		Access:     NewAccessLog(database),
+		Compiler:   deps.Compiler,
+		Progress:   progress.New(config.ProgressHistory),
+		sockets:    &sockets{open: map[*socket]bool{}},
+		streams:    streams,
+	}
+	h.Queue.Reorder(config.QueueReorder)
+	h.Queue.TenantLimit(config.MaxCompilesPerIp)
+	go h.Access.Run(shutdown)
+	go h.sockets.broadcastShutdown(shutdown)
+	if config.CleanupEnabled {
+		go h.runCleanup(shutdown)
+	}
+	if config.OverflowEnabled && datastoreClient != nil {
+		h.Overflow = &datastoreOverflow{database: database, client: datastoreClient}
+		go h.drainOverflow(shutdown)
 	}
-	h.mux.HandleFunc("/", h.PageHandler)
-	h.mux.HandleFunc("/_script.js", h.ScriptHandler)
-	h.mux.HandleFunc("/_script.js.map", h.ScriptHandler)
-	h.mux.HandleFunc("/_info/", tracker.Handler)
 
-	h.mux.HandleFunc("/_jsgo/", h.SocketHandler(&jsgo.Handler{h.Cache, h.Fileserver, h.Database}))
+	h.mux.HandleFunc("/", Timeout(config.ApiRouteTimeout, h.Access.Handler(SecurityHeaders(h.PageHandler))))
+	h.mux.HandleFunc("/_script.js", Timeout(config.CompileRouteTimeout, h.Access.Handler(h.ScriptHandler)))
+	h.mux.HandleFunc("/_script.js.map", Timeout(config.StaticRouteTimeout, h.Access.Handler(h.ScriptHandler)))
+	h.mux.HandleFunc("/_info/", Timeout(config.ApiRouteTimeout, TokenHandler(config.InfoTokenEnv, tracker.Handler)))
+	h.mux.HandleFunc("/_version", Timeout(config.ApiRouteTimeout, h.VersionHandler))
+	h.mux.HandleFunc("/_manifest/", Timeout(config.ApiRouteTimeout, h.Access.Handler(TenantHandler(h.ManifestHandler))))
+	h.mux.HandleFunc("/_esm/", Timeout(config.ApiRouteTimeout, h.Access.Handler(TenantHandler(h.EsmHandler))))
+	h.mux.HandleFunc("/_docs/", Timeout(config.ApiRouteTimeout, h.Access.Handler(TenantHandler(h.DocsHandler))))
+	h.mux.HandleFunc("/_estimate/", Timeout(config.ApiRouteTimeout, TenantHandler(h.EstimateHandler)))
+	h.mux.HandleFunc("/_files/", Timeout(config.ApiRouteTimeout, h.Access.Handler(TenantHandler(h.FilesHandler))))
+	h.mux.HandleFunc("/_precache/", Timeout(config.ApiRouteTimeout, h.Access.Handler(TenantHandler(h.PrecacheHandler))))
+	h.mux.HandleFunc("/_upload/", Timeout(config.CompileRouteTimeout, TenantHandler(LimitBody(config.MaxUploadSize, h.UploadHandler))))
+	h.mux.HandleFunc("/_snippet/", Timeout(config.CompileRouteTimeout, TenantHandler(LimitBody(config.MaxSnippetSize, h.SnippetHandler))))
+	h.mux.HandleFunc("/_refs/", Timeout(config.ApiRouteTimeout, h.RefsHandler))
+	h.mux.HandleFunc("/_api/compile", Timeout(config.ApiRouteTimeout, TenantHandler(LimitBody(config.MaxPostSize, h.AsyncHandler))))
+	h.mux.HandleFunc("/_api/diff", Timeout(config.CompileRouteTimeout, TenantHandler(LimitBody(config.MaxPostSize, h.DiffHandler))))
+	h.mux.HandleFunc("/_api/job/", h.JobHandler) // the log has a timeout, but watching is a websocket
+
+	// Websocket routes are long-lived, so they have no overall timeout.
+	h.mux.HandleFunc("/_jsgo/", TenantHandler(h.SocketHandler(h.jsgoHandler())))
 	h.mux.HandleFunc("/_play/", h.SocketHandler(&play.Handler{h.Cache, h.Fileserver, h.Database}))
 	h.mux.HandleFunc("/_frizz/", h.SocketHandler(&frizz.Handler{h.Cache, h.Fileserver, h.Database}))
 	h.mux.HandleFunc("/_wasm/", h.SocketHandler(&wasm.Handler{h.Cache, h.Fileserver, h.Database}))
 
 	//h.mux.HandleFunc("/_ws/", h.SocketHandler)
 	//h.mux.HandleFunc("/_pg/", h.SocketHandler)
-	h.mux.HandleFunc("/favicon.ico", h.IconHandler)
-	h.mux.HandleFunc("/compile.css", h.CssHandler)
-	h.mux.HandleFunc("/_ah/health", h.HealthCheckHandler)
+	h.mux.HandleFunc("/favicon.ico", Timeout(config.StaticRouteTimeout, h.IconHandler))
+	h.mux.HandleFunc("/compile.css", Timeout(config.StaticRouteTimeout, h.CssHandler))
+	h.mux.HandleFunc("/_ah/health", Timeout(config.ApiRouteTimeout, h.HealthCheckHandler))
+	h.mux.HandleFunc("/_admin/concurrency", Timeout(config.ApiRouteTimeout, AdminHandler(LimitBody(config.MaxPostSize, h.ConcurrencyHandler))))
+	h.mux.HandleFunc("/_admin/compiles", Timeout(config.ApiRouteTimeout, AdminHandler(h.CompilesHandler)))
+	h.mux.HandleFunc("/_admin/access", Timeout(config.ApiRouteTimeout, AdminHandler(h.AccessHandler)))
 	if config.LOCAL {
 		dir, err := patsy.Dir(vos.Os(), "github.com/dave/jsgo/assets/static/")
 		if err != nil {
 			panic(err)
 		}
-		h.mux.Handle("/_local/", http.FileServer(http.Dir(dir)))
+		h.mux.HandleFunc("/_local/", Timeout(config.StaticRouteTimeout, http.FileServer(http.Dir(dir)).ServeHTTP))
 	}
 	return h
 }
 
 type Handler struct {
 	Cache      *cache.Cache
+	HostCaches map[string]*cache.Cache
 	Fileserver services.Fileserver
 	Database   services.Database
+	Datastore  *datastore.Client // Used for queries. This is nil in local mode.
+	Access     *AccessLog
+	Compiler   backend.Compiler // If nil, backend.Default is used
 	Waitgroup  *sync.WaitGroup
 	Queue      *queue.Queue
+	Progress   *progress.Hub // Messages of running websocket jobs, for watchers
+	Overflow   OverflowQueue // Async jobs waiting for room in the compile queue. nil if disabled.
 	mux        *http.ServeMux
 	shutdown   chan struct{}
+	sockets    *sockets
+	streams    *streamLimiter // files being streamed to clients (see StreamWithTimeout)
+	namespace  string         // the tenant's namespace of a copy made by tenant
+}
+
+// streamDrainTimeout is config.StreamDrainTimeout. It's a var so tests can shorten it.
+var streamDrainTimeout = config.StreamDrainTimeout
+
+// Shutdown waits for the compiles to be cancelled once the shutdown channel has been closed, then gives
+// the files being streamed to clients streamDrainTimeout to finish. Compiles must finish or be cancelled,
+// but downloads are usually fast, so letting them finish means clients aren't left with truncated
+// scripts. Streams still running after the drain window (or when ctx is done) are stopped, and new
+// streams are refused.
+func (h *Handler) Shutdown(ctx context.Context) {
+	if h.Waitgroup != nil {
+		h.Waitgroup.Wait()
+	}
+	if h.streams == nil {
+		return
+	}
+	if stopped := h.streams.drain(ctx, streamDrainTimeout); stopped > 0 {
+		fmt.Printf("shutdown: stopped %d unfinished streams\n", stopped)
+	}
+}
+
+func (h *Handler) compiler() backend.Compiler {
+	if h.Compiler == nil {
+		return backend.Default
+	}
+	return h.Compiler
+}
+
+func (h *Handler) jsgoHandler() *jsgo.Handler {
+	return &jsgo.Handler{Cache: h.Cache, HostCaches: h.HostCaches, Fileserver: h.Fileserver, Database: h.Database, Compiler: h.Compiler}
 }
 
 var upgrader = websocket.Upgrader{
@@ -140,16 +230,17 @@ var upgrader = websocket.Upgrader{
 
 func (h *Handler) storeError(ctx context.Context, err error, req *http.Request) {
 
-	if err == queue.TooManyItemsQueued {
+	if err == queue.TooManyItemsQueued || err == queue.TooManyTenantItems {
 		// If the server is getting flooded by a DOS, this will prevent database flooding
 		return
 	}
 
 	// ignore errors when logging an error
 	store.StoreError(ctx, h.Database, store.Error{
-		Time:  time.Now(),
-		Error: err.Error(),
-		Ip:    req.Header.Get("X-Forwarded-For"),
+		Time:      time.Now(),
+		Error:     err.Error(),
+		Ip:        clientip.Get(req),
+		RequestId: req.Header.Get(requestid.Header),
 	})
 
 }
@@ -171,7 +262,7 @@ func (h *Handler) HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	h.mux.ServeHTTP(w, r)
+	requestid.Handler(AltSvc(h.mux)).ServeHTTP(w, r)
 }
 
 func ServeStatic(name string, w http.ResponseWriter, req *http.Request, mimeType string) error {
@@ -180,7 +271,7 @@ func ServeStatic(name string, w http.ResponseWriter, req *http.Request, mimeType
 	file, err = assets.Assets.Open(name)
 	if err != nil {
 		if os.IsNotExist(err) {
-			http.NotFound(w, req)
+			notFound(w, req)
 			return nil
 		}
 		http.Error(w, fmt.Sprintf("error opening %s", name), 500)
@@ -188,6 +279,17 @@ func ServeStatic(name string, w http.ResponseWriter, req *http.Request, mimeType
 	}
 	defer file.Close()
 
+	fi, err := assets.Assets.Stat(name)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error opening %s", name), 500)
+		return nil
+	}
+	hash, err := assets.Hash(fi, name)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error opening %s", name), 500)
+		return nil
+	}
+
 	w.Header().Set("Cache-Control", "public,max-age=31536000,immutable")
 	if mimeType == "" {
 		w.Header().Set("Content-Type", mime.TypeByExtension(pathpkg.Ext(req.URL.Path)))
@@ -196,15 +298,82 @@ func ServeStatic(name string, w http.ResponseWriter, req *http.Request, mimeType
 	}
 
 	_, noCompress := file.(httpgzip.NotWorthGzipCompressing)
+	var gz []byte
 	gzb, isGzb := file.(httpgzip.GzipByter)
+	if isGzb {
+		gz = gzb.GzipBytes()
+	} else {
+		// assets are precompressed when they're loaded (see config.PrecompressAssets)
+		gz, isGzb = assets.GzipBytes(fi, name)
+	}
 
-	if isGzb && !noCompress && strings.Contains(req.Header.Get("Accept-Encoding"), "gzip") {
+	// If the client refuses identity, files are compressed even if it's not worth it.
+	encoding, identity := negotiate(req, "gzip")
+	if encoding == "" && !identity {
+		logCompression(req, "", "refused: no acceptable encoding")
+		http.Error(w, "no acceptable encoding", http.StatusNotAcceptable)
+		return nil
+	}
+	compress := encoding == "gzip"
+
+	switch {
+	case !compress:
+		logSkipped(req, "gzip")
+	case noCompress && identity:
+		logCompression(req, "", "skipped: not worth compressing")
+	case isGzb:
+		logCompression(req, "gzip", "gzip: precomputed")
+	case fi.Size() < config.StreamGzipMinSize && identity:
+		logCompression(req, "", "skipped: below threshold")
+	default:
+		logCompression(req, "gzip", "gzip: streamed")
+	}
+
+	if isGzb && compress && (!noCompress || !identity) {
 		w.Header().Set("Content-Encoding", "gzip")
-		if err := WriteWithTimeout(w, gzb.GzipBytes()); err != nil {
+		w.Header().Set("ETag", etag(hash, "gzip"))
+		if notModified(w, req) {
+			return nil
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(gz)))
+		if req.Method == http.MethodHead {
+			return nil
+		}
+		if err := WriteWithTimeout(w, gz); err != nil {
+			http.Error(w, fmt.Sprintf("error streaming gzipped %s", name), 500)
+			return err
+		}
+	} else if compress && (!noCompress && fi.Size() >= config.StreamGzipMinSize || !identity) {
+		// Large files without precompressed contents are compressed while streaming, so the compressed
+		// file is never held in memory. The length isn't known in advance, so a HEAD request counts the
+		// bytes of the same compression without keeping them.
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("ETag", etag(hash, "gzip"))
+		if notModified(w, req) {
+			return nil
+		}
+		if req.Method == http.MethodHead {
+			length, err := gzipLength(file)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("error compressing %s", name), 500)
+				return err
+			}
+			w.Header().Set("Content-Length", fmt.Sprint(length))
+			return nil
+		}
+		if err := StreamGzipWithTimeout(w, file); err != nil {
 			http.Error(w, fmt.Sprintf("error streaming gzipped %s", name), 500)
 			return err
 		}
 	} else {
+		w.Header().Set("ETag", etag(hash, ""))
+		if notModified(w, req) {
+			return nil
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(fi.Size()))
+		if req.Method == http.MethodHead {
+			return nil
+		}
 		if err := StreamWithTimeout(w, file); err != nil {
 			http.Error(w, fmt.Sprintf("error streaming %s", name), 500)
 			return err
@@ -214,27 +383,80 @@ func ServeStatic(name string, w http.ResponseWriter, req *http.Request, mimeType
 
 }
 
-func StreamWithTimeout(w io.Writer, r io.Reader) error {
-	c := make(chan error, 1)
-	go func() {
-		_, err := io.Copy(w, r)
-		c <- err
-	}()
-	select {
-	case err := <-c:
-		if err != nil {
-			return err
+// etag returns a strong validator for a static file from the hash of its contents (see assets.Hash).
+// The encoding is included so the gzipped and identity representations don't share an ETag. Streamed
+// gzip isn't byte for byte stable across compressor versions, but it is within a server version.
+func etag(hash, encoding string) string {
+	if encoding == "" {
+		return fmt.Sprintf(`"%s"`, hash)
+	}
+	return fmt.Sprintf(`"%s-%s"`, hash, encoding)
+}
+
+// notModified replies 304 Not Modified if the If-None-Match header of the request matches the ETag of
+// the response.
+func notModified(w http.ResponseWriter, req *http.Request) bool {
+	match := req.Header.Get("If-None-Match")
+	if match == "" {
+		return false
+	}
+	tag := w.Header().Get("ETag")
+	for _, m := range strings.Split(match, ",") {
+		m = strings.TrimPrefix(strings.TrimSpace(m), "W/")
+		if m == "*" || m == tag {
+			w.WriteHeader(http.StatusNotModified)
+			return true
 		}
-		return nil
-	case <-time.After(config.WriteTimeout):
-		return errors.New("timeout")
 	}
+	return false
+}
+
+// gzipLength returns the length of r compressed as StreamGzipWithTimeout compresses it.
+func gzipLength(r io.Reader) (int64, error) {
+	var length lengthWriter
+	gzw := gzip.NewWriter(&length)
+	if _, err := io.Copy(gzw, r); err != nil {
+		return 0, err
+	}
+	if err := gzw.Close(); err != nil {
+		return 0, err
+	}
+	return int64(length), nil
+}
+
+// lengthWriter counts the bytes written to it.
+type lengthWriter int64
+
+func (l *lengthWriter) Write(b []byte) (int, error) {
+	*l += lengthWriter(len(b))
+	return len(b), nil
+}
+
+// StreamWithTimeout copies r to w. It waits for a stream slot first (see streams), and the timeout
+// starts when the copy starts.
+func StreamWithTimeout(w io.Writer, r io.Reader) error {
+	return streams.run(w, func(w io.Writer) error {
+		_, err := io.Copy(w, rateLimit(r, config.StreamBytesPerSecond))
+		return err
+	})
 }
 
 func WriteWithTimeout(w io.Writer, b []byte) error {
 	return StreamWithTimeout(w, bytes.NewBuffer(b))
 }
 
+// StreamGzipWithTimeout gzips r on the fly while streaming it to w, with the same slots and timeout as
+// StreamWithTimeout.
+func StreamGzipWithTimeout(w io.Writer, r io.Reader) error {
+	return streams.run(w, func(w io.Writer) error {
+		gzw := gzip.NewWriter(w)
+		if _, err := io.Copy(gzw, rateLimit(r, config.StreamBytesPerSecond)); err != nil {
+			return err
+		}
+		return gzw.Close()
+	})
+}
+
 type Pather interface {
 	Path() string
 }
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dave/jsgo/assets"
+)
+
+func TestServeStaticHead(t *testing.T) {
+	f, err := assets.Assets.Create("/head-test.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("body { color: red; }")); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("HEAD", "/head-test.css", nil)
+	if err := ServeStatic(req.URL.Path, w, req, "text/css"); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Fatalf("expected empty body, got %q", w.Body.String())
+	}
+	for header, expected := range map[string]string{
+		"Content-Length": "20",
+		"Content-Type":   "text/css",
+		"Cache-Control":  "public,max-age=31536000,immutable",
+	} {
+		if found := w.Header().Get(header); found != expected {
+			t.Fatalf("expected %s %q, got %q", header, expected, found)
+		}
+	}
+	if w.Header().Get("ETag") == "" {
+		t.Fatal("expected ETag")
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("HEAD", "/missing.css", nil)
+	if err := ServeStatic(req.URL.Path, w, req, "text/css"); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+}
+
+// benchmarkMap is a large source map-like payload for comparing the memory use of buffered and
+// streaming gzip. Run with: go test -bench Gzip -benchmem
+var benchmarkMap = bytes.Repeat([]byte(`{"version":3,"file":"_script.js","mappings":"AAAA,SAAS,CAAC;"},`), 1<<17)
+
+func BenchmarkGzipBuffered(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf := &bytes.Buffer{}
+		gzw := gzip.NewWriter(buf)
+		gzw.Write(benchmarkMap)
+		gzw.Close()
+		if err := WriteWithTimeout(ioutil.Discard, buf.Bytes()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGzipStreaming(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := StreamGzipWithTimeout(ioutil.Discard, bytes.NewReader(benchmarkMap)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestServeStaticPrecompressed(t *testing.T) {
+	contents := bytes.Repeat([]byte("body { color: red; }\n"), 100)
+	f, err := assets.Assets.Create("/precompress-test.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(contents)
+	f.Close()
+	if err := assets.Precompress(assets.Assets, "/"); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/precompress-test.css", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	if err := ServeStatic(req.URL.Path, w, req, "text/css"); err != nil {
+		t.Fatal(err)
+	}
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Content-Length") != fmt.Sprint(w.Body.Len()) {
+		t.Fatalf("expected precompressed response, got %v", w.Header())
+	}
+	r, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(r); !bytes.Equal(b, contents) {
+		t.Fatal("unexpected contents")
+	}
+}
+
+func TestServeStaticEtag(t *testing.T) {
+	f, err := assets.Assets.Create("/etag-test.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("body { color: blue; }"))
+	f.Close()
+
+	serve := func(method, match string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/etag-test.css", nil)
+		if match != "" {
+			req.Header.Set("If-None-Match", match)
+		}
+		if err := ServeStatic(req.URL.Path, w, req, "text/css"); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	// The ETag is the hash of the contents, so it's the same for every request.
+	tag := serve("GET", "").Header().Get("ETag")
+	if again := serve("GET", "").Header().Get("ETag"); tag == "" || again != tag {
+		t.Fatalf("expected a stable ETag, got %q and %q", tag, again)
+	}
+
+	for _, match := range []string{tag, `"other", ` + tag, "W/" + tag, "*"} {
+		if w := serve("GET", match); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("%s: expected 304, got %d", match, w.Code)
+		}
+	}
+	if w := serve("GET", `"other"`); w.Code != 200 || w.Body.String() != "body { color: blue; }" {
+		t.Fatalf("expected the file, got %d", w.Code)
+	}
+}
+
+func TestServeStaticStreamedHead(t *testing.T) {
+	// Images aren't precompressed, so large ones are compressed while streaming.
+	contents := bytes.Repeat([]byte("stream test\n"), 100000)
+	f, err := assets.Assets.Create("/stream-test.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(contents)
+	f.Close()
+
+	serve := func(method string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/stream-test.png", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		if err := ServeStatic(req.URL.Path, w, req, "image/png"); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+	get, head := serve("GET"), serve("HEAD")
+	if get.Header().Get("Content-Encoding") != "gzip" || head.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected streamed gzip, got %v and %v", get.Header(), head.Header())
+	}
+	if head.Body.Len() != 0 || head.Header().Get("Content-Length") != fmt.Sprint(get.Body.Len()) {
+		t.Fatalf("expected the compressed length %d, got %q", get.Body.Len(), head.Header().Get("Content-Length"))
+	}
+}
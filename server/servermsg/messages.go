@@ -5,6 +5,12 @@ import "encoding/gob"
 func RegisterTypes() {
 	gob.Register(Queueing{})
 	gob.Register(Error{})
+	gob.Register(Job{})
+}
+
+// Job is the first message sent on a websocket. Id identifies the job in /_api/job/<id>/log.
+type Job struct {
+	Id string
 }
 
 type Queueing struct {
@@ -14,4 +20,6 @@ type Queueing struct {
 
 type Error struct {
 	Message string
+	Code    string // identifies the message in all languages - see the locale package. Empty for untranslated messages.
+	Detail  string // the raw compiler output behind an explained error (see backend.Unsupported), if any.
 }
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"sync"
+)
+
+// sockets tracks the open websocket connections so they can all be told when the server shuts down.
+type sockets struct {
+	m        sync.Mutex
+	open     map[*socket]bool
+	shutdown bool // set once the shutdown message has been broadcast
+}
+
+type socket struct {
+	// shutdown sends the shutdown message to the client and cancels the request.
+	shutdown func()
+
+	m      sync.Mutex
+	closed bool // set by remove, after which shutdown must not be called
+}
+
+// notify calls shutdown unless the socket has been removed.
+func (sock *socket) notify() {
+	sock.m.Lock()
+	defer sock.m.Unlock()
+	if !sock.closed {
+		sock.shutdown()
+	}
+}
+
+// add tracks a socket. If the server is already shutting down, the socket is told immediately.
+func (s *sockets) add(sock *socket) {
+	s.m.Lock()
+	s.open[sock] = true
+	shutdown := s.shutdown
+	s.m.Unlock()
+	if shutdown {
+		sock.notify()
+	}
+}
+
+// remove must be called before the socket stops accepting messages. It blocks while the socket is being
+// told about the shutdown, so shutdown is never called on a closed socket.
+func (s *sockets) remove(sock *socket) {
+	s.m.Lock()
+	delete(s.open, sock)
+	s.m.Unlock()
+	sock.m.Lock()
+	defer sock.m.Unlock()
+	sock.closed = true
+}
+
+// broadcastShutdown waits for the shutdown signal and then tells all open sockets to reconnect. The
+// sockets are told in parallel, because each one stores an error before queueing the message on its
+// send loop, which writes it within config.ShutdownWriteTimeout. Sockets opened later are told when
+// they're added.
+func (s *sockets) broadcastShutdown(shutdown chan struct{}) {
+	<-shutdown
+	s.m.Lock()
+	s.shutdown = true
+	open := make([]*socket, 0, len(s.open))
+	for sock := range s.open {
+		open = append(open, sock)
+	}
+	s.m.Unlock()
+
+	var wg sync.WaitGroup
+	for _, sock := range open {
+		sock := sock
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sock.notify()
+		}()
+	}
+	wg.Wait()
+}
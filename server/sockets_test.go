@@ -0,0 +1,53 @@
+package server
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBroadcastShutdown(t *testing.T) {
+	s := &sockets{open: map[*socket]bool{}}
+
+	// Each socket blocks until all of them have been told, so the broadcast only finishes if they're
+	// told in parallel.
+	const count = 5
+	var told sync.WaitGroup
+	told.Add(count)
+	all := make(chan struct{})
+	go func() {
+		told.Wait()
+		close(all)
+	}()
+	for i := 0; i < count; i++ {
+		s.add(&socket{shutdown: func() {
+			told.Done()
+			<-all
+		}})
+	}
+
+	// A removed socket isn't told.
+	removed := &socket{shutdown: func() { t.Fatal("removed socket was told") }}
+	s.add(removed)
+	s.remove(removed)
+
+	shutdown := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		s.broadcastShutdown(shutdown)
+		close(done)
+	}()
+	close(shutdown)
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out - sockets weren't told in parallel")
+	}
+
+	// Sockets added after the broadcast are told immediately.
+	var late bool
+	s.add(&socket{shutdown: func() { late = true }})
+	if !late {
+		t.Fatal("expected a socket added after shutdown to be told")
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+	"cloud.google.com/go/storage"
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/migrate"
+	"github.com/dave/services"
+	"github.com/dave/services/database/gcsdatabase"
+	"github.com/dave/services/database/localdatabase"
+	"github.com/dave/services/fileserver/gcsfileserver"
+	"github.com/dave/services/fileserver/localfileserver"
+	"google.golang.org/api/iterator"
+)
+
+// Storage is the fileserver and database of the server's config: the local fileserver and database in
+// local mode, and Google Cloud Storage and Datastore otherwise.
+type Storage struct {
+	Fileserver services.Fileserver
+	Database   services.Database
+	Datastore  *datastore.Client // Used for queries. This is nil in local mode.
+}
+
+// NewStorage connects to the storage of the server's config. The fileservers can delete and list files
+// (see cleanup.Deleter and migrate.Lister).
+func NewStorage(ctx context.Context) (Storage, error) {
+	if config.LOCAL {
+		return Storage{
+			Fileserver: NewLocalFileserver(config.LocalFileserverTempDir),
+			Database:   localdatabase.New(config.LocalFileserverTempDir),
+		}, nil
+	}
+	storageClient, err := storage.NewClient(ctx)
+	if err != nil {
+		return Storage{}, err
+	}
+	datastoreClient, err := datastore.NewClient(ctx, config.ProjectID)
+	if err != nil {
+		return Storage{}, err
+	}
+	return Storage{
+		Fileserver: gcsStorage{gcsfileserver.New(storageClient, config.Buckets), storageClient},
+		Database:   gcsdatabase.New(datastoreClient),
+		Datastore:  datastoreClient,
+	}, nil
+}
+
+// NewLocalFileserver returns a local fileserver that stores its files in dir.
+func NewLocalFileserver(dir string) services.Fileserver {
+	return localStorage{localfileserver.New(dir, config.Static, config.Host, config.Bucket), dir}
+}
+
+// gcsStorage adds Delete (see cleanup.Deleter) and List (see migrate.Lister) to the GCS fileserver.
+type gcsStorage struct {
+	services.Fileserver
+	client *storage.Client
+}
+
+// Delete deletes a file. Files that don't exist are already deleted.
+func (s gcsStorage) Delete(ctx context.Context, bucket, name string) error {
+	if err := s.client.Bucket(bucket).Object(name).Delete(ctx); err != nil && err != storage.ErrObjectNotExist {
+		return err
+	}
+	return nil
+}
+
+func (s gcsStorage) CanDelete() bool { return true }
+
+// List lists the files in a bucket, with the content type and cache control they were stored with.
+func (s gcsStorage) List(ctx context.Context, bucket string) ([]migrate.File, error) {
+	var files []migrate.File
+	it := s.client.Bucket(bucket).Objects(ctx, nil)
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, migrate.File{Name: attrs.Name, ContentType: attrs.ContentType, CacheControl: attrs.CacheControl})
+	}
+}
+
+// localStorage adds Delete (see cleanup.Deleter) and List (see migrate.Lister) to the local fileserver,
+// which stores each file at <dir>/<bucket>/<escaped name>.
+type localStorage struct {
+	services.Fileserver
+	dir string
+}
+
+// Delete deletes a file. Files that don't exist are already deleted.
+func (s localStorage) Delete(ctx context.Context, bucket, name string) error {
+	if err := os.Remove(filepath.Join(expandHome(s.dir), bucket, url.PathEscape(name))); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s localStorage) CanDelete() bool { return true }
+
+// List lists the files in a bucket. The local fileserver doesn't record content types.
+func (s localStorage) List(ctx context.Context, bucket string) ([]migrate.File, error) {
+	fis, err := ioutil.ReadDir(filepath.Join(expandHome(s.dir), bucket))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []migrate.File
+	for _, fi := range fis {
+		if fi.IsDir() {
+			continue
+		}
+		name, err := url.PathUnescape(fi.Name())
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, migrate.File{Name: name})
+	}
+	return files, nil
+}
+
+// expandHome expands a leading ~ in dir to the home directory, like the local fileserver does.
+func expandHome(dir string) string {
+	if dir != "~" && !strings.HasPrefix(dir, "~/") {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return dir
+	}
+	return filepath.Join(home, strings.TrimPrefix(dir, "~"))
+}
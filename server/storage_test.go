@@ -0,0 +1,36 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsgo-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "pkg", url.PathEscape("github.com/a/b.abc.js"))
+	os.MkdirAll(filepath.Dir(name), 0777)
+	if err := ioutil.WriteFile(name, []byte("x"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	d := localStorage{dir: dir}
+	for i := 0; i < 2; i++ {
+		// deleting a file that's already gone isn't an error
+		if err := d.Delete(context.Background(), "pkg", "github.com/a/b.abc.js"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Fatalf("expected the file to be deleted, found %v", err)
+	}
+	if !NewPrefixFileserver(d, "pkg", "p", "").(*PrefixFileserver).CanDelete() {
+		t.Fatal("expected the prefix fileserver to delete with the local fileserver")
+	}
+}
@@ -2,17 +2,20 @@ package store
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"cloud.google.com/go/datastore"
 	"github.com/dave/jsgo/config"
 	"github.com/dave/services"
+	"google.golang.org/api/iterator"
 )
 
 type Error struct {
-	Time  time.Time
-	Error string
-	Ip    string
+	Time      time.Time
+	Error     string
+	Ip        string
+	RequestId string
 }
 
 type ShareData struct {
@@ -31,6 +34,28 @@ type CompileData struct {
 
 	Success bool
 	Error   string
+
+	// Duration is the time taken to fetch and compile. Zero for compiles stored before it was recorded.
+	Duration time.Duration
+
+	// Slow is set for a compile that took longer than config.SlowCompileThreshold, when
+	// config.StoreSlowCompiles is set. Phases has the time taken by each phase of a slow compile.
+	Slow   bool
+	Phases CompilePhases
+
+	// Stale is set on the package entity when a later compile of the path failed, and this build was
+	// served instead (see messages.Compile.Stale). The next successful compile clears it.
+	Stale bool
+
+	Version   string // Version of the server that built this
+	Toolchain string // Version of the compiler that built this
+}
+
+// CompilePhases is the time taken by each phase of a compile.
+type CompilePhases struct {
+	Fetch   time.Duration // downloading and checking the source
+	Wait    time.Duration // waiting for a compile slot
+	Compile time.Duration // compiling and storing the files
 }
 
 type DeployData struct {
@@ -40,9 +65,36 @@ type DeployData struct {
 	Ip       string
 }
 
+// AccessData records the number of times a file was served, and the total bytes, since the previous
+// record for the same path.
+type AccessData struct {
+	Path  string
+	Time  time.Time
+	Hits  int
+	Bytes int64
+}
+
+// OverflowJob is an async compile request waiting in the overflow queue, because the compile queue was
+// full when it was submitted.
+type OverflowJob struct {
+	Id       string
+	Time     time.Time // When the job was submitted. The oldest job is started first.
+	Deadline time.Time // The job is dropped if it hasn't started by then.
+	Ip       string
+	Lang     string
+	Tenant   string // The tenant namespace of the client (see tenant.Namespace), or empty
+	Message  []byte `datastore:",noindex"` // The compile message as JSON
+}
+
 type CompileContents struct {
 	Main     string
 	Packages []CompilePackage
+
+	// Total size of the files, raw and gzipped, and the compression ratio (gzipped / raw). These are
+	// zero for compiles stored before the sizes were recorded.
+	RawBytes  int64
+	GzipBytes int64
+	Ratio     float64
 }
 
 type DeployContents struct {
@@ -57,6 +109,40 @@ type CompilePackage struct {
 	Standard bool
 }
 
+// BuildData lists the files of a compile output, keyed by its build id (the hash of the main package
+// file). Build ids are content hashes, so the data never changes once stored.
+type BuildData struct {
+	Path  string
+	Min   bool
+	Time  time.Time
+	Files []BuildFile
+
+	Version   string // Version of the server that built this
+	Toolchain string // Version of the compiler that built this
+
+	// Index is the hash of the index page, if it was written at its hash in the index bucket (as
+	// <hash> and <hash>/index.html). Empty for builds with the page at the package path.
+	Index string
+
+	// Expires is when the files may be deleted by the cleanup job, which sets Evicted when it has
+	// deleted them. Zero never expires.
+	Expires time.Time
+	Evicted bool
+}
+
+type BuildFile struct {
+	Name string // name in the pkg bucket
+	Size int64
+	Hash string // hex encoded sha256 of the contents
+}
+
+// MigrationData records that the files of a build have been copied to another fileserver (see the
+// migrate package), so an interrupted migration can resume where it stopped.
+type MigrationData struct {
+	Time  time.Time
+	Files int
+}
+
 type WasmDeploy struct {
 	Time  time.Time
 	Ip    string
@@ -99,6 +185,82 @@ func StoreCompile(ctx context.Context, database services.Database, path string,
 	return nil
 }
 
+// StoreFailedCompile logs a compile that failed. Only the compile log is written - the package entity
+// keeps the last successful compile.
+func StoreFailedCompile(ctx context.Context, database services.Database, data CompileData) error {
+	if _, err := database.Put(ctx, compileKey(), &data); err != nil {
+		return err
+	}
+	return nil
+}
+
+func StoreBuild(ctx context.Context, database services.Database, id string, data BuildData) error {
+	if _, err := database.Put(ctx, buildKey(id), &data); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Build returns the files of the compile output with the build id.
+func Build(ctx context.Context, database services.Database, id string) (bool, BuildData, error) {
+	var data BuildData
+	if err := database.Get(ctx, buildKey(id), &data); err != nil {
+		if err == datastore.ErrNoSuchEntity {
+			return false, BuildData{}, nil
+		}
+		return false, BuildData{}, err
+	}
+	return true, data, nil
+}
+
+// Builds returns the ids and file lists of all the compile outputs.
+func Builds(ctx context.Context, database services.Database) ([]string, []BuildData, error) {
+	var builds []BuildData
+	keys, err := database.GetAll(ctx, datastore.NewQuery(config.BuildKind), &builds)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := make([]string, len(keys))
+	for i, key := range keys {
+		ids[i] = key.Name
+	}
+	return ids, builds, nil
+}
+
+// Packages returns the paths and latest compiles of all the packages.
+func Packages(ctx context.Context, database services.Database) ([]string, []CompileData, error) {
+	var packages []CompileData
+	keys, err := database.GetAll(ctx, datastore.NewQuery(config.PackageKind), &packages)
+	if err != nil {
+		return nil, nil, err
+	}
+	paths := make([]string, len(keys))
+	for i, key := range keys {
+		paths[i] = key.Name
+	}
+	return paths, packages, nil
+}
+
+// StoreMigration records that the build with the id has been migrated to destination.
+func StoreMigration(ctx context.Context, database services.Database, destination, id string, data MigrationData) error {
+	if _, err := database.Put(ctx, migrationKey(destination, id), &data); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Migrated returns true if the build with the id has been migrated to destination.
+func Migrated(ctx context.Context, database services.Database, destination, id string) (bool, error) {
+	var data MigrationData
+	if err := database.Get(ctx, migrationKey(destination, id), &data); err != nil {
+		if err == datastore.ErrNoSuchEntity {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
 func StoreWasmDeploy(ctx context.Context, database services.Database, data WasmDeploy) error {
 	if _, err := database.Put(ctx, wasmDeployKey(), &data); err != nil {
 		return err
@@ -106,6 +268,75 @@ func StoreWasmDeploy(ctx context.Context, database services.Database, data WasmD
 	return nil
 }
 
+// StoreAccesses writes several access records in batches of config.DatabaseBatchSize.
+func StoreAccesses(ctx context.Context, database services.Database, data []AccessData) error {
+	for len(data) > 0 {
+		n := len(data)
+		if n > config.DatabaseBatchSize {
+			n = config.DatabaseBatchSize
+		}
+		keys := make([]*datastore.Key, n)
+		for i := range keys {
+			keys[i] = accessKey()
+		}
+		if _, err := database.PutMulti(ctx, keys, data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// StoreOverflow adds a job to the overflow queue, or replaces the job with the same id.
+func StoreOverflow(ctx context.Context, database services.Database, job OverflowJob) error {
+	if _, err := database.Put(ctx, overflowKey(job.Id), &job); err != nil {
+		return err
+	}
+	return nil
+}
+
+// NextOverflow removes the oldest job from the overflow queue and returns it. found is false if the queue
+// is empty. Each job is removed in a transaction, so when several servers drain the queue at once, only
+// one of them gets the job.
+func NextOverflow(ctx context.Context, client *datastore.Client) (job OverflowJob, found bool, err error) {
+	q := datastore.NewQuery(config.OverflowKind).Order("Time").Limit(config.OverflowCandidates).KeysOnly()
+	keys, err := client.GetAll(ctx, q, nil)
+	if err != nil {
+		return OverflowJob{}, false, err
+	}
+	for _, key := range keys {
+		_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+			if err := tx.Get(key, &job); err != nil {
+				return err
+			}
+			return tx.Delete(key)
+		})
+		if err == datastore.ErrNoSuchEntity || err == datastore.ErrConcurrentTransaction {
+			continue // another server has taken this job
+		}
+		if err != nil {
+			return OverflowJob{}, false, err
+		}
+		return job, true, nil
+	}
+	return OverflowJob{}, false, nil
+}
+
+// Access returns the total hits and bytes served for path since the given time. The query needs a
+// composite index (see server/main/index.yaml).
+func Access(ctx context.Context, client *datastore.Client, path string, since time.Time) (hits int, bytes int64, err error) {
+	var records []AccessData
+	q := datastore.NewQuery(config.AccessKind).Filter("Path =", path).Filter("Time >=", since)
+	if _, err := client.GetAll(ctx, q, &records); err != nil {
+		return 0, 0, err
+	}
+	for _, r := range records {
+		hits += r.Hits
+		bytes += r.Bytes
+	}
+	return hits, bytes, nil
+}
+
 func Package(ctx context.Context, database services.Database, path string) (bool, CompileData, error) {
 	var data CompileData
 	if err := database.Get(ctx, packageKey(path), &data); err != nil {
@@ -117,10 +348,100 @@ func Package(ctx context.Context, database services.Database, path string) (bool
 	return true, data, nil
 }
 
+// MarkStale flags the package entity of path as stale (see CompileData.Stale).
+func MarkStale(ctx context.Context, database services.Database, path string) error {
+	found, data, err := Package(ctx, database, path)
+	if err != nil || !found {
+		return err
+	}
+	data.Stale = true
+	if _, err := database.Put(ctx, packageKey(path), &data); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CompileQuery filters the compile log. Zero values don't filter.
+type CompileQuery struct {
+	Since   time.Time
+	Until   time.Time
+	Path    string
+	Ip      string
+	Success *bool
+	Limit   int
+	Cursor  string // Cursor from a previous page
+}
+
+// InvalidCursor is returned by Compiles when the cursor can't be decoded.
+var InvalidCursor = errors.New("invalid cursor")
+
+// Compiles queries the compile log, most recent first. It returns a cursor for the next page (empty if
+// there are no more results), and the total number of results matching the filters. The filters are run
+// by the datastore, so each combination of filters needs a composite index (see server/main/index.yaml).
+// Ip is the address of the client (see clientip.Get).
+func Compiles(ctx context.Context, client *datastore.Client, q CompileQuery) (compiles []CompileData, next string, total int, err error) {
+	query := datastore.NewQuery(config.CompileKind)
+	if !q.Since.IsZero() {
+		query = query.Filter("Time >=", q.Since)
+	}
+	if !q.Until.IsZero() {
+		query = query.Filter("Time <", q.Until)
+	}
+	if q.Path != "" {
+		query = query.Filter("Path =", q.Path)
+	}
+	if q.Ip != "" {
+		query = query.Filter("Ip =", q.Ip)
+	}
+	if q.Success != nil {
+		query = query.Filter("Success =", *q.Success)
+	}
+	query = query.Order("-Time")
+
+	total, err = client.Count(ctx, query)
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	page := query.Limit(q.Limit)
+	if q.Cursor != "" {
+		cursor, err := datastore.DecodeCursor(q.Cursor)
+		if err != nil {
+			return nil, "", 0, InvalidCursor
+		}
+		page = page.Start(cursor)
+	}
+
+	it := client.Run(ctx, page)
+	for {
+		var data CompileData
+		if _, err := it.Next(&data); err == iterator.Done {
+			break
+		} else if err != nil {
+			return nil, "", 0, err
+		}
+		compiles = append(compiles, data)
+	}
+
+	if len(compiles) == q.Limit {
+		cursor, err := it.Cursor()
+		if err != nil {
+			return nil, "", 0, err
+		}
+		next = cursor.String()
+	}
+
+	return compiles, next, total, nil
+}
+
 func errorKey() *datastore.Key {
 	return datastore.IncompleteKey(config.ErrorKind, nil)
 }
 
+func accessKey() *datastore.Key {
+	return datastore.IncompleteKey(config.AccessKind, nil)
+}
+
 func compileKey() *datastore.Key {
 	return datastore.IncompleteKey(config.CompileKind, nil)
 }
@@ -140,3 +461,15 @@ func shareKey() *datastore.Key {
 func packageKey(path string) *datastore.Key {
 	return datastore.NameKey(config.PackageKind, path, nil)
 }
+
+func overflowKey(id string) *datastore.Key {
+	return datastore.NameKey(config.OverflowKind, id, nil)
+}
+
+func buildKey(id string) *datastore.Key {
+	return datastore.NameKey(config.BuildKind, id, nil)
+}
+
+func migrationKey(destination, id string) *datastore.Key {
+	return datastore.NameKey(config.MigrationKind, destination+"/"+id, nil)
+}
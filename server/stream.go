@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dave/jsgo/config"
+)
+
+// streams limits the number of files being streamed to clients at once. In a download spike, excess
+// streams wait briefly for a slot, rather than all sharing the bandwidth and all timing out.
+var streams = newStreamLimiter(config.MaxConcurrentStreams, config.StreamWaitTimeout, config.WriteTimeout)
+
+// ServerBusy is returned when a stream waits too long for a slot.
+var ServerBusy = errors.New("server busy")
+
+type streamLimiter struct {
+	slots   chan struct{}
+	wait    time.Duration // maximum time to wait for a slot
+	timeout time.Duration // maximum time for the stream, once it has started
+
+	mu      sync.Mutex
+	active  map[*stoppableWriter]bool // streams that are running
+	closed  bool                      // set by drain: new streams are refused
+	drained chan struct{}             // closed when the last active stream finishes after drain starts
+}
+
+func newStreamLimiter(n int, wait, timeout time.Duration) *streamLimiter {
+	return &streamLimiter{
+		slots:   make(chan struct{}, n),
+		wait:    wait,
+		timeout: timeout,
+		active:  map[*stoppableWriter]bool{},
+	}
+}
+
+// run waits for a slot and runs stream, returning an error if it takes longer than the timeout. The slot
+// is held until stream returns, even after a timeout, so the limit reflects the streams really running.
+// Once the timeout has passed, writes to the writer passed to stream fail, so stream returns as soon as
+// a write in progress finishes (writes to a slow client are limited by config.ServerWriteTimeout).
+func (l *streamLimiter) run(w io.Writer, stream func(w io.Writer) error) error {
+	timer := time.NewTimer(l.wait)
+	select {
+	case l.slots <- struct{}{}:
+		timer.Stop()
+	case <-timer.C:
+		return ServerBusy
+	}
+	sw := &stoppableWriter{w: w}
+	if !l.start(sw) {
+		<-l.slots
+		return ServerBusy
+	}
+	c := make(chan error, 1)
+	go func() {
+		defer func() { <-l.slots }()
+		defer l.finish(sw)
+		c <- stream(sw)
+	}()
+	select {
+	case err := <-c:
+		return err
+	case <-time.After(l.timeout):
+		sw.stop()
+		return errors.New("timeout")
+	}
+}
+
+// start records a stream as active, unless the limiter is being drained.
+func (l *streamLimiter) start(sw *stoppableWriter) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return false
+	}
+	l.active[sw] = true
+	return true
+}
+
+func (l *streamLimiter) finish(sw *stoppableWriter) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.active, sw)
+	if len(l.active) == 0 && l.drained != nil {
+		close(l.drained)
+		l.drained = nil
+	}
+}
+
+// drain refuses new streams, and waits up to timeout (or until ctx is done) for the active streams to
+// finish. Streams still running are then stopped, and the number stopped is returned.
+func (l *streamLimiter) drain(ctx context.Context, timeout time.Duration) int {
+	l.mu.Lock()
+	l.closed = true
+	var drained chan struct{}
+	if len(l.active) > 0 {
+		if l.drained == nil {
+			l.drained = make(chan struct{})
+		}
+		drained = l.drained
+	}
+	l.mu.Unlock()
+	if drained == nil {
+		return 0
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-drained:
+		return 0
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for sw := range l.active {
+		sw.stop()
+	}
+	return len(l.active)
+}
+
+// stoppableWriter is a writer that fails after stop is called.
+type stoppableWriter struct {
+	w       io.Writer
+	stopped int32
+}
+
+var streamStopped = errors.New("stream stopped")
+
+func (s *stoppableWriter) Write(b []byte) (int, error) {
+	if atomic.LoadInt32(&s.stopped) == 1 {
+		return 0, streamStopped
+	}
+	return s.w.Write(b)
+}
+
+func (s *stoppableWriter) stop() {
+	atomic.StoreInt32(&s.stopped, 1)
+}
+
+// rateLimit limits reads from r to bytesPerSecond. Zero is unlimited.
+func rateLimit(r io.Reader, bytesPerSecond int) io.Reader {
+	if bytesPerSecond <= 0 {
+		return r
+	}
+	return &rateLimitedReader{r: r, rate: bytesPerSecond, start: time.Now()}
+}
+
+type rateLimitedReader struct {
+	r     io.Reader
+	rate  int
+	start time.Time
+	total int
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	// read at most a tenth of a second's worth at a time, so the rate is smooth
+	if max := r.rate / 10; max > 0 && len(p) > max {
+		p = p[:max]
+	}
+	n, err := r.r.Read(p)
+	r.total += n
+	// sleep until the bytes read so far are within the rate
+	if due := r.start.Add(time.Duration(float64(r.total) / float64(r.rate) * float64(time.Second))); time.Now().Before(due) {
+		time.Sleep(time.Until(due))
+	}
+	return n, err
+}
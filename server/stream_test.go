@@ -0,0 +1,145 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStreamLimiter(t *testing.T) {
+	l := newStreamLimiter(3, time.Second*5, time.Second)
+	var running, max int32
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- l.run(ioutil.Discard, func(w io.Writer) error {
+				n := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+				for {
+					m := atomic.LoadInt32(&max)
+					if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond * 20)
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if max != 3 {
+		t.Fatalf("expected 3 concurrent streams, found %d", max)
+	}
+
+	// Streams that can't get a slot in time fail with ServerBusy.
+	l = newStreamLimiter(1, time.Millisecond*10, time.Second)
+	release := make(chan struct{})
+	go l.run(ioutil.Discard, func(w io.Writer) error { <-release; return nil })
+	time.Sleep(time.Millisecond * 5)
+	if err := l.run(ioutil.Discard, func(w io.Writer) error { return nil }); err != ServerBusy {
+		t.Fatalf("expected ServerBusy, found %v", err)
+	}
+	close(release)
+
+	// After the timeout, writes fail so the stream stops and releases its slot.
+	l = newStreamLimiter(1, time.Millisecond*10, time.Millisecond*20)
+	stopped := make(chan error, 1)
+	err := l.run(ioutil.Discard, func(w io.Writer) error {
+		for {
+			if _, err := w.Write([]byte("a")); err != nil {
+				stopped <- err
+				return err
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+	if err == nil || <-stopped != streamStopped {
+		t.Fatalf("expected the stream to time out and stop, found %v", err)
+	}
+	if err := l.run(ioutil.Discard, func(w io.Writer) error { return nil }); err != nil {
+		t.Fatalf("expected the slot to be released, found %v", err)
+	}
+}
+
+func TestShutdownDrain(t *testing.T) {
+	defer func(d time.Duration) { streamDrainTimeout = d }(streamDrainTimeout)
+	streamDrainTimeout = time.Second
+	h := &Handler{streams: newStreamLimiter(2, time.Millisecond*10, time.Second*5)}
+
+	// A stream in progress when the server shuts down completes within the drain window.
+	started := make(chan struct{})
+	done := make(chan error, 1)
+	buf := &bytes.Buffer{}
+	go func() {
+		done <- h.streams.run(buf, func(w io.Writer) error {
+			close(started)
+			for i := 0; i < 10; i++ {
+				time.Sleep(time.Millisecond * 10)
+				if _, err := w.Write([]byte("a")); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}()
+	<-started
+	h.Shutdown(context.Background())
+	if err := <-done; err != nil || buf.String() != "aaaaaaaaaa" {
+		t.Fatalf("expected the stream to complete, found %v, %q", err, buf.String())
+	}
+
+	// Streams are refused once the handler is shutting down.
+	if err := h.streams.run(ioutil.Discard, func(w io.Writer) error { return nil }); err != ServerBusy {
+		t.Fatalf("expected ServerBusy, found %v", err)
+	}
+
+	// A stream that doesn't finish within the drain window is stopped.
+	streamDrainTimeout = time.Millisecond * 20
+	h = &Handler{streams: newStreamLimiter(2, time.Millisecond*10, time.Second*5)}
+	started = make(chan struct{})
+	go func() {
+		done <- h.streams.run(ioutil.Discard, func(w io.Writer) error {
+			close(started)
+			for {
+				if _, err := w.Write([]byte("a")); err != nil {
+					return err
+				}
+				time.Sleep(time.Millisecond)
+			}
+		})
+	}()
+	<-started
+	start := time.Now()
+	h.Shutdown(context.Background())
+	if err := <-done; err != streamStopped {
+		t.Fatalf("expected the stream to be stopped, found %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("expected the stream to be stopped after the drain window")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	start := time.Now()
+	buf := &bytes.Buffer{}
+	if _, err := buf.ReadFrom(rateLimit(bytes.NewReader(make([]byte, 3000)), 10000)); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Millisecond*250 || buf.Len() != 3000 {
+		t.Fatalf("expected about 300ms for 3000 bytes at 10000/s, found %v and %d bytes", elapsed, buf.Len())
+	}
+}
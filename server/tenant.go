@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/tenant"
+)
+
+// TenantHandler wraps a handler so the tenant that made the request is resolved once (see
+// tenant.Namespace) and carried in the request's context, where the handlers (see Handler.tenant) and
+// the compiles read it. Requests with an API key that isn't a tenant's are rejected.
+func TenantHandler(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		namespace, err := tenant.Namespace(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		handler(w, req.WithContext(tenant.NewContext(req.Context(), namespace)))
+	}
+}
+
+// tenant returns a copy of the handler that reads and writes the files and records of the namespace in
+// the context of req (see TenantHandler). Outside a tenant's namespace the handler is returned as is.
+func (h *Handler) tenant(req *http.Request) *Handler {
+	namespace := tenant.FromContext(req.Context())
+	if namespace == "" {
+		return h
+	}
+	c := *h
+	c.namespace = namespace
+	c.Fileserver = tenant.NewFileserver(h.Fileserver, namespace)
+	c.Database = tenant.NewDatabase(h.Database, namespace)
+	return &c
+}
+
+// pkgHost returns the host and path that the files of the handler's namespace are served from.
+func (h *Handler) pkgHost() string {
+	if h.namespace != "" {
+		return tenant.PkgHost(h.namespace)
+	}
+	return config.PkgHostPath()
+}
+
+// indexPath returns the path of an index page in the index bucket, which is in the handler's namespace.
+func (h *Handler) indexPath(name string) string {
+	if h.namespace != "" {
+		return tenant.Prefix(h.namespace) + "/" + name
+	}
+	return name
+}
@@ -0,0 +1,258 @@
+// Package tenant isolates the compiles of tenants in multi-tenant deployments. A tenant is identified by
+// the API key in the Authorization header of a request (see config.TenantKeysEnv), and its files and
+// database records are kept in its own namespace, so identical sources compiled by different tenants
+// produce separate artifacts that other tenants can't read or replace.
+package tenant
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/cleanup"
+	"github.com/dave/services"
+)
+
+// ErrUnknownKey is returned by Namespace when the request has an API key that isn't a tenant's.
+var ErrUnknownKey = errors.New("unknown API key")
+
+var namespaceName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// Keys parses a config.TenantKeysEnv value, and returns the namespace of each key.
+func Keys(value string) (map[string]string, error) {
+	keys := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("invalid tenant %q - use namespace:key", pair)
+		}
+		if !namespaceName.MatchString(parts[0]) {
+			return nil, fmt.Errorf("invalid tenant namespace %q", parts[0])
+		}
+		if _, ok := keys[parts[1]]; ok {
+			return nil, fmt.Errorf("tenant %s has the same key as another tenant", parts[0])
+		}
+		keys[parts[1]] = parts[0]
+	}
+	return keys, nil
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying a namespace, for requests the server makes itself (e.g. async
+// compiles started from the overflow queue), which have no API key.
+func NewContext(ctx context.Context, namespace string) context.Context {
+	return context.WithValue(ctx, contextKey{}, namespace)
+}
+
+// FromContext returns the namespace carried by ctx (see NewContext), or the common namespace ("").
+func FromContext(ctx context.Context) string {
+	namespace, _ := ctx.Value(contextKey{}).(string)
+	return namespace
+}
+
+// Namespace returns the namespace of the tenant that made req: the namespace in its context (see
+// NewContext), or the namespace of the bearer token in the Authorization header. Requests without
+// either are in the common namespace (""), as are all requests when no tenants are configured, so other
+// bearer tokens are only rejected in multi-tenant deployments. The namespace only ever comes from the
+// server's config.
+func Namespace(req *http.Request) (string, error) {
+	if namespace, ok := req.Context().Value(contextKey{}).(string); ok {
+		return namespace, nil
+	}
+	header := req.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", nil
+	}
+	keys, err := Keys(os.Getenv(config.TenantKeysEnv))
+	if err != nil {
+		return "", err
+	}
+	if len(keys) == 0 {
+		return "", nil
+	}
+	found := strings.TrimPrefix(header, "Bearer ")
+	for key, namespace := range keys {
+		if subtle.ConstantTimeCompare([]byte(found), []byte(key)) == 1 {
+			return namespace, nil
+		}
+	}
+	return "", ErrUnknownKey
+}
+
+// Namespaces returns the common namespace ("") followed by the namespace of each tenant, in order.
+func Namespaces() ([]string, error) {
+	keys, err := Keys(os.Getenv(config.TenantKeysEnv))
+	if err != nil {
+		return nil, err
+	}
+	namespaces := []string{""}
+	for _, namespace := range keys {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces[1:])
+	return namespaces, nil
+}
+
+// Each calls f with the fileserver and database of each namespace (see Namespaces), for jobs that work
+// on every build, like cleanup and migration. It stops at the first error.
+func Each(fileserver services.Fileserver, database services.Database, f func(namespace string, fileserver services.Fileserver, database services.Database) error) error {
+	namespaces, err := Namespaces()
+	if err != nil {
+		return err
+	}
+	for _, namespace := range namespaces {
+		if namespace == "" {
+			err = f(namespace, fileserver, database)
+		} else {
+			err = f(namespace, NewFileserver(fileserver, namespace), NewDatabase(database, namespace))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prefix returns the prefix of the names of the files of a namespace in the buckets.
+func Prefix(namespace string) string {
+	return config.TenantPrefix + "/" + namespace
+}
+
+// PkgHost returns the host and path that the files of a namespace in the pkg bucket are served from.
+func PkgHost(namespace string) string {
+	return config.PkgHostPath() + "/" + Prefix(namespace)
+}
+
+// Fileserver stores the files of a namespace under its prefix in every bucket.
+type Fileserver struct {
+	services.Fileserver
+	namespace string
+}
+
+// NewFileserver wraps fileserver for a namespace.
+func NewFileserver(fileserver services.Fileserver, namespace string) *Fileserver {
+	return &Fileserver{Fileserver: fileserver, namespace: namespace}
+}
+
+func (f *Fileserver) Exists(ctx context.Context, bucket, name string) (bool, error) {
+	return f.Fileserver.Exists(ctx, bucket, f.name(name))
+}
+
+func (f *Fileserver) Read(ctx context.Context, bucket, name string, writer io.Writer) (bool, error) {
+	return f.Fileserver.Read(ctx, bucket, f.name(name), writer)
+}
+
+func (f *Fileserver) Write(ctx context.Context, bucket, name string, reader io.Reader, overwrite bool, contentType, cacheControl string) (bool, error) {
+	return f.Fileserver.Write(ctx, bucket, f.name(name), reader, overwrite, contentType, cacheControl)
+}
+
+// Delete deletes a file of the namespace, if the wrapped fileserver can (see cleanup.Deleter).
+func (f *Fileserver) Delete(ctx context.Context, bucket, name string) error {
+	if !cleanup.CanDelete(f.Fileserver) {
+		return errors.New("the fileserver can't delete files")
+	}
+	return f.Fileserver.(cleanup.Deleter).Delete(ctx, bucket, f.name(name))
+}
+
+// CanDelete returns true if the wrapped fileserver can delete files.
+func (f *Fileserver) CanDelete() bool { return cleanup.CanDelete(f.Fileserver) }
+
+// Share copies files from the common namespace into the namespace, unless they're already there. The
+// loader of a build loads every file from the namespace, so the precompiled standard library files,
+// which compiles never write, must be shared.
+func (f *Fileserver) Share(ctx context.Context, bucket, contentType, cacheControl string, names ...string) error {
+	for _, name := range names {
+		exists, err := f.Exists(ctx, bucket, name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		buf := &strings.Builder{}
+		found, err := f.Fileserver.Read(ctx, bucket, name, buf)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("%s not found", name)
+		}
+		if _, err := f.Write(ctx, bucket, name, strings.NewReader(buf.String()), false, contentType, cacheControl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *Fileserver) name(name string) string {
+	return Prefix(f.namespace) + "/" + name
+}
+
+// Database stores the records of a namespace in its own datastore namespace.
+type Database struct {
+	services.Database
+	namespace string
+}
+
+// NewDatabase wraps database for a namespace.
+func NewDatabase(database services.Database, namespace string) *Database {
+	return &Database{Database: database, namespace: namespace}
+}
+
+// Namespace is the datastore namespace of the records.
+func (d *Database) Namespace() string {
+	return "tenant-" + d.namespace
+}
+
+func (d *Database) Get(ctx context.Context, key *datastore.Key, dst interface{}) error {
+	return d.Database.Get(ctx, d.key(key), dst)
+}
+
+func (d *Database) Put(ctx context.Context, key *datastore.Key, src interface{}) (*datastore.Key, error) {
+	return d.Database.Put(ctx, d.key(key), src)
+}
+
+func (d *Database) GetAll(ctx context.Context, query *datastore.Query, dst interface{}) ([]*datastore.Key, error) {
+	return d.Database.GetAll(ctx, query.Namespace(d.Namespace()), dst)
+}
+
+func (d *Database) GetMulti(ctx context.Context, keys []*datastore.Key, dst interface{}) error {
+	return d.Database.GetMulti(ctx, d.keys(keys), dst)
+}
+
+func (d *Database) PutMulti(ctx context.Context, keys []*datastore.Key, src interface{}) ([]*datastore.Key, error) {
+	return d.Database.PutMulti(ctx, d.keys(keys), src)
+}
+
+// key returns a copy of key (and its parents) in the namespace.
+func (d *Database) key(key *datastore.Key) *datastore.Key {
+	if key == nil {
+		return nil
+	}
+	k := *key
+	k.Namespace = d.Namespace()
+	k.Parent = d.key(key.Parent)
+	return &k
+}
+
+func (d *Database) keys(keys []*datastore.Key) []*datastore.Key {
+	namespaced := make([]*datastore.Key, len(keys))
+	for i, key := range keys {
+		namespaced[i] = d.key(key)
+	}
+	return namespaced
+}
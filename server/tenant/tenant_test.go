@@ -0,0 +1,156 @@
+package tenant
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/memstore"
+	"github.com/dave/jsgo/server/store"
+	"github.com/dave/services"
+)
+
+func TestKeys(t *testing.T) {
+	keys, err := Keys(" acme:k1, initech-2:k2 ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]string{"k1": "acme", "k2": "initech-2"}; !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("expected %v, got %v", expected, keys)
+	}
+	for _, value := range []string{"acme", "acme:", "Acme:k1", "../x:k1", "-a:k1", "a:k1,b:k1"} {
+		if _, err := Keys(value); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	defer os.Setenv(config.TenantKeysEnv, os.Getenv(config.TenantKeysEnv))
+	os.Setenv(config.TenantKeysEnv, "acme:k1,initech:k2")
+
+	request := func(header string) *http.Request {
+		req, _ := http.NewRequest(http.MethodPost, "/_api/compile", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		return req
+	}
+	for header, expected := range map[string]string{"": "", "Basic k1": "", "Bearer k1": "acme", "Bearer k2": "initech"} {
+		if namespace, err := Namespace(request(header)); err != nil || namespace != expected {
+			t.Errorf("%q: expected %q, got %q (%v)", header, expected, namespace, err)
+		}
+	}
+	if _, err := Namespace(request("Bearer k3")); err != ErrUnknownKey {
+		t.Fatalf("expected ErrUnknownKey, got %v", err)
+	}
+
+	// Without tenants, bearer tokens (e.g. for other APIs) are in the common namespace.
+	os.Setenv(config.TenantKeysEnv, "")
+	if namespace, err := Namespace(request("Bearer k3")); err != nil || namespace != "" {
+		t.Fatalf("expected the common namespace, got %q (%v)", namespace, err)
+	}
+
+	// The namespace in the context is used without a key.
+	req := request("")
+	req = req.WithContext(NewContext(req.Context(), "acme"))
+	if namespace, err := Namespace(req); err != nil || namespace != "acme" {
+		t.Fatalf("expected acme, got %q (%v)", namespace, err)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	defer os.Setenv(config.TenantKeysEnv, os.Getenv(config.TenantKeysEnv))
+	os.Setenv(config.TenantKeysEnv, "initech:k2,acme:k1")
+
+	namespaces, err := Namespaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"", "acme", "initech"}; !reflect.DeepEqual(namespaces, expected) {
+		t.Fatalf("expected %v, got %v", expected, namespaces)
+	}
+
+	ctx := context.Background()
+	database := memstore.NewDatabase()
+	fileserver := memstore.NewFileserver(nil)
+	err = Each(fileserver, database, func(namespace string, fileserver services.Fileserver, database services.Database) error {
+		_, err := fileserver.Write(ctx, "b", "f", strings.NewReader(namespace), false, "", "")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"b:f", "b:" + Prefix("acme") + "/f", "b:" + Prefix("initech") + "/f"} {
+		if _, ok := fileserver.Files[name]; !ok {
+			t.Errorf("expected %s to be written", name)
+		}
+	}
+}
+
+func TestIsolation(t *testing.T) {
+	ctx := context.Background()
+	database := memstore.NewDatabase()
+	fileserver := memstore.NewFileserver(nil)
+	bucket := config.Bucket[config.Pkg]
+
+	// Both tenants compile identical sources, so the outputs have the same names.
+	compile := func(namespace, contents string) {
+		db := NewDatabase(database, namespace)
+		fs := NewFileserver(fileserver, namespace)
+		if _, err := fs.Write(ctx, bucket, "github.com/a/b.abc.js", strings.NewReader(contents), false, "application/javascript", ""); err != nil {
+			t.Fatal(err)
+		}
+		data := store.CompileData{Path: "github.com/a/b", Success: true, Min: store.CompileContents{Main: "abc"}, Ip: namespace}
+		if err := store.StoreCompile(ctx, db, "github.com/a/b", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	compile("acme", "acme")
+	compile("initech", "initech")
+
+	for _, namespace := range []string{"acme", "initech"} {
+		found, data, err := store.Package(ctx, NewDatabase(database, namespace), "github.com/a/b")
+		if err != nil || !found || data.Ip != namespace {
+			t.Errorf("%s: expected its own compile, got %v %v (%v)", namespace, found, data.Ip, err)
+		}
+		buf := &bytes.Buffer{}
+		if found, err := NewFileserver(fileserver, namespace).Read(ctx, bucket, "github.com/a/b.abc.js", buf); err != nil || !found || buf.String() != namespace {
+			t.Errorf("%s: expected its own file, got %q (%v)", namespace, buf.String(), err)
+		}
+	}
+
+	// Nothing is visible in the common namespace.
+	if found, _, err := store.Package(ctx, database, "github.com/a/b"); err != nil || found {
+		t.Errorf("expected no compile in the common namespace, got %v (%v)", found, err)
+	}
+	if found, err := fileserver.Exists(ctx, bucket, "github.com/a/b.abc.js"); err != nil || found {
+		t.Errorf("expected no file in the common namespace, got %v (%v)", found, err)
+	}
+}
+
+func TestShare(t *testing.T) {
+	ctx := context.Background()
+	fileserver := memstore.NewFileserver(nil)
+	bucket := config.Bucket[config.Pkg]
+	fileserver.Write(ctx, bucket, "prelude.abc.js", strings.NewReader("prelude"), false, "", "")
+
+	fs := NewFileserver(fileserver, "acme")
+	for i := 0; i < 2; i++ {
+		if err := fs.Share(ctx, bucket, "application/javascript", "", "prelude.abc.js"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf := &bytes.Buffer{}
+	if found, err := fs.Read(ctx, bucket, "prelude.abc.js", buf); err != nil || !found || buf.String() != "prelude" {
+		t.Fatalf("expected the shared file, got %q (%v)", buf.String(), err)
+	}
+	if err := fs.Share(ctx, bucket, "application/javascript", "", "missing.abc.js"); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+}
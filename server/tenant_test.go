@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/memstore"
+	"github.com/dave/jsgo/server/store"
+	"github.com/dave/jsgo/server/tenant"
+)
+
+func TestTenantHandler(t *testing.T) {
+	defer os.Setenv(config.TenantKeysEnv, os.Getenv(config.TenantKeysEnv))
+	os.Setenv(config.TenantKeysEnv, "acme:k1")
+
+	db := memstore.NewDatabase()
+	h := &Handler{Database: db}
+	build := store.BuildData{Path: "github.com/a/b", Min: true, Files: []store.BuildFile{{Name: "github.com/a/b.m1.js", Hash: "bb"}}}
+	if err := store.StoreBuild(context.Background(), tenant.NewDatabase(db, "acme"), "f00d", build); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(handler func(w http.ResponseWriter, req *http.Request), path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		w := httptest.NewRecorder()
+		TenantHandler(handler)(w, req)
+		return w
+	}
+
+	// The build is only found in the tenant's namespace, and its files are served from its prefix.
+	w := get(h.PrecacheHandler, "/_precache/f00d", "k1")
+	var entries []PrecacheEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil || w.Code != 200 {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body)
+	}
+	if url := config.Protocol[config.Pkg] + "://" + tenant.PkgHost("acme") + "/github.com/a/b.m1.js"; entries[0].Url != url {
+		t.Fatalf("expected %s, found %s", url, entries[0].Url)
+	}
+	if w := get(h.FilesHandler, "/_files/f00d", "k1"); w.Code != 200 {
+		t.Fatalf("expected the tenant's build, got %d", w.Code)
+	}
+	if w := get(h.FilesHandler, "/_files/f00d", ""); w.Code != 404 {
+		t.Fatalf("expected no build in the common namespace, got %d", w.Code)
+	}
+	if w := get(h.FilesHandler, "/_files/f00d", "k2"); w.Code != 401 {
+		t.Fatalf("expected an unknown key to be rejected, got %d", w.Code)
+	}
+
+	// Without tenants, other bearer tokens are in the common namespace.
+	os.Setenv(config.TenantKeysEnv, "")
+	if w := get(h.FilesHandler, "/_files/f00d", "k2"); w.Code != 404 {
+		t.Fatalf("expected the common namespace, got %d", w.Code)
+	}
+}
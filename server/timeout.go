@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Timeout wraps a handler so the request context has an overall deadline. If the handler hasn't
+// started the response when the deadline passes, the client gets 504 and later writes from the handler
+// are dropped. A response that has started is left to finish - streams have their own write timeouts.
+// This is a backstop for handlers that forget their own timeouts, so websocket routes aren't wrapped.
+func Timeout(timeout time.Duration, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+
+		tw := &timeoutWriter{w: w}
+		done := make(chan struct{})
+		panicked := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if r := recover(); r != nil {
+					panicked <- r
+				}
+				close(done)
+			}()
+			handler(tw, req.WithContext(ctx))
+		}()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			tw.m.Lock()
+			started := tw.started
+			if !started {
+				tw.timedOut = true
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				w.WriteHeader(http.StatusGatewayTimeout)
+				fmt.Fprintf(w, "request timed out after %v\n", timeout)
+			}
+			tw.m.Unlock()
+			if started {
+				<-done
+			}
+		}
+		select {
+		case r := <-panicked:
+			panic(r)
+		default:
+		}
+	}
+}
+
+// timeoutWriter records whether the response has started, and drops writes after a timeout.
+type timeoutWriter struct {
+	w        http.ResponseWriter
+	m        sync.Mutex
+	started  bool
+	timedOut bool
+	header   http.Header // the handler's headers, copied to w when the response starts
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	tw.m.Lock()
+	defer tw.m.Unlock()
+	if tw.header == nil {
+		tw.header = http.Header{}
+		for k, v := range tw.w.Header() {
+			tw.header[k] = v
+		}
+	}
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.m.Lock()
+	defer tw.m.Unlock()
+	if tw.timedOut || tw.started {
+		return
+	}
+	tw.start()
+	tw.w.WriteHeader(status)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.m.Lock()
+	defer tw.m.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.started {
+		tw.start()
+	}
+	return tw.w.Write(b)
+}
+
+func (tw *timeoutWriter) Flush() {
+	tw.m.Lock()
+	defer tw.m.Unlock()
+	if tw.timedOut {
+		return
+	}
+	if f, ok := tw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// start copies the handler's headers to the real response. Must be called with the lock held.
+func (tw *timeoutWriter) start() {
+	tw.started = true
+	if tw.header == nil {
+		return
+	}
+	for k := range tw.w.Header() {
+		if _, ok := tw.header[k]; !ok {
+			tw.w.Header().Del(k)
+		}
+	}
+	for k, v := range tw.header {
+		tw.w.Header()[k] = v
+	}
+}
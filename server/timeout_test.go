@@ -0,0 +1,35 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	slow := Timeout(time.Millisecond*20, func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+		w.Header().Set("X-Late", "1")
+		w.Write([]byte("too late"))
+	})
+	w := httptest.NewRecorder()
+	slow(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusGatewayTimeout || !strings.Contains(w.Body.String(), "timed out") || w.Header().Get("X-Late") != "" {
+		t.Fatalf("expected 504, got %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+
+	// a response that started before the deadline is left to finish
+	started := Timeout(time.Millisecond*20, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("a"))
+		<-req.Context().Done()
+		w.Write([]byte("b"))
+	})
+	w = httptest.NewRecorder()
+	started(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != 200 || w.Body.String() != "ab" || w.Header().Get("Content-Type") != "text/plain" {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+}
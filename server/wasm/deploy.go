@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/clientip"
 	"github.com/dave/jsgo/server/servermsg"
 	"github.com/dave/jsgo/server/store"
 	"github.com/dave/jsgo/server/wasm/messages"
@@ -104,7 +105,7 @@ func (h *Handler) DeployQuery(ctx context.Context, info messages.DeployQuery, re
 func (h *Handler) storeWasmDeploy(ctx context.Context, send func(services.Message), req *http.Request, files []store.WasmDeployFile) {
 	data := store.WasmDeploy{
 		Time:  time.Now(),
-		Ip:    req.Header.Get("X-Forwarded-For"),
+		Ip:    clientip.Get(req),
 		Files: files,
 	}
 	if err := store.StoreWasmDeploy(ctx, h.Database, data); err != nil {
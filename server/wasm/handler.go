@@ -9,11 +9,13 @@ import (
 
 	"cloud.google.com/go/datastore"
 	"github.com/dave/jsgo/config"
+	"github.com/dave/jsgo/server/clientip"
+	"github.com/dave/jsgo/server/queue"
+	"github.com/dave/jsgo/server/requestid"
 	"github.com/dave/jsgo/server/store"
 	"github.com/dave/jsgo/server/wasm/messages"
 	"github.com/dave/services"
 	"github.com/dave/services/getter/cache"
-	"github.com/dave/services/queue"
 	"github.com/dave/services/tracker"
 )
 
@@ -65,17 +67,18 @@ func (h *Handler) UnarshalMessage(b []byte) (services.Message, error) {
 
 func (h *Handler) StoreError(ctx context.Context, err error, req *http.Request) {
 
-	fmt.Println(err)
+	fmt.Printf("%s: %v\n", req.Header.Get(requestid.Header), err)
 
-	if err == queue.TooManyItemsQueued {
+	if err == queue.TooManyItemsQueued || err == queue.TooManyTenantItems {
 		// If the server is getting flooded by a DOS, this will prevent database flooding
 		return
 	}
 
 	h.Database.Put(ctx, datastore.IncompleteKey(config.ErrorKind, nil), &store.Error{
-		Time:  time.Now(),
-		Error: err.Error(),
-		Ip:    req.Header.Get("X-Forwarded-For"),
+		Time:      time.Now(),
+		Error:     err.Error(),
+		Ip:        clientip.Get(req),
+		RequestId: req.Header.Get(requestid.Header),
 	})
 
 }